@@ -0,0 +1,103 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"global-resource-service/resource-management/pkg/common-lib/metrics"
+)
+
+// metrics-diff compares metrics snapshots of two runs and exits with 1 if any metric regressed beyond the threshold.
+// A run is a snapshot file, or a snapshot directory of which the latest snapshot of each source is compared.
+func main() {
+	flag.Usage = printUsage
+
+	var base, current string
+	var threshold, minDeltaMs float64
+	flag.StringVar(&base, "base", "", "Snapshot file or directory of the base run")
+	flag.StringVar(&current, "current", "", "Snapshot file or directory of the run to compare with the base run")
+	flag.Float64Var(&threshold, "threshold", 0.1, "Ratio of increase over the base run flagged as regression, default 0.1 for 10%")
+	flag.Float64Var(&minDeltaMs, "min_delta_ms", 1, "Increases not larger than this in milliseconds are ignored as noise, default 1")
+	flag.Parse()
+
+	if base == "" || current == "" {
+		printUsage()
+	}
+
+	baseSnapshots, err := readRun(base)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error read base run %s. error %v\n", base, err)
+		os.Exit(2)
+	}
+	currentSnapshots, err := readRun(current)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error read current run %s. error %v\n", current, err)
+		os.Exit(2)
+	}
+
+	sources := make([]string, 0, len(currentSnapshots))
+	for source := range currentSnapshots {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	regressionNum := 0
+	for _, source := range sources {
+		baseSnapshot, isOK := baseSnapshots[source]
+		if !isOK {
+			fmt.Printf("[%s] no snapshot in base run, skipped\n", source)
+			continue
+		}
+		for _, r := range metrics.DiffSnapshots(baseSnapshot, currentSnapshots[source], threshold, minDeltaMs) {
+			fmt.Println(r.String())
+			regressionNum++
+		}
+	}
+
+	if regressionNum > 0 {
+		fmt.Printf("%d metrics regressed more than %.1f%%\n", regressionNum, threshold*100)
+		os.Exit(1)
+	}
+	fmt.Println("No regression found")
+}
+
+// readRun reads the snapshot file, or the latest snapshot of each source in the directory
+func readRun(path string) (map[string]*metrics.Snapshot, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return metrics.ReadLatestSnapshots(path)
+	}
+	s, err := metrics.ReadSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]*metrics.Snapshot{s.Source: s}, nil
+}
+
+// printUsage prints usage to stderr and exits with 2, the same as other usage errors
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: ")
+	fmt.Fprintln(os.Stderr, "metrics-diff --base=<snapshot file or dir> --current=<snapshot file or dir> [--threshold=0.1] [--min_delta_ms=1]")
+	os.Exit(2)
+}
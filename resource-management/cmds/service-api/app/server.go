@@ -17,9 +17,12 @@ limitations under the License.
 package app
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"net/http/pprof"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -29,17 +32,65 @@ import (
 	"global-resource-service/resource-management/pkg/aggregrator"
 	common_lib "global-resource-service/resource-management/pkg/common-lib"
 	localMetrics "global-resource-service/resource-management/pkg/common-lib/metrics"
+	"global-resource-service/resource-management/pkg/common-lib/tlsconfig"
 	"global-resource-service/resource-management/pkg/distributor"
+	"global-resource-service/resource-management/pkg/service-api/auth"
 	"global-resource-service/resource-management/pkg/service-api/endpoints"
+	apiTypes "global-resource-service/resource-management/pkg/service-api/types"
 	"global-resource-service/resource-management/pkg/store/redis"
 )
 
+const healthCheckTimeout = 2 * time.Second
+
+// the service is not live if a region manager list-watch is stuck processing a batch of node events longer than this
+const maxEventProcessingTime = 5 * time.Minute
+
 type Config struct {
 	ResourceUrls              []string
 	MasterIp                  string
 	MasterPort                string
 	RedisPort                 string
 	EventMetricsDumpFrequency time.Duration
+	// JSON snapshots of metrics are written to the directory if set
+	MetricsSnapshotDir      string
+	MetricsSnapshotInterval time.Duration
+	RebalanceInterval       time.Duration
+	ClientLeaseDuration     time.Duration
+	// restore nodes from store and watch regions from persisted watch cursors at start
+	ResumeFromStore bool
+	// watch events from region managers are processed in batches
+	EventBatchSize   int
+	EventBatchLinger time.Duration
+	// nodes are listed from region managers in pages of up to ListPageSize nodes
+	ListPageSize int
+	// invalid node events from region managers are appended to the file if set
+	DeadLetterFile string
+	// each resource partition of a region is watched with its own watch
+	WatchByPartition bool
+	// nodes of regions without contact from their region manager longer than the threshold are flagged unschedulable
+	StaleRegionThreshold time.Duration
+	// authentication is disabled if the signing key file is not set
+	TokenSigningKeyFile string
+	ClientTokenTTL      time.Duration
+	// service serves HTTPS if the server certificate is set
+	ServerTLS tlsconfig.Options
+	// aggregator connects to resource region managers with HTTPS if the CA is set
+	RegionManagerTLS tlsconfig.Options
+	Admission        endpoints.AdmissionConfig
+}
+
+// validateConfig rejects config values the service can't run with
+func validateConfig(c *Config) error {
+	if c.RebalanceInterval <= 0 {
+		return fmt.Errorf("invalid rebalance_interval %v, must be positive", c.RebalanceInterval)
+	}
+	if c.MetricsSnapshotDir != "" && c.MetricsSnapshotInterval <= 0 {
+		return fmt.Errorf("invalid metrics_snapshot_interval %v, must be positive", c.MetricsSnapshotInterval)
+	}
+	if c.ClientLeaseDuration < distributor.MinClientLeaseDuration {
+		return fmt.Errorf("invalid client_lease_duration %v, must be at least %v", c.ClientLeaseDuration, distributor.MinClientLeaseDuration)
+	}
+	return nil
 }
 
 // Run and create new service-api.  This should never exit.
@@ -47,13 +98,37 @@ func Run(c *Config) error {
 	klog.V(3).Infof("Starting the API server...")
 	klog.V(3).Infof("Connecting the Redis server via port (%v)...", c.RedisPort)
 
+	if err := validateConfig(c); err != nil {
+		return err
+	}
+
+	var err error
 	store := redis.NewRedisClient(c.MasterIp, c.RedisPort, false)
 	dist := distributor.GetResourceDistributor()
 	dist.SetPersistHelper(store)
+	dist.SetClientLeaseDuration(c.ClientLeaseDuration)
 	installer := endpoints.NewInstaller(dist)
 
 	r := mux.NewRouter().StrictSlash(true)
 
+	if c.TokenSigningKeyFile != "" {
+		signingKey, err := auth.LoadSigningKey(c.TokenSigningKeyFile)
+		if err != nil {
+			return err
+		}
+		signer, err := auth.NewTokenSigner(signingKey, c.ClientTokenTTL)
+		if err != nil {
+			return err
+		}
+		installer.SetTokenSigner(signer)
+		r.Use(endpoints.NewAuthMiddleware(signer, dist))
+		klog.Infof("Bearer token authentication enabled")
+	} else {
+		klog.Warningf("Bearer token authentication disabled, token_signing_key_file is not set")
+	}
+	// after authentication so that requests are limited by authenticated client
+	r.Use(endpoints.NewAdmissionMiddleware(c.Admission, dist))
+
 	// Setup pprof handlers.
 	r.HandleFunc("/debug/pprof/", pprof.Index)
 	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
@@ -63,6 +138,7 @@ func Run(c *Config) error {
 
 	// TODO: reuse k8s mux wrapper, pathrecorder.go for simplify this handler by each path
 	r.HandleFunc(endpoints.NodeStatusPath, installer.NodeHandler)
+	r.HandleFunc(endpoints.CapacityPath, installer.CapacityHandler)
 
 	r.HandleFunc(endpoints.ListWatchResourcePath, installer.ResourceHandler)
 	r.HandleFunc(endpoints.UpdateResourcePath, installer.ResourceHandler)
@@ -70,6 +146,7 @@ func Run(c *Config) error {
 
 	r.HandleFunc(endpoints.ClientAdminitrationPath, installer.ClientAdministrationHandler)
 	r.HandleFunc(endpoints.ClientAdminitrationPath+"/{clientId}", installer.ClientAdministrationHandler)
+	r.HandleFunc(endpoints.ClientLeasePath, installer.ClientLeaseHandler)
 
 	address := fmt.Sprintf("%s:%s", c.MasterIp, c.MasterPort)
 	klog.Infof("Serving at %s", address)
@@ -79,16 +156,83 @@ func Run(c *Config) error {
 		WriteTimeout: 30 * time.Minute,
 		ReadTimeout:  30 * time.Minute,
 	}
+	if c.ServerTLS.IsServerEnabled() {
+		server.TLSConfig, err = tlsconfig.NewServerTLSConfig(c.ServerTLS)
+		if err != nil {
+			return err
+		}
+		klog.Infof("Serving HTTPS, client certificate required: %v", c.ServerTLS.RequireClientCert)
+	}
+
+	var regionManagerTLSConfig *tls.Config
+	if c.RegionManagerTLS.IsClientEnabled() {
+		regionManagerTLSConfig, err = tlsconfig.NewClientTLSConfig(c.RegionManagerTLS)
+		if err != nil {
+			return err
+		}
+	}
+	aggregator := aggregrator.NewAggregator(c.ResourceUrls, dist, regionManagerTLSConfig)
+	aggregator.SetPersistHelper(store)
+	aggregator.SetEventBatching(c.EventBatchSize, c.EventBatchLinger)
+	aggregator.SetStaleRegionThreshold(c.StaleRegionThreshold)
+	aggregator.SetListPageSize(c.ListPageSize)
+	if c.DeadLetterFile != "" {
+		if err := aggregator.SetDeadLetterFile(c.DeadLetterFile); err != nil {
+			klog.Errorf("Failed to open dead letter file %s. error %v", c.DeadLetterFile, err)
+			return err
+		}
+	}
+	aggregator.SetWatchByPartition(c.WatchByPartition)
+	if c.ResumeFromStore {
+		klog.V(3).Infof("Restoring nodes from store ...")
+		// cursors are valid only with the nodes they were persisted with
+		if restoredNum := dist.RestoreNodeStore(); restoredNum > 0 {
+			aggregator.ResumeFromWatchCursors()
+		}
+	}
+
+	// ready once nodes of all regions are loaded and the store is reachable
+	healthHandler := endpoints.NewHealthHandler()
+	healthHandler.AddLivenessCheck("region-event-processing", func() error {
+		return checkEventProcessing(aggregator.GetStuckRegionManagers(maxEventProcessingTime))
+	})
+	healthHandler.AddReadinessCheck("aggregator-initial-list", func() error {
+		return checkInitialList(aggregator.GetInitialListStatus())
+	})
+	healthHandler.AddReadinessCheck("redis", func() error {
+		return store.Ping(healthCheckTimeout)
+	})
+	healthHandler.AddHealthCheck("region-managers", func() error {
+		return checkRegionManagers(aggregator.GetFailedRegionManagers())
+	})
+	// region managers can be added, removed or replaced at runtime, by admins only
+	if c.TokenSigningKeyFile != "" {
+		r.HandleFunc(endpoints.RegionManagerAdministrationPath, endpoints.NewRegionManagerHandler(aggregator).RegionManagersHandler)
+	} else {
+		klog.Warningf("Region manager administration disabled, token_signing_key_file is not set")
+	}
+	r.HandleFunc(endpoints.HealthzPath, healthHandler.HealthzHandler)
+	r.HandleFunc(endpoints.ReadyzPath, healthHandler.ReadyzHandler)
+	r.HandleFunc(endpoints.LivezPath, healthHandler.LivezHandler)
+
+	dist.RegisterMetrics(localMetrics.DefaultRegistry)
+	aggregator.RegisterMetrics(localMetrics.DefaultRegistry)
+	r.HandleFunc(endpoints.MetricsPath, endpoints.NewMetricsHandler(localMetrics.DefaultRegistry))
+	r.HandleFunc(endpoints.LatencyReportPath, endpoints.LatencyReportHandler)
 
 	// start the service and aggregator in go routines
 	var wg sync.WaitGroup
-	var err error
 
 	klog.V(3).Infof("Starting the resource management service ...")
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		err = server.ListenAndServe()
+		if server.TLSConfig != nil {
+			// certificates are loaded in TLSConfig
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
 	}()
 
 	if err != nil {
@@ -100,7 +244,6 @@ func Run(c *Config) error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		aggregator := aggregrator.NewAggregator(c.ResourceUrls, dist)
 		err = aggregator.Run()
 	}()
 
@@ -108,19 +251,99 @@ func Run(c *Config) error {
 		return err
 	}
 
+	// start the stale region detector
+	klog.V(3).Infof("Starting the stale region detector ...")
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		aggregator.RunStaleRegionDetector(make(chan struct{}))
+	}()
+
+	// start the virtual node store rebalancer
+	klog.V(3).Infof("Starting the virtual node store rebalancer ...")
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		dist.RunRebalancer(c.RebalanceInterval, make(chan struct{}))
+	}()
+
+	// start the client lease reaper
+	klog.V(3).Infof("Starting the client lease reaper ...")
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		dist.RunLeaseReaper(c.ClientLeaseDuration/2, make(chan struct{}))
+	}()
+
 	if common_lib.ResourceManagementMeasurement_Enabled {
 		// start the event metrics report
 		klog.V(3).Infof("Starting the event metrics reporting routine...")
+		localMetrics.SetLatencyDimensionIdleTimeout(c.EventMetricsDumpFrequency)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			for {
 				time.Sleep(c.EventMetricsDumpFrequency)
 				localMetrics.PrintLatencyReport()
+				localMetrics.PrintLatencyReportByDimension(localMetrics.LatencyDimension_Region)
 			}
 		}()
+
+		if c.MetricsSnapshotDir != "" {
+			klog.V(3).Infof("Starting the metrics snapshot writer to %s ...", c.MetricsSnapshotDir)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				localMetrics.RunSnapshotWriter(c.MetricsSnapshotDir, c.MetricsSnapshotInterval, takeMetricsSnapshot, make(chan struct{}))
+			}()
+		}
 	}
 
 	wg.Wait()
 	return nil
 }
+
+// takeMetricsSnapshot returns snapshot of checkpoint latencies and active watches of the service
+func takeMetricsSnapshot() *localMetrics.Snapshot {
+	s := localMetrics.NewSnapshot("service-api")
+	s.AddCheckpointLatencies()
+	s.AddCount("active_watches", int(localMetrics.ActiveWatches.Get()))
+	return s
+}
+
+// checkRegionManagers returns error with the urls and last errors of the failed region managers
+func checkRegionManagers(failedRegionManagers []apiTypes.RegionManagerStatus) error {
+	if len(failedRegionManagers) == 0 {
+		return nil
+	}
+	failures := make([]string, len(failedRegionManagers))
+	for i, status := range failedRegionManagers {
+		failures[i] = fmt.Sprintf("%s (%s)", status.Url, status.LastError)
+	}
+	sort.Strings(failures)
+	return fmt.Errorf("list-watch failed for %d region managers: %s", len(failures), strings.Join(failures, ","))
+}
+
+// checkEventProcessing returns error with the region urls whose list-watch is stuck processing node events
+func checkEventProcessing(stuckUrls []string) error {
+	if len(stuckUrls) == 0 {
+		return nil
+	}
+	sort.Strings(stuckUrls)
+	return fmt.Errorf("node events of %d region managers processed longer than %v: %s", len(stuckUrls), maxEventProcessingTime, strings.Join(stuckUrls, ","))
+}
+
+// checkInitialList returns error with the region urls whose initial list is not done
+func checkInitialList(initialListStatus map[string]bool) error {
+	pendingUrls := make([]string, 0)
+	for url, isListed := range initialListStatus {
+		if !isListed {
+			pendingUrls = append(pendingUrls, url)
+		}
+	}
+	if len(pendingUrls) > 0 {
+		sort.Strings(pendingUrls)
+		return fmt.Errorf("initial list not done for %d of %d regions: %s", len(pendingUrls), len(initialListStatus), strings.Join(pendingUrls, ","))
+	}
+	return nil
+}
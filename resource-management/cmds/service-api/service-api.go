@@ -26,7 +26,9 @@ import (
 	"k8s.io/klog/v2"
 
 	"global-resource-service/resource-management/cmds/service-api/app"
+	"global-resource-service/resource-management/pkg/aggregrator"
 	common_lib "global-resource-service/resource-management/pkg/common-lib"
+	"global-resource-service/resource-management/pkg/distributor"
 )
 
 func main() {
@@ -37,11 +39,40 @@ func main() {
 
 	var urls string
 	var metricsEnabled bool
+	var listQPS, queryQPS, registerQPS float64
 	flag.StringVar(&c.MasterIp, "master_ip", "localhost", "Service IP address, if not set, default to localhost")
 	flag.StringVar(&c.MasterPort, "master_port", "8080", "Service port, if not set, default to 8080")
 	flag.StringVar(&urls, "resource_urls", "", "Resource urls of the resource manager services in each region")
 	flag.StringVar(&c.RedisPort, "redis_port", "7379", "Redis port, if not set, default to 7379")
 	flag.DurationVar(&c.EventMetricsDumpFrequency, "metrics_dump_frequency", 5*time.Minute, "Frequency to dump the event metrics, default 5m")
+	flag.StringVar(&c.MetricsSnapshotDir, "metrics_snapshot_dir", "", "Directory to write JSON snapshots of the event metrics, disabled if not set")
+	flag.DurationVar(&c.MetricsSnapshotInterval, "metrics_snapshot_interval", time.Minute, "Interval to write JSON snapshots of the event metrics, default 1m")
+	flag.BoolVar(&c.ResumeFromStore, "resume_from_store", false, "Restore nodes from redis and watch regions from persisted watch cursors at start, regions without valid cursors are listed. default false")
+	flag.IntVar(&c.EventBatchSize, "event_batch_size", aggregrator.DefaultEventBatchSize, "Max number of node events from region managers processed in a batch, default 500")
+	flag.DurationVar(&c.EventBatchLinger, "event_batch_linger", aggregrator.DefaultEventBatchLinger, "Time to wait for more node events before processing a batch not full, default 10ms")
+	flag.IntVar(&c.ListPageSize, "list_page_size", aggregrator.DefaultListPageSize, "Max number of nodes listed in a page from region managers, 0 to list all nodes in one call, default 10000")
+	flag.StringVar(&c.DeadLetterFile, "dead_letter_file", "", "File to append invalid node events from region managers to, one JSON object per line, disabled if not set")
+	flag.BoolVar(&c.WatchByPartition, "watch_by_partition", false, "Watch each resource partition of a region with its own watch, default false")
+	flag.DurationVar(&c.StaleRegionThreshold, "stale_region_threshold", aggregrator.DefaultStaleRegionThreshold, "Time without events, bookmarks or listed pages from a region manager before nodes of its regions are flagged unschedulable, requires region managers sending bookmarks on idle watches, 0 to disable, default 0")
+	flag.DurationVar(&c.RebalanceInterval, "rebalance_interval", time.Minute, "Interval to rebalance virtual node stores between clients, default 1m")
+	flag.DurationVar(&c.ClientLeaseDuration, "client_lease_duration", distributor.DefaultClientLeaseDuration, "Lease duration of registered client without renewal, at least 1s, default 5m")
+	flag.StringVar(&c.TokenSigningKeyFile, "token_signing_key_file", "", "File of the key to sign and verify bearer tokens, authentication and region manager administration are disabled if not set")
+	flag.DurationVar(&c.ClientTokenTTL, "client_token_ttl", 0, "Time to live of tokens issued to clients on registration, default 0 for no expiration. The tokens are invalid once the client lease expires")
+	flag.StringVar(&c.ServerTLS.CertFile, "tls_cert_file", "", "Server certificate file, service serves HTTPS if set with tls_key_file")
+	flag.StringVar(&c.ServerTLS.KeyFile, "tls_key_file", "", "Server private key file")
+	flag.StringVar(&c.ServerTLS.CAFile, "tls_client_ca_file", "", "CA file to verify client certificates, which are optional unless tls_require_client_cert is set")
+	flag.BoolVar(&c.ServerTLS.RequireClientCert, "tls_require_client_cert", false, "Require client certificates signed by tls_client_ca_file, default false")
+	flag.StringVar(&c.RegionManagerTLS.CAFile, "region_manager_ca_file", "", "The only CA trusted to verify resource region managers, connect with HTTPS if set")
+	flag.StringVar(&c.RegionManagerTLS.CertFile, "region_manager_client_cert_file", "", "Client certificate file to connect to resource region managers requiring client certificates")
+	flag.StringVar(&c.RegionManagerTLS.KeyFile, "region_manager_client_key_file", "", "Client private key file to connect to resource region managers")
+	flag.Float64Var(&listQPS, "list_qps", 1, "Rate limit of list requests per client, 0 for unlimited, default 1")
+	flag.IntVar(&c.Admission.ListBurst, "list_burst", 5, "Burst of list requests per client, default 5")
+	flag.Float64Var(&queryQPS, "query_qps", 100, "Rate limit of node query requests per client, 0 for unlimited, default 100")
+	flag.IntVar(&c.Admission.QueryBurst, "query_burst", 200, "Burst of node query requests per client, default 200")
+	flag.Float64Var(&registerQPS, "register_qps", 10, "Rate limit of client registration requests per remote host, 0 for unlimited, default 10")
+	flag.IntVar(&c.Admission.RegisterBurst, "register_burst", 50, "Burst of client registration requests per remote host, default 50")
+	flag.IntVar(&c.Admission.MaxConcurrentWatches, "max_concurrent_watches", 2000, "Maximum number of concurrent watches, 0 for unlimited, default 2000")
+	flag.IntVar(&c.Admission.MaxWatchesPerClient, "max_watches_per_client", 4, "Maximum number of concurrent watches per client, 0 for unlimited, default 4")
 	flag.BoolVar(&metricsEnabled, "enable_metrics", true, "Flag for if node event trace is enabled. default is enabled")
 
 	if !flag.Parsed() {
@@ -60,6 +91,9 @@ func main() {
 	urls = strings.TrimRight(urls, ",")
 
 	common_lib.ResourceManagementMeasurement_Enabled = metricsEnabled
+	c.Admission.ListQPS = float32(listQPS)
+	c.Admission.QueryQPS = float32(queryQPS)
+	c.Admission.RegisterQPS = float32(registerQPS)
 	c.ResourceUrls = strings.Split(urls, ",")
 
 	// Check whether c.ResourceUrls contains invaild urls
@@ -93,7 +127,12 @@ func printUsage() {
 	// klog will use commandline log parameters with nil as named a few below:
 	// --alsologtostderr=true  --logtostderr=false --log_file="/tmp/grs.log"
 	fmt.Println("logging options: --alsologtostderr=true  --logtostderr=false --log_file=/tmp/grs.log")
-	fmt.Println("service config options: --master_ip=<master address>  --master_port=<port> --redis_port=<port> --resource_urls=<url1,url2,...>")
+	fmt.Println("service config options: --master_ip=<master address>  --master_port=<port> --redis_port=<port> --resource_urls=<url1,url2,...> --rebalance_interval=<duration> --client_lease_duration=<duration>")
+	fmt.Println("authentication options: --token_signing_key_file=<key file> --client_token_ttl=<duration>")
+	fmt.Println("admission options: --list_qps=<qps> --list_burst=<n> --query_qps=<qps> --query_burst=<n> --register_qps=<qps> --register_burst=<n>")
+	fmt.Println("                   --max_concurrent_watches=<n> --max_watches_per_client=<n>")
+	fmt.Println("TLS options: --tls_cert_file=<file> --tls_key_file=<file> --tls_client_ca_file=<file> --tls_require_client_cert=true")
+	fmt.Println("             --region_manager_ca_file=<file> --region_manager_client_cert_file=<file> --region_manager_client_key_file=<file>")
 	fmt.Println("Explanation: <master address> could be public ip address or public dns name of the server")
 	fmt.Println("Gate flags: --enable_metrics=true  to enable the detailed event trace checkpoints")
 	os.Exit(0)
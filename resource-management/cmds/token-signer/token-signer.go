@@ -0,0 +1,72 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"global-resource-service/resource-management/pkg/service-api/auth"
+)
+
+// token-signer signs bearer tokens with the service signing key locally, for the admin credential
+// and for testing without an identity service
+func main() {
+	flag.Usage = printUsage
+
+	var keyFile, subject, role string
+	var ttl time.Duration
+	flag.StringVar(&keyFile, "token_signing_key_file", "", "File of the key the service signs and verifies bearer tokens with")
+	flag.StringVar(&subject, "subject", "admin", "Subject of the token, client id for client tokens")
+	flag.StringVar(&role, "role", auth.RoleAdmin, "Role of the token, admin or client")
+	flag.DurationVar(&ttl, "ttl", 24*time.Hour, "Time to live of the token, 0 for no expiration")
+	flag.Parse()
+
+	if keyFile == "" {
+		printUsage()
+	}
+	if role != auth.RoleAdmin && role != auth.RoleClient {
+		fmt.Fprintf(os.Stderr, "invalid role %s\n", role)
+		os.Exit(1)
+	}
+
+	signingKey, err := auth.LoadSigningKey(keyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error read signing key. error %v\n", err)
+		os.Exit(1)
+	}
+	signer, err := auth.NewTokenSigner(signingKey, ttl)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error create token signer. error %v\n", err)
+		os.Exit(1)
+	}
+	token, err := signer.Sign(subject, role)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error sign token. error %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(token)
+}
+
+func printUsage() {
+	fmt.Println("Usage: ")
+	fmt.Println("token-signer --token_signing_key_file=<key file> [--role=admin|client] [--subject=<client id>] [--ttl=<duration>]")
+	os.Exit(0)
+}
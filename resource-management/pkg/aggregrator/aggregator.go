@@ -17,10 +17,13 @@ limitations under the License.
 package aggregrator
 
 import (
+	"crypto/tls"
 	"net/http"
+	"sync"
 	"time"
 
 	distributor "global-resource-service/resource-management/pkg/common-lib/interfaces/distributor"
+	"global-resource-service/resource-management/pkg/common-lib/interfaces/store"
 	"global-resource-service/resource-management/pkg/common-lib/types"
 	"global-resource-service/resource-management/pkg/common-lib/types/runtime"
 )
@@ -28,6 +31,50 @@ import (
 type Aggregator struct {
 	urls           []string
 	EventProcessor distributor.Interface
+	// list-watch of each region manager url, started once the aggregator runs
+	regionRunners map[string]*regionRunner
+	// url to the number of removals in progress, the region manager is not list-watched until they finish
+	removingRegions map[string]int
+	isRunning       bool
+	regionsLock     sync.RWMutex
+	// TLS config to connect to resource region managers, nil for plain http
+	tlsConfig *tls.Config
+
+	// urls of regions whose initial list is processed by the event processor
+	listedUrls map[string]bool
+	listLock   sync.RWMutex
+
+	// store of watch cursors, cursors are not persisted if nil
+	persistHelper store.StoreInterface
+	// watch regions from persisted cursors instead of listing, set once the node store is restored
+	resumeFromWatchCursors bool
+	// url to latest cursors, and to last persisted cursors
+	watchCursors     map[string]types.TransitResourceVersionMap
+	persistedCursors map[string]types.TransitResourceVersionMap
+	cursorsLock      sync.Mutex
+
+	// connection health of each region manager url
+	regionHealths map[string]*regionHealth
+	healthLock    sync.RWMutex
+	// url to the time the list-watch of the region manager started processing its current batch of node events
+	processingSince map[string]time.Time
+	processingLock  sync.Mutex
+	// nodes of regions without contact from their region manager longer than the threshold are flagged stale
+	staleRegionThreshold time.Duration
+
+	// each resource partition of a region is watched with its own watch if set
+	watchByPartition bool
+
+	// max number of nodes listed in a page from region managers, all nodes are listed in one call if not positive
+	listPageSize int
+
+	// invalid node events are appended to the dead letter file if set
+	deadLetters *deadLetterWriter
+
+	// watch events are processed in batches of up to eventBatchSize events,
+	// a batch is processed once eventBatchLinger passed since its first event even if not full
+	eventBatchSize   int
+	eventBatchLinger time.Duration
 }
 
 // To be client of Resource Region Manager
@@ -58,15 +105,102 @@ const (
 	DefaultBatchLength  = 20000
 	httpPrefix          = "http://"
 	defaultPullInterval = 10 * time.Millisecond // 10ms as default pull interval
+
+	initialRewatchBackoff = 1 * time.Second
+	maxRewatchBackoff     = 1 * time.Minute
+	// backoff of retries is increased by a random factor up to jitterFactor
+	jitterFactor = 0.5
+
+	watchCursorsPersistInterval = 1 * time.Second
+
+	DefaultListPageSize = 10000
+
+	DefaultEventBatchSize   = 500
+	DefaultEventBatchLinger = 10 * time.Millisecond
+	// number of batches received but not processed yet, before the watch stream is blocked
+	eventBatchQueueSize = 10
 )
 
 // Initialize aggregator
 //
-func NewAggregator(urls []string, EventProcessor distributor.Interface) *Aggregator {
+func NewAggregator(urls []string, EventProcessor distributor.Interface, tlsConfig *tls.Config) *Aggregator {
 	return &Aggregator{
-		urls:           urls,
-		EventProcessor: EventProcessor,
+		urls:            append([]string{}, urls...),
+		EventProcessor:  EventProcessor,
+		regionRunners:   make(map[string]*regionRunner, len(urls)),
+		removingRegions: make(map[string]int),
+		tlsConfig:       tlsConfig,
+		listedUrls:      make(map[string]bool, len(urls)),
+
+		watchCursors:     make(map[string]types.TransitResourceVersionMap, len(urls)),
+		persistedCursors: make(map[string]types.TransitResourceVersionMap, len(urls)),
+
+		regionHealths:        make(map[string]*regionHealth, len(urls)),
+		processingSince:      make(map[string]time.Time, len(urls)),
+		staleRegionThreshold: DefaultStaleRegionThreshold,
+
+		listPageSize:     DefaultListPageSize,
+		eventBatchSize:   DefaultEventBatchSize,
+		eventBatchLinger: DefaultEventBatchLinger,
+	}
+}
+
+// SetEventBatching sets the max number of watch events processed in a batch and how long to wait for a batch to fill
+// Batch size less than 1 is set to 1
+func (a *Aggregator) SetEventBatching(batchSize int, linger time.Duration) {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	a.eventBatchSize = batchSize
+	a.eventBatchLinger = linger
+}
+
+// SetListPageSize sets the max number of nodes listed in a page from region managers
+// All nodes are listed in one call if pageSize is not positive
+func (a *Aggregator) SetListPageSize(pageSize int) {
+	a.listPageSize = pageSize
+}
+
+// SetWatchByPartition sets whether each resource partition of a region is watched and processed independently,
+// so that a resource partition with many events does not delay events of others
+func (a *Aggregator) SetWatchByPartition(watchByPartition bool) {
+	a.watchByPartition = watchByPartition
+}
+
+// SetPersistHelper sets the store to persist watch cursors of region managers
+func (a *Aggregator) SetPersistHelper(persistTool store.StoreInterface) {
+	a.persistHelper = persistTool
+}
+
+// ResumeFromWatchCursors makes regions watched from persisted cursors at Run, regions without cursors are listed
+// It must be called only if nodes persisted are restored to the event processor
+func (a *Aggregator) ResumeFromWatchCursors() {
+	a.resumeFromWatchCursors = true
+}
+
+// GetInitialListStatus returns whether the initial list of each region url is processed
+func (a *Aggregator) GetInitialListStatus() map[string]bool {
+	urls := a.GetRegionUrls()
+	a.listLock.RLock()
+	defer a.listLock.RUnlock()
+	status := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		status[url] = a.listedUrls[url]
 	}
+	return status
+}
+
+// GetRegionUrls returns the urls of region managers the aggregator list-watches
+func (a *Aggregator) GetRegionUrls() []string {
+	a.regionsLock.RLock()
+	defer a.regionsLock.RUnlock()
+	return append([]string{}, a.urls...)
+}
+
+func (a *Aggregator) setInitialListDone(url string) {
+	a.listLock.Lock()
+	defer a.listLock.Unlock()
+	a.listedUrls[url] = true
 }
 
 // Connect to resource region manager
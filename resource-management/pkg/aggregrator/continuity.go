@@ -0,0 +1,161 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregrator
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"global-resource-service/resource-management/pkg/common-lib/metrics"
+	"global-resource-service/resource-management/pkg/common-lib/types"
+)
+
+// Anomalies of resource versions of node events in their resource partition
+const (
+	// resource versions skipped and not received within rvGapTimeout, events of them are lost
+	RvAnomaly_Gap = "gap"
+	// resource version already received in the watch
+	RvAnomaly_Duplicate = "duplicate"
+	// resource version not newer than the one watched from, e.g. the region manager is restored from an older state
+	RvAnomaly_Regression = "regression"
+)
+
+const (
+	// events can be received out of order, resource versions skipped by a newer event are waited for up to the timeout
+	rvGapTimeout = 5 * time.Second
+	// max number of skipped resource versions waited for in a resource partition, larger gaps are reported at once
+	maxMissingRvs = 10000
+)
+
+// rvContinuity checks the resource versions of node events of each resource partition increase by one
+// from the resource versions watched from
+type rvContinuity struct {
+	startRvs   types.TransitResourceVersionMap
+	highestRvs types.TransitResourceVersionMap
+	// resource versions skipped by newer events, to the time they are found missing
+	missingRvs map[types.RvLocation]map[uint64]time.Time
+}
+
+func newRvContinuity(crv types.TransitResourceVersionMap) *rvContinuity {
+	return &rvContinuity{
+		startRvs:   crv.Copy(),
+		highestRvs: crv.Copy(),
+		missingRvs: make(map[types.RvLocation]map[uint64]time.Time),
+	}
+}
+
+// check records the resource version of an event of the resource partition, and returns its anomaly, empty if in sequence
+// Events of duplicate or regression should be discarded. Event of gap is newer than the ones lost and can be processed
+func (c *rvContinuity) check(loc types.RvLocation, rv uint64, now time.Time) string {
+	highest, isOK := c.highestRvs[loc]
+	if !isOK {
+		// partition not watched from known resource version, its events are checked since the first one
+		if rv > 0 {
+			c.startRvs[loc] = rv - 1
+		}
+		c.highestRvs[loc] = rv
+		return ""
+	}
+
+	if rv > highest {
+		c.highestRvs[loc] = rv
+		if rv-highest-1 > maxMissingRvs {
+			return RvAnomaly_Gap
+		}
+		if rv-highest > 1 && c.missingRvs[loc] == nil {
+			c.missingRvs[loc] = make(map[uint64]time.Time)
+		}
+		for missingRv := highest + 1; missingRv < rv; missingRv++ {
+			c.missingRvs[loc][missingRv] = now
+		}
+		return ""
+	}
+	if _, isMissing := c.missingRvs[loc][rv]; isMissing {
+		delete(c.missingRvs[loc], rv)
+		return ""
+	}
+	if rv <= c.startRvs[loc] {
+		return RvAnomaly_Regression
+	}
+	return RvAnomaly_Duplicate
+}
+
+// getGaps returns the number of resource versions missing longer than rvGapTimeout of each resource partition,
+// which are no longer waited for
+func (c *rvContinuity) getGaps(now time.Time) map[types.RvLocation]int {
+	gaps := make(map[types.RvLocation]int)
+	for loc, missingRvs := range c.missingRvs {
+		for rv, missingTime := range missingRvs {
+			if now.Sub(missingTime) > rvGapTimeout {
+				gaps[loc]++
+				delete(missingRvs, rv)
+			}
+		}
+	}
+	return gaps
+}
+
+// partitionsRelistError is returned by the watch if events of the resource partitions are lost, to list them again
+type partitionsRelistError struct {
+	locs []types.RvLocation
+}
+
+func (e *partitionsRelistError) Error() string {
+	return fmt.Sprintf("events of resource partitions %v are lost", e.locs)
+}
+
+func newPartitionsRelistError(locs map[types.RvLocation]bool) *partitionsRelistError {
+	e := &partitionsRelistError{locs: make([]types.RvLocation, 0, len(locs))}
+	for loc := range locs {
+		e.locs = append(e.locs, loc)
+	}
+	sort.Slice(e.locs, func(i, j int) bool {
+		if e.locs[i].Region != e.locs[j].Region {
+			return e.locs[i].Region < e.locs[j].Region
+		}
+		return e.locs[i].Partition < e.locs[j].Partition
+	})
+	return e
+}
+
+func recordRvAnomaly(url string, loc types.RvLocation, anomaly string, count int) {
+	klog.Warningf("Resource version %s of %d events from region manager %v, region %v, resource partition %v",
+		anomaly, count, url, loc.Region.String(), loc.Partition.String())
+	metrics.RegionManagerRvAnomalies.Add(float64(count), url, loc.Region.String(), loc.Partition.String(), anomaly)
+}
+
+// relistPartitions lists nodes of the resource partitions again, and returns crv with their listed resource versions
+func (a *Aggregator) relistPartitions(client RrmsInterface, url string, crv types.TransitResourceVersionMap, locs []types.RvLocation,
+	stopCh <-chan struct{}) (types.TransitResourceVersionMap, error) {
+	crv = crv.Copy()
+	for _, loc := range locs {
+		klog.Infof("List nodes of resource partition %v again from region manager %v", loc.Partition.String(), url)
+		metrics.RegionManagerPartitionRelists.Inc(url, loc.Region.String(), loc.Partition.String())
+		listedCrv, err := a.listAndProcessNodes(client, url, loc.Partition.GetPartitionName(), stopCh)
+		if err != nil {
+			return nil, err
+		}
+		if rv, isOK := listedCrv[loc]; isOK {
+			crv[loc] = rv
+		}
+	}
+	a.updateWatchCursors(url, crv)
+	return crv, nil
+}
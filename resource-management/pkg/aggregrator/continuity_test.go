@@ -0,0 +1,85 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregrator
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"global-resource-service/resource-management/pkg/common-lib/interfaces/store"
+	"global-resource-service/resource-management/pkg/common-lib/metrics"
+	"global-resource-service/resource-management/pkg/common-lib/types"
+	"global-resource-service/resource-management/pkg/common-lib/types/runtime"
+	"global-resource-service/resource-management/pkg/distributor/storage"
+)
+
+func TestRvContinuity(t *testing.T) {
+	now := time.Now()
+	c := newRvContinuity(types.TransitResourceVersionMap{beijingRP1: 10})
+
+	assert.Equal(t, "", c.check(beijingRP1, 11, now))
+	// out of order events within the timeout
+	assert.Equal(t, "", c.check(beijingRP1, 14, now))
+	assert.Equal(t, "", c.check(beijingRP1, 12, now))
+	assert.Equal(t, 0, len(c.getGaps(now.Add(time.Second))))
+
+	assert.Equal(t, RvAnomaly_Duplicate, c.check(beijingRP1, 12, now))
+	assert.Equal(t, RvAnomaly_Regression, c.check(beijingRP1, 10, now))
+
+	// 13 is not received within the timeout
+	assert.Equal(t, map[types.RvLocation]int{beijingRP1: 1}, c.getGaps(now.Add(rvGapTimeout+time.Second)))
+	assert.Equal(t, 0, len(c.getGaps(now.Add(rvGapTimeout+time.Second))))
+
+	// gap too large to wait for
+	assert.Equal(t, RvAnomaly_Gap, c.check(beijingRP1, 15+maxMissingRvs+1, now))
+	assert.Equal(t, "", c.check(beijingRP1, 15+maxMissingRvs+2, now))
+
+	// partition not watched from known resource version
+	assert.Equal(t, "", c.check(shanghaiRP1, 100, now))
+	assert.Equal(t, RvAnomaly_Regression, c.check(shanghaiRP1, 99, now))
+}
+
+func TestRunRegion_RelistPartitionOnRegression(t *testing.T) {
+	client := &fakeRrmsClient{
+		listRvs: types.TransitResourceVersionMap{beijingRP1: 7},
+		watchResults: []watchResult{
+			{events: []*runtime.NodeEvent{newNodeEvent(beijingRP1, 8), newNodeEvent(beijingRP1, 5)}},
+		},
+	}
+	cursorStore := &storage.FakeStorageInterface{}
+	cursorStore.PersistWatchCursors(&store.WatchCursors{RegionUrl: "region", ResourceVersions: types.TransitResourceVersionMap{beijingRP1: 7}})
+	a := newTestAggregator()
+	a.SetPersistHelper(cursorStore)
+	a.ResumeFromWatchCursors()
+	runRegionUntilWatchResultsUsed(t, a, client)
+
+	// the event of regressed resource version is discarded, and only the partition is listed again
+	assert.Equal(t, []uint64{8}, a.EventProcessor.(*fakeEventProcessor).batches[0])
+	assert.Equal(t, []ListOptions{{Limit: 1}, {Limit: DefaultListPageSize, Partition: "RP1"}}, client.listOptions)
+	assert.Equal(t, types.TransitResourceVersionMap{beijingRP1: 7}, client.watchedRvs[1])
+
+	registry := metrics.NewRegistry()
+	registry.Register(metrics.RegionManagerRvAnomalies, metrics.RegionManagerPartitionRelists)
+	var buf bytes.Buffer
+	assert.Nil(t, registry.WriteText(&buf))
+	assert.True(t, strings.Contains(buf.String(), `grs_region_manager_rv_anomalies_total{url="region",region="Beijing",resource_partition="RP1",anomaly="regression"}`))
+	assert.True(t, strings.Contains(buf.String(), `grs_region_manager_partition_relists_total{url="region",region="Beijing",resource_partition="RP1"}`))
+}
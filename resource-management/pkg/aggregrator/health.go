@@ -0,0 +1,325 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregrator
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"global-resource-service/resource-management/pkg/common-lib/metrics"
+	event "global-resource-service/resource-management/pkg/common-lib/types/runtime"
+	apiTypes "global-resource-service/resource-management/pkg/service-api/types"
+)
+
+const (
+	// stale region detection is disabled by default, it requires region managers that send bookmarks on idle watches
+	DefaultStaleRegionThreshold = time.Duration(0)
+	staleRegionCheckInterval    = 10 * time.Second
+)
+
+// regionHealth is the connection health of a region manager
+type regionHealth struct {
+	// one of listing, watching and backoff, disconnected is derived from the last contact time
+	state string
+	// last time an event or bookmark is received, or the list or watch of the region manager succeeded
+	lastContactTime time.Time
+	lastEventTime   time.Time
+	// time from the node updated in the region manager to the event received by the aggregator, of the last event
+	eventLag time.Duration
+	// nodes of the regions are flagged stale
+	isStale bool
+	// last failed list or watch since the last success
+	lastError           error
+	lastErrorClass      string
+	consecutiveFailures int
+}
+
+// SetStaleRegionThreshold sets how long a region manager can go without contact before nodes of its regions are flagged stale
+// It requires region managers that send bookmarks periodically on idle watches, otherwise an idle but healthy watch
+// is taken as no contact. Nodes are never flagged stale if the threshold is not positive
+func (a *Aggregator) SetStaleRegionThreshold(threshold time.Duration) {
+	a.staleRegionThreshold = threshold
+}
+
+// GetRegionManagerStatus returns the list status and connection health of each region manager
+func (a *Aggregator) GetRegionManagerStatus() []apiTypes.RegionManagerStatus {
+	listStatus := a.GetInitialListStatus()
+	urls := a.GetRegionUrls()
+	now := time.Now()
+
+	a.healthLock.RLock()
+	defer a.healthLock.RUnlock()
+	status := make([]apiTypes.RegionManagerStatus, len(urls))
+	for i, url := range urls {
+		status[i] = apiTypes.RegionManagerStatus{Url: url, InitialListDone: listStatus[url]}
+		if h, isOK := a.regionHealths[url]; isOK {
+			status[i].State = a.getRegionState(h, now)
+			status[i].LastEventTime = h.lastEventTime
+			status[i].EventLagMs = float64(h.eventLag) / float64(time.Millisecond)
+			status[i].Stale = h.isStale
+			if h.lastError != nil {
+				status[i].LastError = fmt.Sprintf("%s: %v", h.lastErrorClass, h.lastError)
+				status[i].ConsecutiveFailures = h.consecutiveFailures
+			}
+		}
+	}
+	return status
+}
+
+// RunStaleRegionDetector flags nodes of regions whose region manager has no contact longer than the stale threshold,
+// and restores the nodes once contact resumes. It runs until stopCh is closed
+func (a *Aggregator) RunStaleRegionDetector(stopCh <-chan struct{}) {
+	if a.staleRegionThreshold <= 0 {
+		klog.Infof("Stale region detection disabled")
+		return
+	}
+	for waitOrStop(staleRegionCheckInterval, stopCh) {
+		a.detectStaleRegions(time.Now())
+	}
+}
+
+func (a *Aggregator) detectStaleRegions(now time.Time) {
+	for _, url := range a.GetRegionUrls() {
+		isStale, isChanged := a.updateRegionStale(url, now)
+		if !isChanged {
+			continue
+		}
+		if isStale {
+			klog.Warningf("No contact with region manager %v for more than %v, flag nodes of its regions stale", url, a.staleRegionThreshold)
+		} else {
+			klog.Infof("Contact with region manager %v resumed, restore stale nodes of its regions", url)
+		}
+		for _, region := range getRegionsOfCursors(a.getLatestWatchCursors(url)) {
+			count := a.EventProcessor.SetRegionNodesStale(region, isStale)
+			klog.Infof("Set %d nodes of region %v stale: %v", count, region.String(), isStale)
+		}
+	}
+}
+
+// updateRegionStale updates whether the region manager is stale, and returns it and whether it changed
+// A region manager being watched is stale too if it goes silent, e.g. its watch connection is open but not served
+func (a *Aggregator) updateRegionStale(url string, now time.Time) (bool, bool) {
+	a.healthLock.Lock()
+	defer a.healthLock.Unlock()
+	h, isOK := a.regionHealths[url]
+	if !isOK {
+		return false, false
+	}
+	isStale := now.Sub(h.lastContactTime) > a.staleRegionThreshold
+	if isStale == h.isStale {
+		return isStale, false
+	}
+	h.isStale = isStale
+	return isStale, true
+}
+
+// isRegionStale returns whether nodes of the regions of the region manager are flagged stale by the stale detector
+func (a *Aggregator) isRegionStale(url string) bool {
+	a.healthLock.RLock()
+	defer a.healthLock.RUnlock()
+	h, isOK := a.regionHealths[url]
+	return isOK && h.isStale
+}
+
+// getRegionState returns the state of the region manager, disconnected if not failed, and no contact longer than the stale threshold
+func (a *Aggregator) getRegionState(h *regionHealth, now time.Time) string {
+	if h.state != apiTypes.RegionManagerState_Failed && a.staleRegionThreshold > 0 && now.Sub(h.lastContactTime) > a.staleRegionThreshold {
+		return apiTypes.RegionManagerState_Disconnected
+	}
+	return h.state
+}
+
+// getOrCreateRegionHealth must be called with healthLock held
+func (a *Aggregator) getOrCreateRegionHealth(url string) *regionHealth {
+	h, isOK := a.regionHealths[url]
+	if !isOK {
+		// a region manager never connected is stale after the threshold since it is added
+		h = &regionHealth{lastContactTime: time.Now()}
+		a.regionHealths[url] = h
+	}
+	return h
+}
+
+// moveRegionHealth makes the health of the region manager the one of the new url, except the state
+func (a *Aggregator) moveRegionHealth(url string, newUrl string) {
+	a.healthLock.Lock()
+	defer a.healthLock.Unlock()
+	if h, isOK := a.regionHealths[url]; isOK {
+		delete(a.regionHealths, url)
+		h.state = ""
+		a.regionHealths[newUrl] = h
+	}
+}
+
+func (a *Aggregator) setRegionState(url string, state string) {
+	a.healthLock.Lock()
+	defer a.healthLock.Unlock()
+	h := a.getOrCreateRegionHealth(url)
+	h.state = state
+	if state == apiTypes.RegionManagerState_Watching {
+		h.recordSuccess()
+	}
+}
+
+// recordRegionContact records a page of nodes is listed from the region manager, or a bookmark is received from its watch
+func (a *Aggregator) recordRegionContact(url string) {
+	a.healthLock.Lock()
+	defer a.healthLock.Unlock()
+	a.getOrCreateRegionHealth(url).recordSuccess()
+}
+
+// recordRegionFailure records the failed list or watch of the region manager, and returns the number of consecutive failures
+func (a *Aggregator) recordRegionFailure(url string, operation string, errorClass string, err error) int {
+	metrics.RegionManagerRequestFailures.Inc(url, operation, errorClass)
+	a.healthLock.Lock()
+	defer a.healthLock.Unlock()
+	h := a.getOrCreateRegionHealth(url)
+	h.lastError = err
+	h.lastErrorClass = errorClass
+	h.consecutiveFailures++
+	return h.consecutiveFailures
+}
+
+// GetFailedRegionManagers returns the status of region managers whose list or watch failed with errors not to be retried
+func (a *Aggregator) GetFailedRegionManagers() []apiTypes.RegionManagerStatus {
+	failed := make([]apiTypes.RegionManagerStatus, 0)
+	for _, status := range a.GetRegionManagerStatus() {
+		if status.State == apiTypes.RegionManagerState_Failed {
+			failed = append(failed, status)
+		}
+	}
+	return failed
+}
+
+// GetStuckRegionManagers returns the urls of region managers whose list-watch has been processing a batch of node
+// events longer than maxProcessingTime, e.g. blocked by the event processor. Waiting for region managers is not stuck
+func (a *Aggregator) GetStuckRegionManagers(maxProcessingTime time.Duration) []string {
+	a.processingLock.Lock()
+	defer a.processingLock.Unlock()
+	now := time.Now()
+	stuck := make([]string, 0)
+	for url, since := range a.processingSince {
+		if now.Sub(since) > maxProcessingTime {
+			stuck = append(stuck, url)
+		}
+	}
+	return stuck
+}
+
+// setProcessingSince records the list-watch of the region manager started processing node events, or is done if zero
+func (a *Aggregator) setProcessingSince(url string, since time.Time) {
+	a.processingLock.Lock()
+	defer a.processingLock.Unlock()
+	if since.IsZero() {
+		delete(a.processingSince, url)
+	} else {
+		a.processingSince[url] = since
+	}
+}
+
+func (h *regionHealth) recordSuccess() {
+	h.lastContactTime = time.Now()
+	h.lastError = nil
+	h.lastErrorClass = ""
+	h.consecutiveFailures = 0
+}
+
+func (a *Aggregator) recordRegionEvent(url string, e *event.NodeEvent) {
+	now := time.Now()
+	a.healthLock.Lock()
+	defer a.healthLock.Unlock()
+	h := a.getOrCreateRegionHealth(url)
+	h.lastContactTime = now
+	h.lastEventTime = now
+	if lastUpdatedTime := e.GetLastUpdatedTime(); !lastUpdatedTime.IsZero() {
+		h.eventLag = now.Sub(lastUpdatedTime)
+	}
+}
+
+// RegisterMetrics registers metrics of region manager health, collected when exported
+func (a *Aggregator) RegisterMetrics(registry *metrics.Registry) {
+	registry.Register(
+		metrics.NewGaugeFunc("grs_region_manager_state", "State of the list-watch of the region manager, 1 for the current state.",
+			[]string{"url", "state"}, a.collectRegionStates),
+		metrics.NewGaugeFunc("grs_region_manager_seconds_since_last_event", "Seconds since the last event received from the region manager.",
+			[]string{"url"}, a.collectSecondsSinceLastEvent),
+		metrics.NewGaugeFunc("grs_region_manager_event_lag_seconds", "Time from the node updated in the region manager to received, of the last event.",
+			[]string{"url"}, a.collectEventLags),
+		metrics.NewGaugeFunc("grs_region_manager_stale", "Whether nodes of the regions of the region manager are flagged stale.",
+			[]string{"url"}, a.collectStaleRegions),
+	)
+}
+
+var regionManagerStates = []string{
+	apiTypes.RegionManagerState_Listing,
+	apiTypes.RegionManagerState_Watching,
+	apiTypes.RegionManagerState_Backoff,
+	apiTypes.RegionManagerState_Disconnected,
+	apiTypes.RegionManagerState_Failed,
+}
+
+func (a *Aggregator) collectRegionStates() []metrics.Sample {
+	status := a.GetRegionManagerStatus()
+	samples := make([]metrics.Sample, 0, len(status)*len(regionManagerStates))
+	for _, s := range status {
+		for _, state := range regionManagerStates {
+			value := 0.0
+			if s.State == state {
+				value = 1
+			}
+			samples = append(samples, metrics.Sample{LabelValues: []string{s.Url, state}, Value: value})
+		}
+	}
+	return samples
+}
+
+func (a *Aggregator) collectSecondsSinceLastEvent() []metrics.Sample {
+	status := a.GetRegionManagerStatus()
+	samples := make([]metrics.Sample, 0, len(status))
+	for _, s := range status {
+		if !s.LastEventTime.IsZero() {
+			samples = append(samples, metrics.Sample{LabelValues: []string{s.Url}, Value: time.Since(s.LastEventTime).Seconds()})
+		}
+	}
+	return samples
+}
+
+func (a *Aggregator) collectEventLags() []metrics.Sample {
+	status := a.GetRegionManagerStatus()
+	samples := make([]metrics.Sample, 0, len(status))
+	for _, s := range status {
+		if !s.LastEventTime.IsZero() {
+			samples = append(samples, metrics.Sample{LabelValues: []string{s.Url}, Value: s.EventLagMs / 1000})
+		}
+	}
+	return samples
+}
+
+func (a *Aggregator) collectStaleRegions() []metrics.Sample {
+	status := a.GetRegionManagerStatus()
+	samples := make([]metrics.Sample, 0, len(status))
+	for _, s := range status {
+		value := 0.0
+		if s.Stale {
+			value = 1
+		}
+		samples = append(samples, metrics.Sample{LabelValues: []string{s.Url}, Value: value})
+	}
+	return samples
+}
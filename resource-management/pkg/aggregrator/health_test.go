@@ -0,0 +1,242 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregrator
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"global-resource-service/resource-management/pkg/clientSdk/util/errors"
+	"global-resource-service/resource-management/pkg/common-lib/metrics"
+	"global-resource-service/resource-management/pkg/common-lib/types"
+	"global-resource-service/resource-management/pkg/common-lib/types/location"
+	"global-resource-service/resource-management/pkg/common-lib/types/runtime"
+	apiTypes "global-resource-service/resource-management/pkg/service-api/types"
+)
+
+func (p *fakeEventProcessor) getRestoredRegions() []location.Region {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]location.Region{}, p.restoredRegions...)
+}
+
+func TestRegionHealth_WatchingAndStale(t *testing.T) {
+	a := newTestAggregator()
+	a.SetStaleRegionThreshold(time.Minute)
+	processor := a.EventProcessor.(*fakeEventProcessor)
+	client := &fakeRrmsClient{watcher: make(fakeWatcher, 10), listRvs: types.TransitResourceVersionMap{beijingRP1: 1}}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go a.runRegion(client, "region", types.TransitResourceVersionMap{beijingRP1: 1}, stopCh)
+
+	e := newNodeEvent(beijingRP1, 2)
+	e.Node.LastUpdatedTime = time.Now().Add(-2 * time.Second)
+	client.watcher <- *e
+	assert.Eventually(t, func() bool {
+		return !a.GetRegionManagerStatus()[0].LastEventTime.IsZero()
+	}, 5*time.Second, 10*time.Millisecond)
+	status := a.GetRegionManagerStatus()[0]
+	assert.Equal(t, apiTypes.RegionManagerState_Watching, status.State)
+	assert.True(t, status.InitialListDone)
+	assert.True(t, status.EventLagMs >= 2000)
+	assert.False(t, status.Stale)
+
+	// a watch without events within the threshold is not stale
+	a.detectStaleRegions(time.Now().Add(30 * time.Second))
+	stale, _ := processor.getRegionActions()
+	assert.Empty(t, stale)
+	assert.False(t, a.GetRegionManagerStatus()[0].Stale)
+
+	// a silent region manager is stale even if its watch is open
+	a.detectStaleRegions(time.Now().Add(2 * time.Minute))
+	stale, _ = processor.getRegionActions()
+	assert.Equal(t, []location.Region{location.Beijing}, stale)
+	assert.True(t, a.GetRegionManagerStatus()[0].Stale)
+	// already flagged
+	a.detectStaleRegions(time.Now().Add(2 * time.Minute))
+	stale, _ = processor.getRegionActions()
+	assert.Equal(t, 1, len(stale))
+
+	// bookmark from the watch is contact
+	a.healthLock.Lock()
+	lastContactTime := a.regionHealths["region"].lastContactTime
+	a.healthLock.Unlock()
+	bookmark := newNodeEvent(beijingRP1, 2)
+	bookmark.Type = runtime.Bookmark
+	client.watcher <- *bookmark
+	assert.Eventually(t, func() bool {
+		a.healthLock.RLock()
+		defer a.healthLock.RUnlock()
+		return a.regionHealths["region"].lastContactTime.After(lastContactTime)
+	}, 5*time.Second, 10*time.Millisecond)
+	a.detectStaleRegions(time.Now())
+	assert.Equal(t, []location.Region{location.Beijing}, processor.getRestoredRegions())
+	assert.False(t, a.GetRegionManagerStatus()[0].Stale)
+
+	// not watched and no contact longer than the threshold
+	a.setRegionState("region", apiTypes.RegionManagerState_Backoff)
+	a.detectStaleRegions(time.Now().Add(2 * time.Minute))
+	stale, _ = processor.getRegionActions()
+	assert.Equal(t, 2, len(stale))
+	assert.True(t, a.GetRegionManagerStatus()[0].Stale)
+
+	a.setRegionState("region", apiTypes.RegionManagerState_Watching)
+	a.detectStaleRegions(time.Now())
+	assert.Equal(t, 2, len(processor.getRestoredRegions()))
+	assert.False(t, a.GetRegionManagerStatus()[0].Stale)
+}
+
+func TestRegionHealth_Disconnected(t *testing.T) {
+	a := newTestAggregator()
+	a.SetStaleRegionThreshold(time.Minute)
+	a.setRegionState("region", apiTypes.RegionManagerState_Backoff)
+	assert.Equal(t, apiTypes.RegionManagerState_Backoff, a.GetRegionManagerStatus()[0].State)
+
+	a.regionHealths["region"].lastContactTime = time.Now().Add(-2 * time.Minute)
+	assert.Equal(t, apiTypes.RegionManagerState_Disconnected, a.GetRegionManagerStatus()[0].State)
+
+	registry := metrics.NewRegistry()
+	a.RegisterMetrics(registry)
+	var buf bytes.Buffer
+	assert.Nil(t, registry.WriteText(&buf))
+	assert.True(t, strings.Contains(buf.String(), `grs_region_manager_state{url="region",state="disconnected"} 1`))
+	assert.True(t, strings.Contains(buf.String(), `grs_region_manager_state{url="region",state="backoff"} 0`))
+	assert.True(t, strings.Contains(buf.String(), `grs_region_manager_stale{url="region"} 0`))
+}
+
+func TestRegionHealth_ListPagesAreContact(t *testing.T) {
+	a := newTestAggregator()
+	a.SetStaleRegionThreshold(time.Minute)
+	processor := a.EventProcessor.(*fakeEventProcessor)
+	processor.failedRv = 3
+	client := &fakeRrmsClient{
+		listRvs: types.TransitResourceVersionMap{beijingRP1: 3},
+		listPages: [][]*runtime.NodeEvent{
+			{newNodeEvent(beijingRP1, 1), newNodeEvent(beijingRP1, 2)},
+			{newNodeEvent(beijingRP1, 3)},
+		},
+	}
+	// the list started longer than the threshold ago
+	a.setRegionState("region", apiTypes.RegionManagerState_Listing)
+	a.regionHealths["region"].lastContactTime = time.Now().Add(-2 * time.Minute)
+
+	// pages received are contact even if the list is not finished
+	_, err := a.listAndProcessNodes(client, "region", "", make(chan struct{}))
+	assert.NotNil(t, err)
+	a.detectStaleRegions(time.Now())
+	stale, _ := processor.getRegionActions()
+	assert.Empty(t, stale)
+	assert.Equal(t, apiTypes.RegionManagerState_Listing, a.GetRegionManagerStatus()[0].State)
+}
+
+func TestListNodes_RetryRetryableErrors(t *testing.T) {
+	a := newTestAggregator()
+	client := &fakeRrmsClient{
+		listRvs:    types.TransitResourceVersionMap{beijingRP1: 1},
+		listErrors: []error{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}},
+	}
+	nodes, crv, _, _, err := a.listNodes(client, ListOptions{}, "region", make(chan struct{}))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, client.listCount)
+	assert.Equal(t, 1, len(nodes))
+	assert.Equal(t, types.TransitResourceVersionMap{beijingRP1: 1}, crv)
+
+	// failures are kept until the region manager is contacted
+	status := a.GetRegionManagerStatus()[0]
+	assert.Equal(t, "retryable: dial tcp: connection refused", status.LastError)
+	assert.Equal(t, 1, status.ConsecutiveFailures)
+	a.recordRegionContact("region")
+	assert.Equal(t, "", a.GetRegionManagerStatus()[0].LastError)
+
+	registry := metrics.NewRegistry()
+	registry.Register(metrics.RegionManagerRequestFailures)
+	var buf bytes.Buffer
+	assert.Nil(t, registry.WriteText(&buf))
+	assert.True(t, strings.Contains(buf.String(), `grs_region_manager_request_failures_total{url="region",operation="list",class="retryable"}`))
+}
+
+func TestListNodes_NotRetryDecodeErrors(t *testing.T) {
+	a := newTestAggregator()
+	var resp types.LogicalNode
+	decodeErr := json.Unmarshal([]byte("not json"), &resp)
+	client := &fakeRrmsClient{
+		listRvs:    types.TransitResourceVersionMap{beijingRP1: 1},
+		listErrors: []error{decodeErr},
+	}
+	_, _, _, _, err := a.listNodes(client, ListOptions{}, "region", make(chan struct{}))
+	assert.Equal(t, decodeErr, err)
+	assert.Equal(t, 1, client.listCount)
+	assert.Equal(t, errors.ErrorClass_BadRequest+": "+decodeErr.Error(), a.GetRegionManagerStatus()[0].LastError)
+}
+
+func TestRunRegion_FailedOnNonRetryableError(t *testing.T) {
+	a := newTestAggregator()
+	client := &fakeRrmsClient{
+		listRvs:    types.TransitResourceVersionMap{beijingRP1: 1},
+		listErrors: []error{errors.NewStatusError(http.StatusUnauthorized, nil)},
+		watcher:    make(fakeWatcher),
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go a.runRegion(client, "region", nil, stopCh)
+
+	// not retried by the list, the region is listed again after backoff
+	assert.Eventually(t, func() bool {
+		return len(a.GetFailedRegionManagers()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	status := a.GetFailedRegionManagers()[0]
+	assert.Equal(t, "region", status.Url)
+	assert.True(t, strings.HasPrefix(status.LastError, errors.ErrorClass_Auth))
+	assert.False(t, status.InitialListDone)
+
+	assert.Eventually(t, func() bool {
+		return a.GetRegionManagerStatus()[0].State == apiTypes.RegionManagerState_Watching
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, len(a.GetFailedRegionManagers()))
+	assert.Equal(t, "", a.GetRegionManagerStatus()[0].LastError)
+}
+
+func TestGetStuckRegionManagers(t *testing.T) {
+	a := newTestAggregator()
+	processor := a.EventProcessor.(*fakeEventProcessor)
+	assert.Empty(t, a.GetStuckRegionManagers(0))
+
+	// event processor is blocked
+	processor.lock.Lock()
+	doneCh := make(chan struct{})
+	go func() {
+		a.processNodes("region", []*runtime.NodeEvent{newNodeEvent(beijingRP1, 1)})
+		close(doneCh)
+	}()
+	assert.Eventually(t, func() bool {
+		return len(a.GetStuckRegionManagers(50*time.Millisecond)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"region"}, a.GetStuckRegionManagers(50*time.Millisecond))
+	assert.Empty(t, a.GetStuckRegionManagers(time.Hour))
+
+	processor.lock.Unlock()
+	<-doneCh
+	assert.Empty(t, a.GetStuckRegionManagers(0))
+}
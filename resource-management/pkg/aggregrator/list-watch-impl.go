@@ -17,108 +17,278 @@ limitations under the License.
 package aggregrator
 
 import (
+	"fmt"
 	"k8s.io/klog/v2"
+	"math/rand"
+	"reflect"
 	"sync"
 	"time"
 
+	"global-resource-service/resource-management/pkg/clientSdk/util/errors"
 	utilruntime "global-resource-service/resource-management/pkg/clientSdk/util/runtime"
 	common_lib "global-resource-service/resource-management/pkg/common-lib"
+	"global-resource-service/resource-management/pkg/common-lib/interfaces/store"
 	"global-resource-service/resource-management/pkg/common-lib/metrics"
 	"global-resource-service/resource-management/pkg/common-lib/types"
+	"global-resource-service/resource-management/pkg/common-lib/types/location"
 	event "global-resource-service/resource-management/pkg/common-lib/types/runtime"
+	apiTypes "global-resource-service/resource-management/pkg/service-api/types"
 )
 
 // LwRun implements Run interface of Aggregator
 func (a *Aggregator) Run() (err error) {
-	numberOfRegions := len(a.urls)
+	a.regionsLock.Lock()
+	defer a.regionsLock.Unlock()
+	a.isRunning = true
 
 	klog.V(3).Infof("Running for loop to connect to to resource region manager...")
 
-	for i := 0; i < numberOfRegions; i++ {
-		go func(i int) {
-			klog.V(3).Infof("Starting goroutine for region: %v", a.urls[i])
-			var err error
-			defer func() {
-				klog.V(3).Infof("Exiting goroutine for region: %v", a.urls[i])
-				if err != nil {
-					klog.Errorf("Error for goroutine: %v", err)
-				}
-			}()
-
-			var crv types.TransitResourceVersionMap
-			var regionNodeEvents [][]*event.NodeEvent
-			var length uint64
-			var eventProcess bool
-
-			// create client to resource region manager
-			c := NewRrmsClient(Config{ServiceUrl: a.urls[i], RequestTimeout: 30 * time.Minute})
+	for _, url := range a.urls {
+		// region managers being removed are started once the removal finishes
+		if a.removingRegions[url] > 0 {
+			continue
+		}
+		a.startRegion(url, a.getWatchCursors(url))
+	}
 
-			klog.V(3).Infof("Starting loop list-watching nodes from region: %v", a.urls[i])
+	klog.V(3).Infof("Finished for loop to connect to to resource region manager...")
+	return nil
+}
 
-			// TODO: add limit in config
-			// TODO: add pagination feature in region resource mgr service
-			// hack, list all 1m node in one call without pagination
-			regionNodeEvents, crv, length, err = a.listNodes(c, ListOptions{Limit: 1000000}, a.urls[i])
+// runRegion list-watches nodes from the region manager until stopCh is closed
+// Nodes are watched from crv if not nil and not ahead of the region manager, otherwise listed first
+// Watch is restarted with backoff from the latest resource versions processed when the watch ends or fails,
+// and the region is listed again if the resource versions expired at the region manager
+func (a *Aggregator) runRegion(client RrmsInterface, url string, crv types.TransitResourceVersionMap, stopCh <-chan struct{}) {
+	if crv != nil && !a.cursorsValidAtRegion(client, url, crv, stopCh) {
+		crv = nil
+	}
+	if crv != nil {
+		klog.Infof("Resume watching nodes from region manager %v with resource versions %v", url, crv)
+		a.updateWatchCursors(url, crv)
+		a.setInitialListDone(url)
+	}
+	var err error
+	backoff := initialRewatchBackoff
 
-			// Exit the goroutine with failed List operation
+	for {
+		if isStopped(stopCh) {
+			return
+		}
+		if crv == nil {
+			klog.V(3).Infof("Starting loop list-watching nodes from region: %v", url)
+			a.setRegionState(url, apiTypes.RegionManagerState_Listing)
+			crv, err = a.listAndProcessNodes(client, url, "", stopCh)
 			if err != nil {
-				return
+				klog.Errorf("failed to list nodes from region manager %v. retry in %v. error %v", url, backoff, err)
+				a.setRegionFailedOrBackoff(url, err)
+				if !waitOrStop(backoff, stopCh) {
+					return
+				}
+				backoff = nextBackoff(backoff)
+				continue
 			}
+			a.updateWatchCursors(url, crv)
+			a.setInitialListDone(url)
+		}
 
-			if length != 0 {
-				klog.V(4).Infof("Total (%v) region node events are listed successfully in (%v) RPs", length, len(regionNodeEvents))
-			} else {
-				// TODO: handel empty list
+		start := time.Now()
+		if a.watchByPartition && len(crv) > 0 {
+			crv, err = a.watchPartitions(client, crv, url, stopCh)
+		} else {
+			crv, err = a.watchNodes(client, crv, url, WatchOptions{}, stopCh)
+		}
+		if err != nil {
+			if errors.IsResourceVersionExpired(err) {
+				klog.Warningf("resource versions expired at region manager %v, list nodes again", url)
+				crv = nil
+				continue
 			}
-
-			// Convert 2D array to 1D array
-			// TODO: add dynamically watch at RP granularity level feature in GRS
-			//       by spawning threads for watch each RP, we can further optimize concurrency and also avoid below conversions
-			minRecordNodeEvents := make([]*event.NodeEvent, 0, length)
-			for j := 0; j < len(regionNodeEvents); j++ {
-				minRecordNodeEvents = append(minRecordNodeEvents, regionNodeEvents[j]...)
+			if relistErr, isOK := err.(*partitionsRelistError); isOK {
+				if crv, err = a.relistPartitions(client, url, crv, relistErr.locs, stopCh); err != nil {
+					klog.Errorf("failed to list resource partitions %v from region manager %v, list nodes again. error %v", relistErr.locs, url, err)
+					crv = nil
+				}
+				continue
 			}
+			klog.Errorf("failed to watch nodes from region manager %v. error %v", url, err)
+			a.recordRegionFailure(url, metrics.RegionManagerOperation_Watch, classifyError(err), err)
+		}
+
+		// a watch session lasted long enough means the region manager is healthy
+		if time.Since(start) > maxRewatchBackoff {
+			backoff = initialRewatchBackoff
+		}
+		klog.V(3).Infof("Watch nodes again from region manager %v in %v", url, backoff)
+		a.setRegionFailedOrBackoff(url, err)
+		if !waitOrStop(backoff, stopCh) {
+			return
+		}
+		backoff = nextBackoff(backoff)
+	}
+}
+
+// cursorsValidAtRegion returns whether none of the persisted cursors is ahead of the current resource versions
+// of the region manager, as cursors ahead of them were persisted before the region manager restarted or was reset
+func (a *Aggregator) cursorsValidAtRegion(client RrmsInterface, url string, crv types.TransitResourceVersionMap, stopCh <-chan struct{}) bool {
+	// a list of one node returns the current resource versions of all resource partitions
+	_, regionRvs, _, _, err := a.listNodes(client, ListOptions{Limit: 1}, url, stopCh)
+	if err != nil {
+		klog.Warningf("Failed to get resource versions of region manager %v to check watch cursors, list region instead. error %v", url, err)
+		return false
+	}
+	for loc, rv := range crv {
+		if regionRv, isOK := regionRvs[loc]; !isOK || rv > regionRv {
+			klog.Warningf("Watch cursors %v of region manager %v are ahead of its resource versions %v, list region instead", crv, url, regionRvs)
+			return false
+		}
+	}
+	return true
+}
+
+// listAndProcessNodes lists nodes of all resource partitions of the region manager, or of the partition only if not empty,
+// and returns the resource versions to watch from
+func (a *Aggregator) listAndProcessNodes(client RrmsInterface, url string, partition string, stopCh <-chan struct{}) (types.TransitResourceVersionMap, error) {
+	// nodes are listed in pages, each page is processed before listing the next one to bound the memory of the list
+	// all pages are returned with the resource versions at the first page
+	var crv types.TransitResourceVersionMap
+	listOpts := ListOptions{Limit: a.listPageSize, Partition: partition}
+	totalLength := uint64(0)
+	pageCount := 0
+	for {
+		regionNodeEvents, pageCrv, length, continueToken, err := a.listNodes(client, listOpts, url, stopCh)
+		if err != nil {
+			return nil, err
+		}
+		// a list of many pages can take longer than the stale threshold, so each received page counts as contact
+		a.recordRegionContact(url)
+		if pageCount == 0 {
+			crv = pageCrv
+		}
+		pageCount++
+		totalLength += length
 
-			start := time.Now()
-			eventProcess, crv = a.EventProcessor.ProcessEvents(minRecordNodeEvents)
-			end := time.Now()
-			klog.V(6).Infof("Event Processor Processed nodes results : %v. duration: %v", eventProcess, end.Sub(start))
+		// Convert 2D array to 1D array
+		// Each RP is watched separately after list if watchByPartition is set, see watchPartitions
+		minRecordNodeEvents := make([]*event.NodeEvent, 0, length)
+		for j := 0; j < len(regionNodeEvents); j++ {
+			minRecordNodeEvents = append(minRecordNodeEvents, regionNodeEvents[j]...)
+		}
+		minRecordNodeEvents = a.filterValidNodeEvents(url, minRecordNodeEvents)
 
-			// start watch node changes
-			a.watchNodes(c, crv, a.urls[i])
+		if !a.processNodes(url, minRecordNodeEvents) {
+			return nil, &processFailedError{message: fmt.Sprintf("failed to process page %d of nodes listed from region manager %v", pageCount, url)}
+		}
 
-		}(i)
+		if continueToken == "" {
+			break
+		}
+		if isStopped(stopCh) {
+			return nil, fmt.Errorf("list of region manager %v stopped after %v pages", url, pageCount)
+		}
+		listOpts.Continue = continueToken
 	}
 
-	klog.V(3).Infof("Finished for loop to connect to to resource region manager...")
-	return nil
+	if totalLength != 0 {
+		klog.V(4).Infof("Total (%v) region node events are listed successfully in (%v) pages", totalLength, pageCount)
+	} else {
+		// TODO: handel empty list
+	}
+
+	// watch from the resource versions of the list, the event processor returns resource versions of all regions
+	if crv == nil {
+		crv = make(types.TransitResourceVersionMap)
+	}
+	return crv, nil
+}
+
+func nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > maxRewatchBackoff {
+		return maxRewatchBackoff
+	}
+	return backoff
+}
+
+// jitter returns the duration increased by a random factor up to jitterFactor, so that retries of regions are spread out
+func jitter(d time.Duration) time.Duration {
+	return d + time.Duration(rand.Float64()*jitterFactor*float64(d))
+}
+
+// processFailedError is returned if node events from the region manager failed to be processed, they are listed or watched again
+type processFailedError struct {
+	message string
 }
 
-func (a *Aggregator) listNodes(client RrmsInterface, listOpts ListOptions, url string) (nodeList [][]*event.NodeEvent,
-	crv types.TransitResourceVersionMap, length uint64, err error) {
+func (e *processFailedError) Error() string {
+	return e.message
+}
+
+// classifyError returns the class of the error of a list or watch, see errors.ClassifyError
+// Failures to process node events are retryable, as they are not errors of the region manager
+func classifyError(err error) string {
+	if _, isOK := err.(*processFailedError); isOK {
+		return errors.ErrorClass_Retryable
+	}
+	return errors.ClassifyError(err)
+}
+
+// setRegionFailedOrBackoff sets the region manager failed if the list or watch failed with an error not to be retried
+// without change, otherwise backoff
+func (a *Aggregator) setRegionFailedOrBackoff(url string, err error) {
+	if err != nil && classifyError(err) != errors.ErrorClass_Retryable && !errors.IsResourceVersionExpired(err) {
+		a.setRegionState(url, apiTypes.RegionManagerState_Failed)
+		return
+	}
+	a.setRegionState(url, apiTypes.RegionManagerState_Backoff)
+}
+
+// waitOrStop returns false if stopCh is closed before the duration passes
+func waitOrStop(d time.Duration, stopCh <-chan struct{}) bool {
+	select {
+	case <-stopCh:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+func isStopped(stopCh <-chan struct{}) bool {
+	select {
+	case <-stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+func (a *Aggregator) listNodes(client RrmsInterface, listOpts ListOptions, url string, stopCh <-chan struct{}) (nodeList [][]*event.NodeEvent,
+	crv types.TransitResourceVersionMap, length uint64, continueToken string, err error) {
 	var start, end time.Time
 
-	retryList := 0
+	// retryable errors are retried with jittered exponential backoff until stopped, other errors are returned
+	backoff := initialRewatchBackoff
 	for {
 		klog.Infof("List resources from region manager %v", url)
 		start = time.Now().UTC()
-		nodeList, crv, length, err = client.List(listOpts)
+		nodeList, crv, length, continueToken, err = client.List(listOpts)
 		end = time.Now().UTC()
-		if err != nil {
-			klog.Warningf("failed list resource from region manager. error %v. retry in one second", err)
-			//TODO: chain to the clientSDK and with necessary changes to bubble up the http error code
-			//      and take action on the different type of errors
-			// for now, the common cost in test env is the region manager started after the GRS service, and hence the wait here
-			time.Sleep(1 * time.Second)
-			if retryList == 60 {
-				klog.Errorf("failed list resource from region manager after retries. error %v", err)
-				return nil, nil, 0, err
-			}
-			retryList++
-			continue
-		} else {
+		if err == nil {
 			break
 		}
+
+		errorClass := errors.ClassifyError(err)
+		failures := a.recordRegionFailure(url, metrics.RegionManagerOperation_List, errorClass, err)
+		if errorClass != errors.ErrorClass_Retryable {
+			klog.Errorf("failed list resource from region manager %v with %s error, not retried. error %v", url, errorClass, err)
+			return nil, nil, 0, "", err
+		}
+		delay := jitter(backoff)
+		klog.Warningf("failed list resource from region manager %v %d times. retry in %v. error %v", url, failures, delay, err)
+		if !waitOrStop(delay, stopCh) {
+			return nil, nil, 0, "", err
+		}
+		backoff = nextBackoff(backoff)
 	}
 	klog.V(3).Infof("Got [%v] RPs, [%v] nodes from region manager, list duration: %v", len(nodeList), length, end.Sub(start))
 
@@ -132,26 +302,72 @@ func (a *Aggregator) listNodes(client RrmsInterface, listOpts ListOptions, url s
 		}
 	}
 
-	return nodeList, crv, length, nil
+	return nodeList, crv, length, continueToken, nil
 }
 
-func (a *Aggregator) watchNodes(client RrmsInterface, crv types.TransitResourceVersionMap, url string) {
+// watchNodes processes node events from the region manager until the watch ends or stopCh is closed
+// It returns the resource versions to watch again from, which are crv updated with the processed events
+// The watch ends with error if events failed to be processed, the resource versions stay below the failed events
+// The resource versions are persisted periodically as watch cursors to resume after restart
+// Bookmark events are skipped and invalid events are quarantined. Events with duplicate or regressed resource versions in their resource partition are discarded, and partitionsRelistError
+// is returned with the partitions to list again if their events are lost
+func (a *Aggregator) watchNodes(client RrmsInterface, crv types.TransitResourceVersionMap, url string, opts WatchOptions,
+	stopCh <-chan struct{}) (types.TransitResourceVersionMap, error) {
 	var start, end time.Time
 
-	klog.V(3).Infof("Watch resources update from region manager %v", url)
+	klog.V(3).Infof("Watch resources update from region manager %v, resource partition %q", url, opts.Partition)
 	start = time.Now().UTC()
-	watcher, err := client.Watch(crv)
+	watcher, err := client.Watch(crv, opts)
 	if err != nil {
-		klog.Errorf("failed list resource from region manager. error %v", err)
+		return crv, err
 	}
+	defer watcher.Stop()
+	a.setRegionState(url, apiTypes.RegionManagerState_Watching)
 
 	watchCh := watcher.ResultChan()
+	tracker := newRvTracker(crv)
+	continuity := newRvContinuity(crv)
+	// resource partitions whose events are lost
+	relistLocs := make(map[types.RvLocation]bool)
+	ticker := time.NewTicker(watchCursorsPersistInterval)
+	defer ticker.Stop()
 
-	var wg sync.WaitGroup
-	wg.Add(1)
+	// batches are processed in the order received to keep the order of events of each resource partition
+	// events of a failed batch stay pending in the tracker, so that they are watched again
+	batchCh := make(chan []*event.NodeEvent, eventBatchQueueSize)
+	processDone := make(chan struct{})
+	processFailed := make(chan struct{})
 	go func() {
-		defer wg.Done()
+		defer close(processDone)
+		isFailed := false
+		for batch := range batchCh {
+			if !a.processNodes(url, batch) {
+				if !isFailed {
+					isFailed = true
+					close(processFailed)
+				}
+				continue
+			}
+			for _, e := range batch {
+				tracker.done(getRvLocation(e), e.Node.GetResourceVersionInt64())
+			}
+		}
+	}()
+	isProcessFailed := false
+
+	func() {
 		defer utilruntime.HandleCrash()
+		batch := make([]*event.NodeEvent, 0, a.eventBatchSize)
+		// lingerCh is set once the first event of a batch is received
+		var lingerCh <-chan time.Time
+		flush := func() {
+			if len(batch) > 0 {
+				batchCh <- batch
+				batch = make([]*event.NodeEvent, 0, a.eventBatchSize)
+			}
+			lingerCh = nil
+		}
+
 		// retrieve updates from watcher
 		for {
 			select {
@@ -159,27 +375,277 @@ func (a *Aggregator) watchNodes(client RrmsInterface, crv types.TransitResourceV
 				if !ok {
 					// End of results.
 					klog.Infof("End of results")
+					flush()
 					return
 				}
 
+				if record.Type == event.Bookmark {
+					// bookmarks are sent on idle watches, the region manager is alive
+					a.recordRegionContact(url)
+					continue
+				}
+				now := time.Now()
+				if !a.isValidNodeEvent(url, &record, now) {
+					// the resource version of the invalid event is received, so that it is not taken as lost
+					if loc, rv, isOK := getInvalidEventRv(&record); isOK && continuity.check(loc, rv, now) == "" {
+						tracker.start(loc, rv)
+						tracker.done(loc, rv)
+					}
+					continue
+				}
 				klog.V(9).Infof("Got node event from region manager, nodeId: %v", record.Node.Id)
-
-				// TODO: refine this go routine to sub functions
-				// TODO: persists the CRV returned from processEvents() for re-watch
-				go func() {
-					a.processNode(&record)
-				}()
+				record.SetCheckpoint(int(metrics.Aggregator_Received))
+				a.recordRegionEvent(url, &record)
+				loc := getRvLocation(&record)
+				anomaly := continuity.check(loc, record.Node.GetResourceVersionInt64(), now)
+				if anomaly != "" {
+					recordRvAnomaly(url, loc, anomaly, 1)
+					if anomaly == RvAnomaly_Duplicate {
+						continue
+					}
+					relistLocs[loc] = true
+					if anomaly == RvAnomaly_Regression {
+						flush()
+						return
+					}
+				}
+				tracker.start(loc, record.Node.GetResourceVersionInt64())
+				batch = append(batch, &record)
+				if len(relistLocs) > 0 {
+					flush()
+					return
+				} else if len(batch) >= a.eventBatchSize {
+					flush()
+				} else if len(batch) == 1 {
+					lingerCh = time.After(a.eventBatchLinger)
+				}
+			case <-lingerCh:
+				flush()
+			case <-processFailed:
+				isProcessFailed = true
+				flush()
+				return
+			case <-ticker.C:
+				a.updateWatchCursors(url, tracker.get())
+				for loc, count := range continuity.getGaps(time.Now()) {
+					recordRvAnomaly(url, loc, RvAnomaly_Gap, count)
+					relistLocs[loc] = true
+				}
+				if len(relistLocs) > 0 {
+					flush()
+					return
+				}
+			case <-stopCh:
+				klog.Infof("Stop watching region manager %v", url)
+				flush()
+				return
 			}
 		}
 	}()
-	wg.Wait()
+	// wait for events being processed so the returned resource versions include them
+	close(batchCh)
+	<-processDone
+	crv = tracker.get()
+	a.updateWatchCursors(url, crv)
 	end = time.Now().UTC()
 	klog.V(3).Infof("Watch session last: %v", end.Sub(start))
-	return
+	if len(relistLocs) > 0 {
+		return crv, newPartitionsRelistError(relistLocs)
+	}
+	if isProcessFailed {
+		return crv, &processFailedError{message: fmt.Sprintf("failed to process node events from region manager %v", url)}
+	}
+	return crv, nil
 }
 
+// watchPartitions watches each resource partition of crv with its own watch until stopCh is closed,
+// or until resource versions of a partition expired, or events of a partition are lost and it failed to be listed again,
+// which is returned to list the region or the partition again
+// Watch of each partition is restarted with backoff independently when it ends or fails
+func (a *Aggregator) watchPartitions(client RrmsInterface, crv types.TransitResourceVersionMap, url string, stopCh <-chan struct{}) (types.TransitResourceVersionMap, error) {
+	partitionStopCh := make(chan struct{})
+	var stopOnce sync.Once
+	stopPartitions := func() { stopOnce.Do(func() { close(partitionStopCh) }) }
+	go func() {
+		select {
+		case <-stopCh:
+			stopPartitions()
+		case <-partitionStopCh:
+		}
+	}()
+
+	latestCrv := crv.Copy()
+	// returned for the region to list again, if resource versions expired or events are lost
+	var regionErr error
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for loc, rv := range crv {
+		wg.Add(1)
+		go func(loc types.RvLocation, partitionCrv types.TransitResourceVersionMap) {
+			defer wg.Done()
+			opts := WatchOptions{Partition: loc.Partition.GetPartitionName()}
+			backoff := initialRewatchBackoff
+			for {
+				start := time.Now()
+				var err error
+				partitionCrv, err = a.watchNodes(client, partitionCrv, url, opts, partitionStopCh)
+				lock.Lock()
+				latestCrv[loc] = partitionCrv[loc]
+				lock.Unlock()
+				if err != nil {
+					if errors.IsResourceVersionExpired(err) {
+						klog.Warningf("resource versions of partition %v expired at region manager %v", opts.Partition, url)
+						lock.Lock()
+						regionErr = err
+						lock.Unlock()
+						stopPartitions()
+						return
+					}
+					if relistErr, isOK := err.(*partitionsRelistError); isOK {
+						relistedCrv, listErr := a.relistPartitions(client, url, partitionCrv, relistErr.locs, partitionStopCh)
+						if listErr == nil {
+							partitionCrv = types.TransitResourceVersionMap{loc: relistedCrv[loc]}
+							continue
+						}
+						klog.Errorf("failed to list partition %v from region manager %v again. error %v", opts.Partition, url, listErr)
+						// the partition is listed again by the region
+						lock.Lock()
+						regionErr = relistErr
+						lock.Unlock()
+						stopPartitions()
+						return
+					}
+					klog.Errorf("failed to watch nodes of partition %v from region manager %v. error %v", opts.Partition, url, err)
+				}
+
+				if time.Since(start) > maxRewatchBackoff {
+					backoff = initialRewatchBackoff
+				}
+				klog.V(3).Infof("Watch nodes of partition %v again from region manager %v in %v", opts.Partition, url, backoff)
+				if !waitOrStop(backoff, partitionStopCh) {
+					return
+				}
+				backoff = nextBackoff(backoff)
+			}
+		}(loc, types.TransitResourceVersionMap{loc: rv})
+	}
+	wg.Wait()
+	stopPartitions()
+	return latestCrv, regionErr
+}
+
+// processNodes applies a batch of node events, so that persistence of the node store status is amortized
+// It returns false if the nodes are not durably applied, e.g. failed to be saved to store
 // TODO: lock this function if the distributor cannot handel concurrent node processing
-func (a *Aggregator) processNode(node *event.NodeEvent) {
-	node.SetCheckpoint(int(metrics.Aggregator_Received))
-	a.EventProcessor.ProcessEvents([]*event.NodeEvent{node})
+func (a *Aggregator) processNodes(url string, nodes []*event.NodeEvent) bool {
+	start := time.Now()
+	a.setProcessingSince(url, start)
+	defer a.setProcessingSince(url, time.Time{})
+	eventProcess, _ := a.EventProcessor.ProcessEvents(nodes)
+	klog.V(6).Infof("Event Processor Processed %d nodes results : %v. duration: %v", len(nodes), eventProcess, time.Since(start))
+	return eventProcess
+}
+
+func getRvLocation(e *event.NodeEvent) types.RvLocation {
+	return types.RvLocation{Region: location.Region(e.Node.GeoInfo.Region), Partition: location.ResourcePartition(e.Node.GeoInfo.ResourcePartition)}
+}
+
+// getWatchCursors returns the persisted resource versions of the region manager if the aggregator resumes from them
+func (a *Aggregator) getWatchCursors(url string) types.TransitResourceVersionMap {
+	if !a.resumeFromWatchCursors || a.persistHelper == nil {
+		return nil
+	}
+	cursors, err := a.persistHelper.GetWatchCursors(url)
+	if err != nil {
+		klog.Infof("No watch cursors to resume from for region manager %v, list nodes. error %v", url, err)
+		return nil
+	}
+	return cursors.ResourceVersions
+}
+
+// getLatestWatchCursors returns the latest resource versions processed from the region manager
+func (a *Aggregator) getLatestWatchCursors(url string) types.TransitResourceVersionMap {
+	a.cursorsLock.Lock()
+	defer a.cursorsLock.Unlock()
+	return a.watchCursors[url]
+}
+
+// updateWatchCursors records the resource versions of the region manager, and persists them if changed since last persisted
+// Resource partitions not in crv keep their resource versions, as partitions could be watched separately
+func (a *Aggregator) updateWatchCursors(url string, crv types.TransitResourceVersionMap) {
+	a.cursorsLock.Lock()
+	defer a.cursorsLock.Unlock()
+	merged := make(types.TransitResourceVersionMap, len(crv))
+	for loc, rv := range a.watchCursors[url] {
+		merged[loc] = rv
+	}
+	for loc, rv := range crv {
+		merged[loc] = rv
+	}
+	crv = merged
+	a.watchCursors[url] = crv
+	if a.persistHelper == nil {
+		return
+	}
+	if reflect.DeepEqual(a.persistedCursors[url], crv) {
+		return
+	}
+	if !a.persistHelper.PersistWatchCursors(&store.WatchCursors{RegionUrl: url, ResourceVersions: crv}) {
+		metrics.PersistenceFailures.Inc(metrics.PersistOperation_WatchCursors)
+		return
+	}
+	a.persistedCursors[url] = crv
+}
+
+// rvTracker keeps the resource version of each resource partition of the region that all events up to are processed
+type rvTracker struct {
+	rvs types.TransitResourceVersionMap
+	// resource versions of events being processed, to the number of events
+	pending map[types.RvLocation]map[uint64]int
+	lock    sync.Mutex
+}
+
+func newRvTracker(crv types.TransitResourceVersionMap) *rvTracker {
+	rvs := make(types.TransitResourceVersionMap, len(crv))
+	for loc, rv := range crv {
+		rvs[loc] = rv
+	}
+	return &rvTracker{rvs: rvs, pending: make(map[types.RvLocation]map[uint64]int)}
+}
+
+func (t *rvTracker) start(loc types.RvLocation, rv uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.pending[loc] == nil {
+		t.pending[loc] = make(map[uint64]int)
+	}
+	t.pending[loc][rv]++
+}
+
+func (t *rvTracker) done(loc types.RvLocation, rv uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.pending[loc][rv]--
+	if t.pending[loc][rv] == 0 {
+		delete(t.pending[loc], rv)
+	}
+	if rv > t.rvs[loc] {
+		t.rvs[loc] = rv
+	}
+}
+
+// get returns the resource versions below the oldest event still being processed of each resource partition
+func (t *rvTracker) get() types.TransitResourceVersionMap {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	rvs := make(types.TransitResourceVersionMap, len(t.rvs))
+	for loc, rv := range t.rvs {
+		for pendingRv := range t.pending[loc] {
+			if pendingRv > 0 && pendingRv <= rv {
+				rv = pendingRv - 1
+			}
+		}
+		rvs[loc] = rv
+	}
+	return rvs
 }
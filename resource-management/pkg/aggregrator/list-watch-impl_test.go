@@ -0,0 +1,423 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregrator
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"global-resource-service/resource-management/pkg/clientSdk/util/errors"
+	"global-resource-service/resource-management/pkg/clientSdk/watch"
+	distributor "global-resource-service/resource-management/pkg/common-lib/interfaces/distributor"
+	"global-resource-service/resource-management/pkg/common-lib/interfaces/store"
+	"global-resource-service/resource-management/pkg/common-lib/types"
+	"global-resource-service/resource-management/pkg/common-lib/types/location"
+	"global-resource-service/resource-management/pkg/common-lib/types/runtime"
+	"global-resource-service/resource-management/pkg/distributor/storage"
+)
+
+var beijingRP1 = types.RvLocation{Region: location.Beijing, Partition: location.ResourcePartition1}
+var shanghaiRP1 = types.RvLocation{Region: location.Shanghai, Partition: location.ResourcePartition1}
+
+// fakeEventProcessor returns the latest resource versions of all regions like the distributor
+type fakeEventProcessor struct {
+	distributor.Interface
+	rvs  types.TransitResourceVersionMap
+	lock sync.Mutex
+	// resource versions of events by processed batch
+	batches [][]uint64
+	// regions whose nodes are flagged stale, restored from stale or deleted
+	staleRegions    []location.Region
+	restoredRegions []location.Region
+	deletedRegions  []location.Region
+	// if set, deleting nodes of a region sends the region to deleteCalledCh and waits until deleteResumeCh is closed
+	deleteCalledCh chan location.Region
+	deleteResumeCh chan struct{}
+	// batches with the resource version fail to be processed
+	failedRv uint64
+}
+
+func (p *fakeEventProcessor) ProcessEvents(events []*runtime.NodeEvent) (bool, types.TransitResourceVersionMap) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	batch := make([]uint64, len(events))
+	p.batches = append(p.batches, batch)
+	for i, e := range events {
+		batch[i] = e.Node.GetResourceVersionInt64()
+		loc := types.RvLocation{Region: location.Region(e.Node.GeoInfo.Region), Partition: location.ResourcePartition(e.Node.GeoInfo.ResourcePartition)}
+		if rv := e.Node.GetResourceVersionInt64(); rv > p.rvs[loc] {
+			p.rvs[loc] = rv
+		}
+	}
+	rvs := make(types.TransitResourceVersionMap, len(p.rvs))
+	for loc, rv := range p.rvs {
+		rvs[loc] = rv
+	}
+	for _, rv := range batch {
+		if rv == p.failedRv {
+			return false, rvs
+		}
+	}
+	return true, rvs
+}
+
+type fakeWatcher chan runtime.NodeEvent
+
+func (w fakeWatcher) Stop() {}
+
+func (w fakeWatcher) ResultChan() <-chan runtime.NodeEvent {
+	return w
+}
+
+type watchResult struct {
+	events []*runtime.NodeEvent
+	err    error
+}
+
+// fakeRrmsClient returns the watch results in order, and records the resource versions of each list and watch call
+type fakeRrmsClient struct {
+	// returned by Watch if set
+	watcher      fakeWatcher
+	listRvs      types.TransitResourceVersionMap
+	watchResults []watchResult
+	listCount    int
+	watchedRvs   []types.TransitResourceVersionMap
+	calledCh     chan struct{}
+
+	// returned by Watch of the partition if set
+	partitionWatchers map[string]fakeWatcher
+	watchedPartitions []string
+	lock              sync.Mutex
+
+	// returned by List page by page if set, the continue token is the index of the next page
+	listPages   [][]*runtime.NodeEvent
+	listOptions []ListOptions
+	// returned by List in order before listing nodes
+	listErrors []error
+}
+
+func (c *fakeRrmsClient) List(opts ListOptions) ([][]*runtime.NodeEvent, types.TransitResourceVersionMap, uint64, string, error) {
+	c.listCount++
+	c.listOptions = append(c.listOptions, opts)
+	if len(c.listErrors) > 0 {
+		err := c.listErrors[0]
+		c.listErrors = c.listErrors[1:]
+		return nil, nil, 0, "", err
+	}
+	if c.listPages != nil {
+		page := 0
+		if opts.Continue != "" {
+			page, _ = strconv.Atoi(opts.Continue)
+		}
+		continueToken := ""
+		if page+1 < len(c.listPages) {
+			continueToken = strconv.Itoa(page + 1)
+		}
+		return [][]*runtime.NodeEvent{c.listPages[page]}, c.listRvs, uint64(len(c.listPages[page])), continueToken, nil
+	}
+	return [][]*runtime.NodeEvent{{newNodeEvent(beijingRP1, 1)}}, c.listRvs, 1, "", nil
+}
+
+func (c *fakeRrmsClient) Watch(rvs types.TransitResourceVersionMap, opts WatchOptions) (watch.Interface, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.watchedRvs = append(c.watchedRvs, rvs)
+	if opts.Partition != "" {
+		c.watchedPartitions = append(c.watchedPartitions, opts.Partition)
+		return c.partitionWatchers[opts.Partition], nil
+	}
+	if c.watcher != nil {
+		return c.watcher, nil
+	}
+	if len(c.watchedRvs) > len(c.watchResults) {
+		close(c.calledCh)
+		return nil, errors.NewStatusError(http.StatusServiceUnavailable, nil)
+	}
+	result := c.watchResults[len(c.watchedRvs)-1]
+	if result.err != nil {
+		return nil, result.err
+	}
+	w := make(fakeWatcher, len(result.events))
+	for _, e := range result.events {
+		w <- *e
+	}
+	close(w)
+	return w, nil
+}
+
+func newNodeEvent(loc types.RvLocation, rv uint64) *runtime.NodeEvent {
+	node := &types.LogicalNode{
+		Id:              strconv.FormatUint(rv, 10),
+		ResourceVersion: strconv.FormatUint(rv, 10),
+		GeoInfo:         types.NodeGeoInfo{Region: types.RegionName(loc.Region), ResourcePartition: types.ResourcePartitionName(loc.Partition)},
+		LastUpdatedTime: time.Now(),
+	}
+	return runtime.NewNodeEvent(node, runtime.Modified)
+}
+
+func newTestAggregator() *Aggregator {
+	processor := &fakeEventProcessor{rvs: types.TransitResourceVersionMap{shanghaiRP1: 100}}
+	return NewAggregator([]string{"region"}, processor, nil)
+}
+
+func runRegionUntilWatchResultsUsed(t *testing.T, a *Aggregator, client *fakeRrmsClient) {
+	client.calledCh = make(chan struct{})
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		a.runRegion(client, "region", a.getWatchCursors("region"), stopCh)
+		close(doneCh)
+	}()
+
+	select {
+	case <-client.calledCh:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for watch calls")
+	}
+	close(stopCh)
+	<-doneCh
+}
+
+func TestRunRegion_RewatchFromLatestResourceVersions(t *testing.T) {
+	client := &fakeRrmsClient{
+		listRvs: types.TransitResourceVersionMap{beijingRP1: 1},
+		watchResults: []watchResult{
+			{events: []*runtime.NodeEvent{newNodeEvent(beijingRP1, 5), newNodeEvent(beijingRP1, 3)}},
+		},
+	}
+	a := newTestAggregator()
+	runRegionUntilWatchResultsUsed(t, a, client)
+
+	assert.Equal(t, 1, client.listCount)
+	assert.True(t, a.GetInitialListStatus()["region"])
+	assert.Equal(t, 2, len(client.watchedRvs))
+	assert.Equal(t, types.TransitResourceVersionMap{beijingRP1: 1}, client.watchedRvs[0])
+	// resource versions of other regions are not watched from this region
+	assert.Equal(t, types.TransitResourceVersionMap{beijingRP1: 5}, client.watchedRvs[1])
+}
+
+func TestRunRegion_ListPages(t *testing.T) {
+	client := &fakeRrmsClient{
+		listRvs: types.TransitResourceVersionMap{beijingRP1: 3},
+		listPages: [][]*runtime.NodeEvent{
+			{newNodeEvent(beijingRP1, 1), newNodeEvent(beijingRP1, 2)},
+			{newNodeEvent(beijingRP1, 3)},
+		},
+		watchResults: []watchResult{
+			{events: []*runtime.NodeEvent{newNodeEvent(beijingRP1, 4)}},
+		},
+	}
+	a := newTestAggregator()
+	a.SetListPageSize(2)
+	runRegionUntilWatchResultsUsed(t, a, client)
+
+	// each page is processed as it is listed
+	assert.Equal(t, 2, client.listCount)
+	assert.Equal(t, []ListOptions{{Limit: 2}, {Limit: 2, Continue: "1"}}, client.listOptions)
+	assert.Equal(t, []uint64{1, 2}, a.EventProcessor.(*fakeEventProcessor).batches[0])
+	assert.Equal(t, []uint64{3}, a.EventProcessor.(*fakeEventProcessor).batches[1])
+	assert.True(t, a.GetInitialListStatus()["region"])
+	// watched from the resource versions of the list
+	assert.Equal(t, types.TransitResourceVersionMap{beijingRP1: 3}, client.watchedRvs[0])
+}
+
+func TestRunRegion_RelistOnExpiredResourceVersions(t *testing.T) {
+	client := &fakeRrmsClient{
+		listRvs: types.TransitResourceVersionMap{beijingRP1: 1},
+		watchResults: []watchResult{
+			{err: errors.NewStatusError(http.StatusGone, nil)},
+		},
+	}
+	runRegionUntilWatchResultsUsed(t, newTestAggregator(), client)
+
+	assert.Equal(t, 2, client.listCount)
+	assert.Equal(t, 2, len(client.watchedRvs))
+}
+
+func TestRunRegion_ResumeFromWatchCursors(t *testing.T) {
+	client := &fakeRrmsClient{
+		listRvs: types.TransitResourceVersionMap{beijingRP1: 8},
+		watchResults: []watchResult{
+			{events: []*runtime.NodeEvent{newNodeEvent(beijingRP1, 8)}},
+		},
+	}
+	cursorStore := &storage.FakeStorageInterface{}
+	cursorStore.PersistWatchCursors(&store.WatchCursors{RegionUrl: "region", ResourceVersions: types.TransitResourceVersionMap{beijingRP1: 7}})
+	a := newTestAggregator()
+	a.SetPersistHelper(cursorStore)
+	a.ResumeFromWatchCursors()
+	runRegionUntilWatchResultsUsed(t, a, client)
+
+	// only the resource versions of the region manager are listed to check the cursors
+	assert.Equal(t, []ListOptions{{Limit: 1}}, client.listOptions)
+	assert.True(t, a.GetInitialListStatus()["region"])
+	assert.Equal(t, types.TransitResourceVersionMap{beijingRP1: 7}, client.watchedRvs[0])
+	assert.Equal(t, types.TransitResourceVersionMap{beijingRP1: 8}, client.watchedRvs[1])
+
+	cursors, err := cursorStore.GetWatchCursors("region")
+	assert.Nil(t, err)
+	assert.Equal(t, types.TransitResourceVersionMap{beijingRP1: 8}, cursors.ResourceVersions)
+}
+
+func TestRunRegion_RelistOnWatchCursorsAheadOfRegion(t *testing.T) {
+	client := &fakeRrmsClient{
+		listRvs: types.TransitResourceVersionMap{beijingRP1: 3},
+		watchResults: []watchResult{
+			{events: []*runtime.NodeEvent{newNodeEvent(beijingRP1, 4)}},
+		},
+	}
+	cursorStore := &storage.FakeStorageInterface{}
+	cursorStore.PersistWatchCursors(&store.WatchCursors{RegionUrl: "region", ResourceVersions: types.TransitResourceVersionMap{beijingRP1: 7}})
+	a := newTestAggregator()
+	a.SetPersistHelper(cursorStore)
+	a.ResumeFromWatchCursors()
+	runRegionUntilWatchResultsUsed(t, a, client)
+
+	// the region manager was reset after the cursors were persisted, the region is listed again
+	assert.Equal(t, []ListOptions{{Limit: 1}, {Limit: DefaultListPageSize}}, client.listOptions)
+	assert.Equal(t, types.TransitResourceVersionMap{beijingRP1: 3}, client.watchedRvs[0])
+}
+
+func TestRvTracker(t *testing.T) {
+	tracker := newRvTracker(types.TransitResourceVersionMap{beijingRP1: 1})
+	tracker.start(beijingRP1, 5)
+	tracker.start(beijingRP1, 6)
+	tracker.start(shanghaiRP1, 3)
+	tracker.done(beijingRP1, 6)
+	// events before the one being processed are all processed
+	assert.Equal(t, types.TransitResourceVersionMap{beijingRP1: 4}, tracker.get())
+
+	tracker.done(beijingRP1, 5)
+	tracker.done(shanghaiRP1, 3)
+	assert.Equal(t, types.TransitResourceVersionMap{beijingRP1: 6, shanghaiRP1: 3}, tracker.get())
+}
+
+func (p *fakeEventProcessor) getBatches() [][]uint64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([][]uint64{}, p.batches...)
+}
+
+func TestWatchNodes_BatchEvents(t *testing.T) {
+	a := newTestAggregator()
+	a.SetEventBatching(2, time.Minute)
+	processor := a.EventProcessor.(*fakeEventProcessor)
+	client := &fakeRrmsClient{watcher: make(fakeWatcher, 10)}
+	watchDone := make(chan types.TransitResourceVersionMap)
+	go func() {
+		crv, err := a.watchNodes(client, types.TransitResourceVersionMap{beijingRP1: 1}, "region", WatchOptions{}, nil)
+		assert.Nil(t, err)
+		watchDone <- crv
+	}()
+
+	for rv := uint64(2); rv <= 4; rv++ {
+		client.watcher <- *newNodeEvent(beijingRP1, rv)
+	}
+	assert.Eventually(t, func() bool { return len(processor.getBatches()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, [][]uint64{{2, 3}}, processor.getBatches())
+
+	// the last batch not full is processed at the end of watch
+	close(client.watcher)
+	assert.Equal(t, types.TransitResourceVersionMap{beijingRP1: 4}, <-watchDone)
+	assert.Equal(t, [][]uint64{{2, 3}, {4}}, processor.getBatches())
+}
+
+func TestWatchNodes_BatchLinger(t *testing.T) {
+	a := newTestAggregator()
+	a.SetEventBatching(100, 100*time.Millisecond)
+	processor := a.EventProcessor.(*fakeEventProcessor)
+	client := &fakeRrmsClient{watcher: make(fakeWatcher, 10)}
+	watchDone := make(chan types.TransitResourceVersionMap)
+	go func() {
+		crv, _ := a.watchNodes(client, types.TransitResourceVersionMap{beijingRP1: 1}, "region", WatchOptions{}, nil)
+		watchDone <- crv
+	}()
+
+	client.watcher <- *newNodeEvent(beijingRP1, 2)
+	client.watcher <- *newNodeEvent(beijingRP1, 3)
+	assert.Eventually(t, func() bool { return len(processor.getBatches()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, [][]uint64{{2, 3}}, processor.getBatches())
+
+	close(client.watcher)
+	assert.Equal(t, types.TransitResourceVersionMap{beijingRP1: 3}, <-watchDone)
+}
+
+func TestWatchNodes_ProcessFailed(t *testing.T) {
+	a := newTestAggregator()
+	a.SetEventBatching(1, time.Minute)
+	cursorStore := &storage.FakeStorageInterface{}
+	a.SetPersistHelper(cursorStore)
+	processor := a.EventProcessor.(*fakeEventProcessor)
+	processor.failedRv = 3
+	client := &fakeRrmsClient{watcher: make(fakeWatcher, 10)}
+	for rv := uint64(2); rv <= 4; rv++ {
+		client.watcher <- *newNodeEvent(beijingRP1, rv)
+	}
+
+	// the watch ends at the failed batch, and is watched again from below it
+	crv, err := a.watchNodes(client, types.TransitResourceVersionMap{beijingRP1: 1}, "region", WatchOptions{}, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, types.TransitResourceVersionMap{beijingRP1: 2}, crv)
+	cursors, err := cursorStore.GetWatchCursors("region")
+	assert.Nil(t, err)
+	assert.Equal(t, types.TransitResourceVersionMap{beijingRP1: 2}, cursors.ResourceVersions)
+}
+
+func TestRunRegion_WatchByPartition(t *testing.T) {
+	beijingRP2 := types.RvLocation{Region: location.Beijing, Partition: location.ResourcePartition2}
+	a := newTestAggregator()
+	a.SetWatchByPartition(true)
+	a.SetEventBatching(1, time.Minute)
+	client := &fakeRrmsClient{
+		partitionWatchers: map[string]fakeWatcher{"RP1": make(fakeWatcher, 10), "RP2": make(fakeWatcher, 10)},
+		listRvs:           types.TransitResourceVersionMap{beijingRP1: 1, beijingRP2: 1},
+	}
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		a.runRegion(client, "region", types.TransitResourceVersionMap{beijingRP1: 1, beijingRP2: 1}, stopCh)
+		close(doneCh)
+	}()
+
+	// events of a partition are processed without waiting for other partitions
+	client.partitionWatchers["RP2"] <- *newNodeEvent(beijingRP2, 2)
+	client.partitionWatchers["RP2"] <- *newNodeEvent(beijingRP2, 3)
+	assert.Eventually(t, func() bool {
+		return a.getLatestWatchCursors("region")[beijingRP2] == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	client.partitionWatchers["RP1"] <- *newNodeEvent(beijingRP1, 2)
+	assert.Eventually(t, func() bool {
+		return a.getLatestWatchCursors("region")[beijingRP1] == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	close(stopCh)
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for partition watches to stop")
+	}
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	assert.ElementsMatch(t, []string{"RP1", "RP2"}, client.watchedPartitions)
+	assert.ElementsMatch(t, []types.TransitResourceVersionMap{{beijingRP1: 1}, {beijingRP2: 1}}, client.watchedRvs)
+	assert.Equal(t, types.TransitResourceVersionMap{beijingRP1: 2, beijingRP2: 3}, a.getLatestWatchCursors("region"))
+}
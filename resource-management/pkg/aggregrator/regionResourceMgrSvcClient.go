@@ -19,8 +19,8 @@ limitations under the License.
 package aggregrator
 
 import (
+	"crypto/tls"
 	"encoding/json"
-	"net/http"
 	"strconv"
 	"time"
 
@@ -41,17 +41,29 @@ const ResourceName = "resources"
 type Config struct {
 	ServiceUrl     string
 	RequestTimeout time.Duration
+	// optional, connect with HTTPS if set. See tlsconfig.NewClientTLSConfig for CA pinning
+	TLSConfig *tls.Config
 }
 
 // ListOptions contains optional settings for List nodes
 type ListOptions struct {
-	// Limit is equivalent to URL query parameter ?limit=500
+	// Limit is equivalent to URL query parameter ?limit=500, all nodes are listed if not positive
 	Limit int
+	// Continue is the token returned with the previous page to list the next page
+	Continue string
+	// Partition is equivalent to URL query parameter ?partition=RP1, all partitions of the region are listed if empty
+	Partition string
+}
+
+// WatchOptions contains optional settings for Watch nodes
+type WatchOptions struct {
+	// Partition is equivalent to URL query parameter ?partition=RP1, all partitions of the region are watched if empty
+	Partition string
 }
 
 type RrmsInterface interface {
-	List(ListOptions) ([][]*runtime.NodeEvent, types.TransitResourceVersionMap, uint64, error)
-	Watch(types.TransitResourceVersionMap) (watch.Interface, error)
+	List(ListOptions) ([][]*runtime.NodeEvent, types.TransitResourceVersionMap, uint64, string, error)
+	Watch(types.TransitResourceVersionMap, WatchOptions) (watch.Interface, error)
 }
 
 // RrmsClient implements Region Resource Mgr Service's L/W Interface
@@ -63,15 +75,15 @@ type RrmsClient struct {
 
 // NewRrmsClient returns a reference to the RrmsClient object
 func NewRrmsClient(cfg Config) *RrmsClient {
-	httpclient := http.Client{Timeout: cfg.RequestTimeout}
-	url, err := rest.DefaultServerURL(cfg.ServiceUrl, "", false)
+	httpclient := rest.NewHTTPClient(cfg.RequestTimeout, cfg.TLSConfig)
+	url, err := rest.DefaultServerURL(cfg.ServiceUrl, "", cfg.TLSConfig != nil)
 
 	if err != nil {
 		klog.Errorf("failed to get the default URL. error %v", err)
 		return nil
 	}
 
-	c, err := rest.NewRESTClient(url, rest.ClientContentConfig{}, nil, &httpclient)
+	c, err := rest.NewRESTClient(url, rest.ClientContentConfig{}, nil, httpclient)
 	if err != nil {
 		klog.Errorf("failed to get the RESTClient. error %v", err)
 		return nil
@@ -84,33 +96,49 @@ func NewRrmsClient(cfg Config) *RrmsClient {
 }
 
 // List takes label and field selectors, and returns the list of Nodes that match those selectors.
-func (c *RrmsClient) List(opts ListOptions) ([][]*runtime.NodeEvent, types.TransitResourceVersionMap, uint64, error) {
+// If opts.Limit is set, a page of nodes is returned with the continue token of the next page, which is empty at the last page.
+// The resource versions returned with every page are the ones at the first page
+func (c *RrmsClient) List(opts ListOptions) ([][]*runtime.NodeEvent, types.TransitResourceVersionMap, uint64, string, error) {
 	req := c.restClient.Get()
 	req = req.Resource(ResourceName)
 	req = req.Timeout(c.config.RequestTimeout)
-	req = req.Param("limit", strconv.Itoa(opts.Limit))
+	if opts.Limit > 0 {
+		req = req.Param(ep.ListLimitParameter, strconv.Itoa(opts.Limit))
+	}
+	if opts.Continue != "" {
+		req = req.Param(ep.ListContinueParameter, opts.Continue)
+	}
+	if opts.Partition != "" {
+		req = req.Param(ep.ResourcePartitionParameter, opts.Partition)
+	}
 
 	respRet, err := req.DoRaw()
 	if err != nil {
-		return nil, nil, 0, err
+		return nil, nil, 0, "", err
 	}
 
 	resp := simulatorTypes.ResponseFromRRM{}
 
 	err = json.Unmarshal(respRet, &resp)
+	if err != nil {
+		return nil, nil, 0, "", err
+	}
 
 	actualCrv := resp.RvMap
 
-	return resp.RegionNodeEvents, actualCrv, resp.Length, nil
+	return resp.RegionNodeEvents, actualCrv, resp.Length, resp.Continue, nil
 
 }
 
 // Watch returns a watch.Interface that watches the requested RrmsClient.
-func (c *RrmsClient) Watch(versionMap types.TransitResourceVersionMap) (watch.Interface, error) {
+func (c *RrmsClient) Watch(versionMap types.TransitResourceVersionMap, opts WatchOptions) (watch.Interface, error) {
 	req := c.restClient.Post()
 	req = req.Resource(ResourceName)
 	req = req.Timeout(c.config.RequestTimeout)
 	req = req.Param(ep.WatchParameter, ep.WatchParameterTrue)
+	if opts.Partition != "" {
+		req = req.Param(ep.ResourcePartitionParameter, opts.Partition)
+	}
 
 	crv := apiTypes.WatchRequest{ResourceVersions: versionMap}
 
@@ -0,0 +1,287 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregrator
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"global-resource-service/resource-management/pkg/common-lib/metrics"
+	"global-resource-service/resource-management/pkg/common-lib/types"
+	"global-resource-service/resource-management/pkg/common-lib/types/location"
+	apiTypes "global-resource-service/resource-management/pkg/service-api/types"
+)
+
+// regionRunner is the list-watch of a region manager
+type regionRunner struct {
+	stopCh chan struct{}
+	// closed once the list-watch exits
+	doneCh chan struct{}
+}
+
+// AddRegion adds a region manager and list-watches its nodes if the aggregator is running
+func (a *Aggregator) AddRegion(regionUrl string) error {
+	if !isValidRegionUrl(regionUrl) {
+		return types.Error_InvalidRegionManagerUrl
+	}
+
+	a.regionsLock.Lock()
+	defer a.regionsLock.Unlock()
+	if a.indexOfRegion(regionUrl) >= 0 {
+		return types.Error_RegionManagerExisted
+	}
+	a.urls = append(a.urls, regionUrl)
+	// the list-watch of a region manager being removed is started once its removal finishes
+	if a.isRunning && a.removingRegions[regionUrl] == 0 {
+		// nodes could have been changed or removed since the region manager was last watched
+		a.startRegion(regionUrl, nil)
+	}
+	klog.Infof("Added region manager %v", regionUrl)
+	return nil
+}
+
+// RemoveRegion stops list-watching the region manager, then keeps, flags stale or deletes the nodes of its regions
+// Nodes are changed asynchronously once events of the region manager being processed are done
+// If the region manager is added again meanwhile, nodes not yet changed are kept, and it is list-watched once its
+// nodes are no longer changed
+func (a *Aggregator) RemoveRegion(regionUrl string, nodeAction string) error {
+	if !isValidRegionNodeAction(nodeAction) {
+		return types.Error_InvalidRegionNodeAction
+	}
+
+	a.regionsLock.Lock()
+	defer a.regionsLock.Unlock()
+	i := a.indexOfRegion(regionUrl)
+	if i < 0 {
+		return types.Error_RegionManagerNotFound
+	}
+	a.urls = append(a.urls[:i], a.urls[i+1:]...)
+	runner := a.stopRegion(regionUrl)
+	a.removingRegions[regionUrl]++
+
+	go func() {
+		defer a.finishRemoval(regionUrl)
+		if runner != nil {
+			<-runner.doneCh
+		}
+		// the region manager could be added again meanwhile, its nodes are then left to its list-watch
+		if a.isRegionAdded(regionUrl) {
+			klog.Infof("Region manager %v added again, nodes of its regions are kept", regionUrl)
+			return
+		}
+		regions := getRegionsOfCursors(a.getLatestWatchCursors(regionUrl))
+		// the health of the region manager is removed by cleanup, so stale flags are checked before
+		isStale := a.isRegionStale(regionUrl)
+		a.cleanupRegion(regionUrl)
+		a.applyRegionNodeAction(regionUrl, regions, nodeAction, isStale)
+	}()
+	klog.Infof("Removed region manager %v, nodes of its regions are %v", regionUrl, nodeAction)
+	return nil
+}
+
+// ReplaceRegion replaces the region manager with the one of newUrl, e.g. a standby of the same regions
+// The new region manager is watched from the latest resource versions of the replaced one,
+// and listed if the resource versions are not known or expired at the new region manager
+func (a *Aggregator) ReplaceRegion(regionUrl string, newUrl string) error {
+	if !isValidRegionUrl(newUrl) {
+		return types.Error_InvalidRegionManagerUrl
+	}
+
+	a.regionsLock.Lock()
+	defer a.regionsLock.Unlock()
+	i := a.indexOfRegion(regionUrl)
+	if i < 0 {
+		return types.Error_RegionManagerNotFound
+	}
+	if a.indexOfRegion(newUrl) >= 0 {
+		return types.Error_RegionManagerExisted
+	}
+	a.urls[i] = newUrl
+	runner := a.stopRegion(regionUrl)
+	a.removingRegions[regionUrl]++
+	// nodes flagged stale are restored once the new region manager is contacted
+	a.moveRegionHealth(regionUrl, newUrl)
+	if a.isRunning && a.removingRegions[newUrl] == 0 {
+		a.startRegion(newUrl, a.getLatestWatchCursors(regionUrl))
+	}
+
+	go func() {
+		defer a.finishRemoval(regionUrl)
+		if runner != nil {
+			<-runner.doneCh
+		}
+		if !a.isRegionAdded(regionUrl) {
+			a.cleanupRegion(regionUrl)
+		}
+	}()
+	klog.Infof("Replaced region manager %v with %v", regionUrl, newUrl)
+	return nil
+}
+
+// startRegion list-watches the region manager from crv, or lists it first if crv is nil
+// It must be called with regionsLock held
+func (a *Aggregator) startRegion(regionUrl string, crv types.TransitResourceVersionMap) {
+	runner := &regionRunner{stopCh: make(chan struct{}), doneCh: make(chan struct{})}
+	a.regionRunners[regionUrl] = runner
+
+	go func() {
+		defer close(runner.doneCh)
+		klog.V(3).Infof("Starting goroutine for region: %v", regionUrl)
+		defer klog.V(3).Infof("Exiting goroutine for region: %v", regionUrl)
+
+		// create client to resource region manager
+		c := NewRrmsClient(Config{ServiceUrl: regionUrl, RequestTimeout: 30 * time.Minute, TLSConfig: a.tlsConfig})
+		if c == nil {
+			klog.Errorf("failed to create client to region manager %v", regionUrl)
+			return
+		}
+
+		a.runRegion(c, regionUrl, crv, runner.stopCh)
+	}()
+}
+
+// stopRegion signals the list-watch of the region manager to stop, and returns it if started
+// It must be called with regionsLock held
+func (a *Aggregator) stopRegion(regionUrl string) *regionRunner {
+	runner, isOK := a.regionRunners[regionUrl]
+	if !isOK {
+		return nil
+	}
+	delete(a.regionRunners, regionUrl)
+	close(runner.stopCh)
+	return runner
+}
+
+// isRegionAdded returns whether the region manager url is list-watched, e.g. added again after being removed
+func (a *Aggregator) isRegionAdded(regionUrl string) bool {
+	a.regionsLock.RLock()
+	defer a.regionsLock.RUnlock()
+	return a.indexOfRegion(regionUrl) >= 0
+}
+
+// finishRemoval releases the removal claim of the region manager, and starts its list-watch if it was added again
+// while being removed
+func (a *Aggregator) finishRemoval(regionUrl string) {
+	a.regionsLock.Lock()
+	defer a.regionsLock.Unlock()
+	a.removingRegions[regionUrl]--
+	if a.removingRegions[regionUrl] > 0 {
+		return
+	}
+	delete(a.removingRegions, regionUrl)
+	if a.isRunning && a.indexOfRegion(regionUrl) >= 0 {
+		if _, isOK := a.regionRunners[regionUrl]; !isOK {
+			a.startRegion(regionUrl, nil)
+		}
+	}
+}
+
+// cleanupRegion removes the list status and latest cursors of the region manager
+// Persisted cursors are deleted too, so that the region manager is listed if it is added back after restart
+// It must be called while the region manager is claimed for removal, so that it is not list-watched meanwhile
+func (a *Aggregator) cleanupRegion(regionUrl string) {
+	a.listLock.Lock()
+	delete(a.listedUrls, regionUrl)
+	a.listLock.Unlock()
+
+	a.cursorsLock.Lock()
+	delete(a.watchCursors, regionUrl)
+	delete(a.persistedCursors, regionUrl)
+	if a.persistHelper != nil {
+		if err := a.persistHelper.DeleteWatchCursors(regionUrl); err != nil {
+			klog.Errorf("Failed to delete watch cursors of region manager %v from store. error %v", regionUrl, err)
+			metrics.PersistenceFailures.Inc(metrics.PersistOperation_DeleteWatchCursors)
+		}
+	}
+	a.cursorsLock.Unlock()
+
+	a.healthLock.Lock()
+	delete(a.regionHealths, regionUrl)
+	a.healthLock.Unlock()
+}
+
+// applyRegionNodeAction changes the nodes of the regions one region after another, nodes of the remaining regions
+// are kept once the region manager is added again
+// Kept nodes flagged stale by the stale detector are restored, as the detector no longer checks the removed region manager
+func (a *Aggregator) applyRegionNodeAction(regionUrl string, regions []location.Region, nodeAction string, isStale bool) {
+	for _, region := range regions {
+		if a.isRegionAdded(regionUrl) {
+			klog.Infof("Region manager %v added again, nodes of region %v and the regions after it are kept", regionUrl, region.String())
+			return
+		}
+		switch nodeAction {
+		case apiTypes.RegionNodeAction_Keep:
+			if isStale {
+				count := a.EventProcessor.SetRegionNodesStale(region, false)
+				klog.Infof("Restored %d stale nodes of region %v, region manager %v removed with nodes kept", count, region.String(), regionUrl)
+			}
+		case apiTypes.RegionNodeAction_Stale:
+			count := a.EventProcessor.SetRegionNodesStale(region, true)
+			klog.Infof("Flagged %d nodes of region %v stale, region manager %v removed", count, region.String(), regionUrl)
+		case apiTypes.RegionNodeAction_Delete:
+			count := a.EventProcessor.DeleteRegionNodes(region)
+			klog.Infof("Deleted %d nodes of region %v, region manager %v removed", count, region.String(), regionUrl)
+		}
+	}
+}
+
+// indexOfRegion returns the index of the region manager url, -1 if not found
+func (a *Aggregator) indexOfRegion(regionUrl string) int {
+	for i, u := range a.urls {
+		if u == regionUrl {
+			return i
+		}
+	}
+	return -1
+}
+
+// getRegionsOfCursors returns the regions the resource versions are of
+func getRegionsOfCursors(crv types.TransitResourceVersionMap) []location.Region {
+	regions := make([]location.Region, 0)
+	found := make(map[location.Region]bool)
+	for loc := range crv {
+		if !found[loc.Region] {
+			found[loc.Region] = true
+			regions = append(regions, loc.Region)
+		}
+	}
+	return regions
+}
+
+// isValidRegionUrl returns whether the url is a host:port, with or without http(s) scheme
+func isValidRegionUrl(regionUrl string) bool {
+	if regionUrl == "" || strings.ContainsAny(regionUrl, " \t\n") {
+		return false
+	}
+	if !strings.HasPrefix(regionUrl, "http://") && !strings.HasPrefix(regionUrl, "https://") {
+		regionUrl = httpPrefix + regionUrl
+	}
+	u, err := url.Parse(regionUrl)
+	return err == nil && u.Host != ""
+}
+
+func isValidRegionNodeAction(nodeAction string) bool {
+	switch nodeAction {
+	case apiTypes.RegionNodeAction_Keep, apiTypes.RegionNodeAction_Stale, apiTypes.RegionNodeAction_Delete:
+		return true
+	default:
+		return false
+	}
+}
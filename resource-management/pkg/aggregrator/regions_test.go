@@ -0,0 +1,225 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregrator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"global-resource-service/resource-management/pkg/common-lib/types"
+	"global-resource-service/resource-management/pkg/common-lib/types/location"
+	"global-resource-service/resource-management/pkg/distributor/storage"
+	apiTypes "global-resource-service/resource-management/pkg/service-api/types"
+)
+
+func (p *fakeEventProcessor) SetRegionNodesStale(region location.Region, isStale bool) int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if isStale {
+		p.staleRegions = append(p.staleRegions, region)
+	} else {
+		p.restoredRegions = append(p.restoredRegions, region)
+	}
+	return 1
+}
+
+func (p *fakeEventProcessor) DeleteRegionNodes(region location.Region) int {
+	if p.deleteCalledCh != nil {
+		p.deleteCalledCh <- region
+		<-p.deleteResumeCh
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.deletedRegions = append(p.deletedRegions, region)
+	return 1
+}
+
+func (p *fakeEventProcessor) getRegionActions() ([]location.Region, []location.Region) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]location.Region{}, p.staleRegions...), append([]location.Region{}, p.deletedRegions...)
+}
+
+func TestAddReplaceRemoveRegion(t *testing.T) {
+	a := newTestAggregator()
+
+	assert.Equal(t, types.Error_InvalidRegionManagerUrl, a.AddRegion(""))
+	assert.Equal(t, types.Error_RegionManagerExisted, a.AddRegion("region"))
+	assert.Nil(t, a.AddRegion("127.0.0.1:9119"))
+	assert.Equal(t, []string{"region", "127.0.0.1:9119"}, a.GetRegionUrls())
+
+	assert.Equal(t, types.Error_RegionManagerNotFound, a.ReplaceRegion("unknown", "127.0.0.1:9120"))
+	assert.Equal(t, types.Error_RegionManagerExisted, a.ReplaceRegion("region", "127.0.0.1:9119"))
+	assert.Nil(t, a.ReplaceRegion("region", "https://127.0.0.1:9120"))
+	assert.Equal(t, []string{"https://127.0.0.1:9120", "127.0.0.1:9119"}, a.GetRegionUrls())
+
+	assert.Equal(t, types.Error_InvalidRegionNodeAction, a.RemoveRegion("127.0.0.1:9119", "unknown"))
+	assert.Equal(t, types.Error_RegionManagerNotFound, a.RemoveRegion("region", apiTypes.RegionNodeAction_Keep))
+	assert.Nil(t, a.RemoveRegion("127.0.0.1:9119", apiTypes.RegionNodeAction_Keep))
+	assert.Equal(t, map[string]bool{"https://127.0.0.1:9120": false}, a.GetInitialListStatus())
+}
+
+func TestRemoveRegion_NodeActions(t *testing.T) {
+	a := newTestAggregator()
+	processor := a.EventProcessor.(*fakeEventProcessor)
+	cursorStore := &storage.FakeStorageInterface{}
+	a.SetPersistHelper(cursorStore)
+	a.updateWatchCursors("region", types.TransitResourceVersionMap{beijingRP1: 5, shanghaiRP1: 3})
+	a.setInitialListDone("region")
+	assert.Nil(t, a.AddRegion("127.0.0.1:9119"))
+	a.updateWatchCursors("127.0.0.1:9119", types.TransitResourceVersionMap{shanghaiRP1: 3})
+
+	assert.Nil(t, a.RemoveRegion("region", apiTypes.RegionNodeAction_Stale))
+	assert.Eventually(t, func() bool {
+		stale, _ := processor.getRegionActions()
+		return len(stale) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	stale, deleted := processor.getRegionActions()
+	assert.ElementsMatch(t, []location.Region{location.Beijing, location.Shanghai}, stale)
+	assert.Empty(t, deleted)
+	assert.Nil(t, a.getLatestWatchCursors("region"))
+	_, err := cursorStore.GetWatchCursors("region")
+	assert.Equal(t, types.Error_ObjectNotFound, err)
+	assert.Equal(t, map[string]bool{"127.0.0.1:9119": false}, a.GetInitialListStatus())
+
+	assert.Nil(t, a.RemoveRegion("127.0.0.1:9119", apiTypes.RegionNodeAction_Delete))
+	assert.Eventually(t, func() bool {
+		_, deleted := processor.getRegionActions()
+		return len(deleted) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	_, deleted = processor.getRegionActions()
+	assert.Equal(t, []location.Region{location.Shanghai}, deleted)
+}
+
+func TestRemoveRegion_KeepStaleNodes(t *testing.T) {
+	a := newTestAggregator()
+	a.SetStaleRegionThreshold(time.Minute)
+	processor := a.EventProcessor.(*fakeEventProcessor)
+	a.updateWatchCursors("region", types.TransitResourceVersionMap{beijingRP1: 5})
+	a.setRegionState("region", apiTypes.RegionManagerState_Backoff)
+	a.detectStaleRegions(time.Now().Add(2 * time.Minute))
+	stale, _ := processor.getRegionActions()
+	assert.Equal(t, []location.Region{location.Beijing}, stale)
+
+	// kept nodes flagged stale are restored, nothing clears the flags after the region manager is removed
+	assert.Nil(t, a.RemoveRegion("region", apiTypes.RegionNodeAction_Keep))
+	assert.Eventually(t, func() bool {
+		return len(processor.getRestoredRegions()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []location.Region{location.Beijing}, processor.getRestoredRegions())
+	stale, deleted := processor.getRegionActions()
+	assert.Equal(t, 1, len(stale))
+	assert.Empty(t, deleted)
+}
+
+func TestRemoveRegion_AddedAgain(t *testing.T) {
+	a := newTestAggregator()
+	processor := a.EventProcessor.(*fakeEventProcessor)
+	a.updateWatchCursors("region", types.TransitResourceVersionMap{beijingRP1: 5})
+	a.setInitialListDone("region")
+	// the list-watch of the region manager is still processing events when it is removed
+	runner := &regionRunner{stopCh: make(chan struct{}), doneCh: make(chan struct{})}
+	a.regionRunners["region"] = runner
+
+	assert.Nil(t, a.RemoveRegion("region", apiTypes.RegionNodeAction_Delete))
+	assert.Nil(t, a.AddRegion("region"))
+	close(runner.doneCh)
+
+	assert.Never(t, func() bool {
+		stale, deleted := processor.getRegionActions()
+		return len(stale) > 0 || len(deleted) > 0
+	}, 500*time.Millisecond, 10*time.Millisecond)
+	assert.Equal(t, types.TransitResourceVersionMap{beijingRP1: 5}, a.getLatestWatchCursors("region"))
+	assert.Equal(t, map[string]bool{"region": true}, a.GetInitialListStatus())
+}
+
+func TestRemoveRegion_AddedAgainWhileDeleting(t *testing.T) {
+	a := newTestAggregator()
+	processor := a.EventProcessor.(*fakeEventProcessor)
+	processor.deleteCalledCh = make(chan location.Region)
+	processor.deleteResumeCh = make(chan struct{})
+	a.updateWatchCursors("region", types.TransitResourceVersionMap{beijingRP1: 5, shanghaiRP1: 3})
+
+	assert.Nil(t, a.RemoveRegion("region", apiTypes.RegionNodeAction_Delete))
+	var deletingRegion location.Region
+	select {
+	case deletingRegion = <-processor.deleteCalledCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for nodes of the removed region manager being deleted")
+	}
+
+	// region managers can be read and changed while nodes are being deleted
+	doneCh := make(chan struct{})
+	go func() {
+		assert.Empty(t, a.GetRegionUrls())
+		assert.Nil(t, a.AddRegion("region"))
+		close(doneCh)
+	}()
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for region manager added while nodes are being deleted")
+	}
+	a.regionsLock.RLock()
+	assert.Equal(t, 1, a.removingRegions["region"])
+	a.regionsLock.RUnlock()
+
+	// nodes of the regions after the one being deleted are kept
+	close(processor.deleteResumeCh)
+	assert.Never(t, func() bool {
+		select {
+		case <-processor.deleteCalledCh:
+			return true
+		default:
+			return false
+		}
+	}, 500*time.Millisecond, 10*time.Millisecond)
+	_, deleted := processor.getRegionActions()
+	assert.Equal(t, []location.Region{deletingRegion}, deleted)
+	a.regionsLock.RLock()
+	defer a.regionsLock.RUnlock()
+	assert.Empty(t, a.removingRegions)
+}
+
+func TestRunRegion_StopWatch(t *testing.T) {
+	a := newTestAggregator()
+	client := &fakeRrmsClient{watcher: make(fakeWatcher, 10), listRvs: types.TransitResourceVersionMap{beijingRP1: 1}}
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		a.runRegion(client, "region", types.TransitResourceVersionMap{beijingRP1: 1}, stopCh)
+		close(doneCh)
+	}()
+
+	client.watcher <- *newNodeEvent(beijingRP1, 2)
+	assert.Eventually(t, func() bool {
+		return a.getLatestWatchCursors("region")[beijingRP1] == 1 && len(a.EventProcessor.(*fakeEventProcessor).getBatches()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the watch stream is left open, stop ends the watch and the list-watch loop
+	close(stopCh)
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for region list-watch to stop")
+	}
+	assert.Equal(t, types.TransitResourceVersionMap{beijingRP1: 2}, a.getLatestWatchCursors("region"))
+	// not listed again, other than to check the resource versions watched from
+	assert.Equal(t, []ListOptions{{Limit: 1}}, client.listOptions)
+}
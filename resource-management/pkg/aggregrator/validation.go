@@ -0,0 +1,122 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregrator
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"global-resource-service/resource-management/pkg/common-lib/metrics"
+	"global-resource-service/resource-management/pkg/common-lib/types"
+	"global-resource-service/resource-management/pkg/common-lib/types/location"
+	event "global-resource-service/resource-management/pkg/common-lib/types/runtime"
+)
+
+// deadLetterWriter appends invalid node events to a local file, one JSON object per line
+type deadLetterWriter struct {
+	file    *os.File
+	encoder *json.Encoder
+	lock    sync.Mutex
+}
+
+// deadLetter is the record of an invalid node event in the dead letter file
+type deadLetter struct {
+	Time   time.Time        `json:"time"`
+	Url    string           `json:"url"`
+	Reason string           `json:"reason"`
+	Error  string           `json:"error"`
+	Event  *event.NodeEvent `json:"event"`
+}
+
+// SetDeadLetterFile sets the file to append invalid node events to, the file is created if not exists
+func (a *Aggregator) SetDeadLetterFile(path string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	a.deadLetters = &deadLetterWriter{file: file, encoder: json.NewEncoder(file)}
+	return nil
+}
+
+func (w *deadLetterWriter) write(record *deadLetter) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.encoder.Encode(record)
+}
+
+// isValidNodeEvent returns true if the node event is valid, otherwise quarantines it
+func (a *Aggregator) isValidNodeEvent(url string, e *event.NodeEvent, now time.Time) bool {
+	err := e.Validate(now)
+	if err == nil {
+		return true
+	}
+	a.quarantineNodeEvent(url, e, err, now)
+	return false
+}
+
+// getInvalidEventRv returns the resource partition and resource version of the invalid node event if they are valid
+func getInvalidEventRv(e *event.NodeEvent) (types.RvLocation, uint64, bool) {
+	if e.Node == nil {
+		return types.RvLocation{}, 0, false
+	}
+	rv, err := strconv.ParseUint(e.Node.ResourceVersion, 10, 64)
+	if err != nil || rv == 0 {
+		return types.RvLocation{}, 0, false
+	}
+	loc := getRvLocation(e)
+	if !location.NewLocation(loc.Region, loc.Partition).IsValid() {
+		return types.RvLocation{}, 0, false
+	}
+	return loc, rv, true
+}
+
+// filterValidNodeEvents returns the valid node events, bookmark events are skipped and invalid ones are quarantined
+func (a *Aggregator) filterValidNodeEvents(url string, events []*event.NodeEvent) []*event.NodeEvent {
+	now := time.Now()
+	validEvents := events[:0]
+	for _, e := range events {
+		if e != nil && e.Type != event.Bookmark && a.isValidNodeEvent(url, e, now) {
+			validEvents = append(validEvents, e)
+		}
+	}
+	return validEvents
+}
+
+// quarantineNodeEvent counts the invalid node event by reason, and appends it to the dead letter file if set,
+// so that it is not processed into the node store
+func (a *Aggregator) quarantineNodeEvent(url string, e *event.NodeEvent, err error, now time.Time) {
+	reason := types.NodeInvalidReason_Event
+	var validationErr *types.NodeValidationError
+	if errors.As(err, &validationErr) {
+		reason = validationErr.Reason
+	}
+	metrics.QuarantinedNodeEvents.Inc(url, reason)
+	klog.Warningf("Quarantined invalid node event from region manager %v. error %v", url, err)
+
+	if a.deadLetters == nil {
+		return
+	}
+	if err := a.deadLetters.write(&deadLetter{Time: now, Url: url, Reason: reason, Error: err.Error(), Event: e}); err != nil {
+		klog.Errorf("Failed to write invalid node event to dead letter file. error %v", err)
+	}
+}
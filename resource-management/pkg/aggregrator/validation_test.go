@@ -0,0 +1,118 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregrator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"global-resource-service/resource-management/pkg/common-lib/metrics"
+	"global-resource-service/resource-management/pkg/common-lib/types"
+	"global-resource-service/resource-management/pkg/common-lib/types/runtime"
+)
+
+func TestFilterValidNodeEvents_Quarantine(t *testing.T) {
+	a := newTestAggregator()
+	path := filepath.Join(t.TempDir(), "deadletters.json")
+	assert.Nil(t, a.SetDeadLetterFile(path))
+
+	noId := newNodeEvent(beijingRP1, 2)
+	noId.Node.Id = ""
+	badRv := newNodeEvent(beijingRP1, 3)
+	badRv.Node.ResourceVersion = "abc"
+	bookmark := newNodeEvent(beijingRP1, 4)
+	bookmark.Type = runtime.Bookmark
+	valid := newNodeEvent(beijingRP1, 5)
+
+	// bookmark events are skipped without being quarantined
+	events := a.filterValidNodeEvents("region", []*runtime.NodeEvent{newNodeEvent(beijingRP1, 1), noId, badRv, bookmark, valid})
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "1", events[0].Node.Id)
+	assert.Equal(t, "5", events[1].Node.Id)
+
+	// invalid events are dumped to the dead letter file
+	file, err := os.Open(path)
+	assert.Nil(t, err)
+	defer file.Close()
+	reasons := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		record := deadLetter{}
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &record))
+		assert.Equal(t, "region", record.Url)
+		assert.NotNil(t, record.Event.Node)
+		reasons = append(reasons, record.Reason)
+	}
+	assert.Equal(t, []string{types.NodeInvalidReason_Id, types.NodeInvalidReason_ResourceVersion}, reasons)
+
+	registry := metrics.NewRegistry()
+	registry.Register(metrics.QuarantinedNodeEvents)
+	var buf bytes.Buffer
+	assert.Nil(t, registry.WriteText(&buf))
+	assert.True(t, strings.Contains(buf.String(), `grs_quarantined_node_events_total{url="region",reason="resource_version"}`))
+}
+
+func TestWatchNodes_DiscardInvalidEvents(t *testing.T) {
+	a := newTestAggregator()
+	invalid := newNodeEvent(beijingRP1, 2)
+	invalid.Node.AllocatableResource.MilliCPU = -1
+	bookmark := newNodeEvent(beijingRP1, 3)
+	bookmark.Type = runtime.Bookmark
+	lastInvalid := newNodeEvent(beijingRP1, 4)
+	lastInvalid.Node.LastUpdatedTime = time.Time{}
+	w := make(fakeWatcher, 4)
+	w <- *invalid
+	w <- *newNodeEvent(beijingRP1, 3)
+	w <- *bookmark
+	w <- *lastInvalid
+	close(w)
+	client := &fakeRrmsClient{watcher: w}
+
+	// resource versions of invalid events are received, they are not lost events nor watched again
+	crv, err := a.watchNodes(client, types.TransitResourceVersionMap{beijingRP1: 1}, "region", WatchOptions{}, make(chan struct{}))
+	assert.Nil(t, err)
+	assert.Equal(t, types.TransitResourceVersionMap{beijingRP1: 4}, crv)
+	assert.Equal(t, [][]uint64{{3}}, a.EventProcessor.(*fakeEventProcessor).batches)
+}
+
+func TestGetInvalidEventRv(t *testing.T) {
+	loc, rv, isOK := getInvalidEventRv(newNodeEvent(beijingRP1, 2))
+	assert.True(t, isOK)
+	assert.Equal(t, beijingRP1, loc)
+	assert.Equal(t, uint64(2), rv)
+
+	badRv := newNodeEvent(beijingRP1, 2)
+	badRv.Node.ResourceVersion = "abc"
+	_, _, isOK = getInvalidEventRv(badRv)
+	assert.False(t, isOK)
+
+	badGeoInfo := newNodeEvent(beijingRP1, 2)
+	badGeoInfo.Node.GeoInfo.Region = 1000
+	_, _, isOK = getInvalidEventRv(badGeoInfo)
+	assert.False(t, isOK)
+
+	_, _, isOK = getInvalidEventRv(&runtime.NodeEvent{Type: runtime.Added})
+	assert.False(t, isOK)
+}
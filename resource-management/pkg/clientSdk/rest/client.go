@@ -18,9 +18,11 @@ limitations under the License.
 package rest
 
 import (
+	"crypto/tls"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"global-resource-service/resource-management/pkg/clientSdk/util/flowcontrol"
 )
@@ -70,6 +72,18 @@ type RESTClient struct {
 	Client *http.Client
 }
 
+// NewHTTPClient returns a http client with the request timeout. The client uses HTTPS with
+// the tlsConfig if it is not nil.
+func NewHTTPClient(timeout time.Duration, tlsConfig *tls.Config) *http.Client {
+	client := &http.Client{Timeout: timeout}
+	if tlsConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		client.Transport = transport
+	}
+	return client
+}
+
 // NewRESTClient creates a new RESTClient. This client performs generic REST functions
 // such as Get, Put, Post, and Delete on specified paths.
 func NewRESTClient(baseURL *url.URL, config ClientContentConfig, rateLimiter flowcontrol.RateLimiter, client *http.Client) (*RESTClient, error) {
@@ -299,6 +299,9 @@ func (r *Request) URL() *url.URL {
 	if len(r.resourceName) != 0 {
 		p = path.Join(p, r.resourceName)
 	}
+	if len(r.subpath) != 0 {
+		p = path.Join(p, r.subpath)
+	}
 
 	finalURL := &url.URL{}
 	if r.c.base != nil {
@@ -554,6 +557,7 @@ func (r *Request) doRequest(fn func(*http.Request, *http.Response)) error {
 }
 
 // DoRaw executes the request but does not process the response body.
+// A non-2xx response is returned as errors.StatusError decoded from the body.
 func (r *Request) DoRaw() ([]byte, error) {
 	if err := r.tryThrottle(); err != nil {
 		return nil, err
@@ -563,6 +567,9 @@ func (r *Request) DoRaw() ([]byte, error) {
 	err := r.doRequest(func(req *http.Request, resp *http.Response) {
 		result.body, result.err = ioutil.ReadAll(resp.Body)
 		glogBody("Response Body", result.body)
+		if result.err == nil && (resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices) {
+			result.err = errors.NewStatusError(resp.StatusCode, result.body)
+		}
 		result.decoder = json.NewDecoder(resp.Body)
 	})
 	if err != nil {
@@ -581,7 +588,7 @@ func (r *Request) transformResponse(resp *http.Response, req *http.Request) Resu
 			body = data
 		default:
 			klog.Errorf("Unexpected error when reading response body: %v", err)
-			unexpectedErr := fmt.Errorf("Unexpected error when reading response body. Please retry. Original error: %v", err)
+			unexpectedErr := fmt.Errorf("Unexpected error when reading response body. Please retry. Original error: %w", err)
 			return Result{
 				err: unexpectedErr,
 			}
@@ -597,9 +604,15 @@ func (r *Request) transformResponse(resp *http.Response, req *http.Request) Resu
 		contentType = r.c.content.ContentType
 	}
 
+	var err error
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		err = errors.NewStatusError(resp.StatusCode, body)
+	}
+
 	return Result{
 		body:        body,
 		contentType: contentType,
+		err:         err,
 		statusCode:  resp.StatusCode,
 		decoder:     decoder,
 	}
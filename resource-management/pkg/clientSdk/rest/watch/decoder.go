@@ -31,6 +31,8 @@ import (
 // decoded by the embedded decoder.
 type Decoder struct {
 	decoder *json.Decoder
+	// trace context of the event last decoded
+	trace *runtime.TraceContext
 }
 
 // NewDecoder creates an Decoder for the given writer and codec.
@@ -43,6 +45,7 @@ func NewDecoder(decoder *json.Decoder) *Decoder {
 // Decode blocks until it can return the next object in the reader. Returns an error
 // if the reader is closed or an object can't be decoded.
 func (d *Decoder) Decode() (runtime.EventType, *types.LogicalNode, error) {
+	d.trace = nil
 	var got runtime.NodeEvent
 	err := d.decoder.Decode(&got)
 	if err != nil {
@@ -55,9 +58,15 @@ func (d *Decoder) Decode() (runtime.EventType, *types.LogicalNode, error) {
 		return "", nil, fmt.Errorf("got invalid watch event type: %v", got.Type)
 	}
 
+	d.trace = got.Trace
 	return got.Type, got.Node, nil
 }
 
+// Trace returns the trace context of the event last decoded, nil if the event is not traced.
+func (d *Decoder) Trace() *runtime.TraceContext {
+	return d.trace
+}
+
 // Close closes the underlying r.
 func (d *Decoder) Close() {
 	return
@@ -21,8 +21,8 @@ limitations under the License.
 package rmsclient
 
 import (
+	"crypto/tls"
 	"encoding/json"
-	"net/http"
 	"strconv"
 	"time"
 
@@ -43,6 +43,12 @@ type Config struct {
 	RegionIdToWatch             string
 	InitialRequestTotalMachines int
 	InitialRequestRegions       []string
+	// optional, retries of Register with the same key get the same client id and allocation
+	IdempotencyKey string
+	// optional, admin bearer token for Register when the service has authentication enabled
+	AdminToken string
+	// optional, connect with HTTPS if set. See tlsconfig.NewClientTLSConfig for CA pinning
+	TLSConfig *tls.Config
 }
 
 // ListOptions contains optional settings for List nodes
@@ -55,6 +61,8 @@ type ListOptions struct {
 // below are just 630 related interface definitions
 type RmsInterface interface {
 	Register() (*apiTypes.ClientRegistrationResponse, error)
+	RenewLease(string) (*apiTypes.ClientLeaseResponse, error)
+	Heartbeat(string, time.Duration, <-chan struct{})
 	List(string, ListOptions) ([]*types.LogicalNode, types.TransitResourceVersionMap, error)
 	Watch(string, types.TransitResourceVersionMap) (watch.Interface, error)
 	Query(string, string, string) (*types.LogicalNode, error)
@@ -67,19 +75,21 @@ type rmsClient struct {
 	restClient rest.Interface
 	// ClientId to be set by the Register to the RMS service
 	Id string
+	// bearer token bound to the client id, set by the Register when the service has authentication enabled
+	Token string
 }
 
 // NewRmsClient returns a refence to the rsmClient object
 func NewRmsClient(cfg Config) *rmsClient {
-	httpclient := http.Client{Timeout: cfg.RequestTimeout}
-	url, err := rest.DefaultServerURL(cfg.ServiceUrl, "", false)
+	httpclient := rest.NewHTTPClient(cfg.RequestTimeout, cfg.TLSConfig)
+	url, err := rest.DefaultServerURL(cfg.ServiceUrl, "", cfg.TLSConfig != nil)
 
 	if err != nil {
 		klog.Errorf("failed to get the default URL. error %v", err)
 		return nil
 	}
 
-	c, err := rest.NewRESTClient(url, rest.ClientContentConfig{}, nil, &httpclient)
+	c, err := rest.NewRESTClient(url, rest.ClientContentConfig{}, nil, httpclient)
 	if err != nil {
 		klog.Errorf("failed to get the RESTClient. error %v", err)
 		return nil
@@ -102,6 +112,7 @@ func (c *rmsClient) Register() (*apiTypes.ClientRegistrationResponse, error) {
 		InitialRequestedResource: types.ResourceRequest{
 			TotalMachines:    c.config.InitialRequestTotalMachines,
 			RequestInRegions: nil},
+		IdempotencyKey: c.config.IdempotencyKey,
 	}
 
 	body, err := json.Marshal(cq)
@@ -113,6 +124,7 @@ func (c *rmsClient) Register() (*apiTypes.ClientRegistrationResponse, error) {
 	req = req.Body(body)
 	req = req.Resource("clients")
 	req = req.Timeout(c.config.RequestTimeout)
+	req = setBearerToken(req, c.config.AdminToken)
 
 	resp, err := req.DoRaw()
 
@@ -126,10 +138,54 @@ func (c *rmsClient) Register() (*apiTypes.ClientRegistrationResponse, error) {
 	if err != nil {
 		return nil, err
 	}
+	c.Token = ret.Token
 
 	return &ret, nil
 }
 
+// RenewLease extends the registration lease of the client
+// List and Watch also renew the lease implicitly
+func (c *rmsClient) RenewLease(clientId string) (*apiTypes.ClientLeaseResponse, error) {
+	req := c.restClient.Put()
+	req = req.Resource("clients")
+	req = req.Name(clientId)
+	req = req.Suffix("lease")
+	req = req.Timeout(c.config.RequestTimeout)
+	req = setBearerToken(req, c.Token)
+
+	respRet, err := req.DoRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := apiTypes.ClientLeaseResponse{}
+
+	err = json.Unmarshal(respRet, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// Heartbeat renews the client lease with given interval until stopCh is closed
+// The interval is expected to be shorter than the lease duration returned from Register
+func (c *rmsClient) Heartbeat(clientId string, interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if _, err := c.RenewLease(clientId); err != nil {
+				klog.Errorf("failed to renew lease for client %s. error %v", clientId, err)
+			}
+		}
+	}
+}
+
 // List takes label and field selectors, and returns the list of Nodes that match those selectors.
 func (c *rmsClient) List(clientId string, opts ListOptions) ([]*types.LogicalNode, types.TransitResourceVersionMap, error) {
 	req := c.restClient.Get()
@@ -137,6 +193,7 @@ func (c *rmsClient) List(clientId string, opts ListOptions) ([]*types.LogicalNod
 	req = req.Name(c.Id)
 	req = req.Timeout(c.config.RequestTimeout)
 	req = req.Param("limit", strconv.Itoa(opts.Limit))
+	req = setBearerToken(req, c.Token)
 
 	respRet, err := req.DoRaw()
 	if err != nil {
@@ -164,6 +221,7 @@ func (c *rmsClient) Watch(clientId string, versionMap types.TransitResourceVersi
 	req = req.Name(c.Id)
 	req = req.Timeout(c.config.RequestTimeout)
 	req = req.Param("watch", "true")
+	req = setBearerToken(req, c.Token)
 
 	crv := apiTypes.WatchRequest{ResourceVersions: versionMap}
 
@@ -190,6 +248,7 @@ func (c *rmsClient) Query(nodeId string, regionName string, rpName string) (*typ
 	req = req.Param("nodeId", nodeId)
 	req = req.Param("region", regionName)
 	req = req.Param("resourcePartition", rpName)
+	req = setBearerToken(req, c.Token)
 
 	respRet, err := req.DoRaw()
 	if err != nil {
@@ -209,3 +268,11 @@ func (c *rmsClient) Query(nodeId string, regionName string, rpName string) (*typ
 	return &respNode, nil
 
 }
+
+// setBearerToken sets the authorization header if token is not empty
+func setBearerToken(req *rest.Request, token string) *rest.Request {
+	if token == "" {
+		return req
+	}
+	return req.SetHeader("Authorization", "Bearer "+token)
+}
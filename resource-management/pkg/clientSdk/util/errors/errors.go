@@ -18,9 +18,191 @@ limitations under the License.
 package errors
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+
 	"global-resource-service/resource-management/pkg/common-lib/types"
+	apiTypes "global-resource-service/resource-management/pkg/service-api/types"
+)
+
+// StatusError is the error of a service API call that failed with a non 2xx http status code
+// ErrStatus is decoded from the error response body
+type StatusError struct {
+	StatusCode int
+	ErrStatus  apiTypes.ErrorResponse
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s (http status %d): %s", e.ErrStatus.Code, e.StatusCode, e.ErrStatus.Message)
+}
+
+// NewStatusError returns the error of a failed response. If the response body is not an error response,
+// for example from a server of older version, the error code is derived from the http status code.
+func NewStatusError(statusCode int, body []byte) *StatusError {
+	e := &StatusError{StatusCode: statusCode}
+	if err := json.Unmarshal(body, &e.ErrStatus); err != nil || e.ErrStatus.Code == "" {
+		e.ErrStatus = apiTypes.ErrorResponse{
+			Code:      codeForStatus(statusCode),
+			Message:   string(body),
+			Retryable: statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError,
+		}
+	}
+	return e
+}
+
+func codeForStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return apiTypes.ErrCode_BadRequest
+	case http.StatusUnauthorized:
+		return apiTypes.ErrCode_Unauthorized
+	case http.StatusForbidden:
+		return apiTypes.ErrCode_Forbidden
+	case http.StatusNotFound:
+		return apiTypes.ErrCode_NotFound
+	case http.StatusMethodNotAllowed:
+		return apiTypes.ErrCode_MethodNotAllowed
+	case http.StatusNotImplemented:
+		return apiTypes.ErrCode_NotImplemented
+	case http.StatusGone:
+		return apiTypes.ErrCode_ResourceVersionExpired
+	default:
+		return apiTypes.ErrCode_InternalError
+	}
+}
+
+// asStatusError returns the StatusError in the chain of err, so that errors wrapped with %w are classified too
+func asStatusError(err error) (*StatusError, bool) {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se, true
+	}
+	return nil, false
+}
+
+// ReasonForError returns the error code of a StatusError, or empty string for other errors
+func ReasonForError(err error) string {
+	if e, isOK := asStatusError(err); isOK {
+		return e.ErrStatus.Code
+	}
+	return ""
+}
+
+// IsRetryable returns true if the same request could succeed later
+func IsRetryable(err error) bool {
+	if e, isOK := asStatusError(err); isOK {
+		return e.ErrStatus.Retryable
+	}
+	return false
+}
+
+// IsNotFound returns true if the requested object, or the client, does not exist
+func IsNotFound(err error) bool {
+	if e, isOK := asStatusError(err); isOK {
+		return e.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+// IsClientNotRegistered returns true if the client is not registered, or its lease expired
+func IsClientNotRegistered(err error) bool {
+	return ReasonForError(err) == apiTypes.ErrCode_ClientNotRegistered
+}
+
+// IsConflict returns true if the request conflicts with the current state, for example registration with
+// an idempotency key already used with a different resource request
+func IsConflict(err error) bool {
+	if e, isOK := asStatusError(err); isOK {
+		return e.StatusCode == http.StatusConflict
+	}
+	return false
+}
+
+// IsCapacityExceeded returns true if there are not enough free hosts for the request
+func IsCapacityExceeded(err error) bool {
+	return ReasonForError(err) == apiTypes.ErrCode_HostRequestExceedCapacity
+}
+
+// IsBadRequest returns true if the request is invalid and should not be retried without change
+func IsBadRequest(err error) bool {
+	if e, isOK := asStatusError(err); isOK {
+		return e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity
+	}
+	return false
+}
+
+// IsUnauthorized returns true if the request has no valid credentials, or is not permitted with them
+func IsUnauthorized(err error) bool {
+	if e, isOK := asStatusError(err); isOK {
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	}
+	return false
+}
+
+// Classes of errors, see ClassifyError
+const (
+	// the same request could succeed later
+	ErrorClass_Retryable = "retryable"
+	// credentials need to be fixed
+	ErrorClass_Auth = "auth"
+	// the requested object, or the service path, does not exist
+	ErrorClass_NotFound = "not_found"
+	// the request is invalid or not supported by the server
+	ErrorClass_BadRequest = "bad_request"
 )
 
+// ClassifyError returns the class of the error to decide whether to retry the request
+// Errors without http status code are retryable only if they are network errors or timeouts, for example connection refused,
+// or the response is cut off. Others, for example invalid url or response failed to be decoded, are bad request
+func ClassifyError(err error) string {
+	e, isOK := asStatusError(err)
+	if !isOK {
+		if isTransientError(err) {
+			return ErrorClass_Retryable
+		}
+		return ErrorClass_BadRequest
+	}
+	switch {
+	case IsUnauthorized(err):
+		return ErrorClass_Auth
+	case IsNotFound(err):
+		return ErrorClass_NotFound
+	case e.ErrStatus.Retryable:
+		return ErrorClass_Retryable
+	default:
+		return ErrorClass_BadRequest
+	}
+}
+
+// isTransientError returns true if the request failed in the network and could succeed later
+func isTransientError(err error) bool {
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	// url.Error implements net.Error, whether it is transient depends on the underlying error
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if urlErr.Timeout() || errors.Is(urlErr.Err, io.EOF) {
+			return true
+		}
+		return isTransientError(urlErr.Err)
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// IsResourceVersionExpired returns true if the watch started from resource versions no longer kept by the server,
+// the caller needs to list again and watch from the listed resource versions
+func IsResourceVersionExpired(err error) bool {
+	return ReasonForError(err) == apiTypes.ErrCode_ResourceVersionExpired
+}
+
 // ErrorReporter converts generic errors into runtime.Object errors without
 // requiring the caller to take a dependency on meta/v1 (where Status lives).
 // This prevents circular dependencies in core watch code.
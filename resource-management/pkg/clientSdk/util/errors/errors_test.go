@@ -0,0 +1,138 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package errors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	apiTypes "global-resource-service/resource-management/pkg/service-api/types"
+)
+
+func TestNewStatusError(t *testing.T) {
+	errResp := apiTypes.ErrorResponse{Code: apiTypes.ErrCode_HostRequestExceedCapacity, Message: "Requested hosts exceeds capacity", Retryable: true}
+	body, err := json.Marshal(errResp)
+	assert.Nil(t, err)
+
+	err = NewStatusError(http.StatusConflict, body)
+	assert.Equal(t, apiTypes.ErrCode_HostRequestExceedCapacity, ReasonForError(err))
+	assert.True(t, IsCapacityExceeded(err))
+	assert.True(t, IsConflict(err))
+	assert.True(t, IsRetryable(err))
+	assert.False(t, IsNotFound(err))
+	assert.False(t, IsBadRequest(err))
+
+	errResp = apiTypes.ErrorResponse{Code: apiTypes.ErrCode_ClientNotRegistered, Message: "Client not registered"}
+	body, err = json.Marshal(errResp)
+	assert.Nil(t, err)
+
+	err = NewStatusError(http.StatusNotFound, body)
+	assert.True(t, IsNotFound(err))
+	assert.True(t, IsClientNotRegistered(err))
+	assert.False(t, IsRetryable(err))
+}
+
+func TestNewStatusError_NoErrorResponse(t *testing.T) {
+	err := NewStatusError(http.StatusServiceUnavailable, []byte("service unavailable"))
+	assert.Equal(t, apiTypes.ErrCode_InternalError, ReasonForError(err))
+	assert.True(t, IsRetryable(err))
+	assert.Equal(t, "service unavailable", err.ErrStatus.Message)
+
+	err = NewStatusError(http.StatusBadRequest, nil)
+	assert.True(t, IsBadRequest(err))
+	assert.False(t, IsRetryable(err))
+
+	// region manager reports expired resource versions with the http status code only
+	err = NewStatusError(http.StatusGone, nil)
+	assert.True(t, IsResourceVersionExpired(err))
+	assert.False(t, IsRetryable(err))
+
+	assert.Equal(t, "", ReasonForError(fmt.Errorf("connection refused")))
+	assert.False(t, IsRetryable(fmt.Errorf("connection refused")))
+}
+
+func TestStatusError_Wrapped(t *testing.T) {
+	expired := fmt.Errorf("watch region manager: %w", NewStatusError(http.StatusGone, nil))
+	assert.True(t, IsResourceVersionExpired(expired))
+	assert.Equal(t, apiTypes.ErrCode_ResourceVersionExpired, ReasonForError(expired))
+	assert.Equal(t, ErrorClass_BadRequest, ClassifyError(expired))
+
+	unauthorized := fmt.Errorf("list nodes: %w", NewStatusError(http.StatusUnauthorized, nil))
+	assert.True(t, IsUnauthorized(unauthorized))
+	assert.Equal(t, ErrorClass_Auth, ClassifyError(unauthorized))
+
+	notFound := fmt.Errorf("get node: %w", NewStatusError(http.StatusNotFound, nil))
+	assert.True(t, IsNotFound(notFound))
+	assert.Equal(t, ErrorClass_NotFound, ClassifyError(notFound))
+
+	unavailable := fmt.Errorf("list nodes: %w", NewStatusError(http.StatusServiceUnavailable, nil))
+	assert.True(t, IsRetryable(unavailable))
+	assert.Equal(t, ErrorClass_Retryable, ClassifyError(unavailable))
+
+	conflict := fmt.Errorf("register client: %w", NewStatusError(http.StatusConflict, nil))
+	assert.True(t, IsConflict(conflict))
+	badRequest := fmt.Errorf("register client: %w", NewStatusError(http.StatusBadRequest, nil))
+	assert.True(t, IsBadRequest(badRequest))
+}
+
+func TestClassifyError(t *testing.T) {
+	// network errors
+	connRefused := &url.Error{Op: "Get", URL: "http://localhost:9119/resources", Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}
+	assert.Equal(t, ErrorClass_Retryable, ClassifyError(connRefused))
+	assert.Equal(t, ErrorClass_Retryable, ClassifyError(fmt.Errorf("list nodes: %w", connRefused)))
+	assert.Equal(t, ErrorClass_Retryable, ClassifyError(&url.Error{Op: "Get", URL: "http://localhost:9119/resources", Err: io.EOF}))
+	assert.Equal(t, ErrorClass_Retryable, ClassifyError(context.DeadlineExceeded))
+	assert.Equal(t, ErrorClass_Retryable, ClassifyError(io.ErrUnexpectedEOF))
+	// response cut off
+	var resp apiTypes.ErrorResponse
+	assert.Equal(t, ErrorClass_Retryable, ClassifyError(json.NewDecoder(strings.NewReader(`{"code": `)).Decode(&resp)))
+
+	// permanent errors without http status code
+	_, err := url.Parse("http://localhost:9119/%zz")
+	assert.Equal(t, ErrorClass_BadRequest, ClassifyError(err))
+	var nodes []apiTypes.ErrorResponse
+	err = json.Unmarshal([]byte(`{"node_list": 1}`), &nodes)
+	assert.NotNil(t, err)
+	assert.Equal(t, ErrorClass_BadRequest, ClassifyError(err))
+	assert.Equal(t, ErrorClass_BadRequest, ClassifyError(json.NewDecoder(strings.NewReader("not json")).Decode(&nodes)))
+	assert.Equal(t, ErrorClass_BadRequest, ClassifyError(fmt.Errorf("invalid resource version")))
+
+	assert.Equal(t, ErrorClass_Retryable, ClassifyError(NewStatusError(http.StatusServiceUnavailable, nil)))
+	assert.Equal(t, ErrorClass_Retryable, ClassifyError(NewStatusError(http.StatusTooManyRequests, nil)))
+	assert.Equal(t, ErrorClass_Auth, ClassifyError(NewStatusError(http.StatusUnauthorized, nil)))
+	assert.Equal(t, ErrorClass_Auth, ClassifyError(NewStatusError(http.StatusForbidden, nil)))
+	assert.Equal(t, ErrorClass_NotFound, ClassifyError(NewStatusError(http.StatusNotFound, nil)))
+	assert.Equal(t, ErrorClass_BadRequest, ClassifyError(NewStatusError(http.StatusBadRequest, nil)))
+	assert.Equal(t, ErrorClass_BadRequest, ClassifyError(NewStatusError(http.StatusMethodNotAllowed, nil)))
+
+	// error response of the service
+	body, err := json.Marshal(apiTypes.ErrorResponse{Code: apiTypes.ErrCode_TokenExpired, Message: "Bearer token expired"})
+	assert.Nil(t, err)
+	err = NewStatusError(http.StatusUnauthorized, body)
+	assert.True(t, IsUnauthorized(err))
+	assert.Equal(t, ErrorClass_Auth, ClassifyError(err))
+}
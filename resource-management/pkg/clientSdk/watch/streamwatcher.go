@@ -43,6 +43,15 @@ type Decoder interface {
 	Close()
 }
 
+// TraceDecoder is a Decoder of streams whose events can be traced.
+// StreamWatcher carries the trace context of each decoded event in the event it sends down the result channel.
+type TraceDecoder interface {
+	Decoder
+
+	// Trace returns the trace context of the event last decoded, nil if the event is not traced.
+	Trace() *runtime.TraceContext
+}
+
 // Reporter hides the details of how an error is turned into a runtime.Object for
 // reporting on a watch stream since this package may not import a higher level report.
 type Reporter interface {
@@ -126,9 +135,13 @@ func (sw *StreamWatcher) receive() {
 			}
 			return
 		}
-		sw.result <- runtime.NodeEvent{
+		event := runtime.NodeEvent{
 			Type: action,
 			Node: obj,
 		}
+		if traceDecoder, isOK := sw.source.(TraceDecoder); isOK {
+			event.Trace = traceDecoder.Trace()
+		}
+		sw.result <- event
 	}
 }
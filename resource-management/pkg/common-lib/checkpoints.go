@@ -0,0 +1,67 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common_lib
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Registry of checkpoints that events are stamped with when passing a stage of the service.
+// Components register checkpoints at init, events carry a time vector indexed by the registered checkpoints.
+
+type checkpointInfo struct {
+	name       string
+	isRequired bool
+}
+
+var checkpoints []checkpointInfo
+var checkpointLock sync.RWMutex
+
+// RegisterCheckpoint registers a checkpoint by unique name and returns its index in the checkpoint vector of events.
+// Required checkpoints are expected to be stamped on every event sent to clients.
+// It is supposed to be called at init, before any event is created.
+func RegisterCheckpoint(name string, isRequired bool) int {
+	checkpointLock.Lock()
+	defer checkpointLock.Unlock()
+	for _, c := range checkpoints {
+		if c.name == name {
+			panic(fmt.Sprintf("checkpoint %s is already registered", name))
+		}
+	}
+	checkpoints = append(checkpoints, checkpointInfo{name: name, isRequired: isRequired})
+	return len(checkpoints) - 1
+}
+
+// GetCheckpointNum returns the number of registered checkpoints, i.e. the length of checkpoint vector of events
+func GetCheckpointNum() int {
+	checkpointLock.RLock()
+	defer checkpointLock.RUnlock()
+	return len(checkpoints)
+}
+
+func GetCheckpointName(checkpoint int) string {
+	checkpointLock.RLock()
+	defer checkpointLock.RUnlock()
+	return checkpoints[checkpoint].name
+}
+
+func IsCheckpointRequired(checkpoint int) bool {
+	checkpointLock.RLock()
+	defer checkpointLock.RUnlock()
+	return checkpoints[checkpoint].isRequired
+}
@@ -16,8 +16,4 @@ limitations under the License.
 
 package common_lib
 
-const (
-	Len_ResourceManagementCheckpoint = 6
-)
-
 var ResourceManagementMeasurement_Enabled = true
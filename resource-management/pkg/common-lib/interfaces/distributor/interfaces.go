@@ -17,6 +17,8 @@ limitations under the License.
 package distributor
 
 import (
+	"time"
+
 	"global-resource-service/resource-management/pkg/common-lib/types"
 	"global-resource-service/resource-management/pkg/common-lib/types/location"
 	"global-resource-service/resource-management/pkg/common-lib/types/runtime"
@@ -24,10 +26,18 @@ import (
 
 type Interface interface {
 	RegisterClient(*types.Client) error
+	RenewClientLease(clientId string) error
+	GetClientLeaseDuration() time.Duration
+	GetClientLeaseGeneration(clientId string) (int64, error)
 
 	ListNodesForClient(clientId string) ([]*types.LogicalNode, types.TransitResourceVersionMap, error)
 	Watch(clientId string, rvs types.TransitResourceVersionMap, watchChan chan runtime.Object, stopCh chan struct{}) error
 	ProcessEvents(events []*runtime.NodeEvent) (bool, types.TransitResourceVersionMap)
+	// For nodes of region managers removed or not reachable
+	SetRegionNodesStale(region location.Region, isStale bool) int
+	DeleteRegionNodes(region location.Region) int
 
 	GetNodeStatus(region location.Region, resourcePartition location.ResourcePartition, nodeId string) (*types.LogicalNode, error)
+
+	GetCapacity() *types.CapacitySummary
 }
@@ -25,6 +25,7 @@ const (
 	Preserve_VirtualNodesAssignments_KeyPrefix = "VirtualNodesAssignments"
 	Preserve_NodeStoreStatus_KeyPrefix         = "NodeStoreStatus"
 	Preserve_Client_KeyPrefix                  = "Client"
+	Preserve_WatchCursors_KeyPrefix            = "WatchCursors"
 )
 
 type StoreInterface interface {
@@ -39,6 +40,20 @@ type StoreInterface interface {
 	GetClients() ([]*types.Client, error)
 	// UpdateClient will be used with client Add/remove resources
 	UpdateClient(string, *types.Client) error
+	// DeleteClient will be used when client lease expires
+	DeleteClient(string) error
+
+	// Get all nodes, during distributor restart
+	GetNodes() []*types.LogicalNode
+	// DeleteNodes will be used when nodes of a removed region are deleted
+	DeleteNodes([]*types.LogicalNode) bool
+
+	// Interfaces for watch cursors of region managers, aggregator resumes watch from them after restart
+	PersistWatchCursors(*WatchCursors) bool
+	// GetWatchCursors returns Error_ObjectNotFound if cursors of the region are not persisted
+	GetWatchCursors(regionUrl string) (*WatchCursors, error)
+	// DeleteWatchCursors will be used when the region manager is removed
+	DeleteWatchCursors(regionUrl string) error
 
 	// For fake storage test only, no need to implement
 	InitNodeIdCache()
@@ -53,8 +68,11 @@ type NodeStoreStatus struct {
 	// # of max resource partition in each region
 	PartitionMaxNum int
 
-	// virutal node number per resource partition
-	VirtualNodeNumPerRP int
+	// target host number per virtual node, virtual nodes are split or merged around it
+	HostsPerVirtualNode int
+
+	// total virtual node number of all resource partitions
+	VirtualNodeNum int
 
 	// Latest resource version map
 	CurrentResourceVerions types.TransitResourceVersionMap
@@ -64,6 +82,21 @@ func (nsStatus *NodeStoreStatus) GetKey() string {
 	return Preserve_NodeStoreStatus_KeyPrefix
 }
 
+// WatchCursors are the latest resource versions of each resource partition of a region manager
+// whose node events are applied to the node store and persisted
+type WatchCursors struct {
+	RegionUrl        string
+	ResourceVersions types.TransitResourceVersionMap
+}
+
+func (cursors *WatchCursors) GetKey() string {
+	return GetWatchCursorsKey(cursors.RegionUrl)
+}
+
+func GetWatchCursorsKey(regionUrl string) string {
+	return Preserve_WatchCursors_KeyPrefix + "." + regionUrl
+}
+
 type VirtualNodeAssignment struct {
 	ClientId     string
 	VirtualNodes []*VirtualNodeConfig
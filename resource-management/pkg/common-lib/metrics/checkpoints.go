@@ -16,21 +16,17 @@ limitations under the License.
 
 package metrics
 
-type ResourceManagementCheckpoint int
-
-const (
-	Aggregator_Received ResourceManagementCheckpoint = 0
-
-	Distributor_Received ResourceManagementCheckpoint = 1
-	Distributor_Sending  ResourceManagementCheckpoint = 2
-	Distributor_Sent     ResourceManagementCheckpoint = 3
-
-	Serializer_Encoded ResourceManagementCheckpoint = 4
-	Serializer_Sent    ResourceManagementCheckpoint = 5
+import (
+	"sort"
+	"sync"
 
-	Len_ResourceManagementCheckpoint = 6
+	common_lib "global-resource-service/resource-management/pkg/common-lib"
+	"global-resource-service/resource-management/pkg/common-lib/types/runtime"
 )
 
+// ResourceManagementCheckpoint is the index of a registered checkpoint in the checkpoint vector of events
+type ResourceManagementCheckpoint int
+
 type ResourceManagementCheckpointName string
 
 const (
@@ -43,3 +39,72 @@ const (
 	Serializer_Encoded_Name ResourceManagementCheckpointName = "SER_ENCODED"
 	Serializer_Sent_Name    ResourceManagementCheckpointName = "SER_SENT"
 )
+
+// checkpoints of the event path from region manager to client, registered in the order events pass them
+var (
+	Aggregator_Received = RegisterCheckpoint(Aggregator_Received_Name, true)
+
+	Distributor_Received = RegisterCheckpoint(Distributor_Received_Name, true)
+	Distributor_Sending  = RegisterCheckpoint(Distributor_Sending_Name, true)
+	Distributor_Sent     = RegisterCheckpoint(Distributor_Sent_Name, true)
+
+	Serializer_Encoded = RegisterCheckpoint(Serializer_Encoded_Name, true)
+	Serializer_Sent    = RegisterCheckpoint(Serializer_Sent_Name, true)
+)
+
+// RegisterCheckpoint registers a checkpoint for latency metrics, supposed to be called at init of the component owning the stage.
+// Events are expected to be stamped with required checkpoints before sent to clients, missing ones are reported as error.
+func RegisterCheckpoint(name ResourceManagementCheckpointName, isRequired bool) ResourceManagementCheckpoint {
+	return ResourceManagementCheckpoint(common_lib.RegisterCheckpoint(string(name), isRequired))
+}
+
+// checkpoints passed after events may already be sent to clients, recorded by RecordCheckpoint instead of stamped
+var recordedCheckpoints = make(map[ResourceManagementCheckpoint]bool)
+var recordedCheckpointLock sync.RWMutex
+
+// RegisterRecordedCheckpoint registers a checkpoint passed after events may already be sent to clients, e.g. nodes
+// saved to store while events are sent. The event is not stamped as it is read by the sender concurrently,
+// latency of the checkpoint is recorded by RecordCheckpoint when passed.
+func RegisterRecordedCheckpoint(name ResourceManagementCheckpointName) ResourceManagementCheckpoint {
+	checkpoint := RegisterCheckpoint(name, false)
+	recordedCheckpointLock.Lock()
+	recordedCheckpoints[checkpoint] = true
+	recordedCheckpointLock.Unlock()
+	return checkpoint
+}
+
+// GetCheckpoints returns all registered checkpoints in registration order
+func GetCheckpoints() []ResourceManagementCheckpoint {
+	ret := make([]ResourceManagementCheckpoint, common_lib.GetCheckpointNum())
+	for i := range ret {
+		ret[i] = ResourceManagementCheckpoint(i)
+	}
+	return ret
+}
+
+func (c ResourceManagementCheckpoint) Name() ResourceManagementCheckpointName {
+	return ResourceManagementCheckpointName(common_lib.GetCheckpointName(int(c)))
+}
+
+func (c ResourceManagementCheckpoint) IsRequired() bool {
+	return common_lib.IsCheckpointRequired(int(c))
+}
+
+func (c ResourceManagementCheckpoint) isRecorded() bool {
+	recordedCheckpointLock.RLock()
+	defer recordedCheckpointLock.RUnlock()
+	return recordedCheckpoints[c]
+}
+
+// GetCheckpointTraceHops returns the checkpoints stamped on the event as trace hops in time order
+func GetCheckpointTraceHops(e runtime.Object) []runtime.TraceHop {
+	checkpointsPerEvent := e.GetCheckpoints()
+	hops := make([]runtime.TraceHop, 0, len(checkpointsPerEvent))
+	for i, t := range checkpointsPerEvent {
+		if !t.IsZero() {
+			hops = append(hops, runtime.TraceHop{Name: string(ResourceManagementCheckpoint(i).Name()), Time: t})
+		}
+	}
+	sort.SliceStable(hops, func(i, j int) bool { return hops[i].Time.Before(hops[j].Time) })
+	return hops
+}
@@ -19,112 +19,117 @@ package metrics
 import (
 	"fmt"
 	"k8s.io/klog/v2"
+	"strings"
 	"sync"
+	"time"
 
 	common_lib "global-resource-service/resource-management/pkg/common-lib"
+	"global-resource-service/resource-management/pkg/common-lib/types/location"
 	"global-resource-service/resource-management/pkg/common-lib/types/runtime"
 )
 
-type LatencyMetricsAllCheckpoints struct {
-	Aggregator_Received  *LatencyMetrics
-	Distributor_Received *LatencyMetrics
-	Distributor_Sending  *LatencyMetrics
-	Distributor_Sent     *LatencyMetrics
-	Serializer_Encoded   *LatencyMetrics
-	Serializer_Sent      *LatencyMetrics
-}
-
-var latencyMetricsAllCheckpoints *LatencyMetricsAllCheckpoints
+// latency metrics indexed by checkpoint, grown for checkpoints registered after first use
+var latencyMetricsAllCheckpoints []*LatencyMetrics
 var latencyMetricsLock sync.RWMutex
 
-func init() {
-	latencyMetricsAllCheckpoints = new(LatencyMetricsAllCheckpoints)
-	latencyMetricsAllCheckpoints.Aggregator_Received = NewLatencyMetrics(int(Aggregator_Received))
-	latencyMetricsAllCheckpoints.Distributor_Received = NewLatencyMetrics(int(Distributor_Received))
-	latencyMetricsAllCheckpoints.Distributor_Sending = NewLatencyMetrics(int(Distributor_Sending))
-	latencyMetricsAllCheckpoints.Distributor_Sent = NewLatencyMetrics(int(Distributor_Sent))
-	latencyMetricsAllCheckpoints.Serializer_Encoded = NewLatencyMetrics(int(Serializer_Encoded))
-	latencyMetricsAllCheckpoints.Serializer_Sent = NewLatencyMetrics(int(Serializer_Sent))
+// getLatencyMetrics returns latency metrics of the checkpoint, caller needs to hold latencyMetricsLock
+func getLatencyMetrics(checkpoint ResourceManagementCheckpoint) *LatencyMetrics {
+	for i := len(latencyMetricsAllCheckpoints); i <= int(checkpoint); i++ {
+		latencyMetricsAllCheckpoints = append(latencyMetricsAllCheckpoints, NewLatencyMetrics(i))
+	}
+	return latencyMetricsAllCheckpoints[checkpoint]
 }
 
-func AddLatencyMetricsAllCheckpoints(e runtime.Object) {
+// AddLatencyMetricsAllCheckpoints records latency of all registered checkpoints of the event sent to the client,
+// overall and by source region, resource partition and client id
+// Events not received from region managers are skipped, so that end-to-end latency only covers node changes
+func AddLatencyMetricsAllCheckpoints(e runtime.Object, clientId string) {
 	if !common_lib.ResourceManagementMeasurement_Enabled {
 		return
 	}
 	if e == nil {
 		klog.Error("Nil event")
+		return
 	}
 	checkpointsPerEvent := e.GetCheckpoints()
 	if checkpointsPerEvent == nil {
 		klog.Errorf("Event (%v, Id %s, RV %v) does not have checkpoint stamped", e.GetEventType(), e.GetId(), e.GetResourceVersionInt64())
 	}
+	// events generated in the service, e.g. for stale nodes or nodes of removed regions, are not from region managers
+	if int(Aggregator_Received) >= len(checkpointsPerEvent) || checkpointsPerEvent[Aggregator_Received].IsZero() {
+		klog.V(6).Infof("[Metrics] Skip event (%v, Id %s, RV %v) not received from region managers", e.GetEventType(), e.GetId(), e.GetResourceVersionInt64())
+		return
+	}
 	lastUpdatedTime := e.GetLastUpdatedTime()
-
-	agg_received_time := checkpointsPerEvent[Aggregator_Received]
-	dis_received_time := checkpointsPerEvent[Distributor_Received]
-	dis_sending_time := checkpointsPerEvent[Distributor_Sending]
-	dis_sent_time := checkpointsPerEvent[Distributor_Sent]
-	serializer_encoded_time := checkpointsPerEvent[Serializer_Encoded]
-	serializer_sent_time := checkpointsPerEvent[Serializer_Sent]
+	dimensionValues := getDimensionValues(e, clientId)
 
 	errMsg := fmt.Sprintf("Event (%v, Id %s, RV %v)", e.GetEventType(), e.GetId(), e.GetResourceVersionInt64()) + " does not have %s stamped"
+	checkpoints := GetCheckpoints()
+	details := make([]string, 0, len(checkpoints))
 	latencyMetricsLock.Lock()
-	if !agg_received_time.IsZero() {
-		latencyMetricsAllCheckpoints.Aggregator_Received.AddLatencyMetrics(agg_received_time.Sub(lastUpdatedTime))
-	} else {
-		klog.Errorf(errMsg, Aggregator_Received)
+	for _, checkpoint := range checkpoints {
+		if checkpoint.isRecorded() {
+			continue
+		}
+		if int(checkpoint) >= len(checkpointsPerEvent) || checkpointsPerEvent[checkpoint].IsZero() {
+			if checkpoint.IsRequired() {
+				klog.Errorf(errMsg, checkpoint.Name())
+			}
+			continue
+		}
+		latency := checkpointsPerEvent[checkpoint].Sub(lastUpdatedTime)
+		getLatencyMetrics(checkpoint).AddLatencyMetrics(latency)
+		observeCheckpointLatency(dimensionValues, checkpoint.Name(), latency)
+		details = append(details, fmt.Sprintf("%s: %v", checkpoint.Name(), latency))
 	}
-	if !dis_received_time.IsZero() {
-		latencyMetricsAllCheckpoints.Distributor_Received.AddLatencyMetrics(dis_received_time.Sub(lastUpdatedTime))
-	} else {
-		klog.Errorf(errMsg, Distributor_Received)
-	}
-	if !dis_sending_time.IsZero() {
-		latencyMetricsAllCheckpoints.Distributor_Sending.AddLatencyMetrics(dis_sending_time.Sub(lastUpdatedTime))
-	} else {
-		klog.Errorf(errMsg, Distributor_Sending)
-	}
-	if !dis_sent_time.IsZero() {
-		latencyMetricsAllCheckpoints.Distributor_Sent.AddLatencyMetrics(dis_sent_time.Sub(lastUpdatedTime))
-	} else {
-		klog.Errorf(errMsg, Distributor_Sent)
-	}
-	if !serializer_encoded_time.IsZero() {
-		latencyMetricsAllCheckpoints.Serializer_Encoded.AddLatencyMetrics(serializer_encoded_time.Sub(lastUpdatedTime))
-	} else {
-		klog.Errorf(errMsg, Serializer_Encoded)
-	}
-	if !serializer_sent_time.IsZero() {
-		latencyMetricsAllCheckpoints.Serializer_Sent.AddLatencyMetrics(serializer_sent_time.Sub(lastUpdatedTime))
-	} else {
-		klog.Errorf(errMsg, Serializer_Sent)
+	latencyMetricsLock.Unlock()
+	klog.V(6).Infof("[Metrics][Detail] node %v RV %v: %s", e.GetId(), e.GetResourceVersionInt64(), strings.Join(details, ", "))
+}
+
+// RecordCheckpoint records latency of the event passing the checkpoint registered by RegisterRecordedCheckpoint,
+// overall and by source region and resource partition
+func RecordCheckpoint(e runtime.Object, checkpoint ResourceManagementCheckpoint) {
+	if !common_lib.ResourceManagementMeasurement_Enabled || e == nil {
+		return
 	}
+	latency := time.Now().UTC().Sub(e.GetLastUpdatedTime())
+	dimensionValues := getDimensionValues(e, "")
+
+	latencyMetricsLock.Lock()
+	getLatencyMetrics(checkpoint).AddLatencyMetrics(latency)
+	observeCheckpointLatency(dimensionValues, checkpoint.Name(), latency)
 	latencyMetricsLock.Unlock()
-	klog.V(6).Infof("[Metrics][Detail] node %v RV %v: %s: %v, %s: %v, %s: %v, %s: %v, %s: %v, %s: %v",
-		e.GetId(), e.GetResourceVersionInt64(),
-		Aggregator_Received_Name, agg_received_time.Sub(lastUpdatedTime),
-		Distributor_Received_Name, dis_received_time.Sub(lastUpdatedTime),
-		Distributor_Sending_Name, dis_sending_time.Sub(lastUpdatedTime),
-		Distributor_Sent_Name, dis_sent_time.Sub(lastUpdatedTime),
-		Serializer_Encoded_Name, serializer_encoded_time.Sub(lastUpdatedTime),
-		Serializer_Sent_Name, serializer_sent_time.Sub(lastUpdatedTime))
 }
 
+// PrintLatencyReport logs latency report of all registered checkpoints
 func PrintLatencyReport() {
-	latencyMetricsLock.RLock()
-	agg_received_summary := latencyMetricsAllCheckpoints.Aggregator_Received.GetSummary()
-	dis_received_summary := latencyMetricsAllCheckpoints.Distributor_Received.GetSummary()
-	dis_sending_summary := latencyMetricsAllCheckpoints.Distributor_Sending.GetSummary()
-	dis_sent_summary := latencyMetricsAllCheckpoints.Distributor_Sent.GetSummary()
-	serializer_encoded_summary := latencyMetricsAllCheckpoints.Serializer_Encoded.GetSummary()
-	serializer_sent_summary := latencyMetricsAllCheckpoints.Serializer_Sent.GetSummary()
+	checkpoints := GetCheckpoints()
+	summaries := make([]*LatencyReport, len(checkpoints))
+	latencyMetricsLock.Lock()
+	for i, checkpoint := range checkpoints {
+		summaries[i] = getLatencyMetrics(checkpoint).GetSummary()
+	}
+	latencyMetricsLock.Unlock()
 
-	latencyMetricsLock.RUnlock()
 	metrics_Message := "[Metrics][%s] perc50 %v, perc90 %v, perc99 %v. Total count %v"
-	klog.Infof(metrics_Message, Aggregator_Received_Name, agg_received_summary.P50, agg_received_summary.P90, agg_received_summary.P99, agg_received_summary.TotalCount)
-	klog.Infof(metrics_Message, Distributor_Received_Name, dis_received_summary.P50, dis_received_summary.P90, dis_received_summary.P99, dis_received_summary.TotalCount)
-	klog.Infof(metrics_Message, Distributor_Sending_Name, dis_sending_summary.P50, dis_sending_summary.P90, dis_sending_summary.P99, dis_sending_summary.TotalCount)
-	klog.Infof(metrics_Message, Distributor_Sent_Name, dis_sent_summary.P50, dis_sent_summary.P90, dis_sent_summary.P99, dis_sent_summary.TotalCount)
-	klog.Infof(metrics_Message, Serializer_Encoded_Name, serializer_encoded_summary.P50, serializer_encoded_summary.P90, serializer_encoded_summary.P99, serializer_encoded_summary.TotalCount)
-	klog.Infof(metrics_Message, Serializer_Sent_Name, serializer_sent_summary.P50, serializer_sent_summary.P90, serializer_sent_summary.P99, serializer_sent_summary.TotalCount)
+	for i, checkpoint := range checkpoints {
+		klog.Infof(metrics_Message, checkpoint.Name(), summaries[i].P50, summaries[i].P90, summaries[i].P99, summaries[i].TotalCount)
+	}
+}
+
+// getDimensionValues returns the bounded value of each latency dimension of the event
+func getDimensionValues(e runtime.Object, clientId string) map[LatencyDimension]string {
+	geoInfo := e.GetGeoInfo()
+	loc := location.NewLocation(location.Region(geoInfo.Region), location.ResourcePartition(geoInfo.ResourcePartition))
+	dimensionValues := make(map[LatencyDimension]string, len(latencyByDimension))
+	now := time.Now()
+	if loc != nil {
+		regionName := loc.GetRegion().String()
+		dimensionValues[LatencyDimension_Region] = latencyByDimension[LatencyDimension_Region].boundedValue(regionName, now)
+		dimensionValues[LatencyDimension_ResourcePartition] = latencyByDimension[LatencyDimension_ResourcePartition].boundedValue(regionName+"/"+loc.GetResourcePartition().String(), now)
+	}
+	if clientId != "" {
+		dimensionValues[LatencyDimension_Client] = latencyByDimension[LatencyDimension_Client].boundedValue(clientId, now)
+	}
+	return dimensionValues
 }
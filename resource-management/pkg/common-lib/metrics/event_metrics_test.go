@@ -18,6 +18,7 @@ package metrics
 
 import (
 	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
 	"runtime"
 	"strconv"
 	"testing"
@@ -42,7 +43,7 @@ func Test_PrintLatencyReport(t *testing.T) {
 	ne.SetCheckpoint(int(Distributor_Sent))
 	ne.SetCheckpoint(int(Serializer_Encoded))
 	ne.SetCheckpoint(int(Serializer_Sent))
-	AddLatencyMetricsAllCheckpoints(ne)
+	AddLatencyMetricsAllCheckpoints(ne, "")
 	PrintLatencyReport()
 }
 
@@ -81,7 +82,7 @@ func Test_MemoryUsageOfLatencyReport(t *testing.T) {
 		nodes[i].SetCheckpoint(int(Distributor_Sent))
 		nodes[i].SetCheckpoint(int(Serializer_Encoded))
 		nodes[i].SetCheckpoint(int(Serializer_Sent))
-		AddLatencyMetricsAllCheckpoints(nodes[i])
+		AddLatencyMetricsAllCheckpoints(nodes[i], "")
 	}
 	PrintLatencyReport()
 
@@ -94,3 +95,63 @@ func createNodeEvent() *runtime2.NodeEvent {
 	ne := runtime2.NewNodeEvent(n, runtime2.Added)
 	return ne
 }
+
+func Test_RegisterCheckpoint(t *testing.T) {
+	common_lib.ResourceManagementMeasurement_Enabled = true
+	ne := createNodeEvent()
+
+	// checkpoint registered after the event is created
+	name := ResourceManagementCheckpointName("TEST_STAGE_" + uuid.New().String())
+	checkpoint := RegisterCheckpoint(name, false)
+	assert.Equal(t, name, checkpoint.Name())
+	assert.False(t, checkpoint.IsRequired())
+	assert.Equal(t, checkpoint, GetCheckpoints()[len(GetCheckpoints())-1])
+	assert.Panics(t, func() { RegisterCheckpoint(name, false) })
+
+	ne.SetCheckpoint(int(Aggregator_Received))
+	ne.SetCheckpoint(int(checkpoint))
+	assert.Equal(t, len(GetCheckpoints()), len(ne.GetCheckpoints()))
+	assert.False(t, ne.GetCheckpoints()[checkpoint].IsZero())
+
+	AddLatencyMetricsAllCheckpoints(ne, "")
+	latencyMetricsLock.Lock()
+	assert.Equal(t, 1, getLatencyMetrics(checkpoint).GetSummary().TotalCount)
+	latencyMetricsLock.Unlock()
+	assert.Equal(t, uint64(1), CheckpointLatency.GetCount(string(name)))
+	PrintLatencyReport()
+}
+
+func Test_RecordCheckpoint(t *testing.T) {
+	common_lib.ResourceManagementMeasurement_Enabled = true
+	ne := createNodeEvent()
+
+	name := ResourceManagementCheckpointName("TEST_RECORDED_" + uuid.New().String())
+	checkpoint := RegisterRecordedCheckpoint(name)
+	assert.False(t, checkpoint.IsRequired())
+
+	// latency is recorded when passed, not again from the checkpoints stamped on the event sent
+	ne.SetCheckpoint(int(Aggregator_Received))
+	RecordCheckpoint(ne, checkpoint)
+	assert.True(t, len(ne.GetCheckpoints()) <= int(checkpoint) || ne.GetCheckpoints()[checkpoint].IsZero())
+	AddLatencyMetricsAllCheckpoints(ne, "")
+	latencyMetricsLock.Lock()
+	assert.Equal(t, 1, getLatencyMetrics(checkpoint).GetSummary().TotalCount)
+	latencyMetricsLock.Unlock()
+	assert.Equal(t, uint64(1), CheckpointLatency.GetCount(string(name)))
+}
+
+func Test_AddLatencyMetrics_SkipEventsNotFromRegionManagers(t *testing.T) {
+	common_lib.ResourceManagementMeasurement_Enabled = true
+	name := ResourceManagementCheckpointName("TEST_GENERATED_" + uuid.New().String())
+	checkpoint := RegisterCheckpoint(name, false)
+
+	// event generated by the distributor, without aggregator received checkpoint
+	ne := createNodeEvent()
+	ne.SetCheckpoint(int(checkpoint))
+	AddLatencyMetricsAllCheckpoints(ne, "")
+	assert.Equal(t, uint64(0), CheckpointLatency.GetCount(string(name)))
+
+	ne.SetCheckpoint(int(Aggregator_Received))
+	AddLatencyMetricsAllCheckpoints(ne, "")
+	assert.Equal(t, uint64(1), CheckpointLatency.GetCount(string(name)))
+}
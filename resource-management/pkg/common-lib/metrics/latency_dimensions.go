@@ -0,0 +1,188 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// LatencyDimension is the attribute of events that latency metrics are broken down by
+type LatencyDimension string
+
+const (
+	LatencyDimension_Region            LatencyDimension = "region"
+	LatencyDimension_ResourcePartition LatencyDimension = "resource_partition"
+	LatencyDimension_Client            LatencyDimension = "client"
+)
+
+// OtherDimensionValue is where latencies are recorded once a dimension reached its max number of values
+const OtherDimensionValue = "other"
+
+// DefaultMaxDimensionValues bounds the number of values tracked per dimension, e.g. number of clients
+const DefaultMaxDimensionValues = 100
+
+// DefaultDimensionValueIdleTimeout is the default time a value is tracked without events, e.g. of an expired client
+const DefaultDimensionValueIdleTimeout = 5 * time.Minute
+
+// dimensionLatency records latency of each checkpoint by values of a dimension,
+// new values beyond the max number of values are recorded as OtherDimensionValue
+// Values without events longer than the idle timeout are evicted with their latency, to make room for new values
+type dimensionLatency struct {
+	dimension      LatencyDimension
+	histogram      *HistogramVec
+	maxValues      int
+	idleTimeout    time.Duration
+	trackedValues  map[string]time.Time
+	trackedValueMu sync.Mutex
+}
+
+func newDimensionLatency(dimension LatencyDimension, maxValues int) *dimensionLatency {
+	return &dimensionLatency{
+		dimension: dimension,
+		histogram: NewHistogramVec("grs_event_checkpoint_latency_by_"+string(dimension)+"_seconds",
+			"Latency of node events at each checkpoint since the node was last updated in region manager, by "+string(dimension)+".",
+			checkpointLatencyBuckets, string(dimension), "checkpoint"),
+		maxValues:     maxValues,
+		idleTimeout:   DefaultDimensionValueIdleTimeout,
+		trackedValues: make(map[string]time.Time),
+	}
+}
+
+func (d *dimensionLatency) setIdleTimeout(idleTimeout time.Duration) {
+	d.trackedValueMu.Lock()
+	defer d.trackedValueMu.Unlock()
+	d.idleTimeout = idleTimeout
+}
+
+// boundedValue returns the value itself if tracked or still under the max number of values, otherwise OtherDimensionValue
+func (d *dimensionLatency) boundedValue(value string, now time.Time) string {
+	d.trackedValueMu.Lock()
+	defer d.trackedValueMu.Unlock()
+	if _, isOK := d.trackedValues[value]; isOK {
+		d.trackedValues[value] = now
+		return value
+	}
+	if len(d.trackedValues) >= d.maxValues {
+		d.evictIdleValues(now)
+		if len(d.trackedValues) >= d.maxValues {
+			return OtherDimensionValue
+		}
+	}
+	d.trackedValues[value] = now
+	if len(d.trackedValues) == d.maxValues {
+		klog.Warningf("Latency metrics by %s reached max %d values, new values are recorded as %s until values are idle for %v",
+			d.dimension, d.maxValues, OtherDimensionValue, d.idleTimeout)
+	}
+	return value
+}
+
+// evictIdleValues stops tracking values without events longer than the idle timeout. Caller needs to hold trackedValueMu
+func (d *dimensionLatency) evictIdleValues(now time.Time) {
+	for value, lastSeen := range d.trackedValues {
+		if now.Sub(lastSeen) > d.idleTimeout {
+			delete(d.trackedValues, value)
+			d.histogram.deleteSeries(0, value)
+		}
+	}
+}
+
+func (d *dimensionLatency) observe(value string, checkpointName ResourceManagementCheckpointName, latency time.Duration) {
+	d.histogram.Observe(latency.Seconds(), value, string(checkpointName))
+}
+
+// getReport returns latency report of each checkpoint by dimension value, all values if value is empty
+func (d *dimensionLatency) getReport(value string) map[string]map[ResourceManagementCheckpointName]*LatencyReport {
+	ret := make(map[string]map[ResourceManagementCheckpointName]*LatencyReport)
+	for _, labelValues := range d.histogram.GetLabelValues() {
+		if value != "" && labelValues[0] != value {
+			continue
+		}
+		reportByCheckpoint, isOK := ret[labelValues[0]]
+		if !isOK {
+			reportByCheckpoint = make(map[ResourceManagementCheckpointName]*LatencyReport)
+			ret[labelValues[0]] = reportByCheckpoint
+		}
+		reportByCheckpoint[ResourceManagementCheckpointName(labelValues[1])] = d.histogram.GetSummary(labelValues...)
+	}
+	return ret
+}
+
+var latencyByDimension = map[LatencyDimension]*dimensionLatency{
+	LatencyDimension_Region:            newDimensionLatency(LatencyDimension_Region, DefaultMaxDimensionValues),
+	LatencyDimension_ResourcePartition: newDimensionLatency(LatencyDimension_ResourcePartition, DefaultMaxDimensionValues),
+	LatencyDimension_Client:            newDimensionLatency(LatencyDimension_Client, DefaultMaxDimensionValues),
+}
+
+func init() {
+	for _, d := range latencyByDimension {
+		DefaultRegistry.Register(d.histogram)
+	}
+}
+
+// SetLatencyDimensionIdleTimeout sets the time values of latency dimensions are tracked without events,
+// it should be no less than the report interval so that latency of values is reported before eviction
+func SetLatencyDimensionIdleTimeout(idleTimeout time.Duration) {
+	for _, d := range latencyByDimension {
+		d.setIdleTimeout(idleTimeout)
+	}
+}
+
+// GetLatencyDimensions returns the dimensions latency metrics are broken down by
+func GetLatencyDimensions() []LatencyDimension {
+	dimensions := make([]LatencyDimension, 0, len(latencyByDimension))
+	for dimension := range latencyByDimension {
+		dimensions = append(dimensions, dimension)
+	}
+	sort.Slice(dimensions, func(i, j int) bool { return dimensions[i] < dimensions[j] })
+	return dimensions
+}
+
+// GetLatencyReportByDimension returns estimated latency percentiles of each checkpoint by value of the dimension,
+// or of the given value only if it is not empty. Returns false if the dimension is unknown.
+func GetLatencyReportByDimension(dimension LatencyDimension, value string) (map[string]map[ResourceManagementCheckpointName]*LatencyReport, bool) {
+	d, isOK := latencyByDimension[dimension]
+	if !isOK {
+		return nil, false
+	}
+	return d.getReport(value), true
+}
+
+// PrintLatencyReportByDimension logs latency report of each checkpoint by value of the dimension
+func PrintLatencyReportByDimension(dimension LatencyDimension) {
+	reports, isOK := GetLatencyReportByDimension(dimension, "")
+	if !isOK {
+		return
+	}
+	values := make([]string, 0, len(reports))
+	for value := range reports {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	metrics_Message := "[Metrics][%s=%s][%s] perc50 %v, perc90 %v, perc99 %v. Total count %v"
+	for _, value := range values {
+		for _, checkpoint := range GetCheckpoints() {
+			if summary, isOK := reports[value][checkpoint.Name()]; isOK {
+				klog.Infof(metrics_Message, dimension, value, checkpoint.Name(), summary.P50, summary.P90, summary.P99, summary.TotalCount)
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	common_lib "global-resource-service/resource-management/pkg/common-lib"
+	"global-resource-service/resource-management/pkg/common-lib/types/location"
+	runtime2 "global-resource-service/resource-management/pkg/common-lib/types/runtime"
+)
+
+func TestDimensionLatency_BoundedValues(t *testing.T) {
+	now := time.Now()
+	d := newDimensionLatency("test", 2)
+	assert.Equal(t, "client1", d.boundedValue("client1", now))
+	assert.Equal(t, "client2", d.boundedValue("client2", now))
+	assert.Equal(t, OtherDimensionValue, d.boundedValue("client3", now))
+	// tracked values are kept
+	assert.Equal(t, "client1", d.boundedValue("client1", now))
+}
+
+func TestDimensionLatency_EvictIdleValues(t *testing.T) {
+	now := time.Now()
+	d := newDimensionLatency("test_evict", 2)
+	d.setIdleTimeout(time.Minute)
+	assert.Equal(t, "client1", d.boundedValue("client1", now))
+	assert.Equal(t, "client2", d.boundedValue("client2", now))
+	d.observe("client1", Aggregator_Received_Name, time.Second)
+	d.observe("client2", Aggregator_Received_Name, time.Second)
+
+	// client2 has events within the idle timeout, client1 is evicted with its latency
+	assert.Equal(t, "client2", d.boundedValue("client2", now.Add(30*time.Second)))
+	assert.Equal(t, OtherDimensionValue, d.boundedValue("client3", now.Add(30*time.Second)))
+	assert.Equal(t, "client3", d.boundedValue("client3", now.Add(61*time.Second)))
+	assert.Equal(t, [][]string{{"client2", string(Aggregator_Received_Name)}}, d.histogram.GetLabelValues())
+	assert.Equal(t, OtherDimensionValue, d.boundedValue("client4", now.Add(61*time.Second)))
+}
+
+func TestHistogramVec_GetSummary(t *testing.T) {
+	h := NewHistogramVec("test_summary_seconds", "Latency.", []float64{0.1, 0.2, 0.4}, "checkpoint")
+	assert.Equal(t, 0, h.GetSummary("AGG_RECEIVED").TotalCount)
+
+	// 50 in (0, 0.1], 40 in (0.1, 0.2], 9 in (0.2, 0.4], 1 beyond
+	for i := 0; i < 50; i++ {
+		h.Observe(0.05, "AGG_RECEIVED")
+	}
+	for i := 0; i < 40; i++ {
+		h.Observe(0.15, "AGG_RECEIVED")
+	}
+	for i := 0; i < 9; i++ {
+		h.Observe(0.3, "AGG_RECEIVED")
+	}
+	h.Observe(1, "AGG_RECEIVED")
+
+	summary := h.GetSummary("AGG_RECEIVED")
+	assert.Equal(t, 100, summary.TotalCount)
+	assert.Equal(t, 100*time.Millisecond, summary.P50)
+	assert.Equal(t, 200*time.Millisecond, summary.P90)
+	assert.Equal(t, 400*time.Millisecond, summary.P99)
+}
+
+func TestGetLatencyReportByDimension(t *testing.T) {
+	common_lib.ResourceManagementMeasurement_Enabled = true
+	clientId := "TestGetLatencyReportByDimension"
+	loc := location.NewLocation(location.Beijing, location.ResourcePartition2)
+	ne := runtime2.NewNodeEvent(createRandomNode(1, loc), runtime2.Added)
+	stampedCheckpoints := []ResourceManagementCheckpoint{Aggregator_Received, Distributor_Received, Distributor_Sending,
+		Distributor_Sent, Serializer_Encoded, Serializer_Sent}
+	for _, checkpoint := range stampedCheckpoints {
+		ne.SetCheckpoint(int(checkpoint))
+	}
+	AddLatencyMetricsAllCheckpoints(ne, clientId)
+
+	reports, isOK := GetLatencyReportByDimension(LatencyDimension_Client, clientId)
+	assert.True(t, isOK)
+	assert.Equal(t, 1, len(reports))
+	assert.Equal(t, len(stampedCheckpoints), len(reports[clientId]))
+	assert.Equal(t, 1, reports[clientId][Serializer_Sent_Name].TotalCount)
+
+	reports, isOK = GetLatencyReportByDimension(LatencyDimension_ResourcePartition, "Beijing/RP2")
+	assert.True(t, isOK)
+	assert.Equal(t, 1, reports["Beijing/RP2"][Aggregator_Received_Name].TotalCount)
+
+	_, isOK = GetLatencyReportByDimension("unknown", "")
+	assert.False(t, isOK)
+	PrintLatencyReportByDimension(LatencyDimension_Client)
+}
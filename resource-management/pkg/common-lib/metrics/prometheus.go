@@ -0,0 +1,376 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Minimal metrics registry exported in Prometheus text format version 0.0.4
+
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Collector is a metric family that writes its samples in Prometheus text format
+type Collector interface {
+	Name() string
+	writeText(w *bufio.Writer)
+}
+
+type metricDesc struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+}
+
+func (d *metricDesc) Name() string {
+	return d.name
+}
+
+func (d *metricDesc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, d.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.metricType)
+}
+
+// labelKey joins label values as the map key of a series
+func (d *metricDesc) labelKey(labelValues []string) string {
+	if len(labelValues) != len(d.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", d.name, len(d.labelNames), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func formatLabels(labelNames []string, labelValues []string, extraName string, extraValue string) string {
+	if len(labelNames) == 0 && extraName == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(labelNames)+1)
+	for i, name := range labelNames {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, labelValues[i]))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", extraName, extraValue))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+}
+
+// sortedSeries returns series sorted by label values so that the output is stable
+func sortedSeries(values map[string]*series) []*series {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	ret := make([]*series, len(keys))
+	for i, key := range keys {
+		ret[i] = values[key]
+	}
+	return ret
+}
+
+// ValueVec is a counter or gauge with labels
+type ValueVec struct {
+	metricDesc
+	values map[string]*series
+	lock   sync.Mutex
+}
+
+// NewCounterVec returns a counter, whose values only increase, partitioned by the label names
+func NewCounterVec(name string, help string, labelNames ...string) *ValueVec {
+	return &ValueVec{metricDesc: metricDesc{name: name, help: help, metricType: "counter", labelNames: labelNames}, values: make(map[string]*series)}
+}
+
+// NewGaugeVec returns a gauge partitioned by the label names
+func NewGaugeVec(name string, help string, labelNames ...string) *ValueVec {
+	return &ValueVec{metricDesc: metricDesc{name: name, help: help, metricType: "gauge", labelNames: labelNames}, values: make(map[string]*series)}
+}
+
+func (v *ValueVec) Add(delta float64, labelValues ...string) {
+	key := v.labelKey(labelValues)
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	s, isOK := v.values[key]
+	if !isOK {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		v.values[key] = s
+	}
+	s.value += delta
+}
+
+func (v *ValueVec) Inc(labelValues ...string) {
+	v.Add(1, labelValues...)
+}
+
+// Dec decreases a gauge
+func (v *ValueVec) Dec(labelValues ...string) {
+	v.Add(-1, labelValues...)
+}
+
+// Set sets a gauge
+func (v *ValueVec) Set(value float64, labelValues ...string) {
+	key := v.labelKey(labelValues)
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.values[key] = &series{labelValues: append([]string(nil), labelValues...), value: value}
+}
+
+// Get returns the current value, for test
+func (v *ValueVec) Get(labelValues ...string) float64 {
+	key := v.labelKey(labelValues)
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if s, isOK := v.values[key]; isOK {
+		return s.value
+	}
+	return 0
+}
+
+func (v *ValueVec) writeText(w *bufio.Writer) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.writeHeader(w)
+	for _, s := range sortedSeries(v.values) {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labelNames, s.labelValues, "", ""), formatValue(s.value))
+	}
+}
+
+// Sample is a value of a gauge function
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// GaugeFunc is a gauge whose values are collected when exported, for state owned by other components
+type GaugeFunc struct {
+	metricDesc
+	collect func() []Sample
+}
+
+func NewGaugeFunc(name string, help string, labelNames []string, collect func() []Sample) *GaugeFunc {
+	return &GaugeFunc{metricDesc: metricDesc{name: name, help: help, metricType: "gauge", labelNames: labelNames}, collect: collect}
+}
+
+func (g *GaugeFunc) writeText(w *bufio.Writer) {
+	values := make(map[string]*series)
+	for _, sample := range g.collect() {
+		values[g.labelKey(sample.LabelValues)] = &series{labelValues: sample.LabelValues, value: sample.Value}
+	}
+	g.writeHeader(w)
+	for _, s := range sortedSeries(values) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labelNames, s.labelValues, "", ""), formatValue(s.value))
+	}
+}
+
+type histogramSeries struct {
+	labelValues  []string
+	bucketCounts []uint64
+	count        uint64
+	sum          float64
+}
+
+// HistogramVec counts observations in cumulative buckets, partitioned by the label names
+type HistogramVec struct {
+	metricDesc
+	buckets []float64
+	values  map[string]*histogramSeries
+	lock    sync.Mutex
+}
+
+// NewHistogramVec returns a histogram with the upper bounds of buckets in increasing order
+func NewHistogramVec(name string, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return &HistogramVec{
+		metricDesc: metricDesc{name: name, help: help, metricType: "histogram", labelNames: labelNames},
+		buckets:    buckets,
+		values:     make(map[string]*histogramSeries),
+	}
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := h.labelKey(labelValues)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	s, isOK := h.values[key]
+	if !isOK {
+		s = &histogramSeries{labelValues: append([]string(nil), labelValues...), bucketCounts: make([]uint64, len(h.buckets))}
+		h.values[key] = s
+	}
+	for i, upperBound := range h.buckets {
+		if value <= upperBound {
+			s.bucketCounts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+// GetCount returns the number of observations, for test
+func (h *HistogramVec) GetCount(labelValues ...string) uint64 {
+	key := h.labelKey(labelValues)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if s, isOK := h.values[key]; isOK {
+		return s.count
+	}
+	return 0
+}
+
+// GetLabelValues returns label values of all series observed
+func (h *HistogramVec) GetLabelValues() [][]string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	ret := make([][]string, 0, len(h.values))
+	for _, s := range sortedHistogramSeries(h.values) {
+		ret = append(ret, s.labelValues)
+	}
+	return ret
+}
+
+// deleteSeries removes series with the value of the label at labelIndex
+func (h *HistogramVec) deleteSeries(labelIndex int, labelValue string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for key, s := range h.values {
+		if s.labelValues[labelIndex] == labelValue {
+			delete(h.values, key)
+		}
+	}
+}
+
+// GetSummary estimates percentiles of observations in seconds, interpolating linearly within the bucket of each percentile
+func (h *HistogramVec) GetSummary(labelValues ...string) *LatencyReport {
+	key := h.labelKey(labelValues)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	s, isOK := h.values[key]
+	if !isOK || s.count == 0 {
+		return &LatencyReport{}
+	}
+	return &LatencyReport{
+		TotalCount: int(s.count),
+		P50:        h.estimateQuantile(s, 0.5),
+		P90:        h.estimateQuantile(s, 0.9),
+		P99:        h.estimateQuantile(s, 0.99),
+	}
+}
+
+func (h *HistogramVec) estimateQuantile(s *histogramSeries, q float64) time.Duration {
+	rank := q * float64(s.count)
+	lowerBound, lowerCount := 0.0, uint64(0)
+	for i, upperBound := range h.buckets {
+		if float64(s.bucketCounts[i]) >= rank {
+			inBucket := s.bucketCounts[i] - lowerCount
+			seconds := upperBound
+			if inBucket > 0 {
+				seconds = lowerBound + (upperBound-lowerBound)*(rank-float64(lowerCount))/float64(inBucket)
+			}
+			return time.Duration(seconds * float64(time.Second))
+		}
+		lowerBound, lowerCount = upperBound, s.bucketCounts[i]
+	}
+	// beyond the largest bucket
+	return time.Duration(lowerBound * float64(time.Second))
+}
+
+func sortedHistogramSeries(values map[string]*histogramSeries) []*histogramSeries {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	ret := make([]*histogramSeries, len(keys))
+	for i, key := range keys {
+		ret[i] = values[key]
+	}
+	return ret
+}
+
+func (h *HistogramVec) writeText(w *bufio.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.writeHeader(w)
+	for _, s := range sortedHistogramSeries(h.values) {
+		for i, upperBound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labelNames, s.labelValues, "le", formatValue(upperBound)), s.bucketCounts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labelNames, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labelNames, s.labelValues, "", ""), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labelNames, s.labelValues, "", ""), s.count)
+	}
+}
+
+// Registry is a set of metric families exported together
+type Registry struct {
+	collectors map[string]Collector
+	lock       sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+// DefaultRegistry is the registry exported by the /metrics endpoint of the service
+var DefaultRegistry = NewRegistry()
+
+// Register adds the collectors to the registry, replacing existing collectors with the same name
+func (r *Registry) Register(collectors ...Collector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, c := range collectors {
+		r.collectors[c.Name()] = c
+	}
+}
+
+// WriteText writes all metric families in Prometheus text format, sorted by name
+func (r *Registry) WriteText(w io.Writer) error {
+	r.lock.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	collectors := make([]Collector, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		collectors[i] = r.collectors[name]
+	}
+	r.lock.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.writeText(bw)
+	}
+	return bw.Flush()
+}
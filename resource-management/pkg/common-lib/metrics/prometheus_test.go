@@ -0,0 +1,76 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryWriteText(t *testing.T) {
+	registry := NewRegistry()
+	counter := NewCounterVec("test_events_total", "Number of events.", "region", "resource_partition")
+	gauge := NewGaugeVec("test_active", "Number of active items.")
+	histogram := NewHistogramVec("test_latency_seconds", "Latency.", []float64{0.1, 1}, "checkpoint")
+	gaugeFunc := NewGaugeFunc("test_hosts", "Number of hosts.", []string{"region"}, func() []Sample {
+		return []Sample{{LabelValues: []string{"Beijing"}, Value: 10}, {LabelValues: []string{"Austin"}, Value: 5}}
+	})
+	registry.Register(counter, gauge, histogram, gaugeFunc)
+
+	counter.Inc("Beijing", "RP1")
+	counter.Add(2, "Beijing", "RP1")
+	counter.Inc("Austin", "RP2")
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+	histogram.Observe(0.05, "AGG_RECEIVED")
+	histogram.Observe(0.5, "AGG_RECEIVED")
+	histogram.Observe(5, "AGG_RECEIVED")
+
+	assert.Equal(t, float64(3), counter.Get("Beijing", "RP1"))
+	assert.Equal(t, uint64(3), histogram.GetCount("AGG_RECEIVED"))
+
+	var buf bytes.Buffer
+	assert.Nil(t, registry.WriteText(&buf))
+	expected := `# HELP test_active Number of active items.
+# TYPE test_active gauge
+test_active 1
+# HELP test_events_total Number of events.
+# TYPE test_events_total counter
+test_events_total{region="Austin",resource_partition="RP2"} 1
+test_events_total{region="Beijing",resource_partition="RP1"} 3
+# HELP test_hosts Number of hosts.
+# TYPE test_hosts gauge
+test_hosts{region="Austin"} 5
+test_hosts{region="Beijing"} 10
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{checkpoint="AGG_RECEIVED",le="0.1"} 1
+test_latency_seconds_bucket{checkpoint="AGG_RECEIVED",le="1"} 2
+test_latency_seconds_bucket{checkpoint="AGG_RECEIVED",le="+Inf"} 3
+test_latency_seconds_sum{checkpoint="AGG_RECEIVED"} 5.55
+test_latency_seconds_count{checkpoint="AGG_RECEIVED"} 3
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestLabelValuesMismatch(t *testing.T) {
+	counter := NewCounterVec("test_mismatch_total", "Number of events.", "region")
+	assert.Panics(t, func() { counter.Inc("Beijing", "RP1") })
+}
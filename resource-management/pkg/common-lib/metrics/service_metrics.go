@@ -0,0 +1,92 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"time"
+)
+
+// Metrics of the resource management service exported by the /metrics endpoint
+
+// checkpoint latency buckets from 1ms to ~65s
+var checkpointLatencyBuckets = []float64{0.001, 0.002, 0.004, 0.008, 0.016, 0.032, 0.064, 0.128, 0.256, 0.512, 1.024, 2.048, 4.096, 8.192, 16.384, 32.768, 65.536}
+
+var (
+	// CheckpointLatency is latency since the node was last updated in region manager, by checkpoint name
+	CheckpointLatency = NewHistogramVec("grs_event_checkpoint_latency_seconds",
+		"Latency of node events at each checkpoint since the node was last updated in region manager.",
+		checkpointLatencyBuckets, "checkpoint")
+
+	// NodeEventsProcessed counts node events received by distributor, by region and resource partition
+	NodeEventsProcessed = NewCounterVec("grs_node_events_total",
+		"Number of node events received by distributor.", "region", "resource_partition")
+
+	// PersistenceFailures counts failed writes to the store, by operation
+	PersistenceFailures = NewCounterVec("grs_persistence_failures_total",
+		"Number of failed writes to the store.", "operation")
+
+	// RegionManagerRequestFailures counts failed list and watch requests to region managers, by error class
+	RegionManagerRequestFailures = NewCounterVec("grs_region_manager_request_failures_total",
+		"Number of failed list and watch requests to region managers.", "url", "operation", "class")
+
+	// RegionManagerRvAnomalies counts node events from region managers whose resource versions are out of sequence
+	// in their resource partition, by anomaly, and resource versions skipped for gaps
+	RegionManagerRvAnomalies = NewCounterVec("grs_region_manager_rv_anomalies_total",
+		"Number of node events from region managers with resource versions out of sequence.", "url", "region", "resource_partition", "anomaly")
+
+	// RegionManagerPartitionRelists counts lists of a single resource partition again after events of it are lost
+	RegionManagerPartitionRelists = NewCounterVec("grs_region_manager_partition_relists_total",
+		"Number of lists of a resource partition again after its events are lost.", "url", "region", "resource_partition")
+
+	// QuarantinedNodeEvents counts invalid node events from region managers that are discarded, by reason
+	QuarantinedNodeEvents = NewCounterVec("grs_quarantined_node_events_total",
+		"Number of invalid node events from region managers discarded.", "url", "reason")
+
+	// ActiveWatches is the number of client watches being served
+	ActiveWatches = NewGaugeVec("grs_active_watches", "Number of client watches being served.")
+)
+
+// persistence operations
+const (
+	PersistOperation_Nodes                   = "nodes"
+	PersistOperation_DeleteNodes             = "delete_nodes"
+	PersistOperation_NodeStoreStatus         = "node_store_status"
+	PersistOperation_VirtualNodesAssignments = "virtual_nodes_assignments"
+	PersistOperation_Client                  = "client"
+	PersistOperation_DeleteClient            = "delete_client"
+	PersistOperation_WatchCursors            = "watch_cursors"
+	PersistOperation_DeleteWatchCursors      = "delete_watch_cursors"
+)
+
+// region manager request operations
+const (
+	RegionManagerOperation_List  = "list"
+	RegionManagerOperation_Watch = "watch"
+)
+
+func init() {
+	DefaultRegistry.Register(CheckpointLatency, NodeEventsProcessed, PersistenceFailures, RegionManagerRequestFailures,
+		RegionManagerRvAnomalies, RegionManagerPartitionRelists, QuarantinedNodeEvents, ActiveWatches)
+}
+
+// observeCheckpointLatency records latency of the checkpoint overall and by the value of each dimension
+func observeCheckpointLatency(dimensionValues map[LatencyDimension]string, checkpointName ResourceManagementCheckpointName, latency time.Duration) {
+	CheckpointLatency.Observe(latency.Seconds(), string(checkpointName))
+	for dimension, value := range dimensionValues {
+		latencyByDimension[dimension].observe(value, checkpointName, latency)
+	}
+}
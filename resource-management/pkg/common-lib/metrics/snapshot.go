@@ -0,0 +1,228 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Snapshot is a machine-readable dump of latency summaries and stats at a point of a test run,
+// for comparing runs across builds
+type Snapshot struct {
+	// Source is the component that took the snapshot, e.g. service-api or e2e
+	Source    string    `json:"source"`
+	Timestamp time.Time `json:"timestamp"`
+	// Latencies are latency summaries by metric name
+	Latencies map[string]LatencySnapshot `json:"latencies"`
+	// Durations are in milliseconds by stat name, larger is worse
+	Durations map[string]float64 `json:"durations_ms"`
+	// Counts are informational by stat name, not compared for regressions
+	Counts map[string]int `json:"counts"`
+}
+
+// LatencySnapshot is a latency summary in milliseconds
+type LatencySnapshot struct {
+	TotalCount int     `json:"total_count"`
+	P50        float64 `json:"p50_ms"`
+	P90        float64 `json:"p90_ms"`
+	P99        float64 `json:"p99_ms"`
+}
+
+const snapshotFileSuffix = ".json"
+
+func NewSnapshot(source string) *Snapshot {
+	return &Snapshot{
+		Source:    source,
+		Timestamp: time.Now().UTC(),
+		Latencies: make(map[string]LatencySnapshot),
+		Durations: make(map[string]float64),
+		Counts:    make(map[string]int),
+	}
+}
+
+func toMilliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (s *Snapshot) AddLatency(name string, report *LatencyReport) {
+	s.Latencies[name] = LatencySnapshot{
+		TotalCount: report.TotalCount,
+		P50:        toMilliseconds(report.P50),
+		P90:        toMilliseconds(report.P90),
+		P99:        toMilliseconds(report.P99),
+	}
+}
+
+func (s *Snapshot) AddDuration(name string, d time.Duration) {
+	s.Durations[name] = toMilliseconds(d)
+}
+
+func (s *Snapshot) AddCount(name string, count int) {
+	s.Counts[name] = count
+}
+
+// AddCheckpointLatencies adds latency summaries of all registered checkpoints, overall as "checkpoint/<name>"
+// and by region as "region/<region>/<name>"
+func (s *Snapshot) AddCheckpointLatencies() {
+	checkpoints := GetCheckpoints()
+	latencyMetricsLock.Lock()
+	for _, checkpoint := range checkpoints {
+		s.AddLatency("checkpoint/"+string(checkpoint.Name()), getLatencyMetrics(checkpoint).GetSummary())
+	}
+	latencyMetricsLock.Unlock()
+
+	reports, _ := GetLatencyReportByDimension(LatencyDimension_Region, "")
+	for region, reportByCheckpoint := range reports {
+		for checkpointName, report := range reportByCheckpoint {
+			s.AddLatency(fmt.Sprintf("region/%s/%s", region, checkpointName), report)
+		}
+	}
+}
+
+// WriteSnapshot writes the snapshot to <dir>/<source>-<timestamp>.json and returns the file path
+func WriteSnapshot(dir string, s *Snapshot) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, fmt.Sprintf("%s-%s%s", s.Source, s.Timestamp.Format("20060102T150405.000Z"), snapshotFileSuffix))
+	// write to temp file then rename, so that a reader never sees a partial snapshot
+	tmpFile := file + ".tmp"
+	if err = ioutil.WriteFile(tmpFile, b, 0644); err != nil {
+		return "", err
+	}
+	return file, os.Rename(tmpFile, file)
+}
+
+func ReadSnapshot(file string) (*Snapshot, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{}
+	if err = json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("invalid snapshot file %s. error %v", file, err)
+	}
+	return s, nil
+}
+
+// ReadLatestSnapshots reads the latest snapshot of each source in the directory
+func ReadLatestSnapshots(dir string) (map[string]*Snapshot, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]*Snapshot)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), snapshotFileSuffix) {
+			continue
+		}
+		s, err := ReadSnapshot(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if latest, isOK := ret[s.Source]; !isOK || s.Timestamp.After(latest.Timestamp) {
+			ret[s.Source] = s
+		}
+	}
+	return ret, nil
+}
+
+// RunSnapshotWriter writes the snapshot taken by takeSnapshot to the directory every interval until stopCh is closed
+func RunSnapshotWriter(dir string, interval time.Duration, takeSnapshot func() *Snapshot, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			file, err := WriteSnapshot(dir, takeSnapshot())
+			if err != nil {
+				klog.Errorf("Error write metrics snapshot to %s. error %v", dir, err)
+				continue
+			}
+			klog.V(3).Infof("Metrics snapshot written to %s", file)
+		}
+	}
+}
+
+// Regression is a metric of the current snapshot worse than the base snapshot beyond the threshold
+type Regression struct {
+	Source  string
+	Metric  string
+	Base    float64
+	Current float64
+}
+
+func (r Regression) String() string {
+	change := "+Inf"
+	if r.Base > 0 {
+		change = fmt.Sprintf("%+.1f%%", (r.Current-r.Base)/r.Base*100)
+	}
+	return fmt.Sprintf("[%s] %s: %.3fms -> %.3fms (%s)", r.Source, r.Metric, r.Base, r.Current, change)
+}
+
+// DiffSnapshots returns latency percentiles and durations of the current snapshot that increased more than
+// threshold ratio of the base snapshot, ignoring increases not larger than minDeltaMs milliseconds.
+// Metrics missing in either snapshot are not compared.
+func DiffSnapshots(base *Snapshot, current *Snapshot, threshold float64, minDeltaMs float64) []Regression {
+	ret := make([]Regression, 0)
+	isRegressed := func(baseValue float64, currentValue float64) bool {
+		return currentValue-baseValue > minDeltaMs && currentValue > baseValue*(1+threshold)
+	}
+
+	for name, baseLatency := range base.Latencies {
+		currentLatency, isOK := current.Latencies[name]
+		if !isOK || baseLatency.TotalCount == 0 || currentLatency.TotalCount == 0 {
+			continue
+		}
+		for _, p := range []struct {
+			name          string
+			base, current float64
+		}{
+			{"p50", baseLatency.P50, currentLatency.P50},
+			{"p90", baseLatency.P90, currentLatency.P90},
+			{"p99", baseLatency.P99, currentLatency.P99},
+		} {
+			if isRegressed(p.base, p.current) {
+				ret = append(ret, Regression{Source: current.Source, Metric: name + "/" + p.name, Base: p.base, Current: p.current})
+			}
+		}
+	}
+	for name, baseDuration := range base.Durations {
+		if currentDuration, isOK := current.Durations[name]; isOK && isRegressed(baseDuration, currentDuration) {
+			ret = append(ret, Regression{Source: current.Source, Metric: name, Base: baseDuration, Current: currentDuration})
+		}
+	}
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Metric < ret[j].Metric })
+	return ret
+}
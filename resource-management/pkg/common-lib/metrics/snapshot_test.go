@@ -0,0 +1,87 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteReadSnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	s := NewSnapshot("e2e")
+	s.AddLatency("watch/delay_per_event", &LatencyReport{TotalCount: 10, P50: time.Millisecond, P90: 2 * time.Millisecond, P99: 3 * time.Millisecond})
+	s.AddDuration("list/duration", 1500*time.Millisecond)
+	s.AddCount("list/nodes", 25000)
+	file, err := WriteSnapshot(dir, s)
+	assert.Nil(t, err)
+
+	ret, err := ReadSnapshot(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "e2e", ret.Source)
+	assert.Equal(t, LatencySnapshot{TotalCount: 10, P50: 1, P90: 2, P99: 3}, ret.Latencies["watch/delay_per_event"])
+	assert.Equal(t, float64(1500), ret.Durations["list/duration"])
+	assert.Equal(t, 25000, ret.Counts["list/nodes"])
+
+	// latest snapshot of each source
+	later := NewSnapshot("e2e")
+	later.Timestamp = s.Timestamp.Add(time.Minute)
+	later.AddCount("list/nodes", 50000)
+	_, err = WriteSnapshot(dir, later)
+	assert.Nil(t, err)
+	service := NewSnapshot("service-api")
+	service.AddCheckpointLatencies()
+	_, err = WriteSnapshot(dir, service)
+	assert.Nil(t, err)
+
+	latest, err := ReadLatestSnapshots(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(latest))
+	assert.Equal(t, 50000, latest["e2e"].Counts["list/nodes"])
+	assert.NotNil(t, latest["service-api"])
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	base := NewSnapshot("e2e")
+	base.Latencies["watch/delay_per_event"] = LatencySnapshot{TotalCount: 100, P50: 10, P90: 20, P99: 100}
+	base.Latencies["checkpoint/SER_SENT"] = LatencySnapshot{TotalCount: 100, P50: 0.1, P90: 0.2, P99: 0.3}
+	base.Durations["list/duration"] = 1000
+	base.Durations["register/duration"] = 50
+	base.Counts["list/nodes"] = 25000
+
+	current := NewSnapshot("e2e")
+	// p99 regressed, p50 and p90 within threshold
+	current.Latencies["watch/delay_per_event"] = LatencySnapshot{TotalCount: 100, P50: 10.5, P90: 21, P99: 150}
+	// sub-millisecond increase is noise
+	current.Latencies["checkpoint/SER_SENT"] = LatencySnapshot{TotalCount: 100, P50: 0.5, P90: 0.8, P99: 1.2}
+	current.Durations["list/duration"] = 1500
+	current.Durations["register/duration"] = 40
+	// counts are not compared
+	current.Counts["list/nodes"] = 1
+
+	regressions := DiffSnapshots(base, current, 0.1, 1)
+	assert.Equal(t, []Regression{
+		{Source: "e2e", Metric: "list/duration", Base: 1000, Current: 1500},
+		{Source: "e2e", Metric: "watch/delay_per_event/p99", Base: 100, Current: 150},
+	}, regressions)
+	assert.Equal(t, "[e2e] list/duration: 1000.000ms -> 1500.000ms (+50.0%)", regressions[0].String())
+
+	assert.Equal(t, 0, len(DiffSnapshots(base, base, 0.1, 1)))
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"global-resource-service/resource-management/pkg/common-lib/types/runtime"
+)
+
+// SpanFileExporter writes trace spans of events to a local file, one JSON object per line
+type SpanFileExporter struct {
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	lock    sync.Mutex
+}
+
+type spanRecord struct {
+	runtime.TraceSpan
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// NewSpanFileExporter creates the file, or truncates it if exists
+func NewSpanFileExporter(path string) (*SpanFileExporter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	writer := bufio.NewWriter(file)
+	return &SpanFileExporter{file: file, writer: writer, encoder: json.NewEncoder(writer)}, nil
+}
+
+func (e *SpanFileExporter) Export(spans []runtime.TraceSpan) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, span := range spans {
+		if err := e.encoder.Encode(spanRecord{TraceSpan: span, DurationMs: toMilliseconds(span.End.Sub(span.Start))}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes buffered spans and closes the file
+func (e *SpanFileExporter) Close() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if err := e.writer.Flush(); err != nil {
+		e.file.Close()
+		return err
+	}
+	return e.file.Close()
+}
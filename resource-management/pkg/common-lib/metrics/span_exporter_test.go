@@ -0,0 +1,60 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"global-resource-service/resource-management/pkg/common-lib/types/runtime"
+)
+
+func TestSpanFileExporter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spans.json")
+	exporter, err := NewSpanFileExporter(file)
+	assert.Nil(t, err)
+
+	origin := time.Now().UTC()
+	trace := runtime.NewTraceContext(origin).WithHops(
+		runtime.TraceHop{Name: runtime.TraceHop_RegionManagerSent, Time: origin.Add(2 * time.Millisecond)},
+		runtime.TraceHop{Name: runtime.TraceHop_ClientReceived, Time: origin.Add(10 * time.Millisecond)})
+	assert.Nil(t, exporter.Export(trace.GetSpans()))
+	assert.Nil(t, exporter.Close())
+
+	f, err := os.Open(file)
+	assert.Nil(t, err)
+	defer f.Close()
+	records := make([]map[string]interface{}, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		record := make(map[string]interface{})
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, trace.TraceId, records[0]["trace_id"])
+	assert.Equal(t, runtime.TraceHop_RegionManagerSent, records[0]["name"])
+	assert.Equal(t, float64(2), records[0]["duration_ms"])
+	assert.Equal(t, runtime.TraceHop_ClientReceived, records[1]["name"])
+	assert.Equal(t, float64(8), records[1]["duration_ms"])
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// Options are the certificate files of a TLS server or client
+// For server, CAFile is used to verify client certificates. For client, CAFile is the only CA
+// trusted to verify the server certificate, and CertFile and KeyFile are the optional client certificate.
+type Options struct {
+	CertFile          string
+	KeyFile           string
+	CAFile            string
+	RequireClientCert bool
+}
+
+// IsServerEnabled returns true if any server option is set, the options are validated by NewServerTLSConfig
+func (o Options) IsServerEnabled() bool {
+	return o.CertFile != "" || o.KeyFile != "" || o.CAFile != "" || o.RequireClientCert
+}
+
+// IsClientEnabled returns true if the CA to verify the server is set
+func (o Options) IsClientEnabled() bool {
+	return o.CAFile != ""
+}
+
+// NewServerTLSConfig returns the TLS config of a HTTPS server. Client certificates are verified with CAFile if set,
+// and required if RequireClientCert is set
+func NewServerTLSConfig(o Options) (*tls.Config, error) {
+	if o.CertFile == "" || o.KeyFile == "" {
+		return nil, errors.New("server certificate and key files are both required")
+	}
+	if o.RequireClientCert && o.CAFile == "" {
+		return nil, errors.New("CA file is required to verify client certificates")
+	}
+	cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate. error %v", err)
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if o.CAFile != "" {
+		config.ClientCAs, err = loadCertPool(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if o.RequireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return config, nil
+}
+
+// NewClientTLSConfig returns the TLS config of a HTTPS client that trusts only the CA in CAFile,
+// with the client certificate if CertFile and KeyFile are set
+func NewClientTLSConfig(o Options) (*tls.Config, error) {
+	if !o.IsClientEnabled() {
+		return nil, errors.New("CA file is required to verify the server")
+	}
+	rootCAs, err := loadCertPool(o.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    rootCAs,
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate. error %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	caPem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file. error %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPem) {
+		return nil, fmt.Errorf("no valid certificate in CA file %s", caFile)
+	}
+	return pool, nil
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// newTestCert creates a certificate signed by parent, or a self signed CA if parent is nil
+func newTestCert(t *testing.T, dir string, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signerCert, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	c := &testCert{cert: cert, key: key, certFile: filepath.Join(dir, name+".crt"), keyFile: filepath.Join(dir, name+".key")}
+	assert.Nil(t, ioutil.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.Nil(t, ioutil.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return c
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil)
+	serverCert := newTestCert(t, dir, "server", ca)
+	clientCert := newTestCert(t, dir, "client", ca)
+	otherCA := newTestCert(t, dir, "other-ca", nil)
+
+	serverConfig, err := NewServerTLSConfig(Options{CertFile: serverCert.certFile, KeyFile: serverCert.keyFile, CAFile: ca.certFile, RequireClientCert: true})
+	assert.Nil(t, err)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = serverConfig
+	server.StartTLS()
+	defer server.Close()
+
+	testCases := []struct {
+		name      string
+		options   Options
+		expectErr bool
+	}{
+		{"pinned CA with client cert", Options{CAFile: ca.certFile, CertFile: clientCert.certFile, KeyFile: clientCert.keyFile}, false},
+		{"pinned CA without client cert", Options{CAFile: ca.certFile}, true},
+		{"other CA", Options{CAFile: otherCA.certFile, CertFile: clientCert.certFile, KeyFile: clientCert.keyFile}, true},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			clientConfig, err := NewClientTLSConfig(tt.options)
+			assert.Nil(t, err)
+			client := http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}, Timeout: 10 * time.Second}
+
+			resp, err := client.Get(server.URL)
+			if tt.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			resp.Body.Close()
+		})
+	}
+}
+
+func TestOptionalClientCert(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil)
+	serverCert := newTestCert(t, dir, "server", ca)
+	clientCert := newTestCert(t, dir, "client", ca)
+	otherCA := newTestCert(t, dir, "other-ca", nil)
+	otherClientCert := newTestCert(t, dir, "other-client", otherCA)
+
+	serverConfig, err := NewServerTLSConfig(Options{CertFile: serverCert.certFile, KeyFile: serverCert.keyFile, CAFile: ca.certFile})
+	assert.Nil(t, err)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = serverConfig
+	server.StartTLS()
+	defer server.Close()
+
+	testCases := []struct {
+		name      string
+		options   Options
+		expectErr bool
+	}{
+		{"client cert signed by client CA", Options{CAFile: ca.certFile, CertFile: clientCert.certFile, KeyFile: clientCert.keyFile}, false},
+		{"without client cert", Options{CAFile: ca.certFile}, false},
+		{"client cert signed by other CA", Options{CAFile: ca.certFile, CertFile: otherClientCert.certFile, KeyFile: otherClientCert.keyFile}, true},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			clientConfig, err := NewClientTLSConfig(tt.options)
+			assert.Nil(t, err)
+			if len(clientConfig.Certificates) > 0 {
+				// send the client certificate even if it is not signed by the CAs the server accepts
+				clientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					return &clientConfig.Certificates[0], nil
+				}
+			}
+			client := http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}, Timeout: 10 * time.Second}
+
+			resp, err := client.Get(server.URL)
+			if tt.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			resp.Body.Close()
+		})
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	dir := t.TempDir()
+	serverCert := newTestCert(t, dir, "server", nil)
+
+	_, err := NewServerTLSConfig(Options{})
+	assert.NotNil(t, err)
+	_, err = NewServerTLSConfig(Options{CertFile: serverCert.certFile})
+	assert.NotNil(t, err, "Expecting error when server key file is not set")
+	_, err = NewServerTLSConfig(Options{KeyFile: serverCert.keyFile})
+	assert.NotNil(t, err, "Expecting error when server certificate file is not set")
+	assert.True(t, Options{KeyFile: serverCert.keyFile}.IsServerEnabled(), "Expecting partial server options validated")
+	_, err = NewServerTLSConfig(Options{CertFile: serverCert.certFile, KeyFile: serverCert.keyFile, RequireClientCert: true})
+	assert.NotNil(t, err, "Expecting error when client CA is not set")
+	_, err = NewClientTLSConfig(Options{})
+	assert.NotNil(t, err)
+	_, err = NewClientTLSConfig(Options{CAFile: serverCert.keyFile})
+	assert.NotNil(t, err, "Expecting error when CA file has no certificate")
+}
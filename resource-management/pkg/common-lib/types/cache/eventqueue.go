@@ -22,6 +22,7 @@ import (
 	"k8s.io/klog/v2"
 	"sort"
 	"sync"
+	"sync/atomic"
 
 	"global-resource-service/resource-management/pkg/common-lib/metrics"
 	"global-resource-service/resource-management/pkg/common-lib/types"
@@ -90,14 +91,24 @@ func (q *EventQueue) GetEventIndexSinceResourceVersion(resourceVersion uint64) (
 
 	oldestRV := e.GetResourceVersionInt64()
 	if oldestRV > resourceVersion {
-		return -1, errors.New(fmt.Sprintf("Resource Partition %v events oldest resource Version %d is newer than requested resource version %d",
-			e.GetGeoInfo().ResourcePartition, oldestRV, resourceVersion))
+		// events since the requested resource version are evicted, caller needs to relist
+		return -1, fmt.Errorf("%w. Resource Partition %v events oldest resource Version %d is newer than requested resource version %d",
+			types.Error_ResourceVersionExpired, e.GetGeoInfo().ResourcePartition, oldestRV, resourceVersion)
 	}
 
 	index := sort.Search(q.endPos-q.startPos, func(i int) bool {
-		return q.circularEventQueue[(q.startPos+i)%LengthOfEventQueue].GetResourceVersionInt64() > resourceVersion
+		return q.circularEventQueue[(q.startPos+i)%LengthOfEventQueue].GetResourceVersionInt64() >= resourceVersion
 	})
 	index += q.startPos
+	// events generated by the service share the resource version of the latest event from the region manager,
+	// they are sent again to watches from that resource version, so that the events after them are not skipped
+	for index < q.endPos {
+		e := q.circularEventQueue[index%LengthOfEventQueue]
+		if e.GetResourceVersionInt64() != resourceVersion || isGeneratedEvent(e) {
+			break
+		}
+		index++
+	}
 	if index == q.endPos {
 		return -1, types.Error_EndOfEventQueue
 	}
@@ -107,6 +118,16 @@ func (q *EventQueue) GetEventIndexSinceResourceVersion(resourceVersion uint64) (
 	return index, nil
 }
 
+// generatedEvent is implemented by events generated by the service for existing nodes
+type generatedEvent interface {
+	IsGenerated() bool
+}
+
+func isGeneratedEvent(e runtime.Object) bool {
+	generated, isOK := e.(generatedEvent)
+	return isOK && generated.IsGenerated()
+}
+
 func (q *EventQueue) GetStartPos() int {
 	return q.startPos
 }
@@ -117,17 +138,29 @@ func (q *EventQueue) GetEndPos() int {
 
 type EventQueuesByLocation struct {
 	watchChan chan runtime.Object
+	// closed when the current watcher stops
+	watchStopCh chan struct{}
+	// number of events enqueued but not yet sent to watcher
+	pendingEventNum int64
 
 	// used to lock enqueue operation during snapshot
 	enqueueLock sync.RWMutex
 
 	eventQueueByLoc map[location.Location]*EventQueue
+	// locations with resync events since last list, watches need to list again
+	resyncLocations map[location.Location]bool
 	locationLock    sync.RWMutex
+
+	// resync events waiting to be sent to watchers, in order
+	resyncBatches   []resyncBatch
+	isResyncSending bool
+	resyncLock      sync.Mutex
 }
 
 func NewEventQueuesByLocation() *EventQueuesByLocation {
 	return &EventQueuesByLocation{
 		eventQueueByLoc: make(map[location.Location]*EventQueue),
+		resyncLocations: make(map[location.Location]bool),
 	}
 }
 
@@ -143,6 +176,7 @@ func (eq *EventQueuesByLocation) EnqueueEvent(e runtime.Object) {
 	eq.enqueueLock.Lock()
 	defer eq.enqueueLock.Unlock()
 	if eq.watchChan != nil {
+		atomic.AddInt64(&eq.pendingEventNum, 1)
 		go func() {
 			eq.watchChan <- e.GetEvent()
 		}()
@@ -158,6 +192,89 @@ func (eq *EventQueuesByLocation) EnqueueEvent(e runtime.Object) {
 	queueByLoc.EnqueueEvent(e)
 }
 
+// EnqueueResyncEvents sends events generated by the service for existing nodes, e.g. nodes of reassigned virtual node
+// stores, to the current watcher. The events keep the resource versions of the nodes, which are older than the events
+// already queued, so they are not added to the event queues. Watches started afterwards need to list again.
+// The events are sent in order by a background sender, so that a slow watcher does not block the caller.
+func (eq *EventQueuesByLocation) EnqueueResyncEvents(events []runtime.Object) {
+	eq.enqueueLock.Lock()
+	defer eq.enqueueLock.Unlock()
+	if eq.watchChan != nil && len(events) > 0 {
+		eq.queueResyncBatch(resyncBatch{events: events, watchChan: eq.watchChan, stopCh: eq.watchStopCh})
+	}
+
+	eq.locationLock.Lock()
+	defer eq.locationLock.Unlock()
+	for _, e := range events {
+		eq.resyncLocations[*e.GetLocation()] = true
+	}
+}
+
+// resyncBatch is a batch of resync events to be sent to the watcher that was current when they were enqueued
+type resyncBatch struct {
+	events    []runtime.Object
+	watchChan chan runtime.Object
+	stopCh    chan struct{}
+}
+
+// queueResyncBatch appends the batch to the pending resync batches and starts the sender if it is not running
+func (eq *EventQueuesByLocation) queueResyncBatch(batch resyncBatch) {
+	eq.resyncLock.Lock()
+	defer eq.resyncLock.Unlock()
+	eq.resyncBatches = append(eq.resyncBatches, batch)
+	if !eq.isResyncSending {
+		eq.isResyncSending = true
+		go eq.sendResyncBatches()
+	}
+}
+
+// sendResyncBatches sends pending resync batches in order until there is none left
+// Events of a batch are dropped once its watcher stops
+func (eq *EventQueuesByLocation) sendResyncBatches() {
+	for {
+		eq.resyncLock.Lock()
+		if len(eq.resyncBatches) == 0 {
+			eq.isResyncSending = false
+			eq.resyncLock.Unlock()
+			return
+		}
+		batch := eq.resyncBatches[0]
+		eq.resyncBatches = eq.resyncBatches[1:]
+		eq.resyncLock.Unlock()
+
+		for _, e := range batch.events {
+			if !sendToWatcher(e, batch.watchChan, batch.stopCh, &eq.pendingEventNum) {
+				break
+			}
+		}
+	}
+}
+
+// sendToWatcher sends the event to the watcher, blocking until it is sent or the watcher stops
+// Returns false if the watcher stopped
+func sendToWatcher(e runtime.Object, watchChan chan runtime.Object, stopCh chan struct{}, pendingEventNum *int64) bool {
+	atomic.AddInt64(pendingEventNum, 1)
+	select {
+	case watchChan <- e.GetEvent():
+		return true
+	case <-stopCh:
+		return false
+	}
+}
+
+// ClearResync allows watches from the resource versions of a list again
+// Caller needs to hold the snapshot lock so that no resync event is missed by the list
+func (eq *EventQueuesByLocation) ClearResync() {
+	eq.locationLock.Lock()
+	defer eq.locationLock.Unlock()
+	eq.resyncLocations = make(map[location.Location]bool)
+}
+
+// GetPendingEventNum returns the number of events enqueued but not yet sent to watcher
+func (eq *EventQueuesByLocation) GetPendingEventNum() int {
+	return int(atomic.LoadInt64(&eq.pendingEventNum))
+}
+
 func (eq *EventQueuesByLocation) Watch(rvs types.InternalResourceVersionMap, clientWatchChan chan runtime.Object, stopCh chan struct{}) error {
 	if eq.watchChan != nil {
 		return errors.New("currently only support one watcher per object event queue")
@@ -170,6 +287,7 @@ func (eq *EventQueuesByLocation) Watch(rvs types.InternalResourceVersionMap, cli
 	}
 
 	eq.watchChan = make(chan runtime.Object, 1000)
+	eq.watchStopCh = stopCh
 	// writing event to channel
 	go func(downstreamCh chan runtime.Object, initEvents []runtime.Object, stopCh chan struct{}, upstreamCh chan runtime.Object) {
 		if downstreamCh == nil {
@@ -185,6 +303,7 @@ func (eq *EventQueuesByLocation) Watch(rvs types.InternalResourceVersionMap, cli
 			select {
 			case <-stopCh:
 				eq.watchChan = nil
+				atomic.StoreInt64(&eq.pendingEventNum, 0)
 				klog.V(3).Infof("Watch stopped due to client request")
 				return
 			case event, ok := <-upstreamCh:
@@ -194,6 +313,7 @@ func (eq *EventQueuesByLocation) Watch(rvs types.InternalResourceVersionMap, cli
 				klog.V(9).Infof("Sending event with object id %v", event.GetId())
 				event.SetCheckpoint(int(metrics.Distributor_Sending))
 				downstreamCh <- event
+				atomic.AddInt64(&eq.pendingEventNum, -1)
 				event.SetCheckpoint(int(metrics.Distributor_Sent))
 				klog.V(9).Infof("Event with object id %v sent", event.GetId())
 			}
@@ -205,6 +325,13 @@ func (eq *EventQueuesByLocation) Watch(rvs types.InternalResourceVersionMap, cli
 }
 
 func (eq *EventQueuesByLocation) getAllEventsSinceResourceVersion(rvs types.InternalResourceVersionMap) ([]runtime.Object, error) {
+	eq.locationLock.RLock()
+	for loc := range eq.resyncLocations {
+		eq.locationLock.RUnlock()
+		return nil, fmt.Errorf("%w. Resource Partition %v has nodes resynced since last list", types.Error_ResourceVersionExpired, loc.GetResourcePartition())
+	}
+	eq.locationLock.RUnlock()
+
 	locStartPostitions := make(map[location.Location]int)
 
 	for loc, rv := range rvs {
@@ -0,0 +1,46 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+// HostCapacity is the number of hosts that are free for new client registration, and already assigned to clients
+type HostCapacity struct {
+	FreeHostNum     int `json:"free_hosts"`
+	AssignedHostNum int `json:"assigned_hosts"`
+}
+
+func (c *HostCapacity) Add(other HostCapacity) {
+	c.FreeHostNum += other.FreeHostNum
+	c.AssignedHostNum += other.AssignedHostNum
+}
+
+// ResourcePartitionCapacity is host capacity of a resource partition, broken down by machine type
+type ResourcePartitionCapacity struct {
+	HostCapacity
+	MachineTypes map[NodeMachineType]HostCapacity `json:"machine_types,omitempty"`
+}
+
+// RegionCapacity is host capacity of a region, broken down by resource partition name
+type RegionCapacity struct {
+	HostCapacity
+	ResourcePartitions map[string]*ResourcePartitionCapacity `json:"resource_partitions,omitempty"`
+}
+
+// CapacitySummary is host capacity of the service, broken down by region name
+type CapacitySummary struct {
+	HostCapacity
+	Regions map[string]*RegionCapacity `json:"regions,omitempty"`
+}
@@ -23,13 +23,30 @@ const (
 	ErrMsg_HostRequestExceedCapacity  = "Requested hosts exceeds capacity"
 	ErrMsg_HostRequestLessThanMiniaml = "Requested host number less than minimal request"
 
-	ErrMsg_ClientIdExisted = "Client id exists"
+	ErrMsg_ClientIdExisted            = "Client id exists"
+	ErrMsg_ClientNotRegistered        = "Client not registered"
+	ErrMsg_ClientRegistrationConflict = "Client registered with different resource request"
 
 	ErrMsg_FailedToProcessBookmarkEvent = "Failed to process bookmark events"
 
-	ErrMsg_EndOfEventQueue = "Reach the end of event queue"
+	ErrMsg_EndOfEventQueue        = "Reach the end of event queue"
+	ErrMsg_ResourceVersionExpired = "Requested resource version is expired"
 
 	ErrMsg_ObjectNotFound = "Object not found"
+
+	ErrMsg_InvalidToken     = "Missing or invalid bearer token"
+	ErrMsg_TokenExpired     = "Bearer token expired"
+	ErrMsg_PermissionDenied = "Permission denied"
+
+	ErrMsg_RequestRateLimited = "Too many requests"
+	ErrMsg_TooManyWatches     = "Too many concurrent watches"
+
+	ErrMsg_RegionManagerExisted    = "Region manager url exists"
+	ErrMsg_RegionManagerNotFound   = "Region manager url not found"
+	ErrMsg_InvalidRegionManagerUrl = "Invalid region manager url"
+	ErrMsg_InvalidRegionNodeAction = "Invalid action on nodes of removed region manager"
+
+	ErrMsg_InvalidNode = "Invalid node"
 )
 
 var Error_HostRequestExceedLimit = errors.New(ErrMsg_HostRequestExceedLimit)
@@ -37,9 +54,26 @@ var Error_HostRequestExceedCapacity = errors.New(ErrMsg_HostRequestExceedCapacit
 var Error_HostRequestLessThanMiniaml = errors.New(ErrMsg_HostRequestLessThanMiniaml)
 
 var Error_ClientIdExisted = errors.New(ErrMsg_ClientIdExisted)
+var Error_ClientNotRegistered = errors.New(ErrMsg_ClientNotRegistered)
+var Error_ClientRegistrationConflict = errors.New(ErrMsg_ClientRegistrationConflict)
 
 var Error_FailedToProcessBookmarkEvent = errors.New(ErrMsg_FailedToProcessBookmarkEvent)
 
 var Error_EndOfEventQueue = errors.New(ErrMsg_EndOfEventQueue)
+var Error_ResourceVersionExpired = errors.New(ErrMsg_ResourceVersionExpired)
 
 var Error_ObjectNotFound = errors.New(ErrMsg_ObjectNotFound)
+
+var Error_InvalidToken = errors.New(ErrMsg_InvalidToken)
+var Error_TokenExpired = errors.New(ErrMsg_TokenExpired)
+var Error_PermissionDenied = errors.New(ErrMsg_PermissionDenied)
+
+var Error_RequestRateLimited = errors.New(ErrMsg_RequestRateLimited)
+var Error_TooManyWatches = errors.New(ErrMsg_TooManyWatches)
+
+var Error_RegionManagerExisted = errors.New(ErrMsg_RegionManagerExisted)
+var Error_RegionManagerNotFound = errors.New(ErrMsg_RegionManagerNotFound)
+var Error_InvalidRegionManagerUrl = errors.New(ErrMsg_InvalidRegionManagerUrl)
+var Error_InvalidRegionNodeAction = errors.New(ErrMsg_InvalidRegionNodeAction)
+
+var Error_InvalidNode = errors.New(ErrMsg_InvalidNode)
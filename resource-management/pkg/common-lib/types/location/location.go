@@ -247,6 +247,12 @@ func (loc *Location) GetResourcePartition() ResourcePartition {
 	return loc.partition
 }
 
+// IsValid returns true if the region and resource partition are defined
+func (loc *Location) IsValid() bool {
+	_, isOK := regionRPToArc[*loc]
+	return isOK
+}
+
 func (loc *Location) GetArcRangeFromLocation() (float64, float64) {
 	locArc := regionRPToArc[*loc]
 	return locArc.lower, locArc.upper
@@ -22,12 +22,46 @@ import (
 	"time"
 
 	"k8s.io/klog/v2"
+
+	"global-resource-service/resource-management/pkg/common-lib/types/location"
 )
 
 const (
 	PreserveNode_KeyPrefix = "MinNode"
+
+	// max time LastUpdatedTime of a valid node can be ahead of the local clock
+	MaxNodeClockSkew = 10 * time.Minute
+)
+
+// Reasons a node is invalid, see NodeValidationError
+const (
+	NodeInvalidReason_Id              = "id"
+	NodeInvalidReason_ResourceVersion = "resource_version"
+	NodeInvalidReason_GeoInfo         = "geo_info"
+	NodeInvalidReason_Resource        = "resource"
+	NodeInvalidReason_Timestamp       = "timestamp"
+	// the event has no node, or is not of type added, modified or deleted
+	NodeInvalidReason_Event = "event"
 )
 
+// NodeValidationError is the error of an invalid node, it wraps Error_InvalidNode
+type NodeValidationError struct {
+	Reason  string
+	Message string
+}
+
+func (e *NodeValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrMsg_InvalidNode, e.Message)
+}
+
+func (e *NodeValidationError) Unwrap() error {
+	return Error_InvalidNode
+}
+
+func newNodeValidationError(reason string, format string, args ...interface{}) *NodeValidationError {
+	return &NodeValidationError{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
 // for now, simply define those as string
 // RegionName and ResourcePartitionName are updated to int per initial performance test of distributor ProcessEvents
 // Later the data type might be changed back to string due to further performance evaluation result
@@ -144,6 +178,33 @@ func (n *LogicalNode) GetResourceVersionInt64() uint64 {
 	return rv
 }
 
+// Validate returns NodeValidationError if the node is invalid: empty id, resource version not a positive integer,
+// undefined region or resource partition, negative resource, or last updated time not set or ahead of now by more than MaxNodeClockSkew
+func (n *LogicalNode) Validate(now time.Time) error {
+	if n.Id == "" {
+		return newNodeValidationError(NodeInvalidReason_Id, "empty id")
+	}
+	if rv, err := strconv.ParseUint(n.ResourceVersion, 10, 64); err != nil || rv == 0 {
+		return newNodeValidationError(NodeInvalidReason_ResourceVersion, "node %s has invalid resource version %q", n.Id, n.ResourceVersion)
+	}
+	if !location.NewLocation(location.Region(n.GeoInfo.Region), location.ResourcePartition(n.GeoInfo.ResourcePartition)).IsValid() {
+		return newNodeValidationError(NodeInvalidReason_GeoInfo, "node %s has invalid region %v or resource partition %v", n.Id, n.GeoInfo.Region, n.GeoInfo.ResourcePartition)
+	}
+	r := n.AllocatableResource
+	if r.MilliCPU < 0 || r.Memory < 0 || r.EphemeralStorage < 0 || r.AllowedPodNumber < 0 {
+		return newNodeValidationError(NodeInvalidReason_Resource, "node %s has negative allocatable resource %+v", n.Id, r)
+	}
+	for name, quantity := range r.ScalarResources {
+		if quantity < 0 {
+			return newNodeValidationError(NodeInvalidReason_Resource, "node %s has negative allocatable resource %s: %d", n.Id, name, quantity)
+		}
+	}
+	if n.LastUpdatedTime.IsZero() || n.LastUpdatedTime.Sub(now) > MaxNodeClockSkew {
+		return newNodeValidationError(NodeInvalidReason_Timestamp, "node %s has invalid last updated time %v", n.Id, n.LastUpdatedTime)
+	}
+	return nil
+}
+
 func (n *LogicalNode) GetKey() string {
 	if n != nil {
 		return fmt.Sprintf("%s.%s.%v.%v", PreserveNode_KeyPrefix, n.Id, n.GeoInfo.Region, n.GeoInfo.ResourcePartition)
@@ -0,0 +1,67 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+
+	"global-resource-service/resource-management/pkg/common-lib/types/location"
+)
+
+func TestLogicalNode_Validate(t *testing.T) {
+	now := time.Now()
+	newNode := func() *LogicalNode {
+		return &LogicalNode{
+			Id:                  "node1",
+			ResourceVersion:     "10",
+			GeoInfo:             NodeGeoInfo{Region: RegionName(location.Beijing), ResourcePartition: ResourcePartitionName(location.ResourcePartition2)},
+			AllocatableResource: NodeResource{MilliCPU: 100, ScalarResources: map[ResourceName]int64{"GPU": 1}},
+			LastUpdatedTime:     now,
+		}
+	}
+	assert.Nil(t, newNode().Validate(now))
+
+	testCases := []struct {
+		name   string
+		modify func(n *LogicalNode)
+		reason string
+	}{
+		{"empty id", func(n *LogicalNode) { n.Id = "" }, NodeInvalidReason_Id},
+		{"resource version not a number", func(n *LogicalNode) { n.ResourceVersion = "abc" }, NodeInvalidReason_ResourceVersion},
+		{"resource version zero", func(n *LogicalNode) { n.ResourceVersion = "0" }, NodeInvalidReason_ResourceVersion},
+		{"undefined region", func(n *LogicalNode) { n.GeoInfo.Region = 100 }, NodeInvalidReason_GeoInfo},
+		{"undefined resource partition", func(n *LogicalNode) { n.GeoInfo.ResourcePartition = -1 }, NodeInvalidReason_GeoInfo},
+		{"negative memory", func(n *LogicalNode) { n.AllocatableResource.Memory = -1 }, NodeInvalidReason_Resource},
+		{"negative scalar resource", func(n *LogicalNode) { n.AllocatableResource.ScalarResources["GPU"] = -1 }, NodeInvalidReason_Resource},
+		{"no last updated time", func(n *LogicalNode) { n.LastUpdatedTime = time.Time{} }, NodeInvalidReason_Timestamp},
+		{"last updated time in future", func(n *LogicalNode) { n.LastUpdatedTime = now.Add(time.Hour) }, NodeInvalidReason_Timestamp},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			n := newNode()
+			tc.modify(n)
+			err := n.Validate(now)
+			assert.True(t, errors.Is(err, Error_InvalidNode))
+			var validationErr *NodeValidationError
+			assert.True(t, errors.As(err, &validationErr))
+			assert.Equal(t, tc.reason, validationErr.Reason)
+		})
+	}
+}
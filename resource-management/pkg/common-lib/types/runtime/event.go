@@ -17,6 +17,7 @@ limitations under the License.
 package runtime
 
 import (
+	"fmt"
 	"time"
 
 	common_lib "global-resource-service/resource-management/pkg/common-lib"
@@ -36,8 +37,10 @@ const (
 )
 
 type NodeEvent struct {
-	Type        EventType
-	Node        *types.LogicalNode
+	Type EventType
+	Node *types.LogicalNode
+	// Trace is set only for traced events
+	Trace       *TraceContext `json:",omitempty"`
 	checkpoints []time.Time
 }
 
@@ -45,17 +48,31 @@ func NewNodeEvent(node *types.LogicalNode, eventType EventType) *NodeEvent {
 	return &NodeEvent{
 		Type:        eventType,
 		Node:        node,
-		checkpoints: make([]time.Time, common_lib.Len_ResourceManagementCheckpoint),
+		checkpoints: make([]time.Time, common_lib.GetCheckpointNum()),
 	}
 }
 
+// Validate returns types.NodeValidationError if the event is not an added, modified or deleted event of a valid node
+func (e *NodeEvent) Validate(now time.Time) error {
+	if e.Node == nil {
+		return &types.NodeValidationError{Reason: types.NodeInvalidReason_Event, Message: fmt.Sprintf("%s event without node", e.Type)}
+	}
+	if e.Type != Added && e.Type != Modified && e.Type != Deleted {
+		return &types.NodeValidationError{Reason: types.NodeInvalidReason_Event, Message: fmt.Sprintf("node %s has event type %q", e.Node.Id, e.Type)}
+	}
+	return e.Node.Validate(now)
+}
+
 func (e *NodeEvent) SetCheckpoint(checkpoint int) {
 	if !common_lib.ResourceManagementMeasurement_Enabled {
 		return
 	}
 
-	if e.checkpoints == nil {
-		e.checkpoints = make([]time.Time, common_lib.Len_ResourceManagementCheckpoint)
+	if len(e.checkpoints) <= checkpoint {
+		// checkpoint registered after the event is created
+		checkpoints := make([]time.Time, common_lib.GetCheckpointNum())
+		copy(checkpoints, e.checkpoints)
+		e.checkpoints = checkpoints
 	}
 	e.checkpoints[checkpoint] = time.Now().UTC()
 }
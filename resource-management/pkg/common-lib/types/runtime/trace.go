@@ -0,0 +1,92 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Names of trace hops stamped outside of the service checkpoints
+const (
+	TraceHop_RegionManagerSent = "RRM_SENT"
+	TraceHop_ServiceSending    = "SER_SENDING"
+	TraceHop_ClientReceived    = "CLIENT_RECEIVED"
+)
+
+// TraceContext is optional trace metadata of an event, carried in the watch wire format
+// from region manager through the service to watch clients
+type TraceContext struct {
+	TraceId string `json:"trace_id"`
+	// OriginTime is when the change happened in region manager
+	OriginTime time.Time  `json:"origin_time"`
+	Hops       []TraceHop `json:"hops,omitempty"`
+}
+
+// TraceHop is the time an event passed a stage on its way to clients
+type TraceHop struct {
+	Name string    `json:"name"`
+	Time time.Time `json:"time"`
+}
+
+// TraceSpan is the duration between two consecutive hops of an event, or between the origin and the first hop
+type TraceSpan struct {
+	TraceId string    `json:"trace_id"`
+	Name    string    `json:"name"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+}
+
+func NewTraceContext(originTime time.Time) *TraceContext {
+	return &TraceContext{
+		TraceId:    uuid.New().String(),
+		OriginTime: originTime,
+	}
+}
+
+// WithHops returns a copy of the trace context with the hops appended
+func (t *TraceContext) WithHops(hops ...TraceHop) *TraceContext {
+	ret := &TraceContext{
+		TraceId:    t.TraceId,
+		OriginTime: t.OriginTime,
+		Hops:       make([]TraceHop, 0, len(t.Hops)+len(hops)),
+	}
+	ret.Hops = append(ret.Hops, t.Hops...)
+	ret.Hops = append(ret.Hops, hops...)
+	return ret
+}
+
+// GetSpans returns the timeline of the event as spans between consecutive hops, each span is named by the hop ending it
+func (t *TraceContext) GetSpans() []TraceSpan {
+	spans := make([]TraceSpan, len(t.Hops))
+	start := t.OriginTime
+	for i, hop := range t.Hops {
+		spans[i] = TraceSpan{TraceId: t.TraceId, Name: hop.Name, Start: start, End: hop.Time}
+		start = hop.Time
+	}
+	return spans
+}
+
+// WithTraceHops returns a shallow copy of the event with the hops appended to its trace context, for encoding to the next hop.
+// Returns the event itself if it is not traced.
+func (e *NodeEvent) WithTraceHops(hops ...TraceHop) *NodeEvent {
+	if e.Trace == nil {
+		return e
+	}
+	return &NodeEvent{Type: e.Type, Node: e.Node, Trace: e.Trace.WithHops(hops...)}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"global-resource-service/resource-management/pkg/common-lib/types"
+)
+
+func TestTraceContext_WithHopsAndSpans(t *testing.T) {
+	origin := time.Now().UTC()
+	trace := NewTraceContext(origin)
+	assert.NotEqual(t, "", trace.TraceId)
+
+	sent := trace.WithHops(TraceHop{Name: TraceHop_RegionManagerSent, Time: origin.Add(time.Millisecond)})
+	received := sent.WithHops(TraceHop{Name: TraceHop_ClientReceived, Time: origin.Add(5 * time.Millisecond)})
+	// hops are appended to copies
+	assert.Equal(t, 0, len(trace.Hops))
+	assert.Equal(t, 1, len(sent.Hops))
+	assert.Equal(t, trace.TraceId, received.TraceId)
+
+	assert.Equal(t, []TraceSpan{
+		{TraceId: trace.TraceId, Name: TraceHop_RegionManagerSent, Start: origin, End: origin.Add(time.Millisecond)},
+		{TraceId: trace.TraceId, Name: TraceHop_ClientReceived, Start: origin.Add(time.Millisecond), End: origin.Add(5 * time.Millisecond)},
+	}, received.GetSpans())
+}
+
+func TestNodeEvent_TraceWireFormat(t *testing.T) {
+	node := &types.LogicalNode{Id: "node1", ResourceVersion: "10", LastUpdatedTime: time.Now().UTC()}
+
+	// untraced events are encoded without trace
+	event := NewNodeEvent(node, Modified)
+	assert.Equal(t, event, event.WithTraceHops(TraceHop{Name: TraceHop_RegionManagerSent, Time: time.Now().UTC()}))
+	b, err := json.Marshal(event)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(b), "Trace")
+
+	event.Trace = NewTraceContext(node.LastUpdatedTime)
+	wireEvent := event.WithTraceHops(TraceHop{Name: TraceHop_RegionManagerSent, Time: time.Now().UTC()})
+	assert.Equal(t, 0, len(event.Trace.Hops))
+	b, err = json.Marshal(wireEvent)
+	assert.Nil(t, err)
+
+	decoded := NodeEvent{}
+	assert.Nil(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, Modified, decoded.Type)
+	assert.Equal(t, "node1", decoded.Node.Id)
+	assert.Equal(t, event.Trace.TraceId, decoded.Trace.TraceId)
+	assert.True(t, event.Trace.OriginTime.Equal(decoded.Trace.OriginTime))
+	assert.Equal(t, 1, len(decoded.Trace.Hops))
+	assert.Equal(t, TraceHop_RegionManagerSent, decoded.Trace.Hops[0].Name)
+}
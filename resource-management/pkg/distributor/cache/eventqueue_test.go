@@ -17,6 +17,7 @@ limitations under the License.
 package cache
 
 import (
+	"errors"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 
@@ -95,6 +96,7 @@ func Test_getEventIndexSinceResourceVersion_ByLoc(t *testing.T) {
 	index, err = qloc.GetEventIndexSinceResourceVersion(uint64(11))
 	assert.NotNil(t, err)
 	assert.True(t, strings.Contains(err.Error(), "newer than requested resource version 11"))
+	assert.True(t, errors.Is(err, types.Error_ResourceVersionExpired))
 	assert.Equal(t, -1, index)
 
 	// search rv 10100
@@ -20,7 +20,9 @@ import (
 	"errors"
 	"fmt"
 	"k8s.io/klog/v2"
+	"reflect"
 	"sync"
+	"time"
 
 	"global-resource-service/resource-management/pkg/common-lib/interfaces/store"
 	"global-resource-service/resource-management/pkg/common-lib/metrics"
@@ -40,11 +42,24 @@ type ResourceDistributor struct {
 
 	// clientId to virtual node store map
 	clientToStores map[string][]*storage.VirtualNodeStore
-	allocateLock   sync.RWMutex
+	// clientId to registered client, granted resource of the client is in client.Resource
+	clients      map[string]*types.Client
+	allocateLock sync.RWMutex
+
+	// clientId to client lease expire time
+	clientLeaseExpireTime map[string]time.Time
+	// clientId to generation of the client lease, tokens issued on registration are valid for the generation only
+	clientLeaseGeneration map[string]int64
+	lastLeaseGeneration   int64
+	clientLeaseDuration   time.Duration
+	leaseLock             sync.Mutex
 
 	persistHelper store.StoreInterface
 }
 
+// Distributor_Persisted is passed once nodes of the events are saved to store, events may be sent to clients before
+var Distributor_Persisted = metrics.RegisterRecordedCheckpoint("DIS_PERSISTED")
+
 var _distributor *ResourceDistributor = nil
 var once sync.Once
 
@@ -52,14 +67,20 @@ const (
 	MinimalRequestHostNum = 50
 )
 
-var virutalStoreNumPerResourcePartition = 1000 // 50K per resource partition, 50 hosts per virtual node store
+// target host number per virtual node store. Virtual node stores in each resource partition are split or merged
+// as the resource partition size changes, to keep allocation granularity near MinimalRequestHostNum
+var hostsPerVirtualStore = MinimalRequestHostNum
 
 func GetResourceDistributor() *ResourceDistributor {
 	once.Do(func() {
 		_distributor = &ResourceDistributor{
-			defaultNodeStore:  createNodeStore(),
-			nodeEventQueueMap: make(map[string]*cache.NodeEventQueue),
-			clientToStores:    make(map[string][]*storage.VirtualNodeStore),
+			defaultNodeStore:      createNodeStore(),
+			nodeEventQueueMap:     make(map[string]*cache.NodeEventQueue),
+			clientToStores:        make(map[string][]*storage.VirtualNodeStore),
+			clients:               make(map[string]*types.Client),
+			clientLeaseExpireTime: make(map[string]time.Time),
+			clientLeaseGeneration: make(map[string]int64),
+			clientLeaseDuration:   DefaultClientLeaseDuration,
 		}
 	})
 	return _distributor
@@ -69,22 +90,28 @@ func (dis *ResourceDistributor) SetPersistHelper(persistTool store.StoreInterfac
 	dis.persistHelper = persistTool
 }
 
-// TODO - get virtual node number, region num, partition num from external
+// TODO - get region num, partition num from external
 func createNodeStore() *storage.NodeStore {
-	return storage.NewNodeStore(virutalStoreNumPerResourcePartition, location.GetRegionNum(), location.GetRPNum())
+	return storage.NewNodeStore(hostsPerVirtualStore, location.GetRegionNum(), location.GetRPNum())
 }
 
 // TODO: post 630, allocate resources per request for different type of hardware and regions
+// RegisterClient is idempotent: registering an existing client id with the same resource request gets the existing
+// allocation, while a different resource request is rejected with Error_ClientRegistrationConflict
 func (dis *ResourceDistributor) RegisterClient(client *types.Client) error {
 	clientId := client.ClientId
-	assignedHostNum, err := dis.allocateNodesToClient(clientId, client.Resource.TotalMachines)
-	if err != nil {
+	assignedHostNum, err := dis.allocateNodesToClient(client)
+	if err == types.Error_ClientIdExisted {
+		return dis.getExistingRegistration(client)
+	} else if err != nil {
 		klog.Errorf("Error allocate resource for client. Error %v\n", err)
 		return err
 	}
+	dis.grantClientLease(clientId)
 
 	err = dis.persistHelper.PersistClient(clientId, client)
 	if err != nil {
+		metrics.PersistenceFailures.Inc(metrics.PersistOperation_Client)
 		klog.Errorf("Error persistent client to store. Error %v\n", err)
 		return err
 	}
@@ -93,16 +120,30 @@ func (dis *ResourceDistributor) RegisterClient(client *types.Client) error {
 	return nil
 }
 
-func (dis *ResourceDistributor) allocateNodesToClient(clientId string, requestedHostNum int) (int, error) {
+// getExistingRegistration sets client to the registered one if the resource request is same
+func (dis *ResourceDistributor) getExistingRegistration(client *types.Client) error {
+	dis.allocateLock.RLock()
+	existingClient, isOK := dis.clients[client.ClientId]
+	dis.allocateLock.RUnlock()
+	if !isOK {
+		return types.Error_ClientIdExisted
+	}
+	if !reflect.DeepEqual(existingClient.Resource, client.Resource) {
+		klog.V(3).Infof("Client %s registered with different resource request. existing %v, requested %v", client.ClientId, existingClient.Resource, client.Resource)
+		return types.Error_ClientRegistrationConflict
+	}
+
+	*client = *existingClient
+	dis.RenewClientLease(client.ClientId)
+	klog.Infof("Client id %s already registered, requested host # = %d\n", client.ClientId, client.Resource.TotalMachines)
+	return nil
+}
+
+func (dis *ResourceDistributor) allocateNodesToClient(client *types.Client) (int, error) {
+	clientId := client.ClientId
+	requestedHostNum := client.Resource.TotalMachines
 	dis.allocateLock.Lock()
 	defer dis.allocateLock.Unlock()
-	if requestedHostNum <= MinimalRequestHostNum {
-		return 0, types.Error_HostRequestLessThanMiniaml
-	} else if requestedHostNum > dis.defaultNodeStore.GetTotalHostNum() {
-		return 0, types.Error_HostRequestExceedLimit
-	} else if !dis.defaultNodeStore.CheckFreeCapacity(requestedHostNum) {
-		return 0, types.Error_HostRequestExceedCapacity
-	}
 
 	// check client id existence
 	if _, isOK := dis.nodeEventQueueMap[clientId]; isOK {
@@ -112,6 +153,14 @@ func (dis *ResourceDistributor) allocateNodesToClient(clientId string, requested
 		return 0, types.Error_ClientIdExisted
 	}
 
+	if requestedHostNum <= MinimalRequestHostNum {
+		return 0, types.Error_HostRequestLessThanMiniaml
+	} else if requestedHostNum > dis.defaultNodeStore.GetTotalHostNum() {
+		return 0, types.Error_HostRequestExceedLimit
+	} else if !dis.defaultNodeStore.CheckFreeCapacity(requestedHostNum) {
+		return 0, types.Error_HostRequestExceedCapacity
+	}
+
 	// allocate virtual nodes to client
 	// get all virtual stores that are unassigned
 	allStores := dis.defaultNodeStore.GetVirtualStores()
@@ -122,7 +171,7 @@ func (dis *ResourceDistributor) allocateNodesToClient(clientId string, requested
 		}
 	}
 	if len(freeStores) == 0 {
-		return 0, errors.New("No available hosts")
+		return 0, types.Error_HostRequestExceedCapacity
 	}
 
 	// Get sorted virtual node stores based on ordering criteria
@@ -139,7 +188,7 @@ func (dis *ResourceDistributor) allocateNodesToClient(clientId string, requested
 		}
 	}
 	if !hostAssignIsOK {
-		return 0, errors.New("Not enough hosts")
+		return 0, types.Error_HostRequestExceedCapacity
 	}
 
 	// Create event queue for client
@@ -152,6 +201,8 @@ func (dis *ResourceDistributor) allocateNodesToClient(clientId string, requested
 		store.AssignToClient(clientId, eventQueue)
 	}
 	dis.clientToStores[clientId] = selectedStores
+	clientCopy := *client
+	dis.clients[clientId] = &clientCopy
 
 	// persist virtual node assignment
 	dis.persistVirtualNodesAssignment(clientId, selectedStores)
@@ -193,14 +244,16 @@ func (dis *ResourceDistributor) ListNodesForClient(clientId string) ([]*types.Lo
 	if clientId == "" {
 		return nil, nil, errors.New("Empty clientId")
 	}
+	// hold allocate lock during snapshot so that virtual node stores assigned to client won't be split or merged
 	dis.allocateLock.RLock()
 	assignedStores, isOK := dis.clientToStores[clientId]
-	dis.allocateLock.RUnlock()
 	if !isOK {
-		return nil, nil, errors.New(fmt.Sprintf("Client %s not registered.", clientId))
+		dis.allocateLock.RUnlock()
+		return nil, nil, types.Error_ClientNotRegistered
 	}
 	eventQueue, isOK := dis.nodeEventQueueMap[clientId]
 	if !isOK {
+		dis.allocateLock.RUnlock()
 		return nil, nil, errors.New(fmt.Sprintf("Internal error: missing event queue for Client %s.", clientId))
 	}
 
@@ -212,7 +265,10 @@ func (dis *ResourceDistributor) ListNodesForClient(clientId string) ([]*types.Lo
 		nodesByStore[i], rvMapByStore[i] = assignedStores[i].SnapShot()
 		hostCount += len(nodesByStore[i])
 	}
+	eventQueue.ClearResync()
 	eventQueue.ReleaseSnapshotRLock()
+	dis.allocateLock.RUnlock()
+	dis.RenewClientLease(clientId)
 
 	// combine to single array of nodeEvent
 	nodes := make([]*types.LogicalNode, hostCount)
@@ -243,10 +299,11 @@ func (dis *ResourceDistributor) ListNodesForClient(clientId string) ([]*types.Lo
 }
 
 func (dis *ResourceDistributor) Watch(clientId string, rvs types.TransitResourceVersionMap, watchChan chan runtime.Object, stopCh chan struct{}) error {
-	var nodeEventQueue *cache.NodeEventQueue
-	var isOK bool
-	if nodeEventQueue, isOK = dis.nodeEventQueueMap[clientId]; !isOK || nodeEventQueue == nil {
-		return errors.New(fmt.Sprintf("Client %s not registered", clientId))
+	dis.allocateLock.RLock()
+	nodeEventQueue, isOK := dis.nodeEventQueueMap[clientId]
+	dis.allocateLock.RUnlock()
+	if !isOK || nodeEventQueue == nil {
+		return types.Error_ClientNotRegistered
 	}
 	if rvs == nil {
 		return errors.New("Invalid resource versions: nil")
@@ -259,32 +316,124 @@ func (dis *ResourceDistributor) Watch(clientId string, rvs types.TransitResource
 	}
 
 	internal_rvs := types.ConvertToInternalResourceVersionMap(rvs)
+	dis.RenewClientLease(clientId)
 
 	return nodeEventQueue.Watch(internal_rvs, watchChan, stopCh)
 }
 
+// ProcessEvents applies node events to the node store and sends them to clients
+// Nil events and events with invalid locations are skipped, the events after them are still processed
 func (dis *ResourceDistributor) ProcessEvents(events []*runtime.NodeEvent) (bool, types.TransitResourceVersionMap) {
-	eventsToProcess := make([]*node.ManagedNodeEvent, len(events))
+	eventsToProcess := make([]*node.ManagedNodeEvent, 0, len(events))
 	for i := 0; i < len(events); i++ {
-		if events[i] != nil {
-			loc := location.NewLocation(location.Region(events[i].Node.GeoInfo.Region), location.ResourcePartition(events[i].Node.GeoInfo.ResourcePartition))
-			events[i].SetCheckpoint(int(metrics.Distributor_Received))
-			if loc != nil {
-				eventsToProcess[i] = node.NewManagedNodeEvent(events[i], loc)
-			} else {
-				klog.Errorf("Invalid region %v and/or resource partition %v\n", events[i].Node.GeoInfo.Region, events[i].Node.GeoInfo.ResourcePartition)
-			}
-		} else {
-			break
+		if events[i] == nil {
+			continue
+		}
+		if events[i].Node == nil {
+			klog.Errorf("Skip node event without node at index %d", i)
+			continue
+		}
+		loc := location.NewLocation(location.Region(events[i].Node.GeoInfo.Region), location.ResourcePartition(events[i].Node.GeoInfo.ResourcePartition))
+		events[i].SetCheckpoint(int(metrics.Distributor_Received))
+		if !loc.IsValid() {
+			klog.Errorf("Invalid region %v and/or resource partition %v\n", events[i].Node.GeoInfo.Region, events[i].Node.GeoInfo.ResourcePartition)
+			continue
 		}
+		metrics.NodeEventsProcessed.Inc(loc.GetRegion().String(), loc.GetResourcePartition().String())
+		eventsToProcess = append(eventsToProcess, node.NewManagedNodeEvent(events[i], loc))
 	}
 
 	persistHelper := storage.NewDistributorPersistHelper(dis.persistHelper)
 	result, rvMap := dis.defaultNodeStore.ProcessNodeEvents(eventsToProcess, persistHelper)
-	persistHelper.WaitForAllNodesSaved()
+	if persistHelper.WaitForAllNodesSaved() {
+		// only events handed to the store are persisted
+		for _, e := range eventsToProcess {
+			metrics.RecordCheckpoint(e.GetNodeEvent(), Distributor_Persisted)
+		}
+	} else {
+		// events are sent to clients, but not durable until processed again
+		klog.Errorf("Failed to save nodes of %d events to store", len(eventsToProcess))
+		result = false
+	}
+
+	if dis.defaultNodeStore.NeedsVirtualStoreAdjustment() {
+		dis.adjustVirtualStores()
+	}
 	return result, rvMap
 }
 
+// RestoreNodeStore loads nodes persisted in store to the node store, to resume after service restart
+// It returns the number of nodes restored
+func (dis *ResourceDistributor) RestoreNodeStore() int {
+	nodes := dis.persistHelper.GetNodes()
+	eventsToRestore := make([]*node.ManagedNodeEvent, 0, len(nodes))
+	for _, n := range nodes {
+		if n == nil {
+			continue
+		}
+		loc := location.NewLocation(location.Region(n.GeoInfo.Region), location.ResourcePartition(n.GeoInfo.ResourcePartition))
+		eventsToRestore = append(eventsToRestore, node.NewManagedNodeEvent(runtime.NewNodeEvent(n, runtime.Added), loc))
+	}
+
+	rvMap := dis.defaultNodeStore.RestoreNodeEvents(eventsToRestore)
+	if dis.defaultNodeStore.NeedsVirtualStoreAdjustment() {
+		dis.adjustVirtualStores()
+	}
+	klog.Infof("Restored %d nodes from store, resource versions %v", len(eventsToRestore), rvMap)
+	return len(eventsToRestore)
+}
+
+// SetRegionNodesStale flags nodes of the region unschedulable, or restores the flagged nodes, for clients
+// It returns the number of nodes changed
+func (dis *ResourceDistributor) SetRegionNodesStale(region location.Region, isStale bool) int {
+	changedNum := dis.defaultNodeStore.SetRegionNodesStale(region, isStale)
+	klog.Infof("Set %d nodes of region %v stale: %v", changedNum, region, isStale)
+	return changedNum
+}
+
+// DeleteRegionNodes deletes all nodes of the region from the node store and the persistent store,
+// and sends deleted events to clients
+// It returns the number of nodes deleted
+func (dis *ResourceDistributor) DeleteRegionNodes(region location.Region) int {
+	deletedNodes := dis.defaultNodeStore.DeleteRegionNodes(region)
+	if dis.defaultNodeStore.NeedsVirtualStoreAdjustment() {
+		dis.adjustVirtualStores()
+	}
+	if len(deletedNodes) > 0 {
+		persistHelper := storage.NewDistributorPersistHelper(dis.persistHelper)
+		persistHelper.SetWaitCount(len(deletedNodes))
+		for i := 0; i < len(deletedNodes); i += storage.BatchPersistSize {
+			end := i + storage.BatchPersistSize
+			if end > len(deletedNodes) {
+				end = len(deletedNodes)
+			}
+			persistHelper.PersistDeletedNodes(deletedNodes[i:end])
+		}
+		if !persistHelper.WaitForAllNodesSaved() {
+			klog.Errorf("Failed to delete %d nodes of region %v from store, they are restored after restart", len(deletedNodes), region)
+		}
+	}
+	klog.Infof("Deleted %d nodes of region %v", len(deletedNodes), region)
+	return len(deletedNodes)
+}
+
+// adjustVirtualStores splits or merges virtual node stores per resource partition size
+// and refreshes the virtual node store assignment of affected clients
+func (dis *ResourceDistributor) adjustVirtualStores() {
+	dis.allocateLock.Lock()
+	defer dis.allocateLock.Unlock()
+
+	changedClients := dis.defaultNodeStore.AdjustVirtualStores()
+	for clientId := range changedClients {
+		if _, isOK := dis.clientToStores[clientId]; !isOK {
+			continue
+		}
+		assignedStores := dis.defaultNodeStore.GetVirtualStoresAssignedToClient(clientId)
+		dis.clientToStores[clientId] = assignedStores
+		dis.persistVirtualNodesAssignment(clientId, assignedStores)
+	}
+}
+
 func (dis *ResourceDistributor) persistVirtualNodesAssignment(clientId string, assignedStores []*storage.VirtualNodeStore) bool {
 	vNodeConfigs := make([]*store.VirtualNodeConfig, len(assignedStores))
 	for i, s := range assignedStores {
@@ -305,6 +454,11 @@ func (dis *ResourceDistributor) persistVirtualNodesAssignment(clientId string, a
 	return result
 }
 
+// GetCapacity returns free and assigned host number broken down by region, resource partition and machine type
+func (dis *ResourceDistributor) GetCapacity() *types.CapacitySummary {
+	return dis.defaultNodeStore.GetCapacitySummary()
+}
+
 func (dis *ResourceDistributor) GetNodeStatus(region location.Region, resourcePartition location.ResourcePartition, nodeId string) (*types.LogicalNode, error) {
 	return dis.defaultNodeStore.GetNode(region, resourcePartition, nodeId)
 }
@@ -161,9 +161,17 @@ func TestSingleRPMutipleClients_Workflow(t *testing.T) {
 			}
 
 			// update nodes
+			updateWaitGroup := new(sync.WaitGroup)
 			for i := 0; i < tt.clientNum; i++ {
+				updateWaitGroup.Add(1)
 				go func(expectedEventCount int, nodes []*types.LogicalNode, clientId string) {
+					defer updateWaitGroup.Done()
 					for j := 0; j < expectedEventCount/len(nodes)+2; j++ {
+						select {
+						case <-stopCh:
+							return
+						default:
+						}
 						updateNodeEvents := make([]*runtime.NodeEvent, len(nodes))
 						for k := 0; k < len(nodes); k++ {
 							rvToGenerate += 1
@@ -180,9 +188,11 @@ func TestSingleRPMutipleClients_Workflow(t *testing.T) {
 				}(tt.updateEventNum, nodesByClient[i], clientIds[i])
 			}
 
-			// wait for watch done
+			// wait for watch done, then stop updating nodes before the next test sets up the distributor
 			allWaitGroup.Wait()
 			duration += time.Since(start)
+			close(stopCh)
+			updateWaitGroup.Wait()
 			t.Logf("Test %s succeed! Total duration %v\n", tt.name, duration)
 		})
 	}
@@ -229,7 +239,6 @@ func TestMultipleRPsMutipleClients_Workflow(t *testing.T) {
 
 	for _, tt := range testCases {
 		t.Run(tt.name, func(t *testing.T) {
-			virutalStoreNumPerResourcePartition = tt.hostPerRP / 50
 			distributor := setUp()
 			defer tearDown()
 
@@ -352,11 +361,20 @@ func TestMultipleRPsMutipleClients_Workflow(t *testing.T) {
 			t.Log("Starting to watch update events ##################\n")
 
 			// update nodes
+			updateStopCh := make(chan struct{})
+			updateWaitGroup := new(sync.WaitGroup)
 			for i := 0; i < tt.clientNum; i++ {
+				updateWaitGroup.Add(1)
 				go func(expectedEventCount int, nodes []*types.LogicalNode, clientId string) {
+					defer updateWaitGroup.Done()
 					eventCount := 0
 
 					for j := 0; j < expectedEventCount/len(nodes)+2; j++ {
+						select {
+						case <-updateStopCh:
+							return
+						default:
+						}
 						updateNodeEvents := make([]*runtime.NodeEvent, len(nodes))
 						for k := 0; k < len(nodes); k++ {
 							rvToGenerate += 1
@@ -377,9 +395,11 @@ func TestMultipleRPsMutipleClients_Workflow(t *testing.T) {
 				}(tt.updateEventNum, nodesByClient[i], clientIds[i])
 			}
 
-			// wait for watch done
+			// wait for watch done, then stop updating nodes before the next test sets up the distributor
 			allWaitGroup.Wait()
 			duration += time.Since(start)
+			close(updateStopCh)
+			updateWaitGroup.Wait()
 
 			t.Logf("Test %s succeed! Total duration %v\n", tt.name, duration)
 		})
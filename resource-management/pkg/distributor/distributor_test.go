@@ -20,15 +20,18 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"k8s.io/klog/v2"
+	"math"
 	"strconv"
 	"sync"
 	"testing"
 	"time"
 
+	"global-resource-service/resource-management/pkg/common-lib/hash"
 	"global-resource-service/resource-management/pkg/common-lib/types"
 	"global-resource-service/resource-management/pkg/common-lib/types/location"
 	"global-resource-service/resource-management/pkg/common-lib/types/runtime"
 	"global-resource-service/resource-management/pkg/distributor/cache"
+	"global-resource-service/resource-management/pkg/distributor/node"
 	"global-resource-service/resource-management/pkg/distributor/storage"
 )
 
@@ -41,8 +44,6 @@ var defaultLocBeijing_RP1 = location.NewLocation(location.Beijing, location.Reso
 var defaultRegion = location.Beijing
 var defaultPartition = location.ResourcePartition1
 
-const defaultVirtualStoreNumPerRP = 1000 // 50K per resource partition, 50 hosts per virtual node store
-
 var fakeStorage = &storage.FakeStorageInterface{
 	PersistDelayInNS: 20,
 }
@@ -59,6 +60,10 @@ func setUp() *ResourceDistributor {
 
 	// flush clientToStores map
 	distributor.clientToStores = make(map[string][]*storage.VirtualNodeStore)
+	distributor.clients = make(map[string]*types.Client)
+	distributor.clientLeaseExpireTime = make(map[string]time.Time)
+	distributor.clientLeaseGeneration = make(map[string]int64)
+	distributor.SetClientLeaseDuration(DefaultClientLeaseDuration)
 
 	// initialize persistent store
 	distributor.SetPersistHelper(fakeStorage)
@@ -67,7 +72,7 @@ func setUp() *ResourceDistributor {
 }
 
 func tearDown() {
-	virutalStoreNumPerResourcePartition = defaultVirtualStoreNumPerRP
+	hostsPerVirtualStore = MinimalRequestHostNum
 	singleTestLock.Unlock()
 }
 
@@ -79,7 +84,7 @@ func TestDistributorInit(t *testing.T) {
 
 	// check default virtual node stores
 	defaultNodeStores := distributor.defaultNodeStore.GetVirtualStores()
-	assert.Equal(t, true, len(*defaultNodeStores) > 500, "Expecting virtual store number >= 500")
+	assert.Equal(t, location.GetRegionNum()*location.GetRPNum(), len(*defaultNodeStores), "Expecting one virtual store per resource partition")
 
 	lower := float64(0)
 	for i := 0; i < len(*defaultNodeStores); i++ {
@@ -102,6 +107,97 @@ func TestDistributorInit(t *testing.T) {
 	}
 }
 
+func TestVirtualStoreSplitAndMerge(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+
+	// add nodes to a single resource partition, virtual stores are split around target host number
+	eventsAdd := generateAddNodeEvent(10000, defaultLocBeijing_RP1)
+	result, _ := distributor.ProcessEvents(eventsAdd)
+	assert.True(t, result)
+	stores := distributor.defaultNodeStore.GetVirtualStoresByLocation(*defaultLocBeijing_RP1)
+	assert.True(t, len(stores) > 1, "Expecting virtual store split")
+	verifyVirtualStoresInLocation(t, stores, defaultLocBeijing_RP1, 10000, 2*hostsPerVirtualStore)
+
+	client := types.Client{ClientId: uuid.New().String(), Resource: types.ResourceRequest{TotalMachines: 500}, ClientInfo: types.ClientInfoType{}}
+	err := distributor.RegisterClient(&client)
+	assert.Nil(t, err)
+	assignedStoreNum := len(distributor.clientToStores[client.ClientId])
+
+	// delete most nodes, virtual stores are merged and client assignment is kept
+	eventsDelete := make([]*runtime.NodeEvent, 9900)
+	for i := 0; i < len(eventsDelete); i++ {
+		rvToGenerate += 1
+		node := eventsAdd[i].Node.Copy()
+		node.ResourceVersion = strconv.Itoa(rvToGenerate)
+		eventsDelete[i] = runtime.NewNodeEvent(node, runtime.Deleted)
+	}
+	result, _ = distributor.ProcessEvents(eventsDelete)
+	assert.True(t, result)
+	stores = distributor.defaultNodeStore.GetVirtualStoresByLocation(*defaultLocBeijing_RP1)
+	verifyVirtualStoresInLocation(t, stores, defaultLocBeijing_RP1, 100, 2*hostsPerVirtualStore)
+	assert.True(t, len(distributor.clientToStores[client.ClientId]) <= assignedStoreNum, "Expecting virtual store merge")
+	for _, store := range distributor.clientToStores[client.ClientId] {
+		assert.Equal(t, client.ClientId, store.GetAssignedClient())
+	}
+}
+
+func TestVirtualStoreMerge_NotMarkedWithoutStoresToMerge(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+
+	// a resource partition with few hosts has a single virtual store, deleting its nodes merges nothing
+	eventsAdd := generateAddNodeEvent(10, defaultLocBeijing_RP1)
+	result, _ := distributor.ProcessEvents(eventsAdd)
+	assert.True(t, result)
+	assert.Equal(t, 1, len(distributor.defaultNodeStore.GetVirtualStoresByLocation(*defaultLocBeijing_RP1)))
+
+	rvToGenerate += 1
+	deletedNode := eventsAdd[0].Node.Copy()
+	deletedNode.ResourceVersion = strconv.Itoa(rvToGenerate)
+	distributor.defaultNodeStore.DeleteNode(node.NewManagedNodeEvent(runtime.NewNodeEvent(deletedNode, runtime.Deleted), defaultLocBeijing_RP1))
+	assert.Equal(t, 9, distributor.defaultNodeStore.GetTotalHostNum())
+	assert.False(t, distributor.defaultNodeStore.NeedsVirtualStoreAdjustment(), "Expecting no adjustment without virtual stores to merge")
+}
+
+func TestVirtualStoreSplit_Skewed(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+
+	// all nodes hash into the first sixth of the resource partition, the first split leaves them in one store
+	eventsAdd := make([]*runtime.NodeEvent, 0, 6*hostsPerVirtualStore)
+	for len(eventsAdd) < cap(eventsAdd) {
+		rvToGenerate += 1
+		node := createRandomNode(rvToGenerate, defaultLocBeijing_RP1)
+		if float64(hash.HashStrToUInt64(node.Id))/float64(math.MaxUint64) < 1.0/6 {
+			eventsAdd = append(eventsAdd, runtime.NewNodeEvent(node, runtime.Added))
+		}
+	}
+	result, _ := distributor.ProcessEvents(eventsAdd)
+	assert.True(t, result)
+	assert.True(t, distributor.defaultNodeStore.NeedsVirtualStoreAdjustment(), "Expecting skewed store checked again")
+
+	result, _ = distributor.ProcessEvents(generateAddNodeEvent(1, defaultLocBeijing_RP1))
+	assert.True(t, result)
+	stores := distributor.defaultNodeStore.GetVirtualStoresByLocation(*defaultLocBeijing_RP1)
+	verifyVirtualStoresInLocation(t, stores, defaultLocBeijing_RP1, len(eventsAdd)+1, 2*hostsPerVirtualStore)
+}
+
+func verifyVirtualStoresInLocation(t *testing.T, stores []*storage.VirtualNodeStore, loc *location.Location, expectedHostNum int, maxHostNumPerStore int) {
+	expectedLower, expectedUpper := loc.GetArcRangeFromLocation()
+	hostNum := 0
+	lower := expectedLower
+	for i, store := range stores {
+		lowerBound, upperBound := store.GetRange()
+		assert.Equal(t, lower, lowerBound, "Virtual store %d range is not contiguous", i)
+		assert.True(t, store.GetHostNum() <= maxHostNumPerStore, "Virtual store %d has %d hosts", i, store.GetHostNum())
+		lower = upperBound
+		hostNum += store.GetHostNum()
+	}
+	assert.Equal(t, expectedUpper, lower)
+	assert.Equal(t, expectedHostNum, hostNum)
+}
+
 func measureProcessEvent(t *testing.T, dis *ResourceDistributor, eventType string, events []*runtime.NodeEvent, previousNodeCount int) {
 	// get all node ids
 	nodeIds := make(map[string]bool, len(events))
@@ -226,6 +322,319 @@ func TestAddNodes(t *testing.T) {
 	}
 }
 
+// restoreStorage returns the nodes as persisted before restart
+type restoreStorage struct {
+	*storage.FakeStorageInterface
+	nodes []*types.LogicalNode
+	lock  sync.Mutex
+}
+
+func (rs *restoreStorage) PersistNodes(nodesToPersist []*types.LogicalNode) bool {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	indexById := make(map[string]int, len(rs.nodes))
+	for i, n := range rs.nodes {
+		indexById[n.Id] = i
+	}
+	for _, n := range nodesToPersist {
+		if i, isOK := indexById[n.Id]; isOK {
+			rs.nodes[i] = n
+		} else {
+			rs.nodes = append(rs.nodes, n)
+		}
+	}
+	return true
+}
+
+func (rs *restoreStorage) GetNodes() []*types.LogicalNode {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	return rs.nodes
+}
+
+func (rs *restoreStorage) DeleteNodes(nodesToDelete []*types.LogicalNode) bool {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	deleted := make(map[string]bool, len(nodesToDelete))
+	for _, n := range nodesToDelete {
+		deleted[n.Id] = true
+	}
+	nodes := make([]*types.LogicalNode, 0, len(rs.nodes))
+	for _, n := range rs.nodes {
+		if !deleted[n.Id] {
+			nodes = append(nodes, n)
+		}
+	}
+	rs.nodes = nodes
+	return true
+}
+
+func TestRestoreNodeStore(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+
+	eventsAdd := generateAddNodeEvent(100, defaultLocBeijing_RP1)
+	nodes := make([]*types.LogicalNode, len(eventsAdd))
+	for i := 0; i < len(eventsAdd); i++ {
+		nodes[i] = eventsAdd[i].Node
+	}
+	distributor.SetPersistHelper(&restoreStorage{FakeStorageInterface: fakeStorage, nodes: nodes})
+
+	assert.Equal(t, 100, distributor.RestoreNodeStore())
+	assert.Equal(t, 100, distributor.defaultNodeStore.GetTotalHostNum())
+	rvLoc := types.RvLocation{Region: defaultLocBeijing_RP1.GetRegion(), Partition: defaultLocBeijing_RP1.GetResourcePartition()}
+	assert.Equal(t, uint64(rvToGenerate), distributor.defaultNodeStore.GetCurrentResourceVersions()[rvLoc])
+
+	n, err := distributor.GetNodeStatus(defaultLocBeijing_RP1.GetRegion(), defaultLocBeijing_RP1.GetResourcePartition(), nodes[0].Id)
+	assert.Nil(t, err)
+	assert.Equal(t, nodes[0].Id, n.Id)
+}
+
+func TestRestoreNodeStore_DeletedNodes(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+
+	persistedNodes := &restoreStorage{FakeStorageInterface: fakeStorage}
+	distributor.SetPersistHelper(persistedNodes)
+	eventsAdd := generateAddNodeEvent(10, defaultLocBeijing_RP1)
+	result, _ := distributor.ProcessEvents(eventsAdd)
+	assert.True(t, result)
+	deletedNode := eventsAdd[0].Node.Copy()
+	rvToGenerate += 1
+	deletedNode.ResourceVersion = strconv.Itoa(rvToGenerate)
+	result, _ = distributor.ProcessEvents([]*runtime.NodeEvent{runtime.NewNodeEvent(deletedNode, runtime.Deleted)})
+	assert.True(t, result)
+	assert.Equal(t, 9, len(persistedNodes.GetNodes()))
+
+	// restart
+	distributor.defaultNodeStore = createNodeStore()
+	assert.Equal(t, 9, distributor.RestoreNodeStore())
+	assert.Equal(t, 9, distributor.defaultNodeStore.GetTotalHostNum())
+	_, err := distributor.GetNodeStatus(defaultLocBeijing_RP1.GetRegion(), defaultLocBeijing_RP1.GetResourcePartition(), deletedNode.Id)
+	assert.Equal(t, types.Error_ObjectNotFound, err)
+}
+
+// failedNodeStorage fails to save nodes
+type failedNodeStorage struct {
+	*storage.FakeStorageInterface
+}
+
+func (fs *failedNodeStorage) PersistNodes(nodesToPersist []*types.LogicalNode) bool {
+	return false
+}
+
+func TestProcessEvents_PersistFailed(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+
+	distributor.SetPersistHelper(&failedNodeStorage{FakeStorageInterface: fakeStorage})
+	result, _ := distributor.ProcessEvents(generateAddNodeEvent(10, defaultLocBeijing_RP1))
+	assert.False(t, result)
+}
+
+func TestProcessEvents_SkipInvalidEvents(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+
+	events := generateAddNodeEvent(4, defaultLocBeijing_RP1)
+	invalidNode := events[2].Node
+	invalidNode.GeoInfo.Region = types.RegionName(-1)
+	events[1] = nil
+
+	// events after the nil event and the event with invalid location are processed
+	result, _ := distributor.ProcessEvents(events)
+	assert.True(t, result)
+	assert.Equal(t, 2, distributor.defaultNodeStore.GetTotalHostNum())
+	region := defaultLocBeijing_RP1.GetRegion()
+	partition := defaultLocBeijing_RP1.GetResourcePartition()
+	for _, i := range []int{0, 3} {
+		_, err := distributor.GetNodeStatus(region, partition, events[i].Node.Id)
+		assert.Nil(t, err)
+	}
+	_, err := distributor.GetNodeStatus(region, partition, invalidNode.Id)
+	assert.NotNil(t, err)
+}
+
+func TestSetRegionNodesStaleAndDelete(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+
+	eventsAdd := generateAddNodeEvent(10, defaultLocBeijing_RP1)
+	distributor.ProcessEvents(eventsAdd)
+	persistedNodes := &restoreStorage{FakeStorageInterface: fakeStorage, nodes: make([]*types.LogicalNode, len(eventsAdd))}
+	for i := 0; i < len(eventsAdd); i++ {
+		persistedNodes.nodes[i] = eventsAdd[i].Node
+	}
+	distributor.SetPersistHelper(persistedNodes)
+	region := defaultLocBeijing_RP1.GetRegion()
+	partition := defaultLocBeijing_RP1.GetResourcePartition()
+	node := eventsAdd[0].Node
+
+	assert.Equal(t, 10, distributor.SetRegionNodesStale(region, true))
+	assert.Equal(t, 0, distributor.SetRegionNodesStale(region, true))
+	assert.Equal(t, 0, distributor.SetRegionNodesStale(location.Shanghai, true))
+	n, err := distributor.GetNodeStatus(region, partition, node.Id)
+	assert.Nil(t, err)
+	assert.True(t, n.Taints.NoSchedule)
+	assert.True(t, n.GetResourceVersionInt64() > node.GetResourceVersionInt64())
+
+	// node from the region manager with the same resource version replaces the stale node
+	distributor.ProcessEvents([]*runtime.NodeEvent{runtime.NewNodeEvent(node.Copy(), runtime.Modified)})
+	n, err = distributor.GetNodeStatus(region, partition, node.Id)
+	assert.Nil(t, err)
+	assert.False(t, n.Taints.NoSchedule)
+	assert.Equal(t, 9, distributor.SetRegionNodesStale(region, false))
+
+	assert.Equal(t, 10, distributor.DeleteRegionNodes(region))
+	_, err = distributor.GetNodeStatus(region, partition, node.Id)
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, distributor.DeleteRegionNodes(region))
+	// deleted nodes are removed from store too
+	assert.Empty(t, persistedNodes.nodes)
+}
+
+func TestSetRegionNodesStale_WatchFromBeforeStale(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+
+	result, _ := distributor.ProcessEvents(generateAddNodeEvent(1000, defaultLocBeijing_RP1))
+	assert.True(t, result)
+	clientId := registerClientForRebalance(t, distributor, 500)
+	nodes, rvsBeforeStale, err := distributor.ListNodesForClient(clientId)
+	assert.Nil(t, err)
+	currentRVsBeforeStale := distributor.defaultNodeStore.GetCurrentResourceVersions()
+
+	// region flaps
+	assert.Equal(t, 1000, distributor.SetRegionNodesStale(defaultRegion, true))
+	assert.Equal(t, 1000, distributor.SetRegionNodesStale(defaultRegion, false))
+
+	// stale and restored nodes are sent as modified events with the latest resource version, client does not need to list again
+	watchCh := make(chan runtime.Object)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	assert.Nil(t, distributor.Watch(clientId, rvsBeforeStale, watchCh, stopCh))
+	rvLoc := types.RvLocation{Region: defaultRegion, Partition: defaultPartition}
+	lastRV := rvsBeforeStale[rvLoc]
+	for i := 0; i < 2*len(nodes); i++ {
+		select {
+		case e := <-watchCh:
+			assert.Equal(t, runtime.Modified, e.GetEventType())
+			assert.Equal(t, i < len(nodes), e.(*runtime.NodeEvent).Node.Taints.NoSchedule)
+			assert.True(t, e.GetResourceVersionInt64() >= rvsBeforeStale[rvLoc])
+			assert.True(t, e.GetResourceVersionInt64() >= lastRV)
+			lastRV = e.GetResourceVersionInt64()
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, "Expecting modified events of stale and restored nodes")
+			return
+		}
+	}
+
+	// resource versions of the region manager are not changed by the flap
+	assert.Equal(t, currentRVsBeforeStale, distributor.defaultNodeStore.GetCurrentResourceVersions())
+	_, rvsAfterStale, err := distributor.ListNodesForClient(clientId)
+	assert.Nil(t, err)
+	assert.Equal(t, rvsBeforeStale, rvsAfterStale)
+}
+
+func TestSetRegionNodesStale_WatchFromStaleEvent(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+
+	result, _ := distributor.ProcessEvents(generateAddNodeEvent(1000, defaultLocBeijing_RP1))
+	assert.True(t, result)
+	clientId := registerClientForRebalance(t, distributor, 500)
+	nodes, rvs, err := distributor.ListNodesForClient(clientId)
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, distributor.SetRegionNodesStale(defaultRegion, true))
+	staleNode, err := distributor.GetNodeStatus(defaultRegion, defaultPartition, nodes[0].Id)
+	assert.Nil(t, err)
+	assert.True(t, staleNode.Taints.NoSchedule)
+
+	// next event from the region manager
+	updateEvents := generateUpdateNodeEvents([]*runtime.NodeEvent{runtime.NewNodeEvent(nodes[0], runtime.Added)})
+	assert.True(t, updateEvents[0].Node.GetResourceVersionInt64() == staleNode.GetResourceVersionInt64()+1)
+	result, _ = distributor.ProcessEvents(updateEvents)
+	assert.True(t, result)
+
+	// client received the stale events watches from their resource version
+	rvLoc := types.RvLocation{Region: defaultRegion, Partition: defaultPartition}
+	rvs[rvLoc] = staleNode.GetResourceVersionInt64()
+	watchCh := make(chan runtime.Object)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	assert.Nil(t, distributor.Watch(clientId, rvs, watchCh, stopCh))
+	for {
+		select {
+		case e := <-watchCh:
+			if e.GetResourceVersionInt64() == staleNode.GetResourceVersionInt64() {
+				// stale events are sent again
+				assert.True(t, e.(*runtime.NodeEvent).Node.Taints.NoSchedule)
+				continue
+			}
+			assert.Equal(t, updateEvents[0].Node.Id, e.GetId())
+			assert.Equal(t, updateEvents[0].Node.GetResourceVersionInt64(), e.GetResourceVersionInt64())
+			return
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, "Expecting the next event from the region manager")
+			return
+		}
+	}
+}
+
+func TestDeleteRegionNodes_WatchFromBeforeDelete(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+
+	persistedNodes := &restoreStorage{FakeStorageInterface: fakeStorage}
+	distributor.SetPersistHelper(persistedNodes)
+	result, _ := distributor.ProcessEvents(generateAddNodeEvent(1000, defaultLocBeijing_RP1))
+	assert.True(t, result)
+	clientId := registerClientForRebalance(t, distributor, 500)
+	nodes, rvsBeforeDelete, err := distributor.ListNodesForClient(clientId)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1000, distributor.DeleteRegionNodes(defaultRegion))
+
+	// deleted events are queued with newer resource versions, client does not need to list again
+	watchCh := make(chan runtime.Object)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	assert.Nil(t, distributor.Watch(clientId, rvsBeforeDelete, watchCh, stopCh))
+	rvLoc := types.RvLocation{Region: defaultRegion, Partition: defaultPartition}
+	assert.Equal(t, len(nodes), countWatchedEvents(watchCh, runtime.Deleted, len(nodes)))
+
+	// nodes of the removed region are deleted from store and not restored after restart
+	assert.Empty(t, persistedNodes.GetNodes())
+	distributor.defaultNodeStore = createNodeStore()
+	assert.Equal(t, 0, distributor.RestoreNodeStore())
+	assert.Equal(t, uint64(0), distributor.defaultNodeStore.GetCurrentResourceVersions()[rvLoc])
+}
+
+func TestProcessEvents_DeleteUnknownNode(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+
+	result, _ := distributor.ProcessEvents(generateAddNodeEvent(1000, defaultLocBeijing_RP1))
+	assert.True(t, result)
+	clientId := registerClientForRebalance(t, distributor, 500)
+	_, rvs, err := distributor.ListNodesForClient(clientId)
+	assert.Nil(t, err)
+	watchCh := make(chan runtime.Object)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	assert.Nil(t, distributor.Watch(clientId, rvs, watchCh, stopCh))
+
+	// deleted events of unknown nodes are not sent to clients
+	eventsDelete := generateAddNodeEvent(1000, defaultLocBeijing_RP1)
+	for _, e := range eventsDelete {
+		e.Type = runtime.Deleted
+	}
+	result, _ = distributor.ProcessEvents(eventsDelete)
+	assert.True(t, result)
+	assert.Equal(t, 1000, distributor.defaultNodeStore.GetTotalHostNum())
+	assert.Equal(t, 0, countWatchedEvents(watchCh, runtime.Deleted, 1))
+}
+
 func generateAddNodeEvent(eventNum int, loc *location.Location) []*runtime.NodeEvent {
 	result := make([]*runtime.NodeEvent, eventNum)
 	for i := 0; i < eventNum; i++ {
@@ -336,6 +745,65 @@ func TestRegisterClient_ErrorCases(t *testing.T) {
 	assert.Equal(t, types.Error_HostRequestLessThanMiniaml, err)
 }
 
+func TestRegisterClient_ExceedFreeCapacity(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+
+	result, _ := distributor.ProcessEvents(generateAddNodeEvent(10000, defaultLocBeijing_RP1))
+	assert.True(t, result)
+	assert.True(t, distributor.defaultNodeStore.CheckFreeCapacity(10000))
+
+	client := types.Client{ClientId: uuid.New().String(), Resource: types.ResourceRequest{TotalMachines: 6000}, ClientInfo: types.ClientInfoType{}}
+	err := distributor.RegisterClient(&client)
+	assert.Nil(t, err)
+	assignedHostNum := 0
+	for _, vs := range distributor.clientToStores[client.ClientId] {
+		assignedHostNum += vs.GetHostNum()
+	}
+
+	// hosts assigned to other clients are not free
+	capacity := distributor.GetCapacity()
+	assert.Equal(t, assignedHostNum, capacity.AssignedHostNum)
+	assert.Equal(t, 10000-assignedHostNum, capacity.FreeHostNum)
+	rpCapacity := capacity.Regions[defaultRegion.String()].ResourcePartitions[defaultPartition.String()]
+	assert.Equal(t, capacity.HostCapacity, rpCapacity.HostCapacity)
+	assert.Equal(t, capacity.HostCapacity, rpCapacity.MachineTypes[""])
+	assert.False(t, distributor.defaultNodeStore.CheckFreeCapacity(6000))
+
+	client = types.Client{ClientId: uuid.New().String(), Resource: types.ResourceRequest{TotalMachines: 6000}, ClientInfo: types.ClientInfoType{}}
+	err = distributor.RegisterClient(&client)
+	assert.Equal(t, types.Error_HostRequestExceedCapacity, err)
+}
+
+func TestRegisterClient_Idempotent(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+
+	result, _ := distributor.ProcessEvents(generateAddNodeEvent(10000, defaultLocBeijing_RP1))
+	assert.True(t, result)
+
+	clientId := uuid.New().String()
+	client := types.Client{ClientId: clientId, Resource: types.ResourceRequest{TotalMachines: 500}, ClientInfo: types.ClientInfoType{ClientName: "scheduler-1"}}
+	err := distributor.RegisterClient(&client)
+	assert.Nil(t, err)
+	assignedStores := distributor.clientToStores[clientId]
+	freeHostNum := distributor.GetCapacity().FreeHostNum
+
+	// retry with same resource request gets the existing allocation
+	retryClient := types.Client{ClientId: clientId, Resource: types.ResourceRequest{TotalMachines: 500}, ClientInfo: types.ClientInfoType{}}
+	err = distributor.RegisterClient(&retryClient)
+	assert.Nil(t, err)
+	assert.Equal(t, client, retryClient)
+	assert.Equal(t, assignedStores, distributor.clientToStores[clientId])
+	assert.Equal(t, freeHostNum, distributor.GetCapacity().FreeHostNum)
+
+	// different resource request is rejected
+	conflictClient := types.Client{ClientId: clientId, Resource: types.ResourceRequest{TotalMachines: 600}, ClientInfo: types.ClientInfoType{}}
+	err = distributor.RegisterClient(&conflictClient)
+	assert.Equal(t, types.Error_ClientRegistrationConflict, err)
+	assert.Equal(t, freeHostNum, distributor.GetCapacity().FreeHostNum)
+}
+
 func TestRegisterClient_WithinLimit(t *testing.T) {
 	distributor := setUp()
 	defer tearDown()
@@ -522,7 +990,7 @@ func TestRegistration5MCase(t *testing.T) {
 					assert.NotNil(t, clientId, "Expecting not nil client id")
 					assert.False(t, clientId == "", "Expecting non empty client id")
 					if err != nil {
-						assert.Equal(t, "Not enough hosts", err.Error())
+						assert.Equal(t, types.Error_HostRequestExceedCapacity, err)
 						lock.Lock()
 						*errCount = *errCount + 1
 						lock.Unlock()
@@ -0,0 +1,159 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package distributor
+
+import (
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"global-resource-service/resource-management/pkg/common-lib/metrics"
+	"global-resource-service/resource-management/pkg/common-lib/types"
+	"global-resource-service/resource-management/pkg/distributor/storage"
+)
+
+const DefaultClientLeaseDuration = 5 * time.Minute
+
+// leases are renewed and reaped at fractions of the lease duration
+const MinClientLeaseDuration = time.Second
+
+// SetClientLeaseDuration sets the lease duration granted to client on registration and each renewal
+func (dis *ResourceDistributor) SetClientLeaseDuration(leaseDuration time.Duration) {
+	dis.leaseLock.Lock()
+	defer dis.leaseLock.Unlock()
+	dis.clientLeaseDuration = leaseDuration
+}
+
+func (dis *ResourceDistributor) GetClientLeaseDuration() time.Duration {
+	dis.leaseLock.Lock()
+	defer dis.leaseLock.Unlock()
+	return dis.clientLeaseDuration
+}
+
+// RenewClientLease extends the lease of a registered client by the lease duration
+func (dis *ResourceDistributor) RenewClientLease(clientId string) error {
+	dis.leaseLock.Lock()
+	defer dis.leaseLock.Unlock()
+	if _, isOK := dis.clientLeaseExpireTime[clientId]; !isOK {
+		return types.Error_ClientNotRegistered
+	}
+	dis.clientLeaseExpireTime[clientId] = time.Now().Add(dis.clientLeaseDuration)
+	return nil
+}
+
+// GetClientLeaseGeneration returns the generation of the client lease, which changes each time the client is
+// registered again after its lease expired
+func (dis *ResourceDistributor) GetClientLeaseGeneration(clientId string) (int64, error) {
+	dis.leaseLock.Lock()
+	defer dis.leaseLock.Unlock()
+	generation, isOK := dis.clientLeaseGeneration[clientId]
+	if !isOK {
+		return 0, types.Error_ClientNotRegistered
+	}
+	return generation, nil
+}
+
+// grantClientLease grants a lease of a new generation to the client
+// Generations are unix nano time of the grant, so that they are not reused after restart
+func (dis *ResourceDistributor) grantClientLease(clientId string) {
+	dis.leaseLock.Lock()
+	defer dis.leaseLock.Unlock()
+	now := time.Now()
+	dis.clientLeaseExpireTime[clientId] = now.Add(dis.clientLeaseDuration)
+
+	generation := now.UnixNano()
+	if generation <= dis.lastLeaseGeneration {
+		generation = dis.lastLeaseGeneration + 1
+	}
+	dis.lastLeaseGeneration = generation
+	dis.clientLeaseGeneration[clientId] = generation
+}
+
+func (dis *ResourceDistributor) getExpiredClients() []string {
+	dis.leaseLock.Lock()
+	defer dis.leaseLock.Unlock()
+	now := time.Now()
+	expiredClients := make([]string, 0)
+	for clientId, expireTime := range dis.clientLeaseExpireTime {
+		if now.After(expireTime) {
+			expiredClients = append(expiredClients, clientId)
+		}
+	}
+	return expiredClients
+}
+
+// RunLeaseReaper periodically reclaims resources of clients whose lease expired until stopCh is closed
+func (dis *ResourceDistributor) RunLeaseReaper(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			klog.V(3).Infof("Client lease reaper stopped")
+			return
+		case <-ticker.C:
+			dis.ReapExpiredClients()
+		}
+	}
+}
+
+// ReapExpiredClients releases virtual node stores of clients whose lease expired back to the free pool,
+// removes the clients and persists the change. Returns the ids of clients reaped.
+func (dis *ResourceDistributor) ReapExpiredClients() []string {
+	expiredClients := dis.getExpiredClients()
+	if len(expiredClients) == 0 {
+		return expiredClients
+	}
+
+	dis.allocateLock.Lock()
+	defer dis.allocateLock.Unlock()
+
+	reapedClients := make([]string, 0, len(expiredClients))
+	for _, clientId := range expiredClients {
+		// lease might be renewed after expired clients are collected
+		dis.leaseLock.Lock()
+		expireTime, isOK := dis.clientLeaseExpireTime[clientId]
+		if !isOK || time.Now().Before(expireTime) {
+			dis.leaseLock.Unlock()
+			continue
+		}
+		delete(dis.clientLeaseExpireTime, clientId)
+		delete(dis.clientLeaseGeneration, clientId)
+		dis.leaseLock.Unlock()
+
+		releasedHostNum := 0
+		for _, vs := range dis.clientToStores[clientId] {
+			releasedHostNum += vs.GetHostNum()
+			dis.defaultNodeStore.ReleaseVirtualStore(vs)
+		}
+		delete(dis.clientToStores, clientId)
+		delete(dis.nodeEventQueueMap, clientId)
+		delete(dis.clients, clientId)
+
+		dis.persistVirtualNodesAssignment(clientId, []*storage.VirtualNodeStore{})
+		if err := dis.persistHelper.DeleteClient(clientId); err != nil {
+			metrics.PersistenceFailures.Inc(metrics.PersistOperation_DeleteClient)
+			klog.Errorf("Error delete expired client %s from store. Error %v", clientId, err)
+		}
+
+		reapedClients = append(reapedClients, clientId)
+		klog.Infof("Client %s lease expired at %v, released host # = %d", clientId, expireTime, releasedHostNum)
+	}
+
+	return reapedClients
+}
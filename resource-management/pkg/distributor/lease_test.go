@@ -0,0 +1,136 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package distributor
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"global-resource-service/resource-management/pkg/common-lib/metrics"
+	"global-resource-service/resource-management/pkg/common-lib/types"
+)
+
+func TestReapExpiredClients(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+	distributor.SetClientLeaseDuration(200 * time.Millisecond)
+
+	result, _ := distributor.ProcessEvents(generateAddNodeEvent(10000, defaultLocBeijing_RP1))
+	assert.True(t, result)
+
+	expiredClient := types.Client{ClientId: uuid.New().String(), Resource: types.ResourceRequest{TotalMachines: 500}, ClientInfo: types.ClientInfoType{}}
+	err := distributor.RegisterClient(&expiredClient)
+	assert.Nil(t, err)
+	liveClient := types.Client{ClientId: uuid.New().String(), Resource: types.ResourceRequest{TotalMachines: 500}, ClientInfo: types.ClientInfoType{}}
+	err = distributor.RegisterClient(&liveClient)
+	assert.Nil(t, err)
+	expiredStores := distributor.clientToStores[expiredClient.ClientId]
+	freeHostNumBefore := distributor.GetCapacity().FreeHostNum
+
+	assert.Equal(t, 0, len(distributor.ReapExpiredClients()), "Expecting no client expired before lease duration")
+
+	// keep one client alive with lease renewal and list
+	for i := 0; i < 3; i++ {
+		time.Sleep(100 * time.Millisecond)
+		assert.Nil(t, distributor.RenewClientLease(liveClient.ClientId))
+	}
+	_, _, err = distributor.ListNodesForClient(liveClient.ClientId)
+	assert.Nil(t, err)
+
+	reapedClients := distributor.ReapExpiredClients()
+	assert.Equal(t, []string{expiredClient.ClientId}, reapedClients)
+
+	// virtual node stores of expired client are back to free pool
+	releasedHostNum := 0
+	for _, vs := range expiredStores {
+		assert.Equal(t, "", vs.GetAssignedClient())
+		releasedHostNum += vs.GetHostNum()
+	}
+	assert.Equal(t, freeHostNumBefore+releasedHostNum, distributor.GetCapacity().FreeHostNum)
+	_, isOK := distributor.clientToStores[expiredClient.ClientId]
+	assert.False(t, isOK)
+	_, _, err = distributor.ListNodesForClient(expiredClient.ClientId)
+	assert.NotNil(t, err)
+	assert.Equal(t, types.Error_ClientNotRegistered, distributor.RenewClientLease(expiredClient.ClientId))
+
+	// live client is untouched
+	for _, vs := range distributor.clientToStores[liveClient.ClientId] {
+		assert.Equal(t, liveClient.ClientId, vs.GetAssignedClient())
+	}
+}
+
+func TestClientLeaseGeneration_RegisterAgainAfterExpired(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+	distributor.SetClientLeaseDuration(100 * time.Millisecond)
+
+	result, _ := distributor.ProcessEvents(generateAddNodeEvent(10000, defaultLocBeijing_RP1))
+	assert.True(t, result)
+
+	client := types.Client{ClientId: uuid.New().String(), Resource: types.ResourceRequest{TotalMachines: 500}, ClientInfo: types.ClientInfoType{}}
+	assert.Nil(t, distributor.RegisterClient(&client))
+	generation, err := distributor.GetClientLeaseGeneration(client.ClientId)
+	assert.Nil(t, err)
+
+	// registering again with the same request keeps the lease
+	retriedClient := client
+	assert.Nil(t, distributor.RegisterClient(&retriedClient))
+	retriedGeneration, err := distributor.GetClientLeaseGeneration(client.ClientId)
+	assert.Nil(t, err)
+	assert.Equal(t, generation, retriedGeneration)
+
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, []string{client.ClientId}, distributor.ReapExpiredClients())
+	_, err = distributor.GetClientLeaseGeneration(client.ClientId)
+	assert.Equal(t, types.Error_ClientNotRegistered, err)
+
+	// the same client id registered again gets a lease of a new generation
+	reregisteredClient := types.Client{ClientId: client.ClientId, Resource: client.Resource, ClientInfo: types.ClientInfoType{}}
+	assert.Nil(t, distributor.RegisterClient(&reregisteredClient))
+	newGeneration, err := distributor.GetClientLeaseGeneration(client.ClientId)
+	assert.Nil(t, err)
+	assert.True(t, newGeneration > generation, "Expecting new lease generation. Before %d, after %d", generation, newGeneration)
+}
+
+func TestReapExpiredClients_DeleteEventQueueDepthSeries(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+	distributor.SetClientLeaseDuration(100 * time.Millisecond)
+	registry := metrics.NewRegistry()
+	distributor.RegisterMetrics(registry)
+
+	result, _ := distributor.ProcessEvents(generateAddNodeEvent(10000, defaultLocBeijing_RP1))
+	assert.True(t, result)
+	client := types.Client{ClientId: uuid.New().String(), Resource: types.ResourceRequest{TotalMachines: 500}, ClientInfo: types.ClientInfoType{}}
+	assert.Nil(t, distributor.RegisterClient(&client))
+
+	series := fmt.Sprintf("grs_client_event_queue_depth{client=%q}", client.ClientId)
+	var buf bytes.Buffer
+	assert.Nil(t, registry.WriteText(&buf))
+	assert.Contains(t, buf.String(), series)
+
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, []string{client.ClientId}, distributor.ReapExpiredClients())
+	buf.Reset()
+	assert.Nil(t, registry.WriteText(&buf))
+	assert.NotContains(t, buf.String(), series)
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package distributor
+
+import (
+	"global-resource-service/resource-management/pkg/common-lib/metrics"
+)
+
+// RegisterMetrics registers metrics of distributor state, collected when exported
+func (dis *ResourceDistributor) RegisterMetrics(registry *metrics.Registry) {
+	registry.Register(
+		metrics.NewGaugeFunc("grs_registered_clients", "Number of registered clients.", nil, dis.collectRegisteredClients),
+		metrics.NewGaugeFunc("grs_client_event_queue_depth", "Number of node events waiting to be sent to the client watch.",
+			[]string{"client"}, dis.collectEventQueueDepth),
+		metrics.NewGaugeFunc("grs_hosts", "Number of hosts by region and state, free or assigned.",
+			[]string{"region", "state"}, dis.collectHostsByRegion),
+	)
+}
+
+func (dis *ResourceDistributor) collectRegisteredClients() []metrics.Sample {
+	dis.allocateLock.RLock()
+	defer dis.allocateLock.RUnlock()
+	return []metrics.Sample{{Value: float64(len(dis.clients))}}
+}
+
+// collectEventQueueDepth returns the depth of event queues of registered clients only,
+// the series of a client is deleted once the client is unregistered or reaped and its event queue removed
+func (dis *ResourceDistributor) collectEventQueueDepth() []metrics.Sample {
+	dis.allocateLock.RLock()
+	defer dis.allocateLock.RUnlock()
+	samples := make([]metrics.Sample, 0, len(dis.nodeEventQueueMap))
+	for clientId, eventQueue := range dis.nodeEventQueueMap {
+		samples = append(samples, metrics.Sample{LabelValues: []string{clientId}, Value: float64(eventQueue.GetPendingEventNum())})
+	}
+	return samples
+}
+
+func (dis *ResourceDistributor) collectHostsByRegion() []metrics.Sample {
+	capacity := dis.GetCapacity()
+	samples := make([]metrics.Sample, 0, 2*len(capacity.Regions))
+	for regionName, regionCapacity := range capacity.Regions {
+		samples = append(samples,
+			metrics.Sample{LabelValues: []string{regionName, "free"}, Value: float64(regionCapacity.FreeHostNum)},
+			metrics.Sample{LabelValues: []string{regionName, "assigned"}, Value: float64(regionCapacity.AssignedHostNum)})
+	}
+	return samples
+}
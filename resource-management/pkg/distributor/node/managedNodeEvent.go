@@ -18,6 +18,7 @@ package node
 
 import (
 	"k8s.io/klog/v2"
+	"strconv"
 	"time"
 
 	"global-resource-service/resource-management/pkg/common-lib/types"
@@ -29,6 +30,11 @@ import (
 type ManagedNodeEvent struct {
 	nodeEvent *runtime.NodeEvent
 	loc       *location.Location
+
+	// original is the node event from the region manager if the node is flagged stale by the distributor
+	original *ManagedNodeEvent
+	// event is generated by the distributor with the latest resource version from the region manager, see IsGenerated
+	isGenerated bool
 }
 
 func NewManagedNodeEvent(nodeEvent *runtime.NodeEvent, loc *location.Location) *ManagedNodeEvent {
@@ -38,6 +44,52 @@ func NewManagedNodeEvent(nodeEvent *runtime.NodeEvent, loc *location.Location) *
 	}
 }
 
+// NewGeneratedNodeEvent returns an event generated by the distributor for an existing node, e.g. a node restored
+// from stale or deleted with its region, with the latest resource version from the region manager of the resource partition
+func NewGeneratedNodeEvent(nodeEvent *runtime.NodeEvent, loc *location.Location) *ManagedNodeEvent {
+	return &ManagedNodeEvent{
+		nodeEvent:   nodeEvent,
+		loc:         loc,
+		isGenerated: true,
+	}
+}
+
+// NewStaleNodeEvent returns a generated modified event of the node flagged unschedulable with the NoSchedule taint,
+// with the given resource version. The node event from the region manager is kept as the original one
+func NewStaleNodeEvent(original *ManagedNodeEvent, resourceVersion uint64) *ManagedNodeEvent {
+	if original.IsStale() {
+		return original
+	}
+	staleNode := original.CopyNode()
+	staleNode.Taints.NoSchedule = true
+	staleNode.ResourceVersion = strconv.FormatUint(resourceVersion, 10)
+	return &ManagedNodeEvent{
+		nodeEvent:   runtime.NewNodeEvent(staleNode, runtime.Modified),
+		loc:         original.loc,
+		original:    original,
+		isGenerated: true,
+	}
+}
+
+// IsStale returns true if the node is flagged stale by the distributor
+func (n *ManagedNodeEvent) IsStale() bool {
+	return n.original != nil
+}
+
+// IsGenerated returns true if the event is generated by the distributor. Generated events share the resource version
+// of the latest event from the region manager, so that they do not take the one of the next event from the region manager
+func (n *ManagedNodeEvent) IsGenerated() bool {
+	return n.isGenerated
+}
+
+// GetOriginal returns the node event from the region manager before the node is flagged stale
+func (n *ManagedNodeEvent) GetOriginal() *ManagedNodeEvent {
+	if n.original != nil {
+		return n.original
+	}
+	return n
+}
+
 func (n *ManagedNodeEvent) GetId() string {
 	return n.nodeEvent.Node.Id
 }
@@ -59,6 +111,10 @@ func (n *ManagedNodeEvent) GetGeoInfo() types.NodeGeoInfo {
 	return n.nodeEvent.Node.GeoInfo
 }
 
+func (n *ManagedNodeEvent) GetMachineType() types.NodeMachineType {
+	return n.nodeEvent.Node.MachineType
+}
+
 func (n *ManagedNodeEvent) GetEventType() runtime.EventType {
 	return n.nodeEvent.Type
 }
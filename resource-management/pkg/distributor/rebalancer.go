@@ -0,0 +1,142 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package distributor
+
+import (
+	"sort"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"global-resource-service/resource-management/pkg/distributor/storage"
+)
+
+// RunRebalancer periodically rebalances virtual node stores assigned to clients until stopCh is closed
+func (dis *ResourceDistributor) RunRebalancer(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			klog.V(3).Infof("Virtual node store rebalancer stopped")
+			return
+		case <-ticker.C:
+			dis.RebalanceClients()
+		}
+	}
+}
+
+// RebalanceClients compares granted host number with actual host number of each client.
+// Hosts added to or removed from virtual node stores after registration make client drift from its request.
+// Surplus virtual node stores are returned to the free pool with DELETED events sent to the client,
+// and deficit is topped up from free virtual node stores with ADDED events sent to the client.
+// Returns the ids of clients whose virtual node store assignment changed.
+func (dis *ResourceDistributor) RebalanceClients() []string {
+	dis.allocateLock.Lock()
+	defer dis.allocateLock.Unlock()
+
+	changedClients := make([]string, 0)
+	for clientId, client := range dis.clients {
+		grantedHostNum := client.Resource.TotalMachines
+		assignedStores, isOK := dis.clientToStores[clientId]
+		if !isOK {
+			continue
+		}
+
+		actualHostNum := 0
+		for _, vs := range assignedStores {
+			actualHostNum += vs.GetHostNum()
+		}
+
+		var isChanged bool
+		if actualHostNum > grantedHostNum {
+			actualHostNum, isChanged = dis.releaseSurplusStores(assignedStores, actualHostNum, grantedHostNum)
+		} else if actualHostNum < grantedHostNum {
+			actualHostNum, isChanged = dis.topUpDeficitStores(clientId, actualHostNum, grantedHostNum)
+		}
+		if !isChanged {
+			continue
+		}
+
+		assignedStores = dis.defaultNodeStore.GetVirtualStoresAssignedToClient(clientId)
+		dis.clientToStores[clientId] = assignedStores
+		dis.persistVirtualNodesAssignment(clientId, assignedStores)
+		changedClients = append(changedClients, clientId)
+		klog.Infof("Rebalanced client %s, granted host # = %d, actual host # = %d, virtual store # = %d", clientId, grantedHostNum, actualHostNum, len(assignedStores))
+	}
+
+	return changedClients
+}
+
+// releaseSurplusStores releases the largest virtual node stores that are not needed to satisfy the granted host number
+// Caller needs to hold allocateLock
+func (dis *ResourceDistributor) releaseSurplusStores(assignedStores []*storage.VirtualNodeStore, actualHostNum int, grantedHostNum int) (int, bool) {
+	storesBySize := make([]*storage.VirtualNodeStore, len(assignedStores))
+	copy(storesBySize, assignedStores)
+	sort.SliceStable(storesBySize, func(i, j int) bool {
+		return storesBySize[i].GetHostNum() > storesBySize[j].GetHostNum()
+	})
+
+	isChanged := false
+	remainingStoreNum := len(storesBySize)
+	for _, vs := range storesBySize {
+		hostNum := vs.GetHostNum()
+		if remainingStoreNum == 1 || actualHostNum-hostNum < grantedHostNum {
+			continue
+		}
+		dis.defaultNodeStore.ReleaseVirtualStoreWithEvents(vs)
+		actualHostNum -= hostNum
+		remainingStoreNum--
+		isChanged = true
+	}
+
+	return actualHostNum, isChanged
+}
+
+// topUpDeficitStores assigns free virtual node stores to client until granted host number is satisfied
+// Caller needs to hold allocateLock
+func (dis *ResourceDistributor) topUpDeficitStores(clientId string, actualHostNum int, grantedHostNum int) (int, bool) {
+	eventQueue, isOK := dis.nodeEventQueueMap[clientId]
+	if !isOK {
+		klog.Errorf("Internal error: missing event queue for client %s", clientId)
+		return actualHostNum, false
+	}
+
+	freeStores := make(map[*storage.VirtualNodeStore]bool)
+	for _, vs := range *dis.defaultNodeStore.GetVirtualStores() {
+		if vs.GetAssignedClient() == "" && vs.GetHostNum() > 0 {
+			freeStores[vs] = true
+		}
+	}
+
+	isChanged := false
+	for _, vs := range dis.getSortedVirtualStores(freeStores) {
+		if actualHostNum >= grantedHostNum {
+			break
+		}
+		if dis.defaultNodeStore.AssignVirtualStoreWithEvents(vs, clientId, eventQueue) {
+			actualHostNum += vs.GetHostNum()
+			isChanged = true
+		}
+	}
+	if actualHostNum < grantedHostNum {
+		klog.Warningf("Not enough free hosts to top up client %s, granted host # = %d, actual host # = %d", clientId, grantedHostNum, actualHostNum)
+	}
+
+	return actualHostNum, isChanged
+}
@@ -0,0 +1,233 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package distributor
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"global-resource-service/resource-management/pkg/common-lib/types"
+	"global-resource-service/resource-management/pkg/common-lib/types/runtime"
+)
+
+func registerClientForRebalance(t *testing.T, dis *ResourceDistributor, requestedHostNum int) string {
+	client := types.Client{ClientId: uuid.New().String(), Resource: types.ResourceRequest{TotalMachines: requestedHostNum}, ClientInfo: types.ClientInfoType{}}
+	err := dis.RegisterClient(&client)
+	assert.Nil(t, err)
+	return client.ClientId
+}
+
+func getClientHostNum(dis *ResourceDistributor, clientId string) int {
+	hostNum := 0
+	for _, vs := range dis.clientToStores[clientId] {
+		hostNum += vs.GetHostNum()
+	}
+	return hostNum
+}
+
+func watchFromLatest(t *testing.T, dis *ResourceDistributor, clientId string) (chan runtime.Object, chan struct{}) {
+	_, latestRVs, err := dis.ListNodesForClient(clientId)
+	assert.Nil(t, err)
+	watchCh := make(chan runtime.Object)
+	stopCh := make(chan struct{})
+	err = dis.Watch(clientId, latestRVs, watchCh, stopCh)
+	assert.Nil(t, err)
+	return watchCh, stopCh
+}
+
+func countWatchedEvents(watchCh chan runtime.Object, eventType runtime.EventType, expectedEventCount int) int {
+	count := 0
+	for count < expectedEventCount {
+		select {
+		case e := <-watchCh:
+			if e.GetEventType() == eventType {
+				count++
+			}
+		case <-time.After(5 * time.Second):
+			return count
+		}
+	}
+	return count
+}
+
+func TestRebalanceClients_ReleaseSurplus(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+
+	result, _ := distributor.ProcessEvents(generateAddNodeEvent(10000, defaultLocBeijing_RP1))
+	assert.True(t, result)
+	requestedHostNum := 500
+	clientId := registerClientForRebalance(t, distributor, requestedHostNum)
+	distributor.RebalanceClients()
+	assert.True(t, getClientHostNum(distributor, clientId) >= requestedHostNum)
+
+	// new hosts grow the virtual stores already assigned to client
+	result, _ = distributor.ProcessEvents(generateAddNodeEvent(10000, defaultLocBeijing_RP1))
+	assert.True(t, result)
+	hostNumBefore := getClientHostNum(distributor, clientId)
+	assert.True(t, hostNumBefore > 2*requestedHostNum-2*hostsPerVirtualStore, "Expecting client host number grows with new hosts. Got %d", hostNumBefore)
+
+	watchCh, stopCh := watchFromLatest(t, distributor, clientId)
+	defer close(stopCh)
+
+	changedClients := distributor.RebalanceClients()
+	assert.Equal(t, []string{clientId}, changedClients)
+	hostNumAfter := getClientHostNum(distributor, clientId)
+	assert.True(t, hostNumAfter >= requestedHostNum, "Expecting client still has granted hosts. Got %d", hostNumAfter)
+	assert.True(t, hostNumAfter < hostNumBefore, "Expecting surplus hosts released. Before %d, after %d", hostNumBefore, hostNumAfter)
+	for _, vs := range distributor.clientToStores[clientId] {
+		assert.Equal(t, clientId, vs.GetAssignedClient())
+	}
+
+	releasedHostNum := hostNumBefore - hostNumAfter
+	assert.Equal(t, releasedHostNum, countWatchedEvents(watchCh, runtime.Deleted, releasedHostNum))
+}
+
+func TestRebalanceClients_WatchStoppedDuringResync(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+
+	result, _ := distributor.ProcessEvents(generateAddNodeEvent(10000, defaultLocBeijing_RP1))
+	assert.True(t, result)
+	requestedHostNum := 500
+	clientId := registerClientForRebalance(t, distributor, requestedHostNum)
+
+	// surplus hosts more than the watch channel can buffer
+	result, _ = distributor.ProcessEvents(generateAddNodeEvent(40000, defaultLocBeijing_RP1))
+	assert.True(t, result)
+	hostNumBefore := getClientHostNum(distributor, clientId)
+	assert.True(t, hostNumBefore > 1000+2*requestedHostNum, "Expecting client host number grows with new hosts. Got %d", hostNumBefore)
+
+	// client stops watching without receiving the events of the released hosts
+	_, stopCh := watchFromLatest(t, distributor, clientId)
+	doneCh := make(chan struct{})
+	go func() {
+		distributor.RebalanceClients()
+		close(doneCh)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	close(stopCh)
+
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for rebalance after watch stopped")
+	}
+	assert.True(t, getClientHostNum(distributor, clientId) < hostNumBefore)
+}
+
+func TestRebalanceClients_WatcherNotReading(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+
+	result, _ := distributor.ProcessEvents(generateAddNodeEvent(10000, defaultLocBeijing_RP1))
+	assert.True(t, result)
+	requestedHostNum := 500
+	clientId := registerClientForRebalance(t, distributor, requestedHostNum)
+
+	// surplus hosts more than the watch channel can buffer
+	result, _ = distributor.ProcessEvents(generateAddNodeEvent(40000, defaultLocBeijing_RP1))
+	assert.True(t, result)
+	hostNumBefore := getClientHostNum(distributor, clientId)
+
+	// client keeps watching without reading any event
+	_, stopCh := watchFromLatest(t, distributor, clientId)
+	defer close(stopCh)
+
+	doneCh := make(chan struct{})
+	go func() {
+		distributor.RebalanceClients()
+		result, _ := distributor.ProcessEvents(generateAddNodeEvent(100, defaultLocBeijing_RP1))
+		assert.True(t, result)
+		registerClientForRebalance(t, distributor, 100)
+		close(doneCh)
+	}()
+
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for rebalance, node events and registration while watcher is not reading")
+	}
+	assert.True(t, getClientHostNum(distributor, clientId) < hostNumBefore)
+}
+
+func TestRebalanceClients_TopUpDeficit(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+
+	result, _ := distributor.ProcessEvents(generateAddNodeEvent(10000, defaultLocBeijing_RP1))
+	assert.True(t, result)
+	requestedHostNum := 500
+	clientId := registerClientForRebalance(t, distributor, requestedHostNum)
+
+	// remove part of the hosts assigned to client
+	nodes, _, err := distributor.ListNodesForClient(clientId)
+	assert.Nil(t, err)
+	eventsDelete := make([]*runtime.NodeEvent, 300)
+	for i := 0; i < len(eventsDelete); i++ {
+		rvToGenerate += 1
+		node := nodes[i].Copy()
+		node.ResourceVersion = strconv.Itoa(rvToGenerate)
+		eventsDelete[i] = runtime.NewNodeEvent(node, runtime.Deleted)
+	}
+	result, _ = distributor.ProcessEvents(eventsDelete)
+	assert.True(t, result)
+	hostNumBefore := getClientHostNum(distributor, clientId)
+	assert.True(t, hostNumBefore < requestedHostNum)
+
+	watchCh, stopCh := watchFromLatest(t, distributor, clientId)
+	defer close(stopCh)
+
+	changedClients := distributor.RebalanceClients()
+	assert.Equal(t, []string{clientId}, changedClients)
+	hostNumAfter := getClientHostNum(distributor, clientId)
+	assert.True(t, hostNumAfter >= requestedHostNum, "Expecting client topped up to granted hosts. Got %d", hostNumAfter)
+
+	addedHostNum := hostNumAfter - hostNumBefore
+	assert.Equal(t, addedHostNum, countWatchedEvents(watchCh, runtime.Added, addedHostNum))
+}
+
+func TestRebalanceClients_WatchFromBeforeRebalance(t *testing.T) {
+	distributor := setUp()
+	defer tearDown()
+
+	result, _ := distributor.ProcessEvents(generateAddNodeEvent(10000, defaultLocBeijing_RP1))
+	assert.True(t, result)
+	clientId := registerClientForRebalance(t, distributor, 500)
+	result, _ = distributor.ProcessEvents(generateAddNodeEvent(10000, defaultLocBeijing_RP1))
+	assert.True(t, result)
+	_, rvsBeforeRebalance, err := distributor.ListNodesForClient(clientId)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{clientId}, distributor.RebalanceClients())
+
+	// events of the released virtual stores keep the old resource versions of the nodes, client needs to list again
+	err = distributor.Watch(clientId, rvsBeforeRebalance, make(chan runtime.Object), make(chan struct{}))
+	assert.True(t, errors.Is(err, types.Error_ResourceVersionExpired), "Expecting resource version expired. Got %v", err)
+
+	nodes, latestRVs, err := distributor.ListNodesForClient(clientId)
+	assert.Nil(t, err)
+	assert.Equal(t, getClientHostNum(distributor, clientId), len(nodes))
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	assert.Nil(t, distributor.Watch(clientId, latestRVs, make(chan runtime.Object), stopCh))
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"sync"
+
+	"global-resource-service/resource-management/pkg/common-lib/types"
+	"global-resource-service/resource-management/pkg/common-lib/types/location"
+)
+
+// capacityCounter maintains free and assigned host numbers per location and machine type.
+// Counters are changed while holding the lock of the virtual node store the hosts belong to,
+// so that host changes and virtual node store assignment changes are counted consistently.
+type capacityCounter struct {
+	hostsByLoc   map[location.Location]map[types.NodeMachineType]*types.HostCapacity
+	freeHostNum  int
+	capacityLock sync.RWMutex
+}
+
+func newCapacityCounter() *capacityCounter {
+	return &capacityCounter{
+		hostsByLoc: make(map[location.Location]map[types.NodeMachineType]*types.HostCapacity),
+	}
+}
+
+// add changes host number of a machine type in a location by delta
+func (c *capacityCounter) add(loc location.Location, machineType types.NodeMachineType, isAssigned bool, delta int) {
+	c.capacityLock.Lock()
+	defer c.capacityLock.Unlock()
+	c.addLocked(loc, machineType, isAssigned, delta)
+}
+
+func (c *capacityCounter) addLocked(loc location.Location, machineType types.NodeMachineType, isAssigned bool, delta int) {
+	hostsByType, isOK := c.hostsByLoc[loc]
+	if !isOK {
+		hostsByType = make(map[types.NodeMachineType]*types.HostCapacity)
+		c.hostsByLoc[loc] = hostsByType
+	}
+	hosts, isOK := hostsByType[machineType]
+	if !isOK {
+		hosts = &types.HostCapacity{}
+		hostsByType[machineType] = hosts
+	}
+
+	if isAssigned {
+		hosts.AssignedHostNum += delta
+	} else {
+		hosts.FreeHostNum += delta
+		c.freeHostNum += delta
+	}
+}
+
+// move moves hosts of a location between free and assigned
+func (c *capacityCounter) move(loc location.Location, hostNumByType map[types.NodeMachineType]int, toAssigned bool) {
+	c.capacityLock.Lock()
+	defer c.capacityLock.Unlock()
+	for machineType, hostNum := range hostNumByType {
+		c.addLocked(loc, machineType, !toAssigned, -hostNum)
+		c.addLocked(loc, machineType, toAssigned, hostNum)
+	}
+}
+
+func (c *capacityCounter) getFreeHostNum() int {
+	c.capacityLock.RLock()
+	defer c.capacityLock.RUnlock()
+	return c.freeHostNum
+}
+
+func (c *capacityCounter) getSummary() *types.CapacitySummary {
+	c.capacityLock.RLock()
+	defer c.capacityLock.RUnlock()
+
+	summary := &types.CapacitySummary{Regions: make(map[string]*types.RegionCapacity)}
+	for loc, hostsByType := range c.hostsByLoc {
+		regionName := loc.GetRegion().String()
+		regionCapacity, isOK := summary.Regions[regionName]
+		if !isOK {
+			regionCapacity = &types.RegionCapacity{ResourcePartitions: make(map[string]*types.ResourcePartitionCapacity)}
+			summary.Regions[regionName] = regionCapacity
+		}
+		rpCapacity := &types.ResourcePartitionCapacity{MachineTypes: make(map[types.NodeMachineType]types.HostCapacity, len(hostsByType))}
+		for machineType, hosts := range hostsByType {
+			rpCapacity.MachineTypes[machineType] = *hosts
+			rpCapacity.Add(*hosts)
+		}
+		regionCapacity.ResourcePartitions[loc.GetResourcePartition().String()] = rpCapacity
+		regionCapacity.Add(rpCapacity.HostCapacity)
+		summary.Add(rpCapacity.HostCapacity)
+	}
+
+	return summary
+}
@@ -34,6 +34,9 @@ type FakeStorageInterface struct {
 	NodeIds           map[string]bool
 	nodeIdCacheLock   sync.RWMutex
 	isTestNodeIdMatch bool
+
+	watchCursors     map[string]*store.WatchCursors
+	watchCursorsLock sync.RWMutex
 }
 
 func (fs *FakeStorageInterface) InitNodeIdCache() {
@@ -95,6 +98,56 @@ func (fs *FakeStorageInterface) UpdateClient(clientId string, client *types.Clie
 	return fmt.Errorf("not implemented")
 }
 
+func (fs *FakeStorageInterface) DeleteClient(clientId string) error {
+	fs.simulateDelay(1)
+	return nil
+}
+
 func (fs *FakeStorageInterface) GetClients() ([]*types.Client, error) {
 	return nil, fmt.Errorf("not implemented")
 }
+
+func (fs *FakeStorageInterface) GetNodes() []*types.LogicalNode {
+	return nil
+}
+
+func (fs *FakeStorageInterface) DeleteNodes(nodesToDelete []*types.LogicalNode) bool {
+	fs.simulateDelay(len(nodesToDelete))
+
+	if fs.isTestNodeIdMatch {
+		fs.nodeIdCacheLock.Lock()
+		for i := 0; i < len(nodesToDelete); i++ {
+			delete(fs.NodeIds, nodesToDelete[i].Id)
+		}
+		fs.nodeIdCacheLock.Unlock()
+	}
+	return true
+}
+
+func (fs *FakeStorageInterface) PersistWatchCursors(watchCursors *store.WatchCursors) bool {
+	fs.simulateDelay(len(watchCursors.ResourceVersions) + 1)
+	fs.watchCursorsLock.Lock()
+	defer fs.watchCursorsLock.Unlock()
+	if fs.watchCursors == nil {
+		fs.watchCursors = make(map[string]*store.WatchCursors)
+	}
+	fs.watchCursors[watchCursors.RegionUrl] = watchCursors
+	return true
+}
+
+func (fs *FakeStorageInterface) GetWatchCursors(regionUrl string) (*store.WatchCursors, error) {
+	fs.watchCursorsLock.RLock()
+	defer fs.watchCursorsLock.RUnlock()
+	if watchCursors, isOK := fs.watchCursors[regionUrl]; isOK {
+		return watchCursors, nil
+	}
+	return nil, types.Error_ObjectNotFound
+}
+
+func (fs *FakeStorageInterface) DeleteWatchCursors(regionUrl string) error {
+	fs.simulateDelay(1)
+	fs.watchCursorsLock.Lock()
+	defer fs.watchCursorsLock.Unlock()
+	delete(fs.watchCursors, regionUrl)
+	return nil
+}
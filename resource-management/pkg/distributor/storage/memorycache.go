@@ -18,13 +18,17 @@ package storage
 
 import (
 	"sync"
+	"sync/atomic"
 
 	"global-resource-service/resource-management/pkg/common-lib/interfaces/store"
+	"global-resource-service/resource-management/pkg/common-lib/metrics"
 	"global-resource-service/resource-management/pkg/common-lib/types"
 )
 
 type DistributorPersistHelper struct {
 	persistNodeWaitGroup *sync.WaitGroup
+	// number of node batches failed to be saved after retries
+	persistNodeFailures int32
 
 	persistHelper store.StoreInterface
 }
@@ -45,7 +49,17 @@ func (c *DistributorPersistHelper) SetWaitCount(count int) {
 }
 
 func (c *DistributorPersistHelper) PersistNodes(newNodes []*types.LogicalNode) {
-	go func(persistHelper store.StoreInterface, nodes []*types.LogicalNode, wg *sync.WaitGroup) {
+	c.saveNodes(newNodes, c.persistHelper.PersistNodes, metrics.PersistOperation_Nodes)
+}
+
+// PersistDeletedNodes removes nodes of deleted events from store in the background, the same way as PersistNodes
+func (c *DistributorPersistHelper) PersistDeletedNodes(deletedNodes []*types.LogicalNode) {
+	c.saveNodes(deletedNodes, c.persistHelper.DeleteNodes, metrics.PersistOperation_DeleteNodes)
+}
+
+// saveNodes applies the store operation to the nodes in the background with retries, and marks the nodes done
+func (c *DistributorPersistHelper) saveNodes(nodes []*types.LogicalNode, save func([]*types.LogicalNode) bool, operation string) {
+	go func(nodes []*types.LogicalNode, wg *sync.WaitGroup) {
 		retries := 0
 		defer func(numberOfNodes int, wg *sync.WaitGroup) {
 			for i := 0; i < numberOfNodes; i++ {
@@ -54,24 +68,28 @@ func (c *DistributorPersistHelper) PersistNodes(newNodes []*types.LogicalNode) {
 		}(len(nodes), wg)
 
 		for {
-			result := persistHelper.PersistNodes(nodes)
+			result := save(nodes)
 			if result {
 
 				return
 			} else {
 				// TODO - error processing
+				metrics.PersistenceFailures.Inc(operation)
 				if retries >= 5 {
+					atomic.AddInt32(&c.persistNodeFailures, 1)
 					return
 				}
 			}
 			retries++
 		}
-	}(c.persistHelper, newNodes, c.persistNodeWaitGroup)
+	}(nodes, c.persistNodeWaitGroup)
 }
 
+// WaitForAllNodesSaved returns false if any node failed to be saved after retries
 // TODO - timeout
-func (c *DistributorPersistHelper) WaitForAllNodesSaved() {
+func (c *DistributorPersistHelper) WaitForAllNodesSaved() bool {
 	c.persistNodeWaitGroup.Wait()
+	return atomic.LoadInt32(&c.persistNodeFailures) == 0
 }
 
 func (c *DistributorPersistHelper) PersistStoreConfigs(nodeStoreStatus *store.NodeStoreStatus) bool {
@@ -82,9 +100,17 @@ func (c *DistributorPersistHelper) PersistStoreConfigs(nodeStoreStatus *store.No
 }
 
 func (c *DistributorPersistHelper) PersistVirtualNodesAssignment(assignment *store.VirtualNodeAssignment) bool {
-	return c.persistHelper.PersistVirtualNodesAssignments(assignment)
+	result := c.persistHelper.PersistVirtualNodesAssignments(assignment)
+	if !result {
+		metrics.PersistenceFailures.Inc(metrics.PersistOperation_VirtualNodesAssignments)
+	}
+	return result
 }
 
 func (c *DistributorPersistHelper) persistStoreStatus(nodeStoreStatus *store.NodeStoreStatus) bool {
-	return c.persistHelper.PersistNodeStoreStatus(nodeStoreStatus)
+	result := c.persistHelper.PersistNodeStoreStatus(nodeStoreStatus)
+	if !result {
+		metrics.PersistenceFailures.Inc(metrics.PersistOperation_NodeStoreStatus)
+	}
+	return result
 }
@@ -19,6 +19,8 @@ package storage
 import (
 	"k8s.io/klog/v2"
 	"math"
+	"sort"
+	"strconv"
 	"sync"
 
 	"global-resource-service/resource-management/pkg/common-lib/hash"
@@ -46,6 +48,9 @@ type VirtualNodeStore struct {
 
 	clientId   string
 	eventQueue *cache.NodeEventQueue
+
+	// free and assigned host counters shared by all virtual node stores
+	capacity *capacityCounter
 }
 
 func (vs *VirtualNodeStore) GetHostNum() int {
@@ -59,10 +64,14 @@ func (vs *VirtualNodeStore) GetLocation() location.Location {
 }
 
 func (vs *VirtualNodeStore) GetAssignedClient() string {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
 	return vs.clientId
 }
 
 func (vs *VirtualNodeStore) AssignToClient(clientId string, eventQueue *cache.NodeEventQueue) bool {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
 	if vs.clientId != "" {
 		return false
 	} else if clientId == "" {
@@ -72,12 +81,62 @@ func (vs *VirtualNodeStore) AssignToClient(clientId string, eventQueue *cache.No
 	}
 	vs.clientId = clientId
 	vs.eventQueue = eventQueue
+	vs.capacity.move(vs.location, vs.getHostNumByMachineType(), true)
 
 	return true
 }
 
 func (vs *VirtualNodeStore) Release() {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	if vs.clientId == "" {
+		return
+	}
 	vs.clientId = ""
+	vs.eventQueue = nil
+	vs.capacity.move(vs.location, vs.getHostNumByMachineType(), false)
+}
+
+// getHostNumByMachineType returns host number per machine type. Caller needs to hold vs.mu
+func (vs *VirtualNodeStore) getHostNumByMachineType() map[types.NodeMachineType]int {
+	hostNumByType := make(map[types.NodeMachineType]int)
+	for _, n := range vs.nodeEventByHash {
+		hostNumByType[n.GetMachineType()]++
+	}
+	return hostNumByType
+}
+
+// setNodesStale replaces nodes with the ones flagged stale, or the stale nodes with the original ones,
+// and sends the changes to the assigned client as generated modified events with the given resource version. It returns the number of nodes changed
+func (vs *VirtualNodeStore) setNodesStale(isStale bool, resourceVersion uint64) int {
+	vs.mu.Lock()
+	changedEvents := make([]*node.ManagedNodeEvent, 0)
+	for hashValue, n := range vs.nodeEventByHash {
+		if n.IsStale() == isStale {
+			continue
+		}
+		if isStale {
+			changed := node.NewStaleNodeEvent(n, resourceVersion)
+			vs.nodeEventByHash[hashValue] = changed
+			changedEvents = append(changedEvents, changed)
+		} else {
+			original := n.GetOriginal()
+			vs.nodeEventByHash[hashValue] = original
+			restoredNode := original.CopyNode()
+			restoredNode.ResourceVersion = strconv.FormatUint(resourceVersion, 10)
+			changedEvents = append(changedEvents, node.NewGeneratedNodeEvent(runtime.NewNodeEvent(restoredNode, runtime.Modified), original.GetLocation()))
+		}
+	}
+	eventQueue := vs.eventQueue
+	vs.mu.Unlock()
+
+	// event queue is locked after virtual node store is unlocked to keep the locking sequence
+	if eventQueue != nil {
+		for _, e := range changedEvents {
+			eventQueue.EnqueueEvent(e)
+		}
+	}
+	return len(changedEvents)
 }
 
 func (vs *VirtualNodeStore) GetRange() (float64, float64) {
@@ -93,7 +152,8 @@ func (vs *VirtualNodeStore) SnapShot() ([]*types.LogicalNode, types.TransitResou
 	rvs := make(types.TransitResourceVersionMap)
 	for _, node := range vs.nodeEventByHash {
 		nodesCopy[index] = node.CopyNode()
-		newRV := node.GetResourceVersionInt64()
+		// resource versions of stale nodes are generated by the node store, clients watch from the ones of the region manager
+		newRV := node.GetOriginal().GetResourceVersionInt64()
 		rvLoc := *node.GetRvLocation()
 		if lastRV, isOK := rvs[rvLoc]; isOK {
 			if lastRV < newRV {
@@ -121,8 +181,9 @@ func (vs *VirtualNodeStore) GenerateBookmarkEvent() *node.ManagedNodeEvent {
 }
 
 type NodeStore struct {
-	// granularity of the ring - degree for each virtual node managed arc
-	granularOfRing float64
+	// target host number per virtual node store
+	// virtual node stores in a resource partition are split or merged to keep host number around this value
+	hostsPerVirtualStore int
 
 	// # of regions
 	regionNum int
@@ -133,26 +194,29 @@ type NodeStore struct {
 	// # of different resource slots - computation various
 	resourceSlots int
 
-	virtualNodeNum int
-	// node stores by virtual nodes
+	// node stores by virtual nodes, grouped by location and sorted by hash range
 	// Using map instead of array to avoid expanding cost
-	vNodeStores *[]*VirtualNodeStore
+	vNodeStoresByLoc map[location.Location][]*VirtualNodeStore
 	// mutex for virtual store number/size adjustment
 	nsLock sync.RWMutex
 
+	// locations whose virtual node stores need to be split or merged
+	locationsToAdjust map[location.Location]bool
+	adjustLock        sync.Mutex
+
 	totalHostNum int
 	hostNumLock  sync.RWMutex
 
+	// free and assigned host number per location and machine type
+	capacity *capacityCounter
+
 	// Latest resource version map
 	currentRVs [][]uint64
 	rvLock     sync.RWMutex
 }
 
-func NewNodeStore(vNodeNumPerRP int, regionNum int, partitionMaxNum int) *NodeStore {
-	klog.V(3).Infof("Initialize node store with virtual node per RP: %d\n", vNodeNumPerRP)
-
-	totalVirtualNodeNum := vNodeNumPerRP * regionNum * partitionMaxNum
-	virtualNodeStores := make([]*VirtualNodeStore, totalVirtualNodeNum)
+func NewNodeStore(hostsPerVirtualStore int, regionNum int, partitionMaxNum int) *NodeStore {
+	klog.V(3).Infof("Initialize node store with target host number per virtual node: %d\n", hostsPerVirtualStore)
 
 	rvArray := make([][]uint64, regionNum)
 	for i := 0; i < regionNum; i++ {
@@ -160,17 +224,18 @@ func NewNodeStore(vNodeNumPerRP int, regionNum int, partitionMaxNum int) *NodeSt
 	}
 
 	ns := &NodeStore{
-		virtualNodeNum:  totalVirtualNodeNum,
-		vNodeStores:     &virtualNodeStores,
-		granularOfRing:  location.RingRange / (float64(totalVirtualNodeNum)),
-		regionNum:       regionNum,
-		partitionMaxNum: partitionMaxNum,
-		resourceSlots:   regionNum * partitionMaxNum,
-		currentRVs:      rvArray,
-		totalHostNum:    0,
+		hostsPerVirtualStore: hostsPerVirtualStore,
+		vNodeStoresByLoc:     make(map[location.Location][]*VirtualNodeStore, regionNum*partitionMaxNum),
+		locationsToAdjust:    make(map[location.Location]bool),
+		regionNum:            regionNum,
+		partitionMaxNum:      partitionMaxNum,
+		resourceSlots:        regionNum * partitionMaxNum,
+		capacity:             newCapacityCounter(),
+		currentRVs:           rvArray,
+		totalHostNum:         0,
 	}
 
-	ns.generateVirtualNodeStores(vNodeNumPerRP)
+	ns.generateVirtualNodeStores()
 	return ns
 }
 
@@ -195,29 +260,69 @@ func (ns *NodeStore) GetTotalHostNum() int {
 	return ns.totalHostNum
 }
 
+func (ns *NodeStore) GetHostsPerVirtualStore() int {
+	return ns.hostsPerVirtualStore
+}
+
+// CheckFreeCapacity checks whether hosts not assigned to any client are enough for the request
 func (ns *NodeStore) CheckFreeCapacity(requestedHostNum int) bool {
-	ns.nsLock.Lock()
-	defer ns.nsLock.Unlock()
-	allocatableHostNum := 0
-	for _, vs := range *ns.vNodeStores {
-		allocatableHostNum += vs.GetHostNum()
-		if allocatableHostNum >= requestedHostNum {
-			return true
-		}
-	}
+	return ns.capacity.getFreeHostNum() >= requestedHostNum
+}
 
-	return false
+// GetCapacitySummary returns free and assigned host number broken down by region, resource partition and machine type
+func (ns *NodeStore) GetCapacitySummary() *types.CapacitySummary {
+	return ns.capacity.getSummary()
 }
 
+// GetVirtualStores returns all virtual node stores in the order of the hash ring
 func (ns *NodeStore) GetVirtualStores() *[]*VirtualNodeStore {
-	return ns.vNodeStores
+	ns.nsLock.RLock()
+	defer ns.nsLock.RUnlock()
+	vNodeStores := ns.getVirtualStoresInRingOrder()
+	return &vNodeStores
+}
+
+// GetVirtualStoresByLocation returns virtual node stores of a resource partition, sorted by hash range
+func (ns *NodeStore) GetVirtualStoresByLocation(loc location.Location) []*VirtualNodeStore {
+	ns.nsLock.RLock()
+	defer ns.nsLock.RUnlock()
+	stores := ns.vNodeStoresByLoc[loc]
+	storesCopy := make([]*VirtualNodeStore, len(stores))
+	copy(storesCopy, stores)
+	return storesCopy
+}
+
+// GetVirtualStoresAssignedToClient returns all virtual node stores currently assigned to the client
+func (ns *NodeStore) GetVirtualStoresAssignedToClient(clientId string) []*VirtualNodeStore {
+	ns.nsLock.RLock()
+	defer ns.nsLock.RUnlock()
+	assignedStores := make([]*VirtualNodeStore, 0)
+	for _, vs := range ns.getVirtualStoresInRingOrder() {
+		if vs.GetAssignedClient() == clientId {
+			assignedStores = append(assignedStores, vs)
+		}
+	}
+	return assignedStores
+}
+
+func (ns *NodeStore) getVirtualStoresInRingOrder() []*VirtualNodeStore {
+	vNodeStores := make([]*VirtualNodeStore, 0, ns.resourceSlots)
+	for k := 0; k < ns.regionNum; k++ {
+		region := location.Regions[k]
+		rpsInRegion := location.GetRPsForRegion(region)
+		for m := 0; m < ns.partitionMaxNum; m++ {
+			vNodeStores = append(vNodeStores, ns.vNodeStoresByLoc[*location.NewLocation(region, rpsInRegion[m])]...)
+		}
+	}
+	return vNodeStores
 }
 
-func (ns *NodeStore) generateVirtualNodeStores(vNodeNumPerRP int) {
+// generateVirtualNodeStores creates one virtual node store for each resource partition
+// Virtual node stores are split when hosts are added to the resource partition
+func (ns *NodeStore) generateVirtualNodeStores() {
 	ns.nsLock.Lock()
 	defer ns.nsLock.Unlock()
 
-	vNodeIndex := 0
 	for k := 0; k < ns.regionNum; k++ {
 		region := location.Regions[k]
 		rpsInRegion := location.GetRPsForRegion(region)
@@ -225,29 +330,215 @@ func (ns *NodeStore) generateVirtualNodeStores(vNodeNumPerRP int) {
 		for m := 0; m < ns.partitionMaxNum; m++ {
 			loc := location.NewLocation(region, rpsInRegion[m])
 			lowerBound, upperBound := loc.GetArcRangeFromLocation()
+			ns.vNodeStoresByLoc[*loc] = []*VirtualNodeStore{newVirtualNodeStore(*loc, lowerBound, upperBound, VirtualStoreInitSize, ns.capacity)}
+		}
+	}
+}
 
-			for i := 0; i < vNodeNumPerRP; i++ {
+func newVirtualNodeStore(loc location.Location, lowerBound float64, upperBound float64, initSize int, capacity *capacityCounter) *VirtualNodeStore {
+	return &VirtualNodeStore{
+		mu:              sync.RWMutex{},
+		nodeEventByHash: make(map[float64]*node.ManagedNodeEvent, initSize),
+		lowerbound:      lowerBound,
+		upperbound:      upperBound,
+		location:        loc,
+		capacity:        capacity,
+	}
+}
 
-				(*ns.vNodeStores)[vNodeIndex] = &VirtualNodeStore{
-					mu:              sync.RWMutex{},
-					nodeEventByHash: make(map[float64]*node.ManagedNodeEvent, VirtualStoreInitSize),
-					lowerbound:      lowerBound,
-					upperbound:      lowerBound + ns.granularOfRing,
-					location:        *loc,
+// NeedsVirtualStoreAdjustment returns whether any resource partition has virtual node stores to be split or merged
+func (ns *NodeStore) NeedsVirtualStoreAdjustment() bool {
+	ns.adjustLock.Lock()
+	defer ns.adjustLock.Unlock()
+	return len(ns.locationsToAdjust) > 0
+}
+
+func (ns *NodeStore) markLocationToAdjust(loc location.Location) {
+	ns.adjustLock.Lock()
+	ns.locationsToAdjust[loc] = true
+	ns.adjustLock.Unlock()
+}
+
+// AdjustVirtualStores splits virtual node stores that hold more than twice of the target host number and
+// merges adjacent virtual node stores with same assignment whose total host number is within the target.
+// Split stores keep the client assignment of the original store.
+// Returns ids of the clients whose assigned virtual node stores are changed.
+func (ns *NodeStore) AdjustVirtualStores() map[string]bool {
+	ns.adjustLock.Lock()
+	locations := ns.locationsToAdjust
+	ns.locationsToAdjust = make(map[location.Location]bool)
+	ns.adjustLock.Unlock()
+
+	changedClients := make(map[string]bool)
+	if len(locations) == 0 {
+		return changedClients
+	}
+
+	ns.nsLock.Lock()
+	defer ns.nsLock.Unlock()
+	for loc := range locations {
+		oldStoreNum := len(ns.vNodeStoresByLoc[loc])
+		stores := ns.splitVirtualStores(ns.vNodeStoresByLoc[loc], changedClients)
+		stores = ns.mergeVirtualStores(stores, changedClients)
+		ns.vNodeStoresByLoc[loc] = stores
+		klog.V(3).Infof("Adjusted virtual node stores for location %v from %d to %d", loc.String(), oldStoreNum, len(stores))
+
+		// split by equal hash ranges may leave skewed stores above the threshold, check them again in next adjustment
+		for _, vs := range stores {
+			if vs.GetHostNum() > 2*ns.hostsPerVirtualStore {
+				ns.markLocationToAdjust(loc)
+				break
+			}
+		}
+	}
+
+	return changedClients
+}
+
+func (ns *NodeStore) splitVirtualStores(stores []*VirtualNodeStore, changedClients map[string]bool) []*VirtualNodeStore {
+	result := make([]*VirtualNodeStore, 0, len(stores))
+	for _, vs := range stores {
+		hostNum := vs.GetHostNum()
+		if hostNum <= 2*ns.hostsPerVirtualStore {
+			result = append(result, vs)
+			continue
+		}
+
+		splitNum := int(math.Ceil(float64(hostNum) / float64(ns.hostsPerVirtualStore)))
+		result = append(result, vs.split(splitNum)...)
+		if vs.clientId != "" {
+			changedClients[vs.clientId] = true
+		}
+	}
+	return result
+}
+
+func (ns *NodeStore) mergeVirtualStores(stores []*VirtualNodeStore, changedClients map[string]bool) []*VirtualNodeStore {
+	result := make([]*VirtualNodeStore, 0, len(stores))
+	for _, vs := range stores {
+		if len(result) > 0 {
+			last := result[len(result)-1]
+			if last.clientId == vs.clientId && last.GetHostNum()+vs.GetHostNum() <= ns.hostsPerVirtualStore {
+				last.absorb(vs)
+				if vs.clientId != "" {
+					changedClients[vs.clientId] = true
 				}
-				lowerBound += ns.granularOfRing
-				vNodeIndex++
+				continue
 			}
+		}
+		result = append(result, vs)
+	}
+	return result
+}
 
-			// remove the impact of inaccuracy
-			(*ns.vNodeStores)[vNodeIndex-1].upperbound = upperBound
+// split divides the hash range of the virtual store into splitNum equal sub ranges.
+// The original store keeps the first sub range; new stores inherit client assignment.
+func (vs *VirtualNodeStore) split(splitNum int) []*VirtualNodeStore {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	lowerBound, upperBound := vs.lowerbound, vs.upperbound
+	granularity := (upperBound - lowerBound) / float64(splitNum)
+	stores := make([]*VirtualNodeStore, splitNum)
+	stores[0] = vs
+	for i := 1; i < splitNum; i++ {
+		stores[i] = newVirtualNodeStore(vs.location, lowerBound+float64(i)*granularity, lowerBound+float64(i+1)*granularity, len(vs.nodeEventByHash)/splitNum, vs.capacity)
+		stores[i].clientId = vs.clientId
+		stores[i].eventQueue = vs.eventQueue
+	}
+	// remove the impact of inaccuracy
+	stores[splitNum-1].upperbound = upperBound
+	vs.upperbound = lowerBound + granularity
+
+	for hashValue, n := range vs.nodeEventByHash {
+		index := int(math.Ceil((hashValue-lowerBound)/granularity)) - 1
+		if index <= 0 {
+			continue
+		} else if index >= splitNum {
+			index = splitNum - 1
 		}
+		stores[index].nodeEventByHash[hashValue] = n
+		delete(vs.nodeEventByHash, hashValue)
 	}
 
-	(*ns.vNodeStores)[ns.virtualNodeNum-1].upperbound = location.RingRange
+	return stores
+}
+
+// absorb moves hash range and nodes of the adjacent virtual store into this virtual store
+func (vs *VirtualNodeStore) absorb(next *VirtualNodeStore) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	next.mu.Lock()
+	defer next.mu.Unlock()
+
+	for hashValue, n := range next.nodeEventByHash {
+		vs.nodeEventByHash[hashValue] = n
+	}
+	next.nodeEventByHash = make(map[float64]*node.ManagedNodeEvent, VirtualStoreInitSize)
+	vs.upperbound = next.upperbound
+}
+
+// AssignVirtualStoreWithEvents assigns a free virtual store to client and sends ADDED events of all its nodes to the client.
+// Node events are blocked during reassignment so the client won't miss any change of the virtual store.
+func (ns *NodeStore) AssignVirtualStoreWithEvents(vs *VirtualNodeStore, clientId string, eventQueue *cache.NodeEventQueue) bool {
+	ns.nsLock.Lock()
+	defer ns.nsLock.Unlock()
+
+	if !vs.AssignToClient(clientId, eventQueue) {
+		return false
+	}
+	eventQueue.EnqueueResyncEvents(toObjects(vs.generateNodeEvents(runtime.Added)))
+	return true
+}
+
+// ReleaseVirtualStoreWithEvents returns virtual store to the free pool and sends DELETED events of all its nodes to the
+// previously assigned client
+func (ns *NodeStore) ReleaseVirtualStoreWithEvents(vs *VirtualNodeStore) {
+	ns.nsLock.Lock()
+	defer ns.nsLock.Unlock()
+
+	eventQueue := vs.eventQueue
+	vs.Release()
+	if eventQueue == nil {
+		return
+	}
+	eventQueue.EnqueueResyncEvents(toObjects(vs.generateNodeEvents(runtime.Deleted)))
+}
+
+// ReleaseVirtualStore returns virtual store to the free pool without sending events to the previously assigned client
+func (ns *NodeStore) ReleaseVirtualStore(vs *VirtualNodeStore) {
+	ns.nsLock.Lock()
+	defer ns.nsLock.Unlock()
+	vs.Release()
+}
+
+// generateNodeEvents creates events with given type for all nodes in the virtual store, ordered by resource version
+func (vs *VirtualNodeStore) generateNodeEvents(eventType runtime.EventType) []*node.ManagedNodeEvent {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	nodeEvents := make([]*node.ManagedNodeEvent, 0, len(vs.nodeEventByHash))
+	for _, n := range vs.nodeEventByHash {
+		nodeEvent := runtime.NewNodeEvent(n.CopyNode(), eventType)
+		nodeEvents = append(nodeEvents, node.NewManagedNodeEvent(nodeEvent, n.GetLocation()))
+	}
+	sort.Slice(nodeEvents, func(i, j int) bool {
+		return nodeEvents[i].GetResourceVersionInt64() < nodeEvents[j].GetResourceVersionInt64()
+	})
+	return nodeEvents
+}
+
+func toObjects(nodeEvents []*node.ManagedNodeEvent) []runtime.Object {
+	objects := make([]runtime.Object, len(nodeEvents))
+	for i, e := range nodeEvents {
+		objects[i] = e
+	}
+	return objects
 }
 
 func (ns *NodeStore) CreateNode(nodeEvent *node.ManagedNodeEvent) {
+	ns.nsLock.RLock()
+	defer ns.nsLock.RUnlock()
 	isNewNode := ns.addNodeToRing(nodeEvent)
 	if !isNewNode {
 		ns.updateNodeInRing(nodeEvent)
@@ -255,21 +546,33 @@ func (ns *NodeStore) CreateNode(nodeEvent *node.ManagedNodeEvent) {
 }
 
 func (ns *NodeStore) UpdateNode(nodeEvent *node.ManagedNodeEvent) {
+	ns.nsLock.RLock()
+	defer ns.nsLock.RUnlock()
 	ns.updateNodeInRing(nodeEvent)
 }
 
-// TODO
-func (ns NodeStore) DeleteNode(nodeEvent runtime.NodeEvent) {
+func (ns *NodeStore) DeleteNode(nodeEvent *node.ManagedNodeEvent) {
+	ns.nsLock.RLock()
+	defer ns.nsLock.RUnlock()
+	ns.deleteNodeFromRing(nodeEvent)
 }
 
-func (ns NodeStore) GetNode(region location.Region, resourcePartition location.ResourcePartition, nodeId string) (*types.LogicalNode, error) {
+func (ns *NodeStore) GetNode(region location.Region, resourcePartition location.ResourcePartition, nodeId string) (*types.LogicalNode, error) {
 	n := &types.LogicalNode{Id: nodeId}
 	ne := runtime.NewNodeEvent(n, runtime.Bookmark)
 
 	loc := location.NewLocation(location.Region(region), location.ResourcePartition((resourcePartition)))
 	mgmtNE := node.NewManagedNodeEvent(ne, loc)
 
+	ns.nsLock.RLock()
+	defer ns.nsLock.RUnlock()
 	hashValue, _, vNodeStore := ns.getVirtualNodeStore(mgmtNE)
+	if vNodeStore == nil {
+		return nil, types.Error_ObjectNotFound
+	}
+
+	vNodeStore.mu.RLock()
+	defer vNodeStore.mu.RUnlock()
 	if oldNode, isOK := vNodeStore.nodeEventByHash[hashValue]; isOK {
 		return oldNode.CopyNode(), nil
 	} else {
@@ -280,25 +583,45 @@ func (ns NodeStore) GetNode(region location.Region, resourcePartition location.R
 func (ns *NodeStore) ProcessNodeEvents(nodeEvents []*node.ManagedNodeEvent, persistHelper *DistributorPersistHelper) (bool, types.TransitResourceVersionMap) {
 	persistHelper.SetWaitCount(len(nodeEvents))
 
-	eventsToPersist := make([]*types.LogicalNode, BatchPersistSize)
-	i := 0
-	for _, e := range nodeEvents {
+	// only the last event of a node is saved, so that saving and deleting the same node in the background do not race
+	lastEventIndex := make(map[string]int, len(nodeEvents))
+	for i, e := range nodeEvents {
+		if e != nil {
+			lastEventIndex[e.GetId()] = i
+		}
+	}
+
+	nodesToPersist := make([]*types.LogicalNode, 0, BatchPersistSize)
+	nodesToDelete := make([]*types.LogicalNode, 0, BatchPersistSize)
+	for i, e := range nodeEvents {
 		if e == nil {
 			persistHelper.persistNodeWaitGroup.Done()
 			continue
 		}
-		ns.processNodeEvent(e)
-		eventsToPersist[i] = e.GetNodeEvent().Node
-		i++
-		if i == BatchPersistSize {
-			persistHelper.PersistNodes(eventsToPersist)
-			i = 0
-			eventsToPersist = make([]*types.LogicalNode, BatchPersistSize)
+		if !ns.processNodeEvent(e) || lastEventIndex[e.GetId()] != i {
+			persistHelper.persistNodeWaitGroup.Done()
+			continue
 		}
+		// deleted nodes are removed from store, otherwise they are restored after restart
+		if e.GetEventType() == runtime.Deleted {
+			nodesToDelete = append(nodesToDelete, e.GetNodeEvent().Node)
+			if len(nodesToDelete) == BatchPersistSize {
+				persistHelper.PersistDeletedNodes(nodesToDelete)
+				nodesToDelete = make([]*types.LogicalNode, 0, BatchPersistSize)
+			}
+		} else {
+			nodesToPersist = append(nodesToPersist, e.GetNodeEvent().Node)
+			if len(nodesToPersist) == BatchPersistSize {
+				persistHelper.PersistNodes(nodesToPersist)
+				nodesToPersist = make([]*types.LogicalNode, 0, BatchPersistSize)
+			}
+		}
+	}
+	if len(nodesToPersist) > 0 {
+		persistHelper.PersistNodes(nodesToPersist)
 	}
-	if i > 0 {
-		remainingEventsToPersist := eventsToPersist[0:i]
-		persistHelper.PersistNodes(remainingEventsToPersist)
+	if len(nodesToDelete) > 0 {
+		persistHelper.PersistDeletedNodes(nodesToDelete)
 	}
 
 	// persist disk
@@ -311,12 +634,93 @@ func (ns *NodeStore) ProcessNodeEvents(nodeEvents []*node.ManagedNodeEvent, pers
 	return true, ns.GetCurrentResourceVersions()
 }
 
+// SetRegionNodesStale flags nodes of the region unschedulable with the NoSchedule taint, or restores the flagged nodes
+// Flagged nodes are not persisted, and are replaced by the next event of the node from the region manager
+// Changes are sent to clients as modified events with the latest resource version of the resource partition, so that
+// clients watching from before the change get them without listing again, and the next event from the region manager
+// is not skipped by clients watching from the resource version of the changes
+// It returns the number of nodes changed
+func (ns *NodeStore) SetRegionNodesStale(region location.Region, isStale bool) int {
+	// node events are not processed meanwhile, so that the events are queued after the ones of the latest resource version
+	ns.nsLock.Lock()
+	defer ns.nsLock.Unlock()
+	changedNum := 0
+	for loc, vNodeStores := range ns.vNodeStoresByLoc {
+		if loc.GetRegion() != region {
+			continue
+		}
+		resourceVersion := ns.getCurrentResourceVersion(loc)
+		for _, vs := range vNodeStores {
+			changedNum += vs.setNodesStale(isStale, resourceVersion)
+		}
+	}
+	return changedNum
+}
+
+// getCurrentResourceVersion returns the resource version for events generated by the node store in the location
+// It is the latest resource version from the region manager, which is not changed by the generated events
+func (ns *NodeStore) getCurrentResourceVersion(loc location.Location) uint64 {
+	ns.rvLock.RLock()
+	defer ns.rvLock.RUnlock()
+	return ns.currentRVs[loc.GetRegion()][loc.GetResourcePartition()]
+}
+
+// DeleteRegionNodes deletes all nodes of the region from the node store, caller needs to delete the returned nodes from store
+// Deleted events are sent to clients with the latest resource version of the resource partition,
+// the same way as the events of stale nodes
+// It returns the nodes deleted
+func (ns *NodeStore) DeleteRegionNodes(region location.Region) []*types.LogicalNode {
+	// node events are not processed meanwhile, so that the events are queued after the ones of the latest resource version
+	ns.nsLock.Lock()
+	defer ns.nsLock.Unlock()
+	deletedNodes := make([]*types.LogicalNode, 0)
+	for loc, vNodeStores := range ns.vNodeStoresByLoc {
+		if loc.GetRegion() != region {
+			continue
+		}
+		resourceVersion := strconv.FormatUint(ns.getCurrentResourceVersion(loc), 10)
+		for _, vs := range vNodeStores {
+			for _, deleted := range vs.generateNodeEvents(runtime.Deleted) {
+				e := node.NewGeneratedNodeEvent(deleted.GetNodeEvent(), deleted.GetLocation())
+				hashValue, _, _ := ns.getVirtualNodeStore(e)
+				e.GetNodeEvent().Node.ResourceVersion = resourceVersion
+				// event queue is locked before virtual node store to keep the locking sequence
+				if vs.eventQueue != nil {
+					vs.eventQueue.EnqueueEvent(e)
+				}
+				ns.removeNodeFromStore(e, hashValue, vs)
+				deletedNodes = append(deletedNodes, e.GetNodeEvent().Node)
+			}
+		}
+	}
+	return deletedNodes
+}
+
+// RestoreNodeEvents adds nodes persisted before restart to the node store, without persisting them again
+func (ns *NodeStore) RestoreNodeEvents(nodeEvents []*node.ManagedNodeEvent) types.TransitResourceVersionMap {
+	for _, e := range nodeEvents {
+		if e != nil {
+			ns.processNodeEvent(e)
+		}
+	}
+	return ns.GetCurrentResourceVersions()
+}
+
 func (ns *NodeStore) processNodeEvent(nodeEvent *node.ManagedNodeEvent) bool {
+	// node store is locked until the resource version map is updated, so that events generated by the node store
+	// get resource versions not older than the events queued
+	ns.nsLock.RLock()
+	defer ns.nsLock.RUnlock()
 	switch nodeEvent.GetEventType() {
 	case runtime.Added:
-		ns.CreateNode(nodeEvent)
+		isNewNode := ns.addNodeToRing(nodeEvent)
+		if !isNewNode {
+			ns.updateNodeInRing(nodeEvent)
+		}
 	case runtime.Modified:
-		ns.UpdateNode(nodeEvent)
+		ns.updateNodeInRing(nodeEvent)
+	case runtime.Deleted:
+		ns.deleteNodeFromRing(nodeEvent)
 	default:
 		// TODO - action needs to take when non acceptable events happened
 		klog.Warningf("Invalid event type [%v] for node %v, location %v, rv %v",
@@ -358,14 +762,31 @@ func (ns *NodeStore) getNodeHash(node *node.ManagedNodeEvent) (float64, int) {
 	return lower + ringValue*(upper-lower), 0
 }
 
+// getVirtualNodeStore returns hash value of the node, ring id and the virtual node store the node belongs to
+// Caller needs to hold nsLock
 func (ns *NodeStore) getVirtualNodeStore(node *node.ManagedNodeEvent) (float64, int, *VirtualNodeStore) {
 	hashValue, ringId := ns.getNodeHash(node)
-	virtualNodeIndex := int(math.Floor(hashValue / ns.granularOfRing))
-	return hashValue, ringId, (*ns.vNodeStores)[virtualNodeIndex]
+	stores := ns.vNodeStoresByLoc[*node.GetLocation()]
+	if len(stores) == 0 {
+		return hashValue, ringId, nil
+	}
+
+	// virtual node store manages hash range (lowerbound, upperbound]
+	virtualNodeIndex := sort.Search(len(stores), func(i int) bool {
+		return stores[i].upperbound >= hashValue
+	})
+	if virtualNodeIndex == len(stores) {
+		virtualNodeIndex--
+	}
+	return hashValue, ringId, stores[virtualNodeIndex]
 }
 
 func (ns *NodeStore) addNodeToRing(nodeEvent *node.ManagedNodeEvent) (isNewNode bool) {
 	hashValue, _, vNodeStore := ns.getVirtualNodeStore(nodeEvent)
+	if vNodeStore == nil {
+		klog.Errorf("No virtual node store found for node %s, location %v", nodeEvent.GetId(), nodeEvent.GetLocation())
+		return true
+	}
 	// add event to event queue
 	// During list snapshot, eventQueue will be locked first and virtual node stores will be locked later
 	// Keep the locking sequence here to prevent deadlock
@@ -385,6 +806,10 @@ func (ns *NodeStore) addNodeToRing(nodeEvent *node.ManagedNodeEvent) (isNewNode
 		}
 	}
 	vNodeStore.nodeEventByHash[hashValue] = nodeEvent
+	ns.capacity.add(vNodeStore.location, nodeEvent.GetMachineType(), vNodeStore.clientId != "", 1)
+	if len(vNodeStore.nodeEventByHash) > 2*ns.hostsPerVirtualStore {
+		ns.markLocationToAdjust(vNodeStore.location)
+	}
 
 	ns.hostNumLock.Lock()
 	ns.totalHostNum++
@@ -395,6 +820,10 @@ func (ns *NodeStore) addNodeToRing(nodeEvent *node.ManagedNodeEvent) (isNewNode
 
 func (ns *NodeStore) updateNodeInRing(nodeEvent *node.ManagedNodeEvent) {
 	hashValue, _, vNodeStore := ns.getVirtualNodeStore(nodeEvent)
+	if vNodeStore == nil {
+		klog.Errorf("No virtual node store found for node %s, location %v", nodeEvent.GetId(), nodeEvent.GetLocation())
+		return
+	}
 	// add event to event queue
 	// During list snapshot, eventQueue will be locked first and virtual node stores will be locked later
 	// Keep the locking sequence here to prevent deadlock
@@ -406,11 +835,19 @@ func (ns *NodeStore) updateNodeInRing(nodeEvent *node.ManagedNodeEvent) {
 	if oldNode, isOK := vNodeStore.nodeEventByHash[hashValue]; isOK {
 		// TODO - check uuid to make sure updating right node
 		if oldNode.GetId() == nodeEvent.GetId() {
-			if oldNode.GetResourceVersionInt64() < nodeEvent.GetResourceVersionInt64() {
+			// stale node is replaced by the node from the region manager with the same resource version as the original one
+			originalRV := oldNode.GetOriginal().GetResourceVersionInt64()
+			if originalRV < nodeEvent.GetResourceVersionInt64() ||
+				(oldNode.IsStale() && originalRV == nodeEvent.GetResourceVersionInt64()) {
 				vNodeStore.nodeEventByHash[hashValue] = nodeEvent
+				if oldNode.GetMachineType() != nodeEvent.GetMachineType() {
+					isAssigned := vNodeStore.clientId != ""
+					ns.capacity.add(vNodeStore.location, oldNode.GetMachineType(), isAssigned, -1)
+					ns.capacity.add(vNodeStore.location, nodeEvent.GetMachineType(), isAssigned, 1)
+				}
 			} else {
 				klog.V(3).Infof("Discard node update events due to resource version is older: %d. Existing rv %d",
-					nodeEvent.GetResourceVersionInt64(), oldNode.GetResourceVersionInt64())
+					nodeEvent.GetResourceVersionInt64(), originalRV)
 				vNodeStore.mu.Unlock()
 				return
 			}
@@ -428,11 +865,92 @@ func (ns *NodeStore) updateNodeInRing(nodeEvent *node.ManagedNodeEvent) {
 	}
 }
 
+func (ns *NodeStore) deleteNodeFromRing(nodeEvent *node.ManagedNodeEvent) {
+	hashValue, _, vNodeStore := ns.getVirtualNodeStore(nodeEvent)
+	if vNodeStore == nil {
+		klog.Errorf("No virtual node store found for node %s, location %v", nodeEvent.GetId(), nodeEvent.GetLocation())
+		return
+	}
+	// clients do not get deleted events of nodes never sent to them
+	vNodeStore.mu.RLock()
+	oldNode, isOK := vNodeStore.nodeEventByHash[hashValue]
+	isExistingNode := isOK && oldNode.GetId() == nodeEvent.GetId()
+	vNodeStore.mu.RUnlock()
+	if !isExistingNode {
+		klog.V(3).Infof("Node %s to be deleted does not exist in virtual node store", nodeEvent.GetId())
+		return
+	}
+	// add event to event queue
+	// During list snapshot, eventQueue will be locked first and virtual node stores will be locked later
+	// Keep the locking sequence here to prevent deadlock
+	if vNodeStore.eventQueue != nil {
+		vNodeStore.eventQueue.EnqueueEvent(nodeEvent)
+	}
+	ns.removeNodeFromStore(nodeEvent, hashValue, vNodeStore)
+}
+
+// removeNodeFromStore removes the node from its virtual node store without sending events to clients
+// It must be called with nsLock held
+func (ns *NodeStore) removeNodeFromStore(nodeEvent *node.ManagedNodeEvent, hashValue float64, vNodeStore *VirtualNodeStore) {
+	vNodeStore.mu.Lock()
+	oldNode, isOK := vNodeStore.nodeEventByHash[hashValue]
+	if !isOK || oldNode.GetId() != nodeEvent.GetId() {
+		vNodeStore.mu.Unlock()
+		klog.V(3).Infof("Node %s to be deleted does not exist in virtual node store", nodeEvent.GetId())
+		return
+	}
+	delete(vNodeStore.nodeEventByHash, hashValue)
+	ns.capacity.add(vNodeStore.location, oldNode.GetMachineType(), vNodeStore.clientId != "", -1)
+	isUnderFilled := len(vNodeStore.nodeEventByHash) < ns.hostsPerVirtualStore/2
+	vNodeStore.mu.Unlock()
+
+	// virtual stores are adjusted under the allocate lock, so only locations with stores to merge are marked
+	if isUnderFilled && ns.canMergeVirtualStore(vNodeStore) {
+		ns.markLocationToAdjust(vNodeStore.location)
+	}
+
+	ns.hostNumLock.Lock()
+	ns.totalHostNum--
+	ns.hostNumLock.Unlock()
+}
+
+// canMergeVirtualStore returns whether the virtual store can be merged with an adjacent virtual store in its location,
+// see mergeVirtualStores
+// Caller needs to hold nsLock
+func (ns *NodeStore) canMergeVirtualStore(vs *VirtualNodeStore) bool {
+	stores := ns.vNodeStoresByLoc[vs.location]
+	for i, other := range stores {
+		if other != vs {
+			continue
+		}
+		hostNum := vs.GetHostNum()
+		clientId := vs.GetAssignedClient()
+		for _, j := range []int{i - 1, i + 1} {
+			if j < 0 || j >= len(stores) {
+				continue
+			}
+			if stores[j].GetAssignedClient() == clientId && stores[j].GetHostNum()+hostNum <= ns.hostsPerVirtualStore {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
 func (ns *NodeStore) getNodeStoreStatus() *store.NodeStoreStatus {
+	ns.nsLock.RLock()
+	virtualNodeNum := 0
+	for _, stores := range ns.vNodeStoresByLoc {
+		virtualNodeNum += len(stores)
+	}
+	ns.nsLock.RUnlock()
+
 	return &store.NodeStoreStatus{
 		RegionNum:              ns.regionNum,
 		PartitionMaxNum:        ns.partitionMaxNum,
-		VirtualNodeNumPerRP:    ns.virtualNodeNum / (ns.regionNum * ns.partitionMaxNum),
+		HostsPerVirtualNode:    ns.hostsPerVirtualStore,
+		VirtualNodeNum:         virtualNodeNum,
 		CurrentResourceVerions: ns.GetCurrentResourceVersions(),
 	}
 }
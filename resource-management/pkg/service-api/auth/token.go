@@ -0,0 +1,134 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"global-resource-service/resource-management/pkg/common-lib/types"
+)
+
+const (
+	// RoleClient is the role of tokens issued to registered clients, bound to the client id
+	RoleClient = "client"
+	// RoleAdmin is the role of tokens for client administration, signed by the operator
+	RoleAdmin = "admin"
+
+	minSigningKeyLength = 32
+)
+
+// Claims is the payload of a bearer token
+// Subject is the client id for client tokens
+// ExpiresAt is unix time in seconds, 0 means the token does not expire
+// LeaseGeneration is the lease generation of the client the token is issued on registration for, the token is not
+// valid once the lease expires, even if the client is registered again. 0 for tokens not bound to a lease
+type Claims struct {
+	Subject         string `json:"sub"`
+	Role            string `json:"role"`
+	IssuedAt        int64  `json:"iat"`
+	ExpiresAt       int64  `json:"exp,omitempty"`
+	LeaseGeneration int64  `json:"lease,omitempty"`
+}
+
+// TokenSigner signs and verifies bearer tokens with a shared HMAC-SHA256 key
+// Token format is base64url(claims json).base64url(signature of the first part)
+type TokenSigner struct {
+	signingKey []byte
+	tokenTTL   time.Duration
+}
+
+// NewTokenSigner returns a token signer. Tokens signed expire after tokenTTL, or never if tokenTTL is 0
+func NewTokenSigner(signingKey []byte, tokenTTL time.Duration) (*TokenSigner, error) {
+	if len(signingKey) < minSigningKeyLength {
+		return nil, errors.New("token signing key must be at least 32 bytes")
+	}
+	return &TokenSigner{signingKey: signingKey, tokenTTL: tokenTTL}, nil
+}
+
+// LoadSigningKey reads the signing key from file, leading and trailing white spaces are trimmed
+func LoadSigningKey(keyFile string) ([]byte, error) {
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.TrimSpace(string(key))), nil
+}
+
+// Sign issues a token for the subject with the role
+func (s *TokenSigner) Sign(subject string, role string) (string, error) {
+	return s.sign(Claims{Subject: subject, Role: role})
+}
+
+// SignClientLease issues a client token valid for the lease generation of the client only
+func (s *TokenSigner) SignClientLease(clientId string, leaseGeneration int64) (string, error) {
+	return s.sign(Claims{Subject: clientId, Role: RoleClient, LeaseGeneration: leaseGeneration})
+}
+
+func (s *TokenSigner) sign(claims Claims) (string, error) {
+	now := time.Now()
+	claims.IssuedAt = now.Unix()
+	if s.tokenTTL > 0 {
+		claims.ExpiresAt = now.Add(s.tokenTTL).Unix()
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	return encodedPayload + "." + base64.RawURLEncoding.EncodeToString(s.signature(encodedPayload)), nil
+}
+
+// Verify checks the token signature and expiration and returns its claims
+func (s *TokenSigner) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, types.Error_InvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, s.signature(parts[0])) {
+		return nil, types.Error_InvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, types.Error_InvalidToken
+	}
+	claims := &Claims{}
+	if err = json.Unmarshal(payload, claims); err != nil || claims.Subject == "" {
+		return nil, types.Error_InvalidToken
+	}
+	if claims.ExpiresAt > 0 && time.Now().Unix() >= claims.ExpiresAt {
+		return nil, types.Error_TokenExpired
+	}
+
+	return claims, nil
+}
+
+func (s *TokenSigner) signature(encodedPayload string) []byte {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(encodedPayload))
+	return mac.Sum(nil)
+}
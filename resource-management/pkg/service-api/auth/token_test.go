@@ -0,0 +1,106 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"global-resource-service/resource-management/pkg/common-lib/types"
+)
+
+var testSigningKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestSignAndVerifyToken(t *testing.T) {
+	signer, err := NewTokenSigner(testSigningKey, time.Hour)
+	assert.Nil(t, err)
+
+	token, err := signer.Sign("Client-1", RoleClient)
+	assert.Nil(t, err)
+
+	claims, err := signer.Verify(token)
+	assert.Nil(t, err)
+	assert.Equal(t, "Client-1", claims.Subject)
+	assert.Equal(t, RoleClient, claims.Role)
+	assert.True(t, claims.ExpiresAt > time.Now().Unix())
+
+	// token signed with other key
+	otherSigner, err := NewTokenSigner([]byte("abcdef0123456789abcdef0123456789"), time.Hour)
+	assert.Nil(t, err)
+	_, err = otherSigner.Verify(token)
+	assert.Equal(t, types.Error_InvalidToken, err)
+
+	// tampered claims
+	parts := strings.Split(token, ".")
+	adminToken, err := signer.Sign("Client-1", RoleAdmin)
+	assert.Nil(t, err)
+	_, err = signer.Verify(strings.Split(adminToken, ".")[0] + "." + parts[1])
+	assert.Equal(t, types.Error_InvalidToken, err)
+
+	for _, invalidToken := range []string{"", "abc", "a.b.c", parts[0] + "."} {
+		_, err = signer.Verify(invalidToken)
+		assert.Equal(t, types.Error_InvalidToken, err, "Expecting invalid token %s", invalidToken)
+	}
+}
+
+func TestVerifyExpiredToken(t *testing.T) {
+	signer, err := NewTokenSigner(testSigningKey, time.Second)
+	assert.Nil(t, err)
+	token, err := signer.Sign("Client-1", RoleClient)
+	assert.Nil(t, err)
+
+	time.Sleep(time.Second)
+	_, err = signer.Verify(token)
+	assert.Equal(t, types.Error_TokenExpired, err)
+
+	// token without expiration
+	signer, err = NewTokenSigner(testSigningKey, 0)
+	assert.Nil(t, err)
+	token, err = signer.Sign("Client-1", RoleClient)
+	assert.Nil(t, err)
+	claims, err := signer.Verify(token)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), claims.ExpiresAt)
+}
+
+func TestSignClientLeaseToken(t *testing.T) {
+	signer, err := NewTokenSigner(testSigningKey, 0)
+	assert.Nil(t, err)
+	token, err := signer.SignClientLease("Client-1", 42)
+	assert.Nil(t, err)
+
+	claims, err := signer.Verify(token)
+	assert.Nil(t, err)
+	assert.Equal(t, "Client-1", claims.Subject)
+	assert.Equal(t, RoleClient, claims.Role)
+	assert.Equal(t, int64(42), claims.LeaseGeneration)
+
+	// tokens signed by operator are not bound to a lease
+	token, err = signer.Sign("Client-1", RoleClient)
+	assert.Nil(t, err)
+	claims, err = signer.Verify(token)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), claims.LeaseGeneration)
+}
+
+func TestNewTokenSigner_ShortKey(t *testing.T) {
+	_, err := NewTokenSigner([]byte("short"), 0)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"k8s.io/klog/v2"
+
+	"global-resource-service/resource-management/pkg/clientSdk/util/flowcontrol"
+	"global-resource-service/resource-management/pkg/common-lib/types"
+	"global-resource-service/resource-management/pkg/service-api/auth"
+)
+
+// AdmissionConfig is the request rate limits per client and the concurrent watch limits
+// QPS 0 or max watches 0 means unlimited
+type AdmissionConfig struct {
+	ListQPS       float32
+	ListBurst     int
+	QueryQPS      float32
+	QueryBurst    int
+	RegisterQPS   float32
+	RegisterBurst int
+
+	MaxConcurrentWatches int
+	MaxWatchesPerClient  int
+}
+
+type requestKind string
+
+const (
+	requestList     requestKind = "list"
+	requestQuery    requestKind = "query"
+	requestRegister requestKind = "register"
+	requestWatch    requestKind = "watch"
+)
+
+// limiters of clients without requests for this long are removed
+const idleLimiterTimeout = 10 * time.Minute
+
+type clientLimiter struct {
+	limiter  flowcontrol.RateLimiter
+	lastUsed time.Time
+}
+
+// admissionController rate limits requests with a token bucket per client and request kind,
+// and limits the number of concurrent watches
+type admissionController struct {
+	config AdmissionConfig
+	// used to check whether client ids in path are registered
+	leases ClientLeases
+
+	limiters         map[requestKind]map[string]*clientLimiter
+	lastSweep        time.Time
+	watchNum         int
+	watchNumByClient map[string]int
+	lock             sync.Mutex
+}
+
+func newAdmissionController(config AdmissionConfig, leases ClientLeases) *admissionController {
+	return &admissionController{
+		config: config,
+		leases: leases,
+		limiters: map[requestKind]map[string]*clientLimiter{
+			requestList:     make(map[string]*clientLimiter),
+			requestQuery:    make(map[string]*clientLimiter),
+			requestRegister: make(map[string]*clientLimiter),
+		},
+		lastSweep:        time.Now(),
+		watchNumByClient: make(map[string]int),
+	}
+}
+
+// NewAdmissionMiddleware returns the router middleware that rejects requests exceeding the admission config
+// with 429 and Retry-After. It should run after the authentication middleware so that requests are
+// limited by the authenticated client.
+func NewAdmissionMiddleware(config AdmissionConfig, leases ClientLeases) mux.MiddlewareFunc {
+	ac := newAdmissionController(config, leases)
+	return ac.middleware
+}
+
+func (ac *admissionController) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		kind, isOK := getRequestKind(req)
+		if !isOK {
+			next.ServeHTTP(resp, req)
+			return
+		}
+		clientKey := ac.getClientKey(req)
+
+		if kind == requestWatch {
+			if err := ac.acquireWatch(clientKey); err != nil {
+				klog.V(3).Infof("Reject watch from client %s. error %v", clientKey, err)
+				resp.Header().Set("Retry-After", "1")
+				writeServiceError(resp, err, map[string]string{"client": clientKey})
+				return
+			}
+			defer ac.releaseWatch(clientKey)
+		} else if retryAfter, isOK := ac.allow(kind, clientKey); !isOK {
+			klog.V(3).Infof("Reject %s request from client %s, retry after %d seconds", kind, clientKey, retryAfter)
+			resp.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			writeServiceError(resp, types.Error_RequestRateLimited, map[string]string{"client": clientKey, "request": string(kind)})
+			return
+		}
+
+		next.ServeHTTP(resp, req)
+	})
+}
+
+// allow takes a token of the client, or returns the seconds to retry after
+func (ac *admissionController) allow(kind requestKind, clientKey string) (int, bool) {
+	qps, burst := ac.getLimit(kind)
+	if qps <= 0 {
+		return 0, true
+	}
+
+	ac.lock.Lock()
+	now := time.Now()
+	ac.sweepIdleLimiters(now)
+	cl, isOK := ac.limiters[kind][clientKey]
+	if !isOK {
+		cl = &clientLimiter{limiter: flowcontrol.NewTokenBucketRateLimiter(qps, burst)}
+		ac.limiters[kind][clientKey] = cl
+	}
+	cl.lastUsed = now
+	ac.lock.Unlock()
+
+	if cl.limiter.TryAccept() {
+		return 0, true
+	}
+	// time to get a new token, at least 1 second
+	return int(math.Ceil(1 / float64(qps))), false
+}
+
+func (ac *admissionController) getLimit(kind requestKind) (float32, int) {
+	switch kind {
+	case requestList:
+		return ac.config.ListQPS, ac.config.ListBurst
+	case requestQuery:
+		return ac.config.QueryQPS, ac.config.QueryBurst
+	case requestRegister:
+		return ac.config.RegisterQPS, ac.config.RegisterBurst
+	default:
+		return 0, 0
+	}
+}
+
+// sweepIdleLimiters removes limiters of idle clients, the bucket of an idle client is full anyway
+func (ac *admissionController) sweepIdleLimiters(now time.Time) {
+	if now.Sub(ac.lastSweep) < idleLimiterTimeout {
+		return
+	}
+	for _, limiters := range ac.limiters {
+		for clientKey, cl := range limiters {
+			if now.Sub(cl.lastUsed) > idleLimiterTimeout {
+				delete(limiters, clientKey)
+			}
+		}
+	}
+	ac.lastSweep = now
+}
+
+func (ac *admissionController) acquireWatch(clientKey string) error {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+	if ac.config.MaxConcurrentWatches > 0 && ac.watchNum >= ac.config.MaxConcurrentWatches {
+		return types.Error_TooManyWatches
+	}
+	if ac.config.MaxWatchesPerClient > 0 && ac.watchNumByClient[clientKey] >= ac.config.MaxWatchesPerClient {
+		return types.Error_TooManyWatches
+	}
+	ac.watchNum++
+	ac.watchNumByClient[clientKey]++
+	return nil
+}
+
+func (ac *admissionController) releaseWatch(clientKey string) {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+	ac.watchNum--
+	ac.watchNumByClient[clientKey]--
+	if ac.watchNumByClient[clientKey] <= 0 {
+		delete(ac.watchNumByClient, clientKey)
+	}
+}
+
+// getRequestKind returns the kind of requests subject to admission control
+func getRequestKind(req *http.Request) (requestKind, bool) {
+	route := mux.CurrentRoute(req)
+	if route == nil {
+		return "", false
+	}
+	pathTemplate, err := route.GetPathTemplate()
+	if err != nil {
+		return "", false
+	}
+
+	switch {
+	case pathTemplate == ListWatchResourcePath && req.Method == http.MethodGet:
+		return requestList, true
+	case pathTemplate == ListWatchResourcePath && req.Method == http.MethodPost && req.URL.Query().Get(WatchParameter) == WatchParameterTrue:
+		return requestWatch, true
+	case pathTemplate == NodeStatusPath && req.Method == http.MethodGet:
+		return requestQuery, true
+	case pathTemplate == ClientAdminitrationPath && req.Method == http.MethodPost:
+		return requestRegister, true
+	default:
+		return "", false
+	}
+}
+
+// getClientKey returns the authenticated client id, or the registered client id in path, or the remote host.
+// Client tokens are bound to a client id, so requests with client tokens are limited by that client id.
+// Without authentication or with admin tokens, requests are limited by the client id in path if the client is registered,
+// so that clients behind one host do not share a bucket. Other requests, e.g. registration or requests with made up
+// client ids, are limited by the remote host, so that rotating client ids does not get around the limits.
+func (ac *admissionController) getClientKey(req *http.Request) string {
+	if claims := getClaims(req); claims != nil && claims.Role == auth.RoleClient {
+		return claims.Subject
+	}
+	if clientId := mux.Vars(req)[ClientIdPathVariable]; clientId != "" {
+		if _, err := ac.leases.GetClientLeaseGeneration(clientId); err == nil {
+			return clientId
+		}
+	}
+	return getRemoteHost(req)
+}
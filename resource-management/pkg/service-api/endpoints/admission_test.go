@@ -0,0 +1,152 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"global-resource-service/resource-management/pkg/service-api/auth"
+	apitypes "global-resource-service/resource-management/pkg/service-api/types"
+)
+
+// withClientClaims returns the request authenticated with the token of the client
+func withClientClaims(req *http.Request, clientId string) *http.Request {
+	claims := &auth.Claims{Subject: clientId, Role: auth.RoleClient}
+	return req.WithContext(context.WithValue(req.Context(), claimsContextKey, claims))
+}
+
+func TestAdmissionMiddleware_RateLimit(t *testing.T) {
+	okHandler := func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusOK)
+	}
+	r := mux.NewRouter().StrictSlash(true)
+	r.Use(NewAdmissionMiddleware(AdmissionConfig{ListQPS: 0.5, ListBurst: 2, RegisterQPS: 0.1, RegisterBurst: 1}, fakeClientLeases{"client3": 1, "client4": 1}))
+	r.HandleFunc(ListWatchResourcePath, okHandler)
+	r.HandleFunc(ClientAdminitrationPath, okHandler)
+	r.HandleFunc(NodeStatusPath, okHandler)
+
+	serve := func(method string, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		return recorder
+	}
+	serveClient := func(method string, path string, clientId string) *httptest.ResponseRecorder {
+		req := withClientClaims(httptest.NewRequest(method, path, nil), clientId)
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// burst of list requests of a client are allowed, then rejected
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, serveClient(http.MethodGet, "/resource/client1", "client1").Code)
+	}
+	recorder := serveClient(http.MethodGet, "/resource/client1", "client1")
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "2", recorder.Header().Get("Retry-After"))
+	errResp := decodeErrorResponse(t, recorder)
+	assert.Equal(t, apitypes.ErrCode_TooManyRequests, errResp.Code)
+	assert.True(t, errResp.Retryable)
+
+	// other clients are not affected
+	assert.Equal(t, http.StatusOK, serveClient(http.MethodGet, "/resource/client2", "client2").Code)
+
+	// without authentication, registered clients on the same remote host are limited by the client ids in path separately
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/resource/client3").Code)
+		assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/resource/client4").Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, serve(http.MethodGet, "/resource/client3").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(http.MethodGet, "/resource/client4").Code)
+
+	// client ids not registered are limited by the remote host, rotating them does not get around the limit
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/resource/unknown"+strconv.Itoa(i)).Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, serve(http.MethodGet, "/resource/unknown2").Code)
+
+	// registration limited by remote host
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, ClientAdminitrationPath).Code)
+	recorder = serve(http.MethodPost, ClientAdminitrationPath)
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "10", recorder.Header().Get("Retry-After"))
+
+	// query is not limited
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, http.StatusOK, serve(http.MethodGet, NodeStatusPath).Code)
+	}
+}
+
+func TestAdmissionMiddleware_WatchLimit(t *testing.T) {
+	watchStarted := make(chan struct{}, 10)
+	stopWatches := make(chan struct{})
+	watchHandler := func(resp http.ResponseWriter, req *http.Request) {
+		watchStarted <- struct{}{}
+		<-stopWatches
+		resp.WriteHeader(http.StatusOK)
+	}
+	r := mux.NewRouter().StrictSlash(true)
+	r.Use(NewAdmissionMiddleware(AdmissionConfig{MaxConcurrentWatches: 3, MaxWatchesPerClient: 2}, fakeClientLeases{}))
+	r.HandleFunc(ListWatchResourcePath, watchHandler)
+
+	watch := func(clientId string) *httptest.ResponseRecorder {
+		req := withClientClaims(httptest.NewRequest(http.MethodPost, "/resource/"+clientId+"?watch=true", nil), clientId)
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	var wg sync.WaitGroup
+	for _, clientId := range []string{"client1", "client1", "client2"} {
+		wg.Add(1)
+		go func(clientId string) {
+			defer wg.Done()
+			assert.Equal(t, http.StatusOK, watch(clientId).Code)
+		}(clientId)
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-watchStarted:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for watches to start")
+		}
+	}
+
+	// per client limit
+	recorder := watch("client1")
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, apitypes.ErrCode_TooManyWatches, decodeErrorResponse(t, recorder).Code)
+	// total limit
+	recorder = watch("client3")
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "1", recorder.Header().Get("Retry-After"))
+
+	// watches are released when ended
+	close(stopWatches)
+	wg.Wait()
+	assert.Equal(t, http.StatusOK, watch("client3").Code)
+}
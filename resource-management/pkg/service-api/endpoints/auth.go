@@ -0,0 +1,153 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"k8s.io/klog/v2"
+
+	"global-resource-service/resource-management/pkg/common-lib/types"
+	"global-resource-service/resource-management/pkg/service-api/auth"
+)
+
+type authRequirement int
+
+const (
+	// authNone is for paths not listed in authRequirementByPath, e.g. debug paths
+	authNone authRequirement = iota
+	// authAnyClient requires a valid token of any client
+	authAnyClient
+	// authClientOwner requires the token of the client in the path
+	authClientOwner
+	// authAdmin requires an admin token
+	authAdmin
+)
+
+// ClientIdPathVariable is the path variable of the client id in resource and client lease paths
+const ClientIdPathVariable = "clientid"
+
+type contextKey int
+
+// claimsContextKey is the request context key of the verified token claims
+const claimsContextKey contextKey = iota
+
+// admin tokens are accepted for all paths
+var authRequirementByPath = map[string]authRequirement{
+	ClientAdminitrationPath:                 authAdmin,
+	ClientAdminitrationPath + "/{clientId}": authAdmin,
+	ClientLeasePath:                         authClientOwner,
+	ListWatchResourcePath:                   authClientOwner,
+	UpdateResourcePath:                      authClientOwner,
+	ReduceResourcePath:                      authClientOwner,
+	NodeStatusPath:                          authAnyClient,
+	CapacityPath:                            authAnyClient,
+	RegionManagerAdministrationPath:         authAdmin,
+}
+
+// ClientLeases gets lease generations of registered clients, to reject tokens issued for expired leases
+type ClientLeases interface {
+	GetClientLeaseGeneration(clientId string) (int64, error)
+}
+
+// NewAuthMiddleware returns the router middleware that validates the bearer token of requests
+// against the requirement of the matched route path
+// Tokens bound to a client lease are valid only for the current lease generation of the client
+func NewAuthMiddleware(signer *auth.TokenSigner, leases ClientLeases) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			requirement := authNone
+			if route := mux.CurrentRoute(req); route != nil {
+				if pathTemplate, err := route.GetPathTemplate(); err == nil {
+					requirement = authRequirementByPath[pathTemplate]
+				}
+			}
+			if requirement == authNone {
+				next.ServeHTTP(resp, req)
+				return
+			}
+
+			claims, err := signer.Verify(getBearerToken(req))
+			if err == nil {
+				err = checkLeaseGeneration(claims, leases)
+			}
+			if err != nil {
+				klog.V(3).Infof("Reject request %s %s. error %v", req.Method, req.URL.Path, err)
+				resp.Header().Set("WWW-Authenticate", "Bearer")
+				writeServiceError(resp, err, nil)
+				return
+			}
+
+			if !isAuthorized(claims, requirement, mux.Vars(req)[ClientIdPathVariable]) {
+				klog.V(3).Infof("Reject request %s %s from %s with role %s", req.Method, req.URL.Path, claims.Subject, claims.Role)
+				writeServiceError(resp, types.Error_PermissionDenied, nil)
+				return
+			}
+
+			next.ServeHTTP(resp, req.WithContext(context.WithValue(req.Context(), claimsContextKey, claims)))
+		})
+	}
+}
+
+// checkLeaseGeneration returns Error_TokenExpired if the token is issued for a lease the client no longer holds
+func checkLeaseGeneration(claims *auth.Claims, leases ClientLeases) error {
+	if claims.LeaseGeneration == 0 {
+		return nil
+	}
+	generation, err := leases.GetClientLeaseGeneration(claims.Subject)
+	if err != nil || generation != claims.LeaseGeneration {
+		return types.Error_TokenExpired
+	}
+	return nil
+}
+
+func isAuthorized(claims *auth.Claims, requirement authRequirement, clientId string) bool {
+	if claims.Role == auth.RoleAdmin {
+		return true
+	}
+	if claims.Role != auth.RoleClient {
+		return false
+	}
+
+	switch requirement {
+	case authAnyClient:
+		return true
+	case authClientOwner:
+		return claims.Subject == clientId
+	default:
+		return false
+	}
+}
+
+// getClaims returns the verified token claims of the request, nil if the request is not authenticated
+func getClaims(req *http.Request) *auth.Claims {
+	claims, _ := req.Context().Value(claimsContextKey).(*auth.Claims)
+	return claims
+}
+
+// getBearerToken returns the token of the "Authorization: Bearer <token>" header
+func getBearerToken(req *http.Request) string {
+	const prefix = "Bearer "
+	header := req.Header.Get("Authorization")
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(header[len(prefix):])
+}
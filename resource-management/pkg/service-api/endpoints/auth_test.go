@@ -0,0 +1,170 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"global-resource-service/resource-management/pkg/common-lib/types"
+	"global-resource-service/resource-management/pkg/service-api/auth"
+	apitypes "global-resource-service/resource-management/pkg/service-api/types"
+)
+
+func newTestTokenSigner(t *testing.T) *auth.TokenSigner {
+	signer, err := auth.NewTokenSigner([]byte("0123456789abcdef0123456789abcdef"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func signTestToken(t *testing.T, signer *auth.TokenSigner, subject string, role string) string {
+	token, err := signer.Sign(subject, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+type fakeClientLeases map[string]int64
+
+func (l fakeClientLeases) GetClientLeaseGeneration(clientId string) (int64, error) {
+	generation, isOK := l[clientId]
+	if !isOK {
+		return 0, types.Error_ClientNotRegistered
+	}
+	return generation, nil
+}
+
+func signTestLeaseToken(t *testing.T, signer *auth.TokenSigner, clientId string, leaseGeneration int64) string {
+	token, err := signer.SignClientLease(clientId, leaseGeneration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	signer := newTestTokenSigner(t)
+
+	okHandler := func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusOK)
+	}
+	clientId := "Client-" + uuid.New().String()
+	// client registered again after its lease of generation 1 expired
+	leases := fakeClientLeases{clientId: 2}
+	r := mux.NewRouter().StrictSlash(true)
+	r.Use(NewAuthMiddleware(signer, leases))
+	r.HandleFunc(ClientAdminitrationPath, okHandler)
+	r.HandleFunc(ListWatchResourcePath, okHandler)
+	r.HandleFunc(ClientLeasePath, okHandler)
+	r.HandleFunc(NodeStatusPath, okHandler)
+	r.HandleFunc(RegionManagerAdministrationPath, okHandler)
+	r.HandleFunc("/debug/pprof/", okHandler)
+
+	clientToken := signTestToken(t, signer, clientId, auth.RoleClient)
+	leaseToken := signTestLeaseToken(t, signer, clientId, 2)
+	expiredLeaseToken := signTestLeaseToken(t, signer, clientId, 1)
+	unregisteredLeaseToken := signTestLeaseToken(t, signer, "Client-"+uuid.New().String(), 1)
+	otherClientToken := signTestToken(t, signer, "Client-"+uuid.New().String(), auth.RoleClient)
+	adminToken := signTestToken(t, signer, "admin", auth.RoleAdmin)
+	otherSigner, err := auth.NewTokenSigner([]byte("abcdef0123456789abcdef0123456789"), 0)
+	assert.Nil(t, err)
+	forgedAdminToken := signTestToken(t, otherSigner, "admin", auth.RoleAdmin)
+
+	testCases := []struct {
+		name         string
+		method       string
+		path         string
+		token        string
+		expectedCode int
+		expectedErr  string
+	}{
+		{"register without token", http.MethodPost, ClientAdminitrationPath, "", http.StatusUnauthorized, apitypes.ErrCode_Unauthorized},
+		{"register with client token", http.MethodPost, ClientAdminitrationPath, clientToken, http.StatusForbidden, apitypes.ErrCode_Forbidden},
+		{"register with forged admin token", http.MethodPost, ClientAdminitrationPath, forgedAdminToken, http.StatusUnauthorized, apitypes.ErrCode_Unauthorized},
+		{"register with admin token", http.MethodPost, ClientAdminitrationPath, adminToken, http.StatusOK, ""},
+		{"list without token", http.MethodGet, "/resource/" + clientId, "", http.StatusUnauthorized, apitypes.ErrCode_Unauthorized},
+		{"list with own token", http.MethodGet, "/resource/" + clientId, clientToken, http.StatusOK, ""},
+		{"list with other client token", http.MethodGet, "/resource/" + clientId, otherClientToken, http.StatusForbidden, apitypes.ErrCode_Forbidden},
+		{"list with admin token", http.MethodGet, "/resource/" + clientId, adminToken, http.StatusOK, ""},
+		{"list with token of current lease", http.MethodGet, "/resource/" + clientId, leaseToken, http.StatusOK, ""},
+		{"list with token of expired lease", http.MethodGet, "/resource/" + clientId, expiredLeaseToken, http.StatusUnauthorized, apitypes.ErrCode_TokenExpired},
+		{"query node with token of unregistered client", http.MethodGet, NodeStatusPath, unregisteredLeaseToken, http.StatusUnauthorized, apitypes.ErrCode_TokenExpired},
+		{"renew lease with own token", http.MethodPut, "/clients/" + clientId + "/lease", clientToken, http.StatusOK, ""},
+		{"renew lease with other client token", http.MethodPut, "/clients/" + clientId + "/lease", otherClientToken, http.StatusForbidden, apitypes.ErrCode_Forbidden},
+		{"query node with client token", http.MethodGet, NodeStatusPath, otherClientToken, http.StatusOK, ""},
+		{"query node without token", http.MethodGet, NodeStatusPath, "", http.StatusUnauthorized, apitypes.ErrCode_Unauthorized},
+		{"add region manager with client token", http.MethodPost, RegionManagerAdministrationPath, clientToken, http.StatusForbidden, apitypes.ErrCode_Forbidden},
+		{"add region manager with admin token", http.MethodPost, RegionManagerAdministrationPath, adminToken, http.StatusOK, ""},
+		{"path without auth requirement", http.MethodGet, "/debug/pprof/", "", http.StatusOK, ""},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.expectedCode, recorder.Code)
+			if tt.expectedErr != "" {
+				errResp := decodeErrorResponse(t, recorder)
+				assert.Equal(t, tt.expectedErr, errResp.Code)
+			}
+		})
+	}
+}
+
+func TestHttpRegisterClient_IssueToken(t *testing.T) {
+	distributor := setUp()
+	defer tearDown(distributor)
+
+	signer := newTestTokenSigner(t)
+	installer := NewInstaller(distributor)
+	installer.SetTokenSigner(signer)
+
+	distributor.ProcessEvents(generateAddNodeEvent(5000))
+
+	recorder := registerClientWithKey(t, installer, "", types.MinTotalMachinesPerRequest)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expecting registration succeeded, got status %d", recorder.Code)
+	}
+	resp := apitypes.ClientRegistrationResponse{}
+	err := json.NewDecoder(recorder.Body).Decode(&resp)
+	assert.Nil(t, err)
+
+	claims, err := signer.Verify(resp.Token)
+	assert.Nil(t, err)
+	assert.Equal(t, resp.ClientId, claims.Subject)
+	assert.Equal(t, auth.RoleClient, claims.Role)
+	leaseGeneration, err := distributor.GetClientLeaseGeneration(resp.ClientId)
+	assert.Nil(t, err)
+	assert.Equal(t, leaseGeneration, claims.LeaseGeneration)
+}
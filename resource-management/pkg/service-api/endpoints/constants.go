@@ -19,6 +19,7 @@ package endpoints
 // URL path
 const (
 	ClientAdminitrationPath = "/clients"
+	ClientLeasePath         = ClientAdminitrationPath + "/{clientid}" + "/lease"
 
 	//RegionlessResourcePath is the default api service url
 	RegionlessResourcePath = "/resource"
@@ -26,6 +27,17 @@ const (
 	// TODO revisit and evaluate API paths.
 	NodeStatusPath = "/nodes"
 
+	CapacityPath = "/capacity"
+
+	RegionManagerAdministrationPath = "/regionmanagers"
+
+	HealthzPath = "/healthz"
+	ReadyzPath  = "/readyz"
+	LivezPath   = "/livez"
+
+	MetricsPath       = "/metrics"
+	LatencyReportPath = MetricsPath + "/latency"
+
 	ListWatchResourcePath = RegionlessResourcePath + "/{clientid}"
 	UpdateResourcePath    = RegionlessResourcePath + "/{clientid}" + "/addResource"
 	ReduceResourcePath    = RegionlessResourcePath + "/{clientid}" + "/reduceResource"
@@ -41,4 +53,10 @@ const (
 	WatchParameterTrue       = "true"
 	ListLimitParameter       = "limit"
 	DefaultResponseTrunkSize = 500
+
+	// ListContinueParameter is the token to list the next page from a region manager, returned with the previous page
+	ListContinueParameter = "continue"
+
+	// ResourcePartitionParameter filters the list and watch of a region manager to the resource partition, e.g. RP1
+	ResourcePartitionParameter = "partition"
 )
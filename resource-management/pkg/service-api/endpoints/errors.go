@@ -0,0 +1,108 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"k8s.io/klog/v2"
+
+	"global-resource-service/resource-management/pkg/common-lib/types"
+	apiTypes "global-resource-service/resource-management/pkg/service-api/types"
+)
+
+// apiError is the http status code and error code an error from the distributor, authentication or admission is reported with
+type apiError struct {
+	statusCode int
+	code       string
+	retryable  bool
+}
+
+var serviceErrors = map[error]apiError{
+	types.Error_HostRequestExceedLimit:     {http.StatusUnprocessableEntity, apiTypes.ErrCode_HostRequestExceedLimit, false},
+	types.Error_HostRequestLessThanMiniaml: {http.StatusUnprocessableEntity, apiTypes.ErrCode_HostRequestLessThanMinimal, false},
+	// hosts could be freed up by other clients
+	types.Error_HostRequestExceedCapacity: {http.StatusConflict, apiTypes.ErrCode_HostRequestExceedCapacity, true},
+
+	types.Error_ClientIdExisted:            {http.StatusConflict, apiTypes.ErrCode_ClientIdExisted, false},
+	types.Error_ClientNotRegistered:        {http.StatusNotFound, apiTypes.ErrCode_ClientNotRegistered, false},
+	types.Error_ClientRegistrationConflict: {http.StatusConflict, apiTypes.ErrCode_ClientRegistrationConflict, false},
+
+	types.Error_ObjectNotFound: {http.StatusNotFound, apiTypes.ErrCode_NotFound, false},
+
+	types.Error_InvalidToken:     {http.StatusUnauthorized, apiTypes.ErrCode_Unauthorized, false},
+	types.Error_TokenExpired:     {http.StatusUnauthorized, apiTypes.ErrCode_TokenExpired, false},
+	types.Error_PermissionDenied: {http.StatusForbidden, apiTypes.ErrCode_Forbidden, false},
+
+	types.Error_RequestRateLimited: {http.StatusTooManyRequests, apiTypes.ErrCode_TooManyRequests, true},
+	types.Error_TooManyWatches:     {http.StatusTooManyRequests, apiTypes.ErrCode_TooManyWatches, true},
+
+	// client needs to list again to get the resource versions to watch from
+	types.Error_ResourceVersionExpired: {http.StatusGone, apiTypes.ErrCode_ResourceVersionExpired, false},
+
+	types.Error_RegionManagerExisted:    {http.StatusConflict, apiTypes.ErrCode_RegionManagerExisted, false},
+	types.Error_RegionManagerNotFound:   {http.StatusNotFound, apiTypes.ErrCode_RegionManagerNotFound, false},
+	types.Error_InvalidRegionManagerUrl: {http.StatusBadRequest, apiTypes.ErrCode_BadRequest, false},
+	types.Error_InvalidRegionNodeAction: {http.StatusBadRequest, apiTypes.ErrCode_BadRequest, false},
+}
+
+// writeError writes the http status code and the error response body
+// It must be called before anything is written to the response
+func writeError(resp http.ResponseWriter, statusCode int, code string, message string, retryable bool, details map[string]string) {
+	errResp := apiTypes.ErrorResponse{Code: code, Message: message, Retryable: retryable, Details: details}
+	b, err := json.Marshal(errResp)
+	if err != nil {
+		klog.Errorf("error marshal error response. error %v", err)
+		resp.WriteHeader(statusCode)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(statusCode)
+	if _, err = resp.Write(b); err != nil {
+		klog.V(3).Infof("error write error response. error %v", err)
+	}
+}
+
+// writeServiceError writes the error returned from the distributor, authentication or admission
+// Errors not known to the service API are reported as retryable internal errors
+func writeServiceError(resp http.ResponseWriter, err error, details map[string]string) {
+	if apiErr, isOK := serviceErrors[err]; isOK {
+		writeError(resp, apiErr.statusCode, apiErr.code, err.Error(), apiErr.retryable, details)
+		return
+	}
+	// errors with detail wrap the known error
+	if apiErr, isOK := serviceErrors[errors.Unwrap(err)]; isOK {
+		writeError(resp, apiErr.statusCode, apiErr.code, err.Error(), apiErr.retryable, details)
+		return
+	}
+	writeInternalError(resp, err.Error())
+}
+
+func writeBadRequest(resp http.ResponseWriter, message string) {
+	writeError(resp, http.StatusBadRequest, apiTypes.ErrCode_BadRequest, message, false, nil)
+}
+
+func writeInternalError(resp http.ResponseWriter, message string) {
+	writeError(resp, http.StatusInternalServerError, apiTypes.ErrCode_InternalError, message, true, nil)
+}
+
+func writeMethodNotAllowed(resp http.ResponseWriter, req *http.Request) {
+	writeError(resp, http.StatusMethodNotAllowed, apiTypes.ErrCode_MethodNotAllowed, "Method "+req.Method+" not allowed", false, nil)
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"k8s.io/klog/v2"
+
+	apiTypes "global-resource-service/resource-management/pkg/service-api/types"
+)
+
+const (
+	healthStatusOk     = "ok"
+	healthStatusFailed = "failed"
+)
+
+// HealthCheckFunc returns nil if the check passed, or the reason it failed
+type HealthCheckFunc func() error
+
+type healthCheck struct {
+	name  string
+	check HealthCheckFunc
+}
+
+// HealthHandler serves /livez with liveness checks, /readyz with readiness checks and /healthz with both and health checks
+type HealthHandler struct {
+	livenessChecks  []healthCheck
+	readinessChecks []healthCheck
+	healthChecks    []healthCheck
+	lock            sync.RWMutex
+}
+
+func NewHealthHandler() *HealthHandler {
+	return &HealthHandler{}
+}
+
+// AddLivenessCheck adds a check that fails if the service needs restart
+func (h *HealthHandler) AddLivenessCheck(name string, check HealthCheckFunc) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.livenessChecks = append(h.livenessChecks, healthCheck{name: name, check: check})
+}
+
+// AddReadinessCheck adds a check that fails if the service should not receive traffic
+func (h *HealthHandler) AddReadinessCheck(name string, check HealthCheckFunc) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.readinessChecks = append(h.readinessChecks, healthCheck{name: name, check: check})
+}
+
+// AddHealthCheck adds a check that is reported by /healthz only, for failures that neither restart would fix
+// nor should take the service out of traffic, for example a broken region manager
+func (h *HealthHandler) AddHealthCheck(name string, check HealthCheckFunc) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.healthChecks = append(h.healthChecks, healthCheck{name: name, check: check})
+}
+
+func (h *HealthHandler) LivezHandler(resp http.ResponseWriter, req *http.Request) {
+	h.lock.RLock()
+	checks := h.livenessChecks
+	h.lock.RUnlock()
+	h.serveChecks(resp, req, checks)
+}
+
+func (h *HealthHandler) ReadyzHandler(resp http.ResponseWriter, req *http.Request) {
+	h.lock.RLock()
+	checks := h.readinessChecks
+	h.lock.RUnlock()
+	h.serveChecks(resp, req, checks)
+}
+
+func (h *HealthHandler) HealthzHandler(resp http.ResponseWriter, req *http.Request) {
+	h.lock.RLock()
+	checks := make([]healthCheck, 0, len(h.livenessChecks)+len(h.readinessChecks)+len(h.healthChecks))
+	checks = append(checks, h.livenessChecks...)
+	checks = append(checks, h.readinessChecks...)
+	checks = append(checks, h.healthChecks...)
+	h.lock.RUnlock()
+	h.serveChecks(resp, req, checks)
+}
+
+// serveChecks runs the checks and responds 200 if all checks passed, otherwise 503, with result of each check
+func (h *HealthHandler) serveChecks(resp http.ResponseWriter, req *http.Request, checks []healthCheck) {
+	if req.Method != http.MethodGet {
+		writeMethodNotAllowed(resp, req)
+		return
+	}
+
+	ret := apiTypes.HealthResponse{Status: healthStatusOk, Checks: make([]apiTypes.HealthCheckResult, len(checks))}
+	for i, c := range checks {
+		ret.Checks[i] = apiTypes.HealthCheckResult{Name: c.name, Healthy: true}
+		if err := c.check(); err != nil {
+			klog.V(3).Infof("Health check %s failed for %s. error %v", c.name, req.URL.Path, err)
+			ret.Checks[i].Healthy = false
+			ret.Checks[i].Message = err.Error()
+			ret.Status = healthStatusFailed
+		}
+	}
+
+	b, err := json.Marshal(ret)
+	if err != nil {
+		klog.V(3).Infof("error marshal health response. error %v", err)
+		writeInternalError(resp, "Failed to marshal health response")
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	if ret.Status != healthStatusOk {
+		resp.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if _, err = resp.Write(b); err != nil {
+		klog.V(3).Infof("error write response. error %v", err)
+	}
+}
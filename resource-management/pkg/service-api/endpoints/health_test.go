@@ -0,0 +1,88 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	apitypes "global-resource-service/resource-management/pkg/service-api/types"
+)
+
+func getHealth(t *testing.T, handler http.HandlerFunc, path string) (int, apitypes.HealthResponse) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	recorder := httptest.NewRecorder()
+	handler(recorder, req)
+
+	ret := apitypes.HealthResponse{}
+	err := json.NewDecoder(recorder.Body).Decode(&ret)
+	assert.Nil(t, err)
+	return recorder.Code, ret
+}
+
+func TestHealthHandler(t *testing.T) {
+	h := NewHealthHandler()
+	var storeErr error
+	h.AddLivenessCheck("ping", func() error { return nil })
+	h.AddReadinessCheck("store", func() error { return storeErr })
+
+	code, ret := getHealth(t, h.ReadyzHandler, ReadyzPath)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, healthStatusOk, ret.Status)
+	assert.Equal(t, []apitypes.HealthCheckResult{{Name: "store", Healthy: true}}, ret.Checks)
+
+	// readiness check failure does not fail liveness
+	storeErr = errors.New("connection refused")
+	code, ret = getHealth(t, h.ReadyzHandler, ReadyzPath)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, healthStatusFailed, ret.Status)
+	assert.Equal(t, []apitypes.HealthCheckResult{{Name: "store", Healthy: false, Message: "connection refused"}}, ret.Checks)
+
+	code, ret = getHealth(t, h.LivezHandler, LivezPath)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, len(ret.Checks))
+
+	// healthz lists all checks
+	code, ret = getHealth(t, h.HealthzHandler, HealthzPath)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, 2, len(ret.Checks))
+	assert.True(t, ret.Checks[0].Healthy)
+	assert.False(t, ret.Checks[1].Healthy)
+}
+
+func TestHealthHandler_HealthCheck(t *testing.T) {
+	h := NewHealthHandler()
+	h.AddLivenessCheck("ping", func() error { return nil })
+	h.AddReadinessCheck("store", func() error { return nil })
+	h.AddHealthCheck("region-managers", func() error { return errors.New("region manager failed") })
+
+	// health check failure is reported by healthz only
+	code, _ := getHealth(t, h.LivezHandler, LivezPath)
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = getHealth(t, h.ReadyzHandler, ReadyzPath)
+	assert.Equal(t, http.StatusOK, code)
+
+	code, ret := getHealth(t, h.HealthzHandler, HealthzPath)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, 3, len(ret.Checks))
+	assert.Equal(t, apitypes.HealthCheckResult{Name: "region-managers", Healthy: false, Message: "region manager failed"}, ret.Checks[2])
+}
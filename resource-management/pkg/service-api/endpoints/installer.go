@@ -20,9 +20,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"k8s.io/klog/v2"
@@ -33,15 +35,22 @@ import (
 	"global-resource-service/resource-management/pkg/common-lib/types"
 	"global-resource-service/resource-management/pkg/common-lib/types/location"
 	"global-resource-service/resource-management/pkg/common-lib/types/runtime"
+	"global-resource-service/resource-management/pkg/service-api/auth"
 	apiTypes "global-resource-service/resource-management/pkg/service-api/types"
 )
 
 type Installer struct {
-	dist di.Interface
+	dist        di.Interface
+	tokenSigner *auth.TokenSigner
 }
 
 func NewInstaller(d di.Interface) *Installer {
-	return &Installer{d}
+	return &Installer{dist: d}
+}
+
+// SetTokenSigner enables issuing client tokens on registration
+func (i *Installer) SetTokenSigner(signer *auth.TokenSigner) {
+	i.tokenSigner = signer
 }
 
 func (i *Installer) ClientAdministrationHandler(resp http.ResponseWriter, req *http.Request) {
@@ -55,19 +64,18 @@ func (i *Installer) ClientAdministrationHandler(resp http.ResponseWriter, req *h
 		i.handleClientUnRegistration(resp, req)
 		return
 	default:
-		resp.WriteHeader(http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(resp, req)
 		return
 	}
 
 }
 
-// TODO: error handling function
 func (i *Installer) handleClientRegistration(resp http.ResponseWriter, req *http.Request) {
 	klog.Infof("handle client registration")
 	body, err := ioutil.ReadAll(req.Body)
 	if err != nil {
 		klog.V(3).Infof("error read request. error %v", err)
-		resp.WriteHeader(http.StatusBadRequest)
+		writeBadRequest(resp, "Failed to read request body")
 		return
 	}
 
@@ -76,52 +84,99 @@ func (i *Installer) handleClientRegistration(resp http.ResponseWriter, req *http
 	err = json.Unmarshal(body, &clientReq)
 	if err != nil {
 		klog.V(3).Infof("error unmarshal request body. error %v", err)
-		resp.WriteHeader(http.StatusInternalServerError)
+		writeBadRequest(resp, "Invalid client registration request")
 		return
 	}
 
 	requestedMachines := clientReq.InitialRequestedResource.TotalMachines
-	if requestedMachines > types.MaxTotalMachinesPerRequest || requestedMachines < types.MinTotalMachinesPerRequest {
+	if requestedMachines > types.MaxTotalMachinesPerRequest {
+		klog.V(3).Infof("Invalid request of resources. requested total machines: %v", requestedMachines)
+		writeServiceError(resp, types.Error_HostRequestExceedLimit, map[string]string{"max_total_machines": strconv.Itoa(types.MaxTotalMachinesPerRequest)})
+		return
+	} else if requestedMachines < types.MinTotalMachinesPerRequest {
 		klog.V(3).Infof("Invalid request of resources. requested total machines: %v", requestedMachines)
-		resp.WriteHeader(http.StatusBadRequest)
+		writeServiceError(resp, types.Error_HostRequestLessThanMiniaml, map[string]string{"min_total_machines": strconv.Itoa(types.MinTotalMachinesPerRequest)})
 		return
 	}
 
-	// TODO: need to design to avoid client to register itself
-	c_id := fmt.Sprintf("%s-%s", store.Preserve_Client_KeyPrefix, uuid.New().String())
-	client := types.Client{ClientId: c_id, Resource: clientReq.InitialRequestedResource, ClientInfo: clientReq.ClientInfo}
+	client := types.Client{ClientId: getClientIdForRegistration(getRegistrationCaller(req), clientReq.IdempotencyKey), Resource: clientReq.InitialRequestedResource, ClientInfo: clientReq.ClientInfo}
 
 	err = i.dist.RegisterClient(&client)
-
 	if err != nil {
 		klog.V(3).Infof("error register client. error %v", err)
-		resp.WriteHeader(http.StatusInternalServerError)
+		writeServiceError(resp, err, nil)
 		return
 	}
 
 	// for 630, request of initial resource request with client registration is either denied or granted in full
-	ret := apiTypes.ClientRegistrationResponse{ClientId: client.ClientId, GrantedResource: client.Resource}
+	ret := apiTypes.ClientRegistrationResponse{ClientId: client.ClientId, GrantedResource: client.Resource,
+		LeaseDurationSeconds: int64(i.dist.GetClientLeaseDuration().Seconds())}
+	if i.tokenSigner != nil {
+		var leaseGeneration int64
+		leaseGeneration, err = i.dist.GetClientLeaseGeneration(client.ClientId)
+		if err == nil {
+			ret.Token, err = i.tokenSigner.SignClientLease(client.ClientId, leaseGeneration)
+		}
+		if err != nil {
+			klog.Errorf("error sign token for client %s. error %v", client.ClientId, err)
+			writeInternalError(resp, "Failed to issue client token")
+			return
+		}
+	}
 
 	b, err := json.Marshal(ret)
 	if err != nil {
 		klog.V(3).Infof("error marshal client response. error %v", err)
-		resp.WriteHeader(http.StatusInternalServerError)
+		writeInternalError(resp, "Failed to marshal client registration response")
 		return
 	}
 
+	resp.Header().Set("Content-Type", "application/json")
 	_, err = resp.Write(b)
 	if err != nil {
 		klog.V(3).Infof("error write response. error %v", err)
-		resp.WriteHeader(http.StatusInternalServerError)
-		return
 	}
 
 	return
 }
 
+// ClientLeaseHandler renews the lease of a registered client, path /clients/{clientid}/lease
+func (i *Installer) ClientLeaseHandler(resp http.ResponseWriter, req *http.Request) {
+	klog.V(3).Infof("handle client lease. URL path: %s", req.URL.Path)
+
+	switch req.Method {
+	case http.MethodPut:
+		clientId := getClientId(req)
+		err := i.dist.RenewClientLease(clientId)
+		if err != nil {
+			klog.V(3).Infof("error renew lease of client %s. error %v", clientId, err)
+			writeServiceError(resp, err, map[string]string{"client_id": clientId})
+			return
+		}
+
+		ret := apiTypes.ClientLeaseResponse{ClientId: clientId, LeaseDurationSeconds: int64(i.dist.GetClientLeaseDuration().Seconds())}
+		b, err := json.Marshal(ret)
+		if err != nil {
+			klog.V(3).Infof("error marshal client lease response. error %v", err)
+			writeInternalError(resp, "Failed to marshal client lease response")
+			return
+		}
+
+		resp.Header().Set("Content-Type", "application/json")
+		_, err = resp.Write(b)
+		if err != nil {
+			klog.V(3).Infof("error write response. error %v", err)
+		}
+		return
+	default:
+		writeMethodNotAllowed(resp, req)
+		return
+	}
+}
+
 func (i *Installer) handleClientUnRegistration(resp http.ResponseWriter, req *http.Request) {
 	klog.V(3).Infof("not implemented")
-	resp.WriteHeader(http.StatusNotImplemented)
+	writeError(resp, http.StatusNotImplemented, apiTypes.ErrCode_NotImplemented, "Client unregistration is not implemented", false, nil)
 	return
 }
 
@@ -131,41 +186,63 @@ func (i *Installer) NodeHandler(resp http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
 		regionName, rpName, nodeId := getNodeId(req)
-		resp.WriteHeader(http.StatusOK)
-		resp.Header().Set("Content-Type", "text/plain")
 
 		region := location.GetRegionFromRegionName(regionName)
 		resourceParition, err := location.GetPartitionFromPartitionName(rpName)
 		if err != nil {
-			resp.WriteHeader(http.StatusBadRequest)
+			writeBadRequest(resp, fmt.Sprintf("Invalid resource partition %s", rpName))
 			return
 		}
 		node, err := i.dist.GetNodeStatus(region, resourceParition, nodeId)
-		if err == types.Error_ObjectNotFound {
-			resp.WriteHeader(http.StatusNotFound)
-		} else if err != nil {
-			klog.Errorf("Error getting node status: region %v, rp %v, nodeId %s, error [%v]", regionName, rpName, nodeId, err)
-			resp.WriteHeader(http.StatusInternalServerError)
-		} else {
-			ret := apiTypes.NodeResponse{Node: *node}
-			b, err := json.Marshal(ret)
-			if err != nil {
-				klog.V(3).Infof("error marshal client response. error %v", err)
-				resp.WriteHeader(http.StatusInternalServerError)
-				return
+		if err != nil {
+			if err != types.Error_ObjectNotFound {
+				klog.Errorf("Error getting node status: region %v, rp %v, nodeId %s, error [%v]", regionName, rpName, nodeId, err)
 			}
+			writeServiceError(resp, err, map[string]string{"node_id": nodeId, "region": regionName, "resource_partition": rpName})
+			return
+		}
 
-			_, err = resp.Write(b)
-			if err != nil {
-				klog.V(3).Infof("error write response. error %v", err)
-				resp.WriteHeader(http.StatusInternalServerError)
-				return
-			}
+		ret := apiTypes.NodeResponse{Node: *node}
+		b, err := json.Marshal(ret)
+		if err != nil {
+			klog.V(3).Infof("error marshal client response. error %v", err)
+			writeInternalError(resp, "Failed to marshal node response")
+			return
+		}
 
+		resp.Header().Set("Content-Type", "application/json")
+		_, err = resp.Write(b)
+		if err != nil {
+			klog.V(3).Infof("error write response. error %v", err)
+		}
+		return
+	default:
+		writeMethodNotAllowed(resp, req)
+		return
+	}
+}
+
+func (i *Installer) CapacityHandler(resp http.ResponseWriter, req *http.Request) {
+	klog.V(3).Infof("handle capacity query: /capacity. URL path: %s", req.URL.Path)
+
+	switch req.Method {
+	case http.MethodGet:
+		ret := apiTypes.CapacityResponse{Capacity: *i.dist.GetCapacity()}
+		b, err := json.Marshal(ret)
+		if err != nil {
+			klog.V(3).Infof("error marshal capacity response. error %v", err)
+			writeInternalError(resp, "Failed to marshal capacity response")
 			return
 		}
+
+		resp.Header().Set("Content-Type", "application/json")
+		_, err = resp.Write(b)
+		if err != nil {
+			klog.V(3).Infof("error write response. error %v", err)
+		}
+		return
 	default:
-		resp.WriteHeader(http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(resp, req)
 		return
 	}
 }
@@ -178,26 +255,25 @@ func (i *Installer) ResourceHandler(resp http.ResponseWriter, req *http.Request)
 		clientId := getClientId(req)
 		klog.Infof("Handle resource for client: %v", clientId)
 
-		resp.WriteHeader(http.StatusOK)
-		resp.Header().Set("Content-Type", "text/plain")
-
-		nodes, crv, err := i.dist.ListNodesForClient(clientId)
-		if err != nil {
-			klog.V(3).Infof("error to get node list from distributor. error %v", err)
-			resp.WriteHeader(http.StatusInternalServerError)
-			return
-		}
 		limit := req.URL.Query().Get(ListLimitParameter)
 		var chunkSize int
+		var err error
 		if len(limit) > 0 {
 			chunkSize, err = strconv.Atoi(limit)
 			if err != nil {
 				klog.Errorf("invalid limit value")
-				resp.WriteHeader(http.StatusBadRequest)
+				writeBadRequest(resp, fmt.Sprintf("Invalid limit value %s", limit))
 				return
 			}
 		}
 
+		nodes, crv, err := i.dist.ListNodesForClient(clientId)
+		if err != nil {
+			klog.V(3).Infof("error to get node list from distributor. error %v", err)
+			writeServiceError(resp, err, map[string]string{"client_id": clientId})
+			return
+		}
+
 		i.handleResponseTrunked(resp, nodes, crv, chunkSize)
 		return
 	// hack: currently crv is used for watch watermark, this is up to 200 RPs which cannot fit as parameters or headers
@@ -214,10 +290,10 @@ func (i *Installer) ResourceHandler(resp http.ResponseWriter, req *http.Request)
 		}
 		return
 	case http.MethodPut:
-		resp.WriteHeader(http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(resp, req)
 		return
 	default:
-		resp.WriteHeader(http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(resp, req)
 		return
 	}
 
@@ -226,7 +302,6 @@ func (i *Installer) ResourceHandler(resp http.ResponseWriter, req *http.Request)
 // simple watch routine
 // TODO: add timeout support
 // TODO: with serialization options
-// TODO: error code and string definition
 //
 func (i *Installer) serverWatch(resp http.ResponseWriter, req *http.Request, clientId string) {
 	klog.V(3).Infof("Serving watch for client: %s", clientId)
@@ -235,14 +310,11 @@ func (i *Installer) serverWatch(resp http.ResponseWriter, req *http.Request, cli
 	watchCh := make(chan runtime.Object, WatchChannelSize)
 	stopCh := make(chan struct{})
 
-	// Signal the distributor to stop the watch for this client on exit
-	defer stopWatch(stopCh)
-
 	// read request body and get the crv
 	crvMap, err := getResourceVersionsMap(req)
 	if err != nil {
 		klog.Errorf("unable to get the resource versions. Error %v", err)
-		resp.WriteHeader(http.StatusInternalServerError)
+		writeBadRequest(resp, "Invalid watch request")
 		return
 	}
 
@@ -253,15 +325,18 @@ func (i *Installer) serverWatch(resp http.ResponseWriter, req *http.Request, cli
 	err = i.dist.Watch(clientId, crvMap, watchCh, stopCh)
 	if err != nil {
 		klog.Errorf("unable to start the watch at store. Error %v", err)
-		resp.WriteHeader(http.StatusInternalServerError)
+		writeServiceError(resp, err, map[string]string{"client_id": clientId})
 		return
 	}
+	// Signal the distributor to stop the watch for this client on exit
+	// Only a started watch receives the stop signal, so it is not sent if the watch failed to start
+	defer stopWatch(stopCh)
 
 	done := req.Context().Done()
 	flusher, ok := resp.(http.Flusher)
 	if !ok {
 		klog.Errorf("unable to start watch - can't get http.Flusher")
-		resp.WriteHeader(http.StatusInternalServerError)
+		writeInternalError(resp, "Streaming not supported")
 		return
 	}
 
@@ -272,12 +347,22 @@ func (i *Installer) serverWatch(resp http.ResponseWriter, req *http.Request, cli
 	flusher.Flush()
 
 	klog.V(3).Infof("Start processing watch event for client: %v", clientId)
+	metrics.ActiveWatches.Inc()
+	defer metrics.ActiveWatches.Dec()
+	// client lease is renewed implicitly while the watch is active
+	leaseRenewTicker := time.NewTicker(i.dist.GetClientLeaseDuration() / 3)
+	defer leaseRenewTicker.Stop()
 	flushBatchSize := 10
 	n := 0
 	for {
 		select {
 		case <-done:
 			return
+		case <-leaseRenewTicker.C:
+			if err := i.dist.RenewClientLease(clientId); err != nil {
+				klog.Errorf("Stop watch for client %s. Error renew lease: %v", clientId, err)
+				return
+			}
 		case record, ok := <-watchCh:
 			if !ok {
 				// End of results.
@@ -287,9 +372,9 @@ func (i *Installer) serverWatch(resp http.ResponseWriter, req *http.Request, cli
 
 			klog.V(6).Infof("Getting event from distributor, node Id: %v", record.GetId())
 
-			if err := json.NewEncoder(resp).Encode(record); err != nil {
+			// the stream has started, failures can only be logged and end the watch
+			if err := json.NewEncoder(resp).Encode(toWireEvent(record)); err != nil {
 				klog.V(3).Infof("encoding record failed. error %v", err)
-				resp.WriteHeader(http.StatusInternalServerError)
 				return
 			}
 
@@ -300,12 +385,51 @@ func (i *Installer) serverWatch(resp http.ResponseWriter, req *http.Request, cli
 				n = 0
 			}
 			record.SetCheckpoint(int(metrics.Serializer_Sent))
-			metrics.AddLatencyMetricsAllCheckpoints(record)
+			metrics.AddLatencyMetricsAllCheckpoints(record, clientId)
 		}
 	}
 }
 
 // Helper functions
+
+// toWireEvent returns the event to encode, with the checkpoints it passed in the service appended to its trace context if traced
+func toWireEvent(record runtime.Object) interface{} {
+	nodeEvent, isOK := record.(*runtime.NodeEvent)
+	if !isOK || nodeEvent.Trace == nil {
+		return record
+	}
+	hops := append(metrics.GetCheckpointTraceHops(nodeEvent), runtime.TraceHop{Name: runtime.TraceHop_ServiceSending, Time: time.Now().UTC()})
+	return nodeEvent.WithTraceHops(hops...)
+}
+
+// getClientIdForRegistration generates a new client id, or a stable client id for the idempotency key of the caller
+// so that retries of the same registration request get the existing allocation
+// The key is scoped by the caller, so that other callers knowing the key do not get the registration of the client
+func getClientIdForRegistration(caller string, idempotencyKey string) string {
+	if idempotencyKey == "" {
+		return fmt.Sprintf("%s-%s", store.Preserve_Client_KeyPrefix, uuid.New().String())
+	}
+	name := caller + "/" + idempotencyKey
+	return fmt.Sprintf("%s-%s", store.Preserve_Client_KeyPrefix, uuid.NewSHA1(uuid.NameSpaceOID, []byte(name)).String())
+}
+
+// getRegistrationCaller returns the subject of the token of the registration request,
+// or the remote host of the request if authentication is disabled
+func getRegistrationCaller(req *http.Request) string {
+	if claims := getClaims(req); claims != nil {
+		return claims.Subject
+	}
+	return getRemoteHost(req)
+}
+
+// get remote host of the request, without port
+func getRemoteHost(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
 func stopWatch(stopCh chan struct{}) {
 	stopCh <- struct{}{}
 }
@@ -360,16 +484,20 @@ func (i *Installer) handleResponseTrunked(resp http.ResponseWriter, nodes []*typ
 		ret, err := json.Marshal(listResp)
 		if err != nil {
 			klog.Errorf("error read get node list. error %v", err)
-			resp.WriteHeader(http.StatusInternalServerError)
+			writeInternalError(resp, "Failed to marshal node list")
 			return
 		}
+		resp.Header().Set("Content-Type", "application/json")
 		resp.Write(ret)
 	} else {
 		flusher, ok := resp.(http.Flusher)
 		if !ok {
 			klog.Errorf("expected http.ResponseWriter to be an http.Flusher")
+			writeInternalError(resp, "Streaming not supported")
+			return
 		}
 
+		resp.Header().Set("Content-Type", "application/json")
 		resp.Header().Set("Connection", "Keep-Alive")
 		resp.Header().Set("X-Content-Type-Options", "nosniff")
 		//TODO: handle network disconnect or similar cases.
@@ -387,8 +515,8 @@ func (i *Installer) handleResponseTrunked(resp http.ResponseWriter, nodes []*typ
 			listResp := apiTypes.ListNodeResponse{NodeList: chunkedNodes, ResourceVersions: crv}
 			ret, err := json.Marshal(listResp)
 			if err != nil {
+				// chunks might have been sent, the client gets an incomplete list
 				klog.Errorf("error read get node list. error %v", err)
-				resp.WriteHeader(http.StatusInternalServerError)
 				return
 			}
 
@@ -17,6 +17,8 @@ limitations under the License.
 package endpoints
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -28,14 +30,17 @@ import (
 
 	"k8s.io/klog/v2"
 
+	"global-resource-service/resource-management/pkg/common-lib/metrics"
 	"global-resource-service/resource-management/pkg/common-lib/types"
 	"global-resource-service/resource-management/pkg/common-lib/types/location"
 	"global-resource-service/resource-management/pkg/common-lib/types/runtime"
 	"global-resource-service/resource-management/pkg/distributor"
 	"global-resource-service/resource-management/pkg/distributor/storage"
+	"global-resource-service/resource-management/pkg/service-api/auth"
 	apitypes "global-resource-service/resource-management/pkg/service-api/types"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -207,3 +212,388 @@ func TestHTTPGetNodeStatus(t *testing.T) {
 		t.Logf("Get node %s status in %v", actualNode.Id, duration)
 	}
 }
+
+func TestHttpGetCapacity(t *testing.T) {
+	distributor := setUp()
+	defer tearDown(distributor)
+
+	installer := NewInstaller(distributor)
+
+	// initialize node store with 10K nodes and register a client
+	eventsAdd := generateAddNodeEvent(10000)
+	distributor.ProcessEvents(eventsAdd)
+	client := types.Client{ClientId: uuid.New().String(), Resource: types.ResourceRequest{TotalMachines: 500}, ClientInfo: types.ClientInfoType{}}
+	err := distributor.RegisterClient(&client)
+	assert.Nil(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, CapacityPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	installer.CapacityHandler(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	resp := apitypes.CapacityResponse{}
+	err = json.NewDecoder(recorder.Body).Decode(&resp)
+	assert.Nil(t, err)
+
+	expected := distributor.GetCapacity()
+	assert.Equal(t, expected.HostCapacity, resp.Capacity.HostCapacity)
+	assert.True(t, resp.Capacity.AssignedHostNum >= 500)
+
+	regionName := location.Region(0).String()
+	rpName := location.ResourcePartition(0).String()
+	regionCapacity, isOK := resp.Capacity.Regions[regionName]
+	assert.True(t, isOK, "Expecting capacity of region %s", regionName)
+	rpCapacity, isOK := regionCapacity.ResourcePartitions[rpName]
+	assert.True(t, isOK, "Expecting capacity of resource partition %s", rpName)
+	assert.Equal(t, expected.Regions[regionName].ResourcePartitions[rpName].HostCapacity, rpCapacity.HostCapacity)
+}
+
+func TestHttpRenewClientLease(t *testing.T) {
+	distributor := setUp()
+	defer tearDown(distributor)
+
+	installer := NewInstaller(distributor)
+
+	eventsAdd := generateAddNodeEvent(10000)
+	distributor.ProcessEvents(eventsAdd)
+	client := types.Client{ClientId: uuid.New().String(), Resource: types.ResourceRequest{TotalMachines: 500}, ClientInfo: types.ClientInfoType{}}
+	err := distributor.RegisterClient(&client)
+	assert.Nil(t, err)
+
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/%s/lease", ClientAdminitrationPath, client.ClientId), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	installer.ClientLeaseHandler(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	resp := apitypes.ClientLeaseResponse{}
+	err = json.NewDecoder(recorder.Body).Decode(&resp)
+	assert.Nil(t, err)
+	assert.Equal(t, client.ClientId, resp.ClientId)
+	assert.Equal(t, int64(distributor.GetClientLeaseDuration().Seconds()), resp.LeaseDurationSeconds)
+
+	// unknown client
+	req, err = http.NewRequest(http.MethodPut, fmt.Sprintf("%s/%s/lease", ClientAdminitrationPath, uuid.New().String()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder = httptest.NewRecorder()
+	installer.ClientLeaseHandler(recorder, req)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func newRegistrationRequest(t *testing.T, idempotencyKey string, totalMachines int) *http.Request {
+	clientReq := apitypes.ClientRegistrationRequest{
+		InitialRequestedResource: types.ResourceRequest{TotalMachines: totalMachines},
+		IdempotencyKey:           idempotencyKey,
+	}
+	body, err := json.Marshal(clientReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, ClientAdminitrationPath, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func registerClientWithKey(t *testing.T, installer *Installer, idempotencyKey string, totalMachines int) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	installer.ClientAdministrationHandler(recorder, newRegistrationRequest(t, idempotencyKey, totalMachines))
+	return recorder
+}
+
+func decodeRegistrationResponse(t *testing.T, recorder *httptest.ResponseRecorder) apitypes.ClientRegistrationResponse {
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	resp := apitypes.ClientRegistrationResponse{}
+	assert.Nil(t, json.NewDecoder(recorder.Body).Decode(&resp))
+	return resp
+}
+
+func TestHttpRegisterClient_Idempotent(t *testing.T) {
+	distributor := setUp()
+	defer tearDown(distributor)
+
+	installer := NewInstaller(distributor)
+
+	eventsAdd := generateAddNodeEvent(10000)
+	distributor.ProcessEvents(eventsAdd)
+
+	idempotencyKey := uuid.New().String()
+	recorder := registerClientWithKey(t, installer, idempotencyKey, 1000)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	resp := apitypes.ClientRegistrationResponse{}
+	err := json.NewDecoder(recorder.Body).Decode(&resp)
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", resp.ClientId)
+
+	// retry gets same client id
+	recorder = registerClientWithKey(t, installer, idempotencyKey, 1000)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	retryResp := apitypes.ClientRegistrationResponse{}
+	err = json.NewDecoder(recorder.Body).Decode(&retryResp)
+	assert.Nil(t, err)
+	assert.Equal(t, resp, retryResp)
+
+	// conflicting resource request is rejected
+	recorder = registerClientWithKey(t, installer, idempotencyKey, 2000)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+
+	// registration without key always gets new client id
+	recorder = registerClientWithKey(t, installer, "", 1000)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	newResp := apitypes.ClientRegistrationResponse{}
+	err = json.NewDecoder(recorder.Body).Decode(&newResp)
+	assert.Nil(t, err)
+	assert.NotEqual(t, resp.ClientId, newResp.ClientId)
+}
+
+func TestHttpRegisterClient_IdempotencyKeyScopedByCaller(t *testing.T) {
+	distributor := setUp()
+	defer tearDown(distributor)
+
+	installer := NewInstaller(distributor)
+	distributor.ProcessEvents(generateAddNodeEvent(10000))
+
+	register := func(req *http.Request) apitypes.ClientRegistrationResponse {
+		recorder := httptest.NewRecorder()
+		installer.ClientAdministrationHandler(recorder, req)
+		return decodeRegistrationResponse(t, recorder)
+	}
+	idempotencyKey := uuid.New().String()
+
+	// without authentication, the key is scoped by remote host
+	req := newRegistrationRequest(t, idempotencyKey, 1000)
+	req.RemoteAddr = "10.0.0.1:1234"
+	resp := register(req)
+	req = newRegistrationRequest(t, idempotencyKey, 1000)
+	req.RemoteAddr = "10.0.0.1:5678"
+	assert.Equal(t, resp.ClientId, register(req).ClientId)
+	req = newRegistrationRequest(t, idempotencyKey, 1000)
+	req.RemoteAddr = "10.0.0.2:1234"
+	otherHostResp := register(req)
+	assert.NotEqual(t, resp.ClientId, otherHostResp.ClientId)
+
+	// with authentication, the key is scoped by token subject
+	adminReq := func(subject string) *http.Request {
+		req := newRegistrationRequest(t, idempotencyKey, 1000)
+		req.RemoteAddr = "10.0.0.1:1234"
+		claims := &auth.Claims{Subject: subject, Role: auth.RoleAdmin}
+		return req.WithContext(context.WithValue(req.Context(), claimsContextKey, claims))
+	}
+	adminResp := register(adminReq("admin1"))
+	assert.NotEqual(t, resp.ClientId, adminResp.ClientId)
+	assert.Equal(t, adminResp.ClientId, register(adminReq("admin1")).ClientId)
+	assert.NotEqual(t, adminResp.ClientId, register(adminReq("admin2")).ClientId)
+}
+
+func decodeErrorResponse(t *testing.T, recorder *httptest.ResponseRecorder) apitypes.ErrorResponse {
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	errResp := apitypes.ErrorResponse{}
+	err := json.NewDecoder(recorder.Body).Decode(&errResp)
+	assert.Nil(t, err)
+	return errResp
+}
+
+func TestHttpErrorResponse(t *testing.T) {
+	distributor := setUp()
+	defer tearDown(distributor)
+
+	installer := NewInstaller(distributor)
+
+	eventsAdd := generateAddNodeEvent(1000)
+	distributor.ProcessEvents(eventsAdd)
+
+	// node not found
+	regionName := location.Region(0).String()
+	rpName := location.ResourcePartition(0).String()
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/nodes?nodeId=%s&region=%v&resourcePartition=%v", uuid.New().String(), regionName, rpName), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	installer.NodeHandler(recorder, req)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	errResp := decodeErrorResponse(t, recorder)
+	assert.Equal(t, apitypes.ErrCode_NotFound, errResp.Code)
+	assert.False(t, errResp.Retryable)
+	assert.Equal(t, rpName, errResp.Details["resource_partition"])
+
+	// list for unregistered client
+	clientId := uuid.New().String()
+	req, err = http.NewRequest(http.MethodGet, "/resource/"+clientId, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder = httptest.NewRecorder()
+	installer.ResourceHandler(recorder, req)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	errResp = decodeErrorResponse(t, recorder)
+	assert.Equal(t, apitypes.ErrCode_ClientNotRegistered, errResp.Code)
+	assert.Equal(t, clientId, errResp.Details["client_id"])
+
+	// request exceeds limit
+	recorder = registerClientWithKey(t, installer, "", types.MaxTotalMachinesPerRequest+1)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	errResp = decodeErrorResponse(t, recorder)
+	assert.Equal(t, apitypes.ErrCode_HostRequestExceedLimit, errResp.Code)
+
+	// request exceeds free capacity
+	freeHostNum := distributor.GetCapacity().FreeHostNum
+	assert.True(t, freeHostNum < types.MaxTotalMachinesPerRequest)
+	recorder = registerClientWithKey(t, installer, "", freeHostNum+1)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	errResp = decodeErrorResponse(t, recorder)
+	assert.Equal(t, apitypes.ErrCode_HostRequestExceedCapacity, errResp.Code)
+	assert.True(t, errResp.Retryable)
+
+	// invalid request body
+	req, err = http.NewRequest(http.MethodPost, ClientAdminitrationPath, bytes.NewReader([]byte("{")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder = httptest.NewRecorder()
+	installer.ClientAdministrationHandler(recorder, req)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	errResp = decodeErrorResponse(t, recorder)
+	assert.Equal(t, apitypes.ErrCode_BadRequest, errResp.Code)
+
+	// method not allowed
+	req, err = http.NewRequest(http.MethodPatch, CapacityPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder = httptest.NewRecorder()
+	installer.CapacityHandler(recorder, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	errResp = decodeErrorResponse(t, recorder)
+	assert.Equal(t, apitypes.ErrCode_MethodNotAllowed, errResp.Code)
+}
+
+func newWatchRequest(t *testing.T, clientId string, crv types.TransitResourceVersionMap) *http.Request {
+	body, err := json.Marshal(apitypes.WatchRequest{ResourceVersions: crv})
+	assert.Nil(t, err)
+	return httptest.NewRequest(http.MethodPost, "/resource/"+clientId+"?watch=true", bytes.NewReader(body))
+}
+
+// listResourceVersions lists nodes of the client and returns the resource versions of the list
+func listResourceVersions(t *testing.T, installer *Installer, clientId string) types.TransitResourceVersionMap {
+	recorder := httptest.NewRecorder()
+	installer.ResourceHandler(recorder, httptest.NewRequest(http.MethodGet, "/resource/"+clientId, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var crv types.TransitResourceVersionMap
+	dec := json.NewDecoder(recorder.Body)
+	for dec.More() {
+		resp := apitypes.ListNodeResponse{}
+		assert.Nil(t, dec.Decode(&resp))
+		if resp.ResourceVersions != nil {
+			crv = resp.ResourceVersions
+		}
+	}
+	return crv
+}
+
+func TestHttpWatch_RelistAfterRebalance(t *testing.T) {
+	distributor := setUp()
+	defer tearDown(distributor)
+
+	installer := NewInstaller(distributor)
+	r := mux.NewRouter().StrictSlash(true)
+	r.Use(NewAdmissionMiddleware(AdmissionConfig{MaxWatchesPerClient: 1}, distributor))
+	r.HandleFunc(ListWatchResourcePath, installer.ResourceHandler)
+
+	distributor.ProcessEvents(generateAddNodeEvent(10000))
+	client := types.Client{ClientId: uuid.New().String(), Resource: types.ResourceRequest{TotalMachines: 500}, ClientInfo: types.ClientInfoType{}}
+	assert.Nil(t, distributor.RegisterClient(&client))
+	crvBeforeRebalance := listResourceVersions(t, installer, client.ClientId)
+
+	// new hosts grow the virtual stores assigned to client, the surplus is released by rebalance
+	capacity := distributor.GetCapacity()
+	distributor.ProcessEvents(generateAddNodeEvent(capacity.FreeHostNum + capacity.AssignedHostNum))
+	assert.Contains(t, distributor.RebalanceClients(), client.ClientId)
+
+	// watch from the resource versions before rebalance needs to list again
+	for i := 0; i < 2; i++ {
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, newWatchRequest(t, client.ClientId, crvBeforeRebalance))
+		assert.Equal(t, http.StatusGone, recorder.Code)
+		assert.Equal(t, apitypes.ErrCode_ResourceVersionExpired, decodeErrorResponse(t, recorder).Code)
+	}
+
+	// watch from the resource versions of a new list
+	crv := listResourceVersions(t, installer, client.ClientId)
+	ctx, cancel := context.WithCancel(context.Background())
+	recorder := httptest.NewRecorder()
+	doneCh := make(chan struct{})
+	go func() {
+		r.ServeHTTP(recorder, newWatchRequest(t, client.ClientId, crv).WithContext(ctx))
+		close(doneCh)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for watch to end")
+	}
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestHttpWatch_FailedToStart(t *testing.T) {
+	distributor := setUp()
+	defer tearDown(distributor)
+
+	installer := NewInstaller(distributor)
+	r := mux.NewRouter().StrictSlash(true)
+	r.Use(NewAdmissionMiddleware(AdmissionConfig{MaxWatchesPerClient: 1}, distributor))
+	r.HandleFunc(ListWatchResourcePath, installer.ResourceHandler)
+
+	// watch of unregistered client fails, the handler returns and the watch slot is released
+	clientId := uuid.New().String()
+	watch := func() *httptest.ResponseRecorder {
+		req := newWatchRequest(t, clientId, types.TransitResourceVersionMap{})
+		recorder := httptest.NewRecorder()
+		doneCh := make(chan struct{})
+		go func() {
+			r.ServeHTTP(recorder, req)
+			close(doneCh)
+		}()
+		select {
+		case <-doneCh:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for failed watch to return")
+		}
+		return recorder
+	}
+	for i := 0; i < 2; i++ {
+		recorder := watch()
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+		assert.Equal(t, apitypes.ErrCode_ClientNotRegistered, decodeErrorResponse(t, recorder).Code)
+	}
+}
+
+func TestToWireEvent(t *testing.T) {
+	node := &types.LogicalNode{Id: "node1", ResourceVersion: "10", LastUpdatedTime: time.Now().UTC()}
+	event := runtime.NewNodeEvent(node, runtime.Modified)
+	assert.Equal(t, event, toWireEvent(event))
+
+	event.Trace = runtime.NewTraceContext(node.LastUpdatedTime).WithHops(runtime.TraceHop{Name: runtime.TraceHop_RegionManagerSent, Time: time.Now().UTC()})
+	event.SetCheckpoint(int(metrics.Aggregator_Received))
+	event.SetCheckpoint(int(metrics.Distributor_Received))
+	wireEvent, isOK := toWireEvent(event).(*runtime.NodeEvent)
+	assert.True(t, isOK)
+	hopNames := make([]string, len(wireEvent.Trace.Hops))
+	for i, hop := range wireEvent.Trace.Hops {
+		hopNames[i] = hop.Name
+	}
+	assert.Equal(t, []string{runtime.TraceHop_RegionManagerSent, string(metrics.Aggregator_Received_Name),
+		string(metrics.Distributor_Received_Name), runtime.TraceHop_ServiceSending}, hopNames)
+	// event in distributor queue is not changed
+	assert.Equal(t, 1, len(event.Trace.Hops))
+}
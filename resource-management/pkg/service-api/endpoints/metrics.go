@@ -0,0 +1,89 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"global-resource-service/resource-management/pkg/common-lib/metrics"
+	apiTypes "global-resource-service/resource-management/pkg/service-api/types"
+)
+
+// NewMetricsHandler returns the handler exporting metrics of the registry in Prometheus text format
+func NewMetricsHandler(registry *metrics.Registry) http.HandlerFunc {
+	return func(resp http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			writeMethodNotAllowed(resp, req)
+			return
+		}
+
+		resp.Header().Set("Content-Type", metrics.PrometheusContentType)
+		if err := registry.WriteText(resp); err != nil {
+			klog.V(3).Infof("error write metrics. error %v", err)
+		}
+	}
+}
+
+// LatencyReportHandler responds event latency percentiles of each checkpoint by value of the dimension
+// in query parameter "dimension", filtered by query parameter "value" if set
+func LatencyReportHandler(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeMethodNotAllowed(resp, req)
+		return
+	}
+
+	dimension := metrics.LatencyDimension(req.URL.Query().Get("dimension"))
+	reports, isOK := metrics.GetLatencyReportByDimension(dimension, req.URL.Query().Get("value"))
+	if !isOK {
+		writeBadRequest(resp, fmt.Sprintf("Invalid latency dimension %q, supported dimensions: %v", dimension, metrics.GetLatencyDimensions()))
+		return
+	}
+
+	ret := apiTypes.LatencyReportResponse{Dimension: string(dimension), Reports: make(map[string]map[string]apiTypes.LatencySummary, len(reports))}
+	for value, reportByCheckpoint := range reports {
+		summaries := make(map[string]apiTypes.LatencySummary, len(reportByCheckpoint))
+		for checkpointName, report := range reportByCheckpoint {
+			summaries[string(checkpointName)] = apiTypes.LatencySummary{
+				TotalCount: report.TotalCount,
+				P50:        toMilliseconds(report.P50),
+				P90:        toMilliseconds(report.P90),
+				P99:        toMilliseconds(report.P99),
+			}
+		}
+		ret.Reports[value] = summaries
+	}
+
+	b, err := json.Marshal(ret)
+	if err != nil {
+		klog.V(3).Infof("error marshal latency report. error %v", err)
+		writeInternalError(resp, "Failed to marshal latency report")
+		return
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	if _, err = resp.Write(b); err != nil {
+		klog.V(3).Infof("error write response. error %v", err)
+	}
+}
+
+func toMilliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"global-resource-service/resource-management/pkg/common-lib/metrics"
+	apitypes "global-resource-service/resource-management/pkg/service-api/types"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	registry := metrics.NewRegistry()
+	watches := metrics.NewGaugeVec("test_active_watches", "Number of client watches being served.")
+	registry.Register(watches)
+	watches.Inc()
+	handler := NewMetricsHandler(registry)
+
+	req := httptest.NewRequest(http.MethodGet, MetricsPath, nil)
+	recorder := httptest.NewRecorder()
+	handler(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, metrics.PrometheusContentType, recorder.Header().Get("Content-Type"))
+	assert.True(t, strings.Contains(recorder.Body.String(), "\ntest_active_watches 1\n"))
+
+	req = httptest.NewRequest(http.MethodPost, MetricsPath, nil)
+	recorder = httptest.NewRecorder()
+	handler(recorder, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestLatencyReportHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, LatencyReportPath+"?dimension=region", nil)
+	recorder := httptest.NewRecorder()
+	LatencyReportHandler(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	ret := apitypes.LatencyReportResponse{}
+	assert.Nil(t, json.NewDecoder(recorder.Body).Decode(&ret))
+	assert.Equal(t, "region", ret.Dimension)
+
+	req = httptest.NewRequest(http.MethodGet, LatencyReportPath+"?dimension=datacenter", nil)
+	recorder = httptest.NewRecorder()
+	LatencyReportHandler(recorder, req)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, apitypes.ErrCode_BadRequest, decodeErrorResponse(t, recorder).Code)
+}
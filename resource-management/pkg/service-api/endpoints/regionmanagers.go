@@ -0,0 +1,127 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+
+	"k8s.io/klog/v2"
+
+	apiTypes "global-resource-service/resource-management/pkg/service-api/types"
+)
+
+const (
+	// RegionManagerUrlParameter is the url of the region manager to remove
+	RegionManagerUrlParameter = "url"
+	// RegionNodeActionParameter is the action on nodes of the removed region manager, keep by default
+	RegionNodeActionParameter = "nodes"
+)
+
+// RegionManagerRegistry adds, removes and replaces region managers the service aggregates nodes from at runtime
+type RegionManagerRegistry interface {
+	// GetRegionManagerStatus returns the list status and connection health of each region manager
+	GetRegionManagerStatus() []apiTypes.RegionManagerStatus
+	AddRegion(url string) error
+	RemoveRegion(url string, nodeAction string) error
+	ReplaceRegion(url string, newUrl string) error
+}
+
+// RegionManagerHandler serves /regionmanagers to list, add, remove and replace region managers
+type RegionManagerHandler struct {
+	registry RegionManagerRegistry
+}
+
+func NewRegionManagerHandler(registry RegionManagerRegistry) *RegionManagerHandler {
+	return &RegionManagerHandler{registry: registry}
+}
+
+// RegionManagersHandler lists region managers with GET, adds one with POST, replaces one with PUT,
+// and removes one with DELETE /regionmanagers?url=<url>&nodes=keep|stale|delete
+// The current region managers are returned on success
+func (h *RegionManagerHandler) RegionManagersHandler(resp http.ResponseWriter, req *http.Request) {
+	klog.V(3).Infof("handle /regionmanagers. URL path: %s", req.URL.Path)
+
+	var err error
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		regionReq, isOK := readRegionManagerRequest(resp, req)
+		if !isOK {
+			return
+		}
+		err = h.registry.AddRegion(regionReq.Url)
+	case http.MethodPut:
+		regionReq, isOK := readRegionManagerRequest(resp, req)
+		if !isOK {
+			return
+		}
+		err = h.registry.ReplaceRegion(regionReq.Url, regionReq.NewUrl)
+	case http.MethodDelete:
+		nodeAction := req.URL.Query().Get(RegionNodeActionParameter)
+		if nodeAction == "" {
+			nodeAction = apiTypes.RegionNodeAction_Keep
+		}
+		err = h.registry.RemoveRegion(req.URL.Query().Get(RegionManagerUrlParameter), nodeAction)
+	default:
+		writeMethodNotAllowed(resp, req)
+		return
+	}
+	if err != nil {
+		klog.V(3).Infof("error %s region manager. error %v", req.Method, err)
+		writeServiceError(resp, err, nil)
+		return
+	}
+
+	h.writeRegionManagers(resp)
+}
+
+func readRegionManagerRequest(resp http.ResponseWriter, req *http.Request) (*apiTypes.RegionManagerRequest, bool) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		klog.V(3).Infof("error read request. error %v", err)
+		writeBadRequest(resp, "Failed to read request body")
+		return nil, false
+	}
+
+	regionReq := &apiTypes.RegionManagerRequest{}
+	if err = json.Unmarshal(body, regionReq); err != nil {
+		klog.V(3).Infof("error unmarshal request body. error %v", err)
+		writeBadRequest(resp, "Invalid region manager request")
+		return nil, false
+	}
+	return regionReq, true
+}
+
+func (h *RegionManagerHandler) writeRegionManagers(resp http.ResponseWriter) {
+	ret := apiTypes.RegionManagersResponse{RegionManagers: h.registry.GetRegionManagerStatus()}
+	sort.Slice(ret.RegionManagers, func(i, j int) bool { return ret.RegionManagers[i].Url < ret.RegionManagers[j].Url })
+
+	b, err := json.Marshal(ret)
+	if err != nil {
+		klog.V(3).Infof("error marshal region managers response. error %v", err)
+		writeInternalError(resp, "Failed to marshal region managers response")
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	if _, err = resp.Write(b); err != nil {
+		klog.V(3).Infof("error write response. error %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"global-resource-service/resource-management/pkg/common-lib/types"
+	apitypes "global-resource-service/resource-management/pkg/service-api/types"
+)
+
+// fakeRegionManagerRegistry keeps urls with the initial list done, and the node action of the last removal
+type fakeRegionManagerRegistry struct {
+	urls           map[string]bool
+	lastNodeAction string
+}
+
+func (r *fakeRegionManagerRegistry) GetRegionManagerStatus() []apitypes.RegionManagerStatus {
+	status := make([]apitypes.RegionManagerStatus, 0, len(r.urls))
+	for url, isListed := range r.urls {
+		status = append(status, apitypes.RegionManagerStatus{Url: url, InitialListDone: isListed})
+	}
+	return status
+}
+
+func (r *fakeRegionManagerRegistry) AddRegion(url string) error {
+	if url == "" {
+		return types.Error_InvalidRegionManagerUrl
+	}
+	if _, isOK := r.urls[url]; isOK {
+		return types.Error_RegionManagerExisted
+	}
+	r.urls[url] = false
+	return nil
+}
+
+func (r *fakeRegionManagerRegistry) RemoveRegion(url string, nodeAction string) error {
+	if _, isOK := r.urls[url]; !isOK {
+		return types.Error_RegionManagerNotFound
+	}
+	delete(r.urls, url)
+	r.lastNodeAction = nodeAction
+	return nil
+}
+
+func (r *fakeRegionManagerRegistry) ReplaceRegion(url string, newUrl string) error {
+	if err := r.RemoveRegion(url, apitypes.RegionNodeAction_Keep); err != nil {
+		return err
+	}
+	return r.AddRegion(newUrl)
+}
+
+func TestRegionManagersHandler(t *testing.T) {
+	registry := &fakeRegionManagerRegistry{urls: map[string]bool{"127.0.0.1:9119": true}}
+	handler := NewRegionManagerHandler(registry).RegionManagersHandler
+	serve := func(method string, target string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		recorder := httptest.NewRecorder()
+		handler(recorder, req)
+		return recorder
+	}
+	getRegionManagers := func(recorder *httptest.ResponseRecorder) []apitypes.RegionManagerStatus {
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		ret := apitypes.RegionManagersResponse{}
+		assert.Nil(t, json.NewDecoder(recorder.Body).Decode(&ret))
+		return ret.RegionManagers
+	}
+
+	assert.Equal(t, []apitypes.RegionManagerStatus{{Url: "127.0.0.1:9119", InitialListDone: true}},
+		getRegionManagers(serve(http.MethodGet, RegionManagerAdministrationPath, "")))
+
+	recorder := serve(http.MethodPost, RegionManagerAdministrationPath, `{"url":"127.0.0.1:9120"}`)
+	assert.Equal(t, []apitypes.RegionManagerStatus{{Url: "127.0.0.1:9119", InitialListDone: true}, {Url: "127.0.0.1:9120"}},
+		getRegionManagers(recorder))
+
+	recorder = serve(http.MethodPut, RegionManagerAdministrationPath, `{"url":"127.0.0.1:9119","new_url":"127.0.0.1:9121"}`)
+	assert.Equal(t, []apitypes.RegionManagerStatus{{Url: "127.0.0.1:9120"}, {Url: "127.0.0.1:9121"}}, getRegionManagers(recorder))
+
+	recorder = serve(http.MethodDelete, RegionManagerAdministrationPath+"?url=127.0.0.1:9120&nodes=stale", "")
+	assert.Equal(t, []apitypes.RegionManagerStatus{{Url: "127.0.0.1:9121"}}, getRegionManagers(recorder))
+	assert.Equal(t, apitypes.RegionNodeAction_Stale, registry.lastNodeAction)
+
+	// nodes are kept by default
+	serve(http.MethodPost, RegionManagerAdministrationPath, `{"url":"127.0.0.1:9120"}`)
+	getRegionManagers(serve(http.MethodDelete, RegionManagerAdministrationPath+"?url=127.0.0.1:9120", ""))
+	assert.Equal(t, apitypes.RegionNodeAction_Keep, registry.lastNodeAction)
+
+	testCases := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"add invalid body", http.MethodPost, RegionManagerAdministrationPath, "{", http.StatusBadRequest, apitypes.ErrCode_BadRequest},
+		{"add invalid url", http.MethodPost, RegionManagerAdministrationPath, `{"url":""}`, http.StatusBadRequest, apitypes.ErrCode_BadRequest},
+		{"add existing", http.MethodPost, RegionManagerAdministrationPath, `{"url":"127.0.0.1:9121"}`, http.StatusConflict, apitypes.ErrCode_RegionManagerExisted},
+		{"remove unknown", http.MethodDelete, RegionManagerAdministrationPath + "?url=unknown", "", http.StatusNotFound, apitypes.ErrCode_RegionManagerNotFound},
+		{"method not allowed", http.MethodPatch, RegionManagerAdministrationPath, "", http.StatusMethodNotAllowed, apitypes.ErrCode_MethodNotAllowed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := serve(tc.method, tc.target, tc.body)
+			assert.Equal(t, tc.expectedStatus, recorder.Code)
+			errResp := apitypes.ErrorResponse{}
+			assert.Nil(t, json.NewDecoder(recorder.Body).Decode(&errResp))
+			assert.Equal(t, tc.expectedCode, errResp.Code)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2022 Authors of Global Resource Service.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+// Error codes of ErrorResponse. Codes are stable across releases, clients should check the code
+// instead of the message or the http status code
+const (
+	ErrCode_BadRequest       = "BadRequest"
+	ErrCode_NotFound         = "NotFound"
+	ErrCode_MethodNotAllowed = "MethodNotAllowed"
+	ErrCode_NotImplemented   = "NotImplemented"
+	ErrCode_InternalError    = "InternalError"
+
+	ErrCode_HostRequestExceedLimit     = "HostRequestExceedLimit"
+	ErrCode_HostRequestExceedCapacity  = "HostRequestExceedCapacity"
+	ErrCode_HostRequestLessThanMinimal = "HostRequestLessThanMinimal"
+
+	ErrCode_ClientIdExisted            = "ClientIdExisted"
+	ErrCode_ClientNotRegistered        = "ClientNotRegistered"
+	ErrCode_ClientRegistrationConflict = "ClientRegistrationConflict"
+
+	ErrCode_Unauthorized = "Unauthorized"
+	ErrCode_TokenExpired = "TokenExpired"
+	ErrCode_Forbidden    = "Forbidden"
+
+	ErrCode_TooManyRequests = "TooManyRequests"
+	ErrCode_TooManyWatches  = "TooManyWatches"
+
+	ErrCode_ResourceVersionExpired = "ResourceVersionExpired"
+
+	ErrCode_RegionManagerExisted  = "RegionManagerExisted"
+	ErrCode_RegionManagerNotFound = "RegionManagerNotFound"
+)
+
+// ErrorResponse is the response body of all failed service API calls
+// Code is one of the ErrCode_ constants
+// Retryable indicates whether the same request could succeed later without change
+// Details are optional key value pairs to help with the error, for example the id of the client
+type ErrorResponse struct {
+	Code      string            `json:"code"`
+	Message   string            `json:"message"`
+	Retryable bool              `json:"retryable"`
+	Details   map[string]string `json:"details,omitempty"`
+}
@@ -16,7 +16,11 @@ limitations under the License.
 
 package types
 
-import "global-resource-service/resource-management/pkg/common-lib/types"
+import (
+	"time"
+
+	"global-resource-service/resource-management/pkg/common-lib/types"
+)
 
 // WatchRequest is the request body of the Watch API call
 // ResourceVersionMap is part of the return of the LIST API call
@@ -26,17 +30,31 @@ type WatchRequest struct {
 
 // ClientRegistrationRequest is the request body when a client register to the resource management service
 // TBD: Optionally, client can set its customized name and initial resource request
+// IdempotencyKey is optional. Registration requests with the same key from the same caller, i.e. the same token subject,
+// or the same remote host if authentication is disabled, get the same client id and allocation.
+// The key must be a secret, e.g. a random uuid, as a caller with the key gets the registration including its token
 type ClientRegistrationRequest struct {
 	ClientInfo               types.ClientInfoType  `json:"client_info,omitempty"`
 	InitialRequestedResource types.ResourceRequest `json:"init_resource_request,omitempty"`
+	IdempotencyKey           string                `json:"idempotency_key,omitempty"`
 }
 
 // ClientRegistrationResponse is the response body for approved client registration request
 // ClientId is required for an approved client registration to the resource management service
 // GrantedResource is an info to client on the resource level the List OP it can request
+// LeaseDurationSeconds is how long the registration is kept without lease renewal, list or watch from the client
+// Token is the bearer token bound to the client id, set when the service has authentication enabled
 type ClientRegistrationResponse struct {
-	ClientId        string                `json:"client_id"`
-	GrantedResource types.ResourceRequest `json:"granted_resource,omitempty"`
+	ClientId             string                `json:"client_id"`
+	GrantedResource      types.ResourceRequest `json:"granted_resource,omitempty"`
+	LeaseDurationSeconds int64                 `json:"lease_duration_seconds,omitempty"`
+	Token                string                `json:"token,omitempty"`
+}
+
+// ClientLeaseResponse is the response body for client lease renewal
+type ClientLeaseResponse struct {
+	ClientId             string `json:"client_id"`
+	LeaseDurationSeconds int64  `json:"lease_duration_seconds"`
 }
 
 // ListNodeResponse is the response body for listing nodes from a client
@@ -51,3 +69,86 @@ type ListNodeResponse struct {
 type NodeResponse struct {
 	Node types.LogicalNode `json:"node"`
 }
+
+// CapacityResponse is the response body for capacity summary query
+// Capacity is the free and assigned host number broken down by region, resource partition and machine type
+type CapacityResponse struct {
+	Capacity types.CapacitySummary `json:"capacity"`
+}
+
+// HealthCheckResult is the result of a single check of health, readiness or liveness
+// Message is the reason of a failed check, or optional detail of a passed check
+type HealthCheckResult struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+// HealthResponse is the response body of /healthz, /readyz and /livez
+// Status is "ok" if all checks passed, otherwise "failed"
+type HealthResponse struct {
+	Status string              `json:"status"`
+	Checks []HealthCheckResult `json:"checks"`
+}
+
+// LatencySummary is the estimated latency percentiles of events at a checkpoint, in milliseconds
+type LatencySummary struct {
+	TotalCount int     `json:"total_count"`
+	P50        float64 `json:"p50_ms"`
+	P90        float64 `json:"p90_ms"`
+	P99        float64 `json:"p99_ms"`
+}
+
+// LatencyReportResponse is the response body of /metrics/latency, latency summary by dimension value then checkpoint name
+type LatencyReportResponse struct {
+	Dimension string                               `json:"dimension"`
+	Reports   map[string]map[string]LatencySummary `json:"reports"`
+}
+
+// Actions on nodes of the regions of a removed region manager
+const (
+	// nodes are kept as they are
+	RegionNodeAction_Keep = "keep"
+	// nodes are tainted NoSchedule until the region is watched again
+	RegionNodeAction_Stale = "stale"
+	// nodes are deleted
+	RegionNodeAction_Delete = "delete"
+)
+
+// RegionManagerRequest is the request body to add the region manager of Url, or to replace it with the one of NewUrl
+type RegionManagerRequest struct {
+	Url    string `json:"url"`
+	NewUrl string `json:"new_url,omitempty"`
+}
+
+// States of the list-watch of a region manager
+const (
+	RegionManagerState_Listing  = "listing"
+	RegionManagerState_Watching = "watching"
+	// waiting to list or watch again after failure or end of watch
+	RegionManagerState_Backoff = "backoff"
+	// not watching, and no contact longer than the stale region threshold
+	RegionManagerState_Disconnected = "disconnected"
+	// list or watch failed with an error not to be retried without change, e.g. auth, not found or bad request
+	RegionManagerState_Failed = "failed"
+)
+
+// RegionManagerStatus is the status and connection health of a region manager the service aggregates nodes from
+// EventLagMs is the time from the node updated in the region manager to received by the service, of the last event
+// Stale is true if nodes of its regions are flagged unschedulable for no contact longer than the threshold
+// LastError is the error of the last failed list or watch since the last success, prefixed with its error class
+type RegionManagerStatus struct {
+	Url                 string    `json:"url"`
+	InitialListDone     bool      `json:"initial_list_done"`
+	State               string    `json:"state,omitempty"`
+	LastEventTime       time.Time `json:"last_event_time,omitempty"`
+	EventLagMs          float64   `json:"event_lag_ms"`
+	Stale               bool      `json:"stale"`
+	LastError           string    `json:"last_error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures,omitempty"`
+}
+
+// RegionManagersResponse is the response body of /regionmanagers
+type RegionManagersResponse struct {
+	RegionManagers []RegionManagerStatus `json:"region_managers"`
+}
@@ -276,6 +276,28 @@ func (gr *Goredis) GetNodes() []*types.LogicalNode {
 	return logicalNodes
 }
 
+// Delete Logical Nodes, nodes not in store are ignored
+//
+func (gr *Goredis) DeleteNodes(logicalNodes []*types.LogicalNode) bool {
+	if len(logicalNodes) == 0 {
+		return true
+	}
+
+	logicalNodeKeys := make([]string, len(logicalNodes))
+	for i, logicalNode := range logicalNodes {
+		logicalNodeKeys[i] = logicalNode.GetKey()
+	}
+
+	err := gr.client.Del(gr.ctx, logicalNodeKeys...).Err()
+
+	if err != nil {
+		klog.Errorf("Error to delete Logical Nodes from Redis Store. error %v", err)
+		return false
+	}
+
+	return true
+}
+
 // Get Node Store Status
 //
 func (gr *Goredis) GetNodeStoreStatus() *store.NodeStoreStatus {
@@ -324,6 +346,64 @@ func (gr *Goredis) GetVirtualNodesAssignments() *store.VirtualNodeAssignment {
 	return virtualNodeAssignment
 }
 
+// Use Redis data type - String to store Watch Cursors of each region manager
+//
+func (gr *Goredis) PersistWatchCursors(watchCursors *store.WatchCursors) bool {
+	watchCursorsBytes, err := json.Marshal(watchCursors)
+
+	if err != nil {
+		klog.Errorf("Error from JSON Marshal for Watch Cursors. error %v", err)
+		return false
+	}
+
+	err = gr.client.Set(gr.ctx, watchCursors.GetKey(), watchCursorsBytes, 0).Err()
+
+	if err != nil {
+		klog.Errorf("Error to persist Watch Cursors to Redis Store. error %v", err)
+		return false
+	}
+
+	return true
+}
+
+// Get Watch Cursors of the region manager
+//
+func (gr *Goredis) GetWatchCursors(regionUrl string) (*store.WatchCursors, error) {
+	value, err := gr.client.Get(gr.ctx, store.GetWatchCursorsKey(regionUrl)).Bytes()
+
+	if err == redis.Nil {
+		return nil, types.Error_ObjectNotFound
+	}
+
+	if err != nil {
+		klog.Errorf("Error to get WatchCursors from Redis Store. error %v", err)
+		return nil, err
+	}
+
+	watchCursors := &store.WatchCursors{}
+	err = json.Unmarshal(value, watchCursors)
+
+	if err != nil {
+		klog.Errorf("Error from JSON Unmarshal for WatchCursors. error %v", err)
+		return nil, err
+	}
+
+	return watchCursors, nil
+}
+
+// Delete Watch Cursors of the region manager
+//
+func (gr *Goredis) DeleteWatchCursors(regionUrl string) error {
+	err := gr.client.Del(gr.ctx, store.GetWatchCursorsKey(regionUrl)).Err()
+
+	if err != nil {
+		klog.Errorf("Error to delete WatchCursors from Redis Store. error %v", err)
+		return err
+	}
+
+	return nil
+}
+
 func (gr *Goredis) PersistClient(clientId string, client *types.Client) error {
 	ci, err := json.Marshal(client)
 
@@ -371,6 +451,24 @@ func (gr *Goredis) UpdateClient(clientId string, client *types.Client) error {
 	return fmt.Errorf("not implemented")
 }
 
+func (gr *Goredis) DeleteClient(clientId string) error {
+	err := gr.client.Del(gr.ctx, clientId).Err()
+
+	if err != nil {
+		klog.Errorf("Error deleting client from Redis Store. error %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// Ping checks the Redis server is reachable within the timeout
+func (gr *Goredis) Ping(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(gr.ctx, timeout)
+	defer cancel()
+	return gr.client.Ping(ctx).Err()
+}
+
 func (gr *Goredis) GetClients() ([]*types.Client, error) {
 	return nil, fmt.Errorf("not implemented")
 }
@@ -125,7 +125,8 @@ func TestPersistNodeStoreStatus(t *testing.T) {
 	testCase0 := &store.NodeStoreStatus{
 		RegionNum:              1000,
 		PartitionMaxNum:        1000,
-		VirtualNodeNumPerRP:    1000,
+		HostsPerVirtualNode:    50,
+		VirtualNodeNum:         1000,
 		CurrentResourceVerions: CRV,
 	}
 
@@ -151,9 +152,14 @@ func TestPersistNodeStoreStatus(t *testing.T) {
 		t.Error("testCases0.PartitionMaxNum      is : ", testCase0.PartitionMaxNum)
 	}
 
-	if nodeStoreStatus.VirtualNodeNumPerRP != testCase0.VirtualNodeNumPerRP {
-		t.Error("nodeStoreStatus.VirtualNodeNumPerRP is : ", nodeStoreStatus.VirtualNodeNumPerRP)
-		t.Error("testCases0.VirtualNodeNumPerRP      is : ", testCase0.VirtualNodeNumPerRP)
+	if nodeStoreStatus.HostsPerVirtualNode != testCase0.HostsPerVirtualNode {
+		t.Error("nodeStoreStatus.HostsPerVirtualNode is : ", nodeStoreStatus.HostsPerVirtualNode)
+		t.Error("testCases0.HostsPerVirtualNode      is : ", testCase0.HostsPerVirtualNode)
+	}
+
+	if nodeStoreStatus.VirtualNodeNum != testCase0.VirtualNodeNum {
+		t.Error("nodeStoreStatus.VirtualNodeNum is : ", nodeStoreStatus.VirtualNodeNum)
+		t.Error("testCases0.VirtualNodeNum      is : ", testCase0.VirtualNodeNum)
 	}
 
 	if nodeStoreStatus.CurrentResourceVerions[testLocation] != testCase0.CurrentResourceVerions[testLocation] {
@@ -162,6 +168,64 @@ func TestPersistNodeStoreStatus(t *testing.T) {
 	}
 }
 
+// Simply Test Persist Watch Cursors, and Get Watch Cursors not persisted
+//
+func TestPersistWatchCursors(t *testing.T) {
+	testLocation := types.RvLocation{Region: location.Beijing, Partition: location.ResourcePartition1}
+	testCase0 := &store.WatchCursors{
+		RegionUrl:        "localhost:9119",
+		ResourceVersions: types.TransitResourceVersionMap{testLocation: 1000},
+	}
+
+	success := GR.PersistWatchCursors(testCase0)
+	assert.True(t, success)
+
+	watchCursors, err := GR.GetWatchCursors(testCase0.RegionUrl)
+	assert.Nil(t, err)
+	assert.Equal(t, testCase0, watchCursors)
+
+	watchCursors, err = GR.GetWatchCursors("localhost:9120")
+	assert.Nil(t, watchCursors)
+	assert.Equal(t, types.Error_ObjectNotFound, err)
+}
+
+// Simply Test Delete Watch Cursors
+//
+func TestDeleteWatchCursors(t *testing.T) {
+	testLocation := types.RvLocation{Region: location.Beijing, Partition: location.ResourcePartition1}
+	testCase0 := &store.WatchCursors{
+		RegionUrl:        "localhost:9121",
+		ResourceVersions: types.TransitResourceVersionMap{testLocation: 1000},
+	}
+
+	assert.True(t, GR.PersistWatchCursors(testCase0))
+	assert.Nil(t, GR.DeleteWatchCursors(testCase0.RegionUrl))
+
+	watchCursors, err := GR.GetWatchCursors(testCase0.RegionUrl)
+	assert.Nil(t, watchCursors)
+	assert.Equal(t, types.Error_ObjectNotFound, err)
+}
+
+// Simply Test Delete Logical Nodes
+//
+func TestDeleteNodes(t *testing.T) {
+	testCase0 := &types.LogicalNode{
+		Id:              "0003",
+		ResourceVersion: "0004",
+		GeoInfo: types.NodeGeoInfo{
+			Region:            1000,
+			ResourcePartition: 1000,
+		},
+	}
+
+	assert.True(t, GR.PersistNodes([]*types.LogicalNode{testCase0}))
+	assert.True(t, GR.DeleteNodes([]*types.LogicalNode{testCase0}))
+
+	for _, logicalNode := range GR.GetNodes() {
+		assert.NotEqual(t, testCase0.Id, logicalNode.Id)
+	}
+}
+
 // Simply Test Persist Virtual Nodes Assignments
 //
 func TestPersistVirtualNodesAssignments(t *testing.T) {
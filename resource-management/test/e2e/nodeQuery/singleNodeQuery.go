@@ -28,6 +28,7 @@ import (
 	"k8s.io/klog/v2"
 
 	"global-resource-service/resource-management/pkg/clientSdk/rmsclient"
+	"global-resource-service/resource-management/pkg/common-lib/tlsconfig"
 	"global-resource-service/resource-management/pkg/common-lib/types"
 	"global-resource-service/resource-management/pkg/common-lib/types/location"
 	"global-resource-service/resource-management/pkg/store/redis"
@@ -48,8 +49,13 @@ func main() {
 
 	testCfg := testConfig{}
 	cfg := rmsclient.Config{}
+	tlsOpts := tlsconfig.Options{}
 
 	flag.StringVar(&cfg.ServiceUrl, "service_url", "localhost:8080", "Service IP address, if not set, default to localhost")
+	flag.StringVar(&cfg.AdminToken, "admin_token", "", "Admin bearer token to register client, required if the service has authentication enabled")
+	flag.StringVar(&tlsOpts.CAFile, "ca_file", "", "The only CA trusted to verify the service, connect with HTTPS if set")
+	flag.StringVar(&tlsOpts.CertFile, "client_cert_file", "", "Client certificate file if the service requires client certificates")
+	flag.StringVar(&tlsOpts.KeyFile, "client_key_file", "", "Client private key file")
 	flag.DurationVar(&cfg.RequestTimeout, "request_timeout", 30*time.Minute, "Timeout for client requests and responses")
 	flag.DurationVar(&testCfg.testDuration, "test_duration", 30*time.Minute, "Test duration, measured by number minutes of watch of node changes. default 10 minutes")
 	flag.IntVar(&testCfg.singleNodeNum, "single_node_num", 1, "Number of single node set requested from redis, default to 1")
@@ -65,6 +71,15 @@ func main() {
 	klog.StartFlushDaemon(time.Second * 1)
 	defer klog.Flush()
 
+	if tlsOpts.IsClientEnabled() {
+		tlsConfig, err := tlsconfig.NewClientTLSConfig(tlsOpts)
+		if err != nil {
+			klog.Errorf("failed to create TLS config. error %v", err)
+			os.Exit(1)
+		}
+		cfg.TLSConfig = tlsConfig
+	}
+
 	//there is two test model:
 	//1. singel node per query per second
 	//2. batch nodes query every minuute.
@@ -29,6 +29,8 @@ import (
 	"global-resource-service/resource-management/pkg/clientSdk/rmsclient"
 	"global-resource-service/resource-management/pkg/clientSdk/tools/cache"
 	utilruntime "global-resource-service/resource-management/pkg/clientSdk/util/runtime"
+	"global-resource-service/resource-management/pkg/common-lib/metrics"
+	"global-resource-service/resource-management/pkg/common-lib/tlsconfig"
 	"global-resource-service/resource-management/pkg/common-lib/types"
 	"global-resource-service/resource-management/pkg/common-lib/types/runtime"
 	"global-resource-service/resource-management/test/e2e/stats"
@@ -41,20 +43,34 @@ const (
 )
 
 type testConfig struct {
-	testDuration time.Duration
-	action       string
-	repeats      int
+	testDuration          time.Duration
+	action                string
+	repeats               int
+	statsSnapshotDir      string
+	statsSnapshotInterval time.Duration
+	traceSpanFile         string
 }
 
+// watch stats are updated under lock only if snapshots are taken during the watch
+var isStatsSnapshotEnabled = false
+
+// spans of traced events are exported to file if set
+var spanExporter *metrics.SpanFileExporter
+
 func main() {
 	flag.Usage = printUsage
 
 	testCfg := testConfig{}
 	cfg := rmsclient.Config{}
+	tlsOpts := tlsconfig.Options{}
 	listOpts := rmsclient.ListOptions{}
 	var regions string
 
 	flag.StringVar(&cfg.ServiceUrl, "service_url", "localhost:8080", "Service IP address, if not set, default to localhost")
+	flag.StringVar(&cfg.AdminToken, "admin_token", "", "Admin bearer token to register client, required if the service has authentication enabled")
+	flag.StringVar(&tlsOpts.CAFile, "ca_file", "", "The only CA trusted to verify the service, connect with HTTPS if set")
+	flag.StringVar(&tlsOpts.CertFile, "client_cert_file", "", "Client certificate file if the service requires client certificates")
+	flag.StringVar(&tlsOpts.KeyFile, "client_key_file", "", "Client private key file")
 	flag.DurationVar(&cfg.RequestTimeout, "request_timeout", 30*time.Minute, "Timeout for client requests and responses")
 	flag.StringVar(&cfg.ClientFriendlyName, "friendly_name", "testclient", "Client friendly name other that the assigned Id")
 	flag.StringVar(&cfg.ClientRegion, "client_region", "Beijing", "Client identify where it is located")
@@ -65,6 +81,9 @@ func main() {
 	flag.StringVar(&testCfg.action, "action", "", "action to perform, can be register list or watch, default to register-list-watch")
 	flag.IntVar(&testCfg.repeats, "repeats", 1, "number of repeats of the action, default to 1")
 	flag.IntVar(&listOpts.Limit, "limit", 25000, "limit for list nodes, default to 25000")
+	flag.StringVar(&testCfg.statsSnapshotDir, "stats_snapshot_dir", "", "Directory to write JSON snapshots of the test stats, disabled if not set")
+	flag.DurationVar(&testCfg.statsSnapshotInterval, "stats_snapshot_interval", time.Minute, "Interval to write JSON snapshots of the test stats, default 1m")
+	flag.StringVar(&testCfg.traceSpanFile, "trace_span_file", "", "File to write spans of traced watch events as JSON lines, disabled if not set")
 
 	if !flag.Parsed() {
 		klog.InitFlags(nil)
@@ -73,6 +92,30 @@ func main() {
 	klog.StartFlushDaemon(time.Second * 1)
 	defer klog.Flush()
 
+	if testCfg.statsSnapshotDir != "" && testCfg.statsSnapshotInterval <= 0 {
+		klog.Errorf("stats_snapshot_interval %v is invalid, must be positive", testCfg.statsSnapshotInterval)
+		os.Exit(1)
+	}
+
+	if tlsOpts.IsClientEnabled() {
+		tlsConfig, err := tlsconfig.NewClientTLSConfig(tlsOpts)
+		if err != nil {
+			klog.Errorf("failed to create TLS config. error %v", err)
+			os.Exit(1)
+		}
+		cfg.TLSConfig = tlsConfig
+	}
+
+	if testCfg.traceSpanFile != "" {
+		exporter, err := metrics.NewSpanFileExporter(testCfg.traceSpanFile)
+		if err != nil {
+			klog.Errorf("failed to create trace span file. error %v", err)
+			os.Exit(1)
+		}
+		spanExporter = exporter
+		defer spanExporter.Close()
+	}
+
 	cfg.InitialRequestRegions = strings.Split(regions, ",")
 	client := rmsclient.NewRmsClient(cfg)
 
@@ -100,6 +143,24 @@ func main() {
 		}
 	}
 
+	takeSnapshot := func() *metrics.Snapshot {
+		s := metrics.NewSnapshot("e2e")
+		registerStats.AddToSnapshot(s)
+		listStats.AddToSnapshot(s)
+		watchStats.AddToSnapshot(s)
+		return s
+	}
+	if testCfg.statsSnapshotDir != "" {
+		isStatsSnapshotEnabled = true
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		go metrics.RunSnapshotWriter(testCfg.statsSnapshotDir, testCfg.statsSnapshotInterval, takeSnapshot, stopCh)
+		// final snapshot once the test is done
+		defer func() {
+			writeStatsSnapshot(testCfg.statsSnapshotDir, takeSnapshot())
+		}()
+	}
+
 	switch testCfg.action {
 	case register:
 		for i := 0; i < testCfg.repeats; i++ {
@@ -163,7 +224,7 @@ func registerClient(client rmsclient.RmsInterface, registerStats *stats.Register
 	}
 	klog.V(6).Infof("Got client registration from service: %v", registrationResp)
 
-	registerStats.RegisterClientDuration = end.Sub(start)
+	registerStats.SetDuration(end.Sub(start))
 	return registrationResp.ClientId
 }
 
@@ -188,8 +249,7 @@ func listNodes(client rmsclient.RmsInterface, clientId string, store cache.Store
 		store.Add(*node)
 	}
 
-	listStats.ListDuration = end.Sub(start)
-	listStats.NumberOfNodesListed = len(nodeList)
+	listStats.SetResult(end.Sub(start), len(nodeList))
 	return crv
 }
 
@@ -225,8 +285,14 @@ func watchNodes(client rmsclient.RmsInterface, clientId string, crv types.Transi
 				}
 				currentTime := time.Now().UTC()
 				watchDelay := currentTime.Sub(record.Node.LastUpdatedTime)
+				if isStatsSnapshotEnabled {
+					watchStats.WatchDelayLock.Lock()
+				}
 				addWatchLatency(watchDelay, watchStats)
 				logIfProlonged(&record, watchDelay, watchStats)
+				if record.Trace != nil {
+					addTrace(record.Trace.WithHops(runtime.TraceHop{Name: runtime.TraceHop_ClientReceived, Time: currentTime}), watchStats)
+				}
 
 				if hasRegionToWatch {
 					if _, isOK := regionsToWatch[record.Node.GeoInfo.Region]; isOK {
@@ -254,13 +320,18 @@ func watchNodes(client rmsclient.RmsInterface, clientId string, crv types.Transi
 				default:
 					klog.Error("not supported event type")
 				}
+				if isStatsSnapshotEnabled {
+					watchStats.WatchDelayLock.Unlock()
+				}
 
 			}
 		}
 	}()
 	wg.Wait()
 	end = time.Now().UTC()
+	watchStats.WatchDelayLock.Lock()
 	watchStats.WatchDuration = end.Sub(start)
+	watchStats.WatchDelayLock.Unlock()
 	if hasRegionToWatch {
 		regionWatchDuration := regionWatchEnd.Sub(*regionWatchStart)
 		klog.Infof("[Throughput] Time to get last event from region %v: %v. Duration %v. Event count %v", regionsToWatch, regionWatchEnd, regionWatchDuration, regionEventCount)
@@ -272,11 +343,21 @@ func addWatchLatency(delay time.Duration, ws *stats.WatchStats) {
 	// Current watch latency is only summarized once. Remove lock/unlock for latency record per event to minimize performance impact
 	// See PR 111.
 	// If later we need to call ws.GetSummary() multiple times, lock needs to be added back.
+	// Caller holds the lock if stats snapshots are taken during the watch.
 	//ws.WatchDelayLock.Lock()
 	ws.WatchDelayPerEvent.AddLatencyMetrics(delay)
 	//ws.WatchDelayLock.Unlock()
 }
 
+func addTrace(trace *runtime.TraceContext, ws *stats.WatchStats) {
+	ws.AddTrace(trace)
+	if spanExporter != nil {
+		if err := spanExporter.Export(trace.GetSpans()); err != nil {
+			klog.Errorf("failed export spans of trace %s. error %v", trace.TraceId, err)
+		}
+	}
+}
+
 func logIfProlonged(record *runtime.NodeEvent, delay time.Duration, ws *stats.WatchStats) {
 	if delay > stats.LongWatchThreshold {
 		klog.Warningf("Prolonged watch node from server: %v with time (%v)", record.Node.Id, delay)
@@ -284,6 +365,15 @@ func logIfProlonged(record *runtime.NodeEvent, delay time.Duration, ws *stats.Wa
 	}
 }
 
+func writeStatsSnapshot(dir string, s *metrics.Snapshot) {
+	file, err := metrics.WriteSnapshot(dir, s)
+	if err != nil {
+		klog.Errorf("failed write stats snapshot to %s. error %v", dir, err)
+		return
+	}
+	klog.Infof("Stats snapshot written to %s", file)
+}
+
 func printTestStats(rs *stats.RegisterClientStats, ls *stats.ListStats, ws *stats.WatchStats) {
 	rs.PrintStats()
 	ls.PrintStats()
@@ -24,6 +24,7 @@ import (
 
 	"global-resource-service/resource-management/pkg/common-lib/metrics"
 	"global-resource-service/resource-management/pkg/common-lib/types"
+	"global-resource-service/resource-management/pkg/common-lib/types/runtime"
 )
 
 const (
@@ -34,6 +35,8 @@ const (
 
 type RegisterClientStats struct {
 	RegisterClientDuration time.Duration
+	// guards the stats written by the test while snapshots are taken
+	lock sync.Mutex
 }
 
 func NewRegisterClientStats() *RegisterClientStats {
@@ -44,9 +47,24 @@ func (rs *RegisterClientStats) PrintStats() {
 	klog.Infof("[Metrics][Register]RegisterClientDuration: %v", rs.RegisterClientDuration)
 }
 
+// SetDuration records the duration of client registration
+func (rs *RegisterClientStats) SetDuration(duration time.Duration) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.RegisterClientDuration = duration
+}
+
+func (rs *RegisterClientStats) AddToSnapshot(s *metrics.Snapshot) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	s.AddDuration("register/duration", rs.RegisterClientDuration)
+}
+
 type ListStats struct {
 	ListDuration        time.Duration
 	NumberOfNodesListed int
+	// guards the stats written by the test while snapshots are taken
+	lock sync.Mutex
 }
 
 func NewListStats() *ListStats {
@@ -57,6 +75,21 @@ func (ls *ListStats) PrintStats() {
 	klog.Infof("[Metrics][List]ListDuration: %v. Number of nodes listed: %v", ls.ListDuration, ls.NumberOfNodesListed)
 }
 
+// SetResult records the duration and the number of nodes of a list
+func (ls *ListStats) SetResult(duration time.Duration, nodeNum int) {
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+	ls.ListDuration = duration
+	ls.NumberOfNodesListed = nodeNum
+}
+
+func (ls *ListStats) AddToSnapshot(s *metrics.Snapshot) {
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+	s.AddDuration("list/duration", ls.ListDuration)
+	s.AddCount("list/nodes", ls.NumberOfNodesListed)
+}
+
 type WatchStats struct {
 	WatchDuration            time.Duration
 	NumberOfProlongedItems   int
@@ -66,10 +99,29 @@ type WatchStats struct {
 	NumberOfProlongedWatches int
 	WatchDelayPerEvent       *metrics.LatencyMetrics
 	WatchDelayLock           sync.RWMutex
+	// latency from the origin to each hop of traced events, by hop name
+	TraceHopLatency map[string]*metrics.LatencyMetrics
+	traceHopNames   []string
 }
 
 func NewWatchStats() *WatchStats {
-	return &WatchStats{WatchDelayPerEvent: metrics.NewLatencyMetrics(0)} // only one data point
+	return &WatchStats{
+		WatchDelayPerEvent: metrics.NewLatencyMetrics(0), // only one data point
+		TraceHopLatency:    make(map[string]*metrics.LatencyMetrics),
+	}
+}
+
+// AddTrace records the timeline of a traced event, hops are reported in the order first seen
+func (ws *WatchStats) AddTrace(trace *runtime.TraceContext) {
+	for _, hop := range trace.Hops {
+		latency, isOK := ws.TraceHopLatency[hop.Name]
+		if !isOK {
+			latency = metrics.NewLatencyMetrics(0)
+			ws.TraceHopLatency[hop.Name] = latency
+			ws.traceHopNames = append(ws.traceHopNames, hop.Name)
+		}
+		latency.AddLatencyMetrics(hop.Time.Sub(trace.OriginTime))
+	}
 }
 
 func (ws *WatchStats) PrintStats() {
@@ -80,6 +132,28 @@ func (ws *WatchStats) PrintStats() {
 	ws.WatchDelayLock.RUnlock()
 	klog.Infof("[Metrics][Watch] perc50 %v, perc90 %v, perc99 %v. Total count %v",
 		watchDelaySummary.P50, watchDelaySummary.P90, watchDelaySummary.P99, watchDelaySummary.TotalCount)
+	for _, hopName := range ws.traceHopNames {
+		hopSummary := ws.TraceHopLatency[hopName].GetSummary()
+		klog.Infof("[Metrics][Trace][%s] perc50 %v, perc90 %v, perc99 %v. Total count %v",
+			hopName, hopSummary.P50, hopSummary.P90, hopSummary.P99, hopSummary.TotalCount)
+	}
+}
+
+// AddToSnapshot adds watch stats to the snapshot, callers updating the stats during the watch need to hold WatchDelayLock
+func (ws *WatchStats) AddToSnapshot(s *metrics.Snapshot) {
+	ws.WatchDelayLock.Lock()
+	defer ws.WatchDelayLock.Unlock()
+	s.AddLatency("watch/delay_per_event", ws.WatchDelayPerEvent.GetSummary())
+	if ws.WatchDuration > 0 {
+		s.AddDuration("watch/duration", ws.WatchDuration)
+	}
+	s.AddCount("watch/added_nodes", ws.NumberOfAddedNodes)
+	s.AddCount("watch/updated_nodes", ws.NumberOfUpdatedNodes)
+	s.AddCount("watch/deleted_nodes", ws.NumberOfDeletedNodes)
+	s.AddCount("watch/prolonged_items", ws.NumberOfProlongedItems)
+	for _, hopName := range ws.traceHopNames {
+		s.AddLatency("trace/"+hopName, ws.TraceHopLatency[hopName].GetSummary())
+	}
 }
 
 type groupByRp map[types.ResourcePartitionName]int
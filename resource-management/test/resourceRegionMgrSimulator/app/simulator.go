@@ -26,6 +26,7 @@ import (
 	"github.com/gorilla/mux"
 	"k8s.io/klog/v2"
 
+	"global-resource-service/resource-management/pkg/common-lib/tlsconfig"
 	"global-resource-service/resource-management/test/resourceRegionMgrSimulator/handlers"
 )
 
@@ -37,6 +38,8 @@ type RegionConfig struct {
 	MasterPort            string
 	DataPattern           string
 	WaitTimeForDataChangePattern int
+	// simulator serves HTTPS if the server certificate is set
+	TLS tlsconfig.Options
 }
 
 func Run(c *RegionConfig) error {
@@ -70,11 +73,24 @@ func Run(c *RegionConfig) error {
 		ReadTimeout:  30 * time.Minute,
 		WriteTimeout: 30 * time.Minute,
 	}
+	if c.TLS.IsServerEnabled() {
+		tlsConfig, err := tlsconfig.NewServerTLSConfig(c.TLS)
+		if err != nil {
+			return err
+		}
+		s.TLSConfig = tlsConfig
+	}
 
 	go func() {
 		klog.V(3).Infof("\nStarting resource region manager simulator server on port (%v)", c.MasterPort)
 
-		err := s.ListenAndServe()
+		var err error
+		if s.TLSConfig != nil {
+			klog.V(3).Infof("Serving HTTPS, client certificate required: %v", c.TLS.RequireClientCert)
+			err = s.ListenAndServeTLS("", "")
+		} else {
+			err = s.ListenAndServe()
+		}
 		if err != nil {
 			klog.Errorf("The HTTP server is not gracefully shutdown : ", err)
 		}
@@ -17,3 +17,6 @@ limitations under the License.
 package config
 
 var RegionId, RpNum, NodesPerRP int
+
+// IsTraceEnabled is whether modified node events are traced from the simulator
+var IsTraceEnabled bool
@@ -17,7 +17,10 @@ limitations under the License.
 package data
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"math/rand"
 	"strconv"
 	"time"
@@ -42,6 +45,12 @@ var RegionNodeEventsList simulatorTypes.RegionNodeEvents
 var RegionNodeEventQueue *cache.EventQueuesByLocation
 var CurrentRVs types.TransitResourceVersionMap
 
+// PartitionNodeEventQueues - node events of each RP, for watches of a single RP
+var PartitionNodeEventQueues map[location.ResourcePartition]*cache.EventQueuesByLocation
+
+var Error_PartitionNotFound = errors.New("Resource partition not found")
+var Error_InvalidContinueToken = errors.New("Invalid continue token")
+
 // The constants are for repeatly generate new modified events
 // Outage pattern - one RP down
 
@@ -57,6 +66,10 @@ func Init(regionName string, rpNum, nodesPerRP int) {
 	config.NodesPerRP = nodesPerRP
 
 	RegionNodeEventQueue = cache.NewEventQueuesByLocation()
+	PartitionNodeEventQueues = make(map[location.ResourcePartition]*cache.EventQueuesByLocation, rpNum)
+	for j := 0; j < rpNum; j++ {
+		PartitionNodeEventQueues[location.ResourcePartitions[j]] = cache.NewEventQueuesByLocation()
+	}
 	RegionNodeEventsList, CurrentRVs = generateAddedNodeEvents(regionName, rpNum, nodesPerRP)
 }
 
@@ -124,10 +137,111 @@ func ListNodes() (simulatorTypes.RegionNodeEvents, uint64, types.TransitResource
 
 }
 
-// Return region node modified events with CRVs in BATCH LENGTH from all RPs
+// listContinue is the position of the next page of a paged list, and the resource versions at the first page
+type listContinue struct {
+	ResourceVersions types.TransitResourceVersionMap `json:"resource_versions"`
+	PartitionIndex   int                             `json:"partition_index"`
+	NodeIndex        int                             `json:"node_index"`
+}
+
+func (c *listContinue) encode() (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeListContinue(token string) (*listContinue, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", Error_InvalidContinueToken, err)
+	}
+	c := &listContinue{}
+	if err = json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("%w: %v", Error_InvalidContinueToken, err)
+	}
+	return c, nil
+}
+
+// Return up to limit region node added events, all if limit is not positive, of all RPs or of the RP of partitionName only,
+// from the position of the continue token, or from the first node if empty, and the continue token of the next page, empty at the last page
+// Each page returns the resource versions of the listed RPs at the first page, so that watch from them gets all node changes since the list started
+// Nodes changed after the list started are returned with the changes, which are also sent to watch
+//
+func ListNodesPage(partitionName string, limit int, continueToken string) (simulatorTypes.RegionNodeEvents, uint64, types.TransitResourceVersionMap, string, error) {
+	firstRP, endRP := 0, config.RpNum
+	if partitionName != "" {
+		partition, err := location.GetPartitionFromPartitionName(partitionName)
+		if err != nil || int(partition) < 0 || int(partition) >= config.RpNum {
+			return nil, 0, nil, "", fmt.Errorf("%w: %s", Error_PartitionNotFound, partitionName)
+		}
+		firstRP, endRP = int(partition), int(partition)+1
+	}
+	if limit <= 0 {
+		limit = (endRP - firstRP) * config.NodesPerRP
+	}
+
+	RegionNodeEventQueue.AcquireSnapshotRLock()
+	defer RegionNodeEventQueue.ReleaseSnapshotRLock()
+
+	position := &listContinue{PartitionIndex: firstRP}
+	if continueToken == "" {
+		position.ResourceVersions = make(types.TransitResourceVersionMap)
+		for loc, rv := range CurrentRVs {
+			if int(loc.Partition) >= firstRP && int(loc.Partition) < endRP {
+				position.ResourceVersions[loc] = rv
+			}
+		}
+	} else {
+		var err error
+		if position, err = decodeListContinue(continueToken); err != nil {
+			return nil, 0, nil, "", err
+		}
+		if position.PartitionIndex < firstRP || position.PartitionIndex >= endRP || position.NodeIndex < 0 || position.NodeIndex >= config.NodesPerRP {
+			return nil, 0, nil, "", fmt.Errorf("%w: position out of range", Error_InvalidContinueToken)
+		}
+	}
+
+	nodeEventsByRP := make(simulatorTypes.RegionNodeEvents, 0)
+	count := 0
+	i, j := position.PartitionIndex, position.NodeIndex
+	for ; i < endRP && count < limit; i, j = i+1, 0 {
+		pageSize := config.NodesPerRP - j
+		if pageSize > limit-count {
+			pageSize = limit - count
+		}
+		nodeEvents := make([]*runtime.NodeEvent, pageSize)
+		for k := 0; k < pageSize; k++ {
+			node := RegionNodeEventsList[i][j+k].Node.Copy()
+			nodeEvents[k] = runtime.NewNodeEvent(node, runtime.Added)
+		}
+		nodeEventsByRP = append(nodeEventsByRP, nodeEvents)
+		count += pageSize
+		if j+pageSize < config.NodesPerRP {
+			// page ends in the middle of the RP
+			j += pageSize
+			break
+		}
+	}
+
+	nextToken := ""
+	if i < endRP {
+		next := &listContinue{ResourceVersions: position.ResourceVersions, PartitionIndex: i, NodeIndex: j}
+		var err error
+		if nextToken, err = next.encode(); err != nil {
+			return nil, 0, nil, "", err
+		}
+	}
+	klog.V(6).Infof("Listed page of (%v) nodes in (%v) RPs, has next page: %v", count, len(nodeEventsByRP), nextToken != "")
+	return nodeEventsByRP, uint64(count), position.ResourceVersions.Copy(), nextToken, nil
+}
+
+// Return region node modified events with CRVs in BATCH LENGTH from all RPs,
+// or from the RP of partitionName only if it is not empty
 // TO DO: paginate support
 //
-func Watch(rvs types.TransitResourceVersionMap, watchChan chan runtime.Object, stopCh chan struct{}) error {
+func Watch(rvs types.TransitResourceVersionMap, partitionName string, watchChan chan runtime.Object, stopCh chan struct{}) error {
 	if rvs == nil {
 		return errors.New("Invalid resource versions: nil")
 	}
@@ -138,8 +252,37 @@ func Watch(rvs types.TransitResourceVersionMap, watchChan chan runtime.Object, s
 		return errors.New("Stop watch channel not provided")
 	}
 
+	eventQueue := RegionNodeEventQueue
+	if partitionName != "" {
+		partition, err := location.GetPartitionFromPartitionName(partitionName)
+		if err != nil {
+			return fmt.Errorf("%w: %s", Error_PartitionNotFound, partitionName)
+		}
+		queue, isOK := PartitionNodeEventQueues[partition]
+		if !isOK {
+			return fmt.Errorf("%w: %s", Error_PartitionNotFound, partitionName)
+		}
+		eventQueue = queue
+
+		partitionRvs := make(types.TransitResourceVersionMap)
+		for loc, rv := range rvs {
+			if loc.Partition == partition {
+				partitionRvs[loc] = rv
+			}
+		}
+		rvs = partitionRvs
+	}
+
 	internal_rvs := types.ConvertToInternalResourceVersionMap(rvs)
-	return RegionNodeEventQueue.Watch(internal_rvs, watchChan, stopCh)
+	return eventQueue.Watch(internal_rvs, watchChan, stopCh)
+}
+
+// enqueueNodeEvent adds the node event to the event queues of the region and of its RP
+func enqueueNodeEvent(e *runtime.NodeEvent) {
+	RegionNodeEventQueue.EnqueueEvent(e)
+	if queue, isOK := PartitionNodeEventQueues[e.GetLocation().GetResourcePartition()]; isOK {
+		queue.EnqueueEvent(e)
+	}
 }
 
 ////////////////////////////////////////
@@ -172,7 +315,7 @@ func generateAddedNodeEvents(regionName string, rpNum, nodesPerRP int) (simulato
 			eventsAdd[j][i] = nodeEvent
 
 			// node event enqueue
-			RegionNodeEventQueue.EnqueueEvent(nodeEvent)
+			enqueueNodeEvent(nodeEvent)
 		}
 
 		cvs[rvLoc] = uint64(rvToGenerateRPs)
@@ -205,9 +348,12 @@ func makeRPDown(rpDownNumber int) {
 			node.LastUpdatedTime = time.Now().UTC()
 
 			newEvent := runtime.NewNodeEvent(node, runtime.Modified)
+			if config.IsTraceEnabled {
+				newEvent.Trace = runtime.NewTraceContext(node.LastUpdatedTime)
+			}
 
 			//RegionNodeEventsList[selectedRP][i] = no need: keep event as added, node will be updated as pointer
-			RegionNodeEventQueue.EnqueueEvent(newEvent)
+			enqueueNodeEvent(newEvent)
 
 			rvToGenerateRPs++
 		}
@@ -253,8 +399,11 @@ func makeDataUpdate(changesThreshold int) {
 			node.LastUpdatedTime = time.Now().UTC()
 
 			newEvent := runtime.NewNodeEvent(node, runtime.Modified)
+			if config.IsTraceEnabled {
+				newEvent.Trace = runtime.NewTraceContext(node.LastUpdatedTime)
+			}
 			//RegionNodeEventsList[j][i] = newEvent - no need: keep event as added, node will be updated as pointer
-			RegionNodeEventQueue.EnqueueEvent(newEvent)
+			enqueueNodeEvent(newEvent)
 
 			count++
 			rvToGenerateRPs++
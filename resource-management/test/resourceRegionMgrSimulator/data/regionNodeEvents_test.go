@@ -17,6 +17,7 @@ limitations under the License.
 package data
 
 import (
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"sync"
 	"testing"
@@ -63,7 +64,7 @@ func TestGetRegionNodeModifiedEventsCRV(t *testing.T) {
 	// Watch node events
 	watchCh := make(chan runtime.Object)
 	stopCh := make(chan struct{})
-	err := Watch(rvs, watchCh, stopCh)
+	err := Watch(rvs, "", watchCh, stopCh)
 	if err != nil {
 		assert.Fail(t, "Encountered error while building watch connection.", "Encountered error while building watch connection. Error %v", err)
 		return
@@ -83,7 +84,7 @@ func TestGetRegionNodeModifiedEventsCRV(t *testing.T) {
 	// watch from previous resource versions again
 	watchCh = make(chan runtime.Object)
 	stopCh = make(chan struct{})
-	err = Watch(rvs, watchCh, stopCh)
+	err = Watch(rvs, "", watchCh, stopCh)
 	if err != nil {
 		assert.Fail(t, "Encountered error while building watch connection.", "Encountered error while building watch connection. Error %v", err)
 		return
@@ -103,7 +104,7 @@ func TestGetRegionNodeModifiedEventsCRV(t *testing.T) {
 	// Test RP down event watches
 	watchCh = make(chan runtime.Object)
 	stopCh = make(chan struct{})
-	err = Watch(rvs, watchCh, stopCh)
+	err = Watch(rvs, "", watchCh, stopCh)
 	if err != nil {
 		assert.Fail(t, "Encountered error while building watch connection.", "Encountered error while building watch connection. Error %v", err)
 		return
@@ -142,6 +143,98 @@ func runWatch(t *testing.T, expectedEventCount int, rvs types.TransitResourceVer
 	}(t, expectedEventCount, rvs, watchCh, stopCh, wg)
 }
 
+func TestWatchPartition(t *testing.T) {
+	Init("Beijing", 2, 10)
+	_, _, rvs := ListNodes()
+
+	err := Watch(rvs, "RP3", make(chan runtime.Object), make(chan struct{}))
+	assert.True(t, errors.Is(err, Error_PartitionNotFound))
+
+	watchCh := make(chan runtime.Object, 10)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	assert.Nil(t, Watch(rvs, "RP2", watchCh, stopCh))
+
+	// 2 modified events in each RP
+	makeDataUpdate(4)
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-watchCh:
+			assert.Equal(t, location.ResourcePartition2, location.ResourcePartition(e.GetGeoInfo().ResourcePartition))
+			assert.True(t, e.GetResourceVersionInt64() > 10)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for events of the resource partition")
+		}
+	}
+	select {
+	case e := <-watchCh:
+		assert.Fail(t, "unexpected event", "event of resource partition %v", e.GetGeoInfo().ResourcePartition)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestListNodesPage(t *testing.T) {
+	Init("Beijing", 3, 10)
+	_, _, expectedRvs := ListNodes()
+
+	ids := make(map[string]bool)
+	pageCount := 0
+	continueToken := ""
+	for {
+		nodeEvents, count, rvs, nextToken, err := ListNodesPage("", 7, continueToken)
+		assert.Nil(t, err)
+		assert.Equal(t, expectedRvs, rvs)
+		n := 0
+		for _, events := range nodeEvents {
+			for _, e := range events {
+				ids[e.Node.Id] = true
+				n++
+			}
+		}
+		assert.Equal(t, int(count), n)
+		pageCount++
+		if nextToken == "" {
+			break
+		}
+		assert.Equal(t, 7, n)
+		continueToken = nextToken
+
+		// nodes updated during the list do not change the resource versions of the list
+		makeDataUpdate(3)
+	}
+	assert.Equal(t, 5, pageCount)
+	assert.Equal(t, 30, len(ids))
+
+	_, _, _, _, err := ListNodesPage("", 7, "invalid")
+	assert.True(t, errors.Is(err, Error_InvalidContinueToken))
+}
+
+func TestListNodesPage_Partition(t *testing.T) {
+	Init("Beijing", 3, 10)
+	rp2 := types.RvLocation{Region: location.Beijing, Partition: location.ResourcePartition2}
+
+	nodeEvents, count, rvs, nextToken, err := ListNodesPage("RP2", 0, "")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10), count)
+	assert.Equal(t, "", nextToken)
+	assert.Equal(t, types.TransitResourceVersionMap{rp2: 10}, rvs)
+	for _, e := range nodeEvents[0] {
+		assert.Equal(t, location.ResourcePartition2, location.ResourcePartition(e.Node.GeoInfo.ResourcePartition))
+	}
+
+	// continue token of the partition only
+	_, count, _, nextToken, err = ListNodesPage("RP2", 6, "")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(6), count)
+	_, count, _, nextToken, err = ListNodesPage("RP2", 6, nextToken)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4), count)
+	assert.Equal(t, "", nextToken)
+
+	_, _, _, _, err = ListNodesPage("RP4", 0, "")
+	assert.True(t, errors.Is(err, Error_PartitionNotFound))
+}
+
 func TestMakeRPDownPerformance(t *testing.T) {
 	// create nodes
 	rpNum := 40
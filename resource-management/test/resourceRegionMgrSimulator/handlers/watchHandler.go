@@ -20,9 +20,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"k8s.io/klog/v2"
 	"net/http"
+	"strconv"
+	"time"
 
 	"global-resource-service/resource-management/pkg/common-lib/types"
 	"global-resource-service/resource-management/pkg/common-lib/types/runtime"
@@ -32,6 +35,9 @@ import (
 	simulatorTypes "global-resource-service/resource-management/test/resourceRegionMgrSimulator/types"
 )
 
+// bookmarks are sent on watches at this interval, so that the aggregator knows the region manager is alive when no node changes
+const watchBookmarkInterval = 30 * time.Second
+
 type WatchHandler struct{}
 
 func NewWatchHandler() *WatchHandler {
@@ -66,8 +72,50 @@ func (w *WatchHandler) ResourceHandler(resp http.ResponseWriter, req *http.Reque
 
 }
 
+// list returns all nodes, or a page of nodes if limit is set, of all RPs or of the RP of the partition parameter
+// Following pages are requested with the continue token of the previous page
+//
 func (w *WatchHandler) list(resp http.ResponseWriter, req *http.Request) {
-	nodeEvents, count, _ := data.ListNodes()
+	limit := 0
+	if limitParam := req.URL.Query().Get(ep.ListLimitParameter); limitParam != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitParam); err != nil || limit < 0 {
+			klog.Errorf("Invalid list limit %v", limitParam)
+			resp.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	continueToken := req.URL.Query().Get(ep.ListContinueParameter)
+	partitionName := req.URL.Query().Get(ep.ResourcePartitionParameter)
+	if limit == 0 && continueToken != "" {
+		klog.Errorf("List limit is required with continue token")
+		resp.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var nodeEvents simulatorTypes.RegionNodeEvents
+	var count uint64
+	var rvs types.TransitResourceVersionMap
+	nextToken := ""
+	if limit == 0 && partitionName == "" {
+		nodeEvents, count, rvs = data.ListNodes()
+	} else {
+		var err error
+		nodeEvents, count, rvs, nextToken, err = data.ListNodesPage(partitionName, limit, continueToken)
+		if err != nil {
+			klog.Errorf("Failed to list page of nodes. Error %v", err)
+			if errors.Is(err, data.Error_InvalidContinueToken) {
+				resp.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, data.Error_PartitionNotFound) {
+				resp.WriteHeader(http.StatusNotFound)
+				return
+			}
+			resp.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
 
 	if count == 0 {
 		klog.V(6).Info("Pulling Region Node Events with batch is in the end")
@@ -77,8 +125,9 @@ func (w *WatchHandler) list(resp http.ResponseWriter, req *http.Request) {
 
 	response := &simulatorTypes.ResponseFromRRM{
 		RegionNodeEvents: nodeEvents,
-		RvMap:            nil,
+		RvMap:            rvs,
 		Length:           uint64(count),
+		Continue:         nextToken,
 	}
 
 	// Serialize region node events result to JSON
@@ -114,11 +163,20 @@ func (w *WatchHandler) serverWatch(resp http.ResponseWriter, req *http.Request,
 
 	klog.V(9).Infof("Received CRV: %v", crvMap)
 
-	// start the watcher
-	klog.V(3).Infof("Start watching resource changes for client: %v", clientId)
-	err = data.Watch(crvMap, watchCh, stopCh)
+	// start the watcher, of all resource partitions if not filtered
+	partitionName := req.URL.Query().Get(ep.ResourcePartitionParameter)
+	klog.V(3).Infof("Start watching resource changes for client: %v, resource partition: %v", clientId, partitionName)
+	err = data.Watch(crvMap, partitionName, watchCh, stopCh)
 	if err != nil {
 		klog.Errorf("unable to start the watcher. Error %v", err)
+		if errors.Is(err, types.Error_ResourceVersionExpired) {
+			resp.WriteHeader(http.StatusGone)
+			return
+		}
+		if errors.Is(err, data.Error_PartitionNotFound) {
+			resp.WriteHeader(http.StatusNotFound)
+			return
+		}
 		resp.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -140,10 +198,18 @@ func (w *WatchHandler) serverWatch(resp http.ResponseWriter, req *http.Request,
 	klog.V(3).Infof("Start processing watch event for client: %v", clientId)
 	i := 0
 	flushBatchSize := 10 // optimized for daily change pattern
+	bookmarkTicker := time.NewTicker(watchBookmarkInterval)
+	defer bookmarkTicker.Stop()
 	for {
 		select {
 		case <-done:
 			return
+		case <-bookmarkTicker.C:
+			if err := json.NewEncoder(resp).Encode(runtime.NewNodeEvent(&types.LogicalNode{}, runtime.Bookmark)); err != nil {
+				klog.Errorf("encoding bookmark failed. error %v", err)
+				return
+			}
+			flusher.Flush()
 		case record, ok := <-watchCh:
 			if !ok {
 				// End of results.
@@ -153,7 +219,11 @@ func (w *WatchHandler) serverWatch(resp http.ResponseWriter, req *http.Request,
 
 			klog.V(6).Infof("Getting event from resource providers, node Id: %v", record.GetId())
 
-			if err := json.NewEncoder(resp).Encode(record.GetEvent()); err != nil {
+			event := record.GetEvent()
+			if nodeEvent, isOK := event.(*runtime.NodeEvent); isOK && nodeEvent.Trace != nil {
+				event = nodeEvent.WithTraceHops(runtime.TraceHop{Name: runtime.TraceHop_RegionManagerSent, Time: time.Now().UTC()})
+			}
+			if err := json.NewEncoder(resp).Encode(event); err != nil {
 				klog.Errorf("encoding record failed. error %v", err)
 				resp.WriteHeader(http.StatusInternalServerError)
 				return
@@ -25,6 +25,7 @@ import (
 	"k8s.io/klog/v2"
 
 	"global-resource-service/resource-management/test/resourceRegionMgrSimulator/app"
+	"global-resource-service/resource-management/test/resourceRegionMgrSimulator/config"
 	"global-resource-service/resource-management/test/resourceRegionMgrSimulator/data"
 )
 
@@ -40,6 +41,11 @@ func main() {
 	flag.IntVar(&c.RPDownNumber, "rp_down_number", 1, "The number of RPs to be pull down, needs to be <= rp_num")
 	flag.StringVar(&c.MasterPort, "master_port", "9119", "Service port, if not set, default to 9119")
 	flag.StringVar(&c.DataPattern, "data_pattern", "Outage", "Simulator data pattern, if not set, default to Outage Mode")
+	flag.StringVar(&c.TLS.CertFile, "tls_cert_file", "", "Server certificate file, simulator serves HTTPS if set with tls_key_file")
+	flag.StringVar(&c.TLS.KeyFile, "tls_key_file", "", "Server private key file")
+	flag.StringVar(&c.TLS.CAFile, "tls_client_ca_file", "", "CA file to verify client certificates, which are optional unless tls_require_client_cert is set")
+	flag.BoolVar(&c.TLS.RequireClientCert, "tls_require_client_cert", false, "Require client certificates signed by tls_client_ca_file, default false")
+	flag.BoolVar(&config.IsTraceEnabled, "enable_trace", false, "Flag for if modified node events carry trace context to watch clients. default is disabled")
 	flag.IntVar(&c.WaitTimeForDataChangePattern, "wait_time_for_data_change_pattern", 5, "Wait time for Outage or Daily pattern, if not set, default to 5")
 
 	if !flag.Parsed() {
@@ -101,6 +107,7 @@ func printUsage() {
 	fmt.Println("\nUsage: Region Resource Manager Simulator")
 	fmt.Println("\n Per region config options: --region_name=<region name> --rp_num=<number of rp> --nodes_per_rp=<number of nodes> --rp_down_number=<number of RP to pull down> --master_port=<port> --data_pattern=<outage or daily> --wait_time_for_data_change_pattern=<number of minutes>")
 	fmt.Println("\n       Per region config options: --region_name=<region name>  --rp_num=<number of rp>  --nodes_per_rp=<number of nodes> --master_port=<port> --data_pattern=<outage or daily> --wait_time_for_data_change_pattern=<number of minutes>")
+	fmt.Println("\n TLS options: --tls_cert_file=<file> --tls_key_file=<file> --tls_client_ca_file=<file> --tls_require_client_cert=true")
 	fmt.Println()
 
 	os.Exit(0)
@@ -30,10 +30,13 @@ type PostCRVstatus bool
 
 // RRM: Resource Region Manager
 //
+// Continue is the token to list the next page, empty at the last page
+//
 type ResponseFromRRM struct {
 	RegionNodeEvents [][]*runtime.NodeEvent
 	RvMap            types.TransitResourceVersionMap
 	Length           uint64
+	Continue         string
 }
 
 // The type is for pulling data with batch from RRM - Resource Region Manager